@@ -1,48 +1,125 @@
 package MikrotikMonitor
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gosnmp/gosnmp"
 	"gopkg.in/yaml.v3"
 	"log"
-	"os"
 	"strings"
 	"time"
 )
 
 type Authentication struct {
-	Active     bool
-	Protocol   string
-	Passphrase string
+	Active         bool
+	Protocol       string
+	Passphrase     string
+	PassphraseFile string `yaml:"passphrase_file"`
 }
 
 type Privacy struct {
-	Active     bool
-	Protocol   string
-	Passphrase string
+	Active         bool
+	Protocol       string
+	Passphrase     string
+	PassphraseFile string `yaml:"passphrase_file"`
 }
 
+// SNMP are the SNMP settings of a device. Transport is udp, the default, or tcp, udp6 and tcp6 restrict the
+// connection to IPv6, udp4 and tcp4 to IPv4. The session is kept open across polls until it was idle for
+// IdleTimeout, default 5m, a negative IdleTimeout connects in every poll. MaxOids limits the OIDs of a request,
+// default 60, for agents which reject large requests. Delay is the minimum time between two requests to the device.
 type SNMP struct {
-	Version        string
+	Version        string         `json:"Version"`
+	Transport      string         `json:"Transport"`
 	Community      string         `json:"-"`
+	CommunityFile  string         `json:"-" yaml:"community_file"`
 	Authentication Authentication `json:"-"`
 	Privacy        Privacy        `json:"-"`
+	Timeout        time.Duration  `json:"Timeout"`
+	IdleTimeout    time.Duration  `json:"IdleTimeout"`
+	MaxOids        int            `json:"MaxOids"`
+	Delay          time.Duration  `json:"Delay"`
+	Retry          Retry          `json:"Retry"`
 }
 
+// Version are the versions of the device. Latest is the newest bootloader firmware, LatestRelease the newest
+// RouterOS release of the update channel of the device as found by its check-for-updates.
 type Version struct {
-	RouterOS   string
-	Bootloader string
-	Latest     string
+	RouterOS        string `json:"RouterOS"`
+	Bootloader      string `json:"Bootloader"`
+	Latest          string `json:"Latest"`
+	LatestRelease   string `json:"LatestRelease"`
+	UpdateAvailable bool   `json:"UpdateAvailable"`
 }
 
 type Device struct {
-	Reached bool
-	Host    string
-	Model   string
-	Name    string
-	SNMP    SNMP
-	Version Version
+	Reached       bool                      `json:"Reached"`
+	LastPolled    time.Time                 `json:"LastPolled"`
+	LastError     string                    `json:"LastError,omitempty"`
+	Host          string                    `json:"Host"`
+	Addresses     []string                  `json:"Addresses"`
+	Address       string                    `json:"Address,omitempty"`
+	ResolvedIP    string                    `json:"ResolvedIP,omitempty"`
+	DNS           DNS                       `json:"-"`
+	Site          string                    `json:"Site"`
+	Group         string                    `json:"Group"`
+	Tags          []string                  `json:"Tags"`
+	Labels        map[string]string         `json:"Labels"`
+	Channel       string                    `json:"Channel"`
+	Backend       string                    `json:"Backend"`
+	Model         string                    `json:"Model"`
+	SerialNumber  string                    `json:"SerialNumber"`
+	SoftwareID    string                    `json:"SoftwareID"`
+	Name          string                    `json:"Name"`
+	Uptime        time.Duration             `json:"Uptime"`
+	Reachability  Reachability              `json:"Reachability"`
+	Availability  Availability              `json:"Availability"`
+	Latency       Latency                   `json:"Latency"`
+	SNMP          SNMP                      `json:"SNMP"`
+	Fallback      Fallback                  `json:"-"`
+	API           API                       `json:"-"`
+	SSH           SSH                       `json:"-"`
+	Version       Version                   `json:"Version"`
+	Interfaces    []Interface               `json:"Interfaces"`
+	Queues        []Queue                   `json:"Queues"`
+	POE           []POEPort                 `json:"POE"`
+	Optics        []Optic                   `json:"Optics"`
+	Wireless      Wireless                  `json:"Wireless"`
+	CAPsMAN       CAPsMAN                   `json:"CAPsMAN"`
+	Health        Health                    `json:"Health"`
+	Hardware      Hardware                  `json:"Hardware"`
+	Storage       []Storage                 `json:"Storage"`
+	Firewall      Firewall                  `json:"Firewall"`
+	Routing       Routing                   `json:"Routing"`
+	VPN           VPN                       `json:"VPN"`
+	Sessions      Sessions                  `json:"Sessions"`
+	Tables        Tables                    `json:"Tables"`
+	Profiles      []string                  `json:"Profiles"`
+	MissingOIDs   []string                  `json:"MissingOIDs"`
+	OIDs          []CustomOID               `json:"OIDs"`
+	Custom        map[string]float64        `json:"Custom"`
+	Services      []ServiceCheck            `json:"Services"`
+	ServiceStates []ServiceState            `json:"ServiceStates"`
+	Script        Script                    `json:"Script"`
+	Provisioning  Provisioning              `json:"Provisioning"`
+	Audit         Audit                     `json:"Audit"`
+	Packages      []Package                 `json:"Packages"`
+	UpdateChannel string                    `json:"UpdateChannel"`
+	Advisories    []string                  `json:"Advisories"`
+	Scripts       []string                  `json:"Scripts"`
+	Timeouts      map[string]time.Duration  `json:"-"`
+	Collectors    map[string]CollectorState `json:"Collectors"`
+	Capabilities  Capabilities              `json:"Capabilities"`
+
+	line     int
+	file     string
+	ctx      context.Context
+	snmp     *gosnmp.GoSNMP
+	scalars  map[string]gosnmp.SnmpPDU
+	pacer    *pacer
+	sessions *sessionPool
 }
 
 type Devices []Device
@@ -77,81 +154,332 @@ func (priv *Privacy) GetProtocol() gosnmp.SnmpV3PrivProtocol {
 
 // GetConfig reads a configuration file and populates the Devices slice with Device objects.
 // It takes a filename string as the input parameter and does not return any value.
-// It uses the yaml.Unmarshal function to parse the content of the file and assigns the parsed Devices to the receiver devices.
+// It uses LoadConfig to read the file, any error is fatal.
 func (devices *Devices) GetConfig(filename string) {
-	var parser struct {
-		Devices []Device `yaml:"devices"`
+	if err := devices.LoadConfig(filename); err != nil {
+		log.Fatal(err)
 	}
+}
 
-	content, err := os.ReadFile(filename)
+// LoadConfig reads a configuration file and populates the Devices slice with Device objects.
+// It parses the content of the file as YAML, decrypting values tagged with !secret, and assigns the parsed Devices to the receiver devices.
+// The filename may be a directory or a glob pattern like conf.d/*.yaml as well, the blocks of all files are merged,
+// e.g. the devices of per-site files generated from an IPAM share the snmp_defaults of a common file.
+// Settings of the snmp_defaults block are inherited by every device which doesn't set them in its own snmp block.
+// Devices without a channel use the channel of their group from the group_channels block.
+// Custom OIDs and service checks of the custom_oids and service_checks blocks are added to the devices they match.
+// Environment variable references like ${SNMP_COMMUNITY} in the values of the config are expanded before the !secret
+// values are decrypted, missing variables are an error.
+// Credentials kept in files or HashiCorp Vault are read with LoadSecrets.
+// Devices of the sources of the inventory block, e.g. NetBox, are added unless the config has a device with their host.
+// The devices are checked with Validate afterwards, the receiver is only modified if the config is valid.
+func (devices *Devices) LoadConfig(filename string) error {
+	return devices.LoadConfigContext(context.Background(), filename)
+}
+
+// LoadConfigContext is LoadConfig with a context, cancelling it aborts reading the sources of the inventory block.
+// Each source has to answer within 2 minutes.
+func (devices *Devices) LoadConfigContext(ctx context.Context, filename string) error {
+	documents, err := readConfigDocuments(filename)
 	if err != nil {
-		log.Fatalf("unable to read config file, %v", err)
+		return err
 	}
 
-	err = yaml.Unmarshal(content, &parser)
-	if err != nil {
-		log.Fatalf("unable to parse config file, %v", err)
+	return devices.loadConfig(ctx, filename, documents)
+}
+
+// loadConfig is LoadConfigContext with the parsed documents of the config files.
+func (devices *Devices) loadConfig(ctx context.Context, filename string, documents []configDocument) error {
+	var parser struct {
+		Defaults      yaml.Node         `yaml:"snmp_defaults"`
+		GroupChannels map[string]string `yaml:"group_channels"`
+		CustomOIDs    []CustomOID       `yaml:"custom_oids"`
+		ServiceChecks []ServiceCheck    `yaml:"service_checks"`
+		Inventory     []InventorySource `yaml:"inventory"`
+	}
+
+	if err := mergeDocuments(documents).Decode(&parser); err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigParse, err)
+	}
+
+	var parsed Devices
+	for _, document := range documents {
+		list := mappingValue(document.root, "devices")
+		if list == nil {
+			continue
+		}
+		if list.Kind != yaml.SequenceNode {
+			return configParseError(filename, document.file, fmt.Errorf("line %d: devices is no list", list.Line))
+		}
+		for _, node := range list.Content {
+			var device Device
+			applyDefaults(node, &parser.Defaults)
+			if err := node.Decode(&device); err != nil {
+				return configParseError(filename, document.file, err)
+			}
+			if document.file != filename {
+				device.file = document.file
+			}
+			parsed = append(parsed, device)
+		}
+	}
+
+	configured := map[string]bool{}
+	for _, device := range parsed {
+		configured[device.Host] = true
+	}
+	for _, source := range parser.Inventory {
+		inventory, err := source.inventory()
+		if err != nil {
+			return fmt.Errorf("invalid inventory in config file: %v", err)
+		}
+		sourceCtx, cancel := context.WithTimeout(ctx, inventoryTimeout)
+		nodes, err := inventory.Devices(sourceCtx)
+		cancel()
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			var device Device
+			applyDefaults(node, &parser.Defaults)
+			if err := node.Decode(&device); err != nil {
+				return configParseError(filename, source.URL, err)
+			}
+			if configured[device.Host] {
+				continue
+			}
+			device.file = source.URL
+			parsed = append(parsed, device)
+		}
+	}
+
+	for i := range parsed {
+		if parsed[i].Channel == "" {
+			parsed[i].Channel = parser.GroupChannels[parsed[i].Group]
+		}
+		for _, custom := range parser.CustomOIDs {
+			if custom.matches(parsed[i]) {
+				parsed[i].OIDs = append(parsed[i].OIDs, custom)
+			}
+		}
+		for _, check := range parser.ServiceChecks {
+			if check.matches(parsed[i]) {
+				parsed[i].Services = append(parsed[i].Services, check)
+			}
+		}
+	}
+
+	if err := parsed.LoadSecrets(); err != nil {
+		return fmt.Errorf("unable to load secrets:\n%v", err)
+	}
+
+	if err := parsed.Validate(); err != nil {
+		return fmt.Errorf("invalid config file:\n%v", err)
 	}
 
-	*devices = parser.Devices
+	*devices = parsed
+
+	return nil
 }
 
 // GetDevice sends SNMP requests to retrieve device information such as version, model, and name.
 // It configures the SNMP connection with the device's host and SNMP settings.
 // It retrieves the device information using a list of OIDs and updates the Device struct accordingly.
 // If any SNMP errors occur during the retrieval process, an error is returned.
+// Devices with the rest, api or ssh backend are read via the RouterOS REST API, the binary API or SSH instead,
+// which populates the same fields.
+// The basic SNMP request is retried according to the Retry policy of the device.
+// OIDs the agent doesn't know don't fail the request, they are reported in MissingOIDs.
+// If the SNMP request fails, the configured fallback probes are run to tell a device which is down from a misconfigured SNMP.
 func (device *Device) GetDevice() error {
-	device.SNMPConfigure()
-	oids := []string{".1.3.6.1.4.1.14988.1.1.4.4.0", ".1.3.6.1.4.1.14988.1.1.7.4.0", ".1.3.6.1.4.1.14988.1.1.7.7.0", ".1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.5.0"}
+	return device.GetDeviceContext(context.Background())
+}
 
-	err := gosnmp.Default.Connect()
-	if err != nil {
-		return fmt.Errorf("fehler beim Verbinden: %v", err)
+// GetDeviceContext is GetDevice with a context, cancelling it aborts the requests to the device.
+// Every device uses its own SNMP client, so devices can be polled concurrently.
+// A device with several Addresses, e.g. an IPv4 and an IPv6 address, is polled at them in order until one answers,
+// Address is the address which answered or the last one tried. The service checks run once for all addresses.
+// Host names are resolved according to the DNS settings, ResolvedIP is the IP the device was polled at.
+func (device *Device) GetDeviceContext(ctx context.Context) error {
+	device.Reachability = Reachability{}
+	device.CheckServices(ctx)
+
+	var errs []error
+	for _, address := range device.transports() {
+		err := device.pollAddress(ctx, address)
+		if err == nil || device.Reached || ctx.Err() != nil {
+			return err
+		}
+		errs = append(errs, err)
 	}
+
+	return errors.Join(errs...)
+}
+
+// getDevice polls the device at its Address.
+func (device *Device) getDevice(ctx context.Context) error {
+	device.ctx = ctx
 	defer func() {
-		if err := gosnmp.Default.Conn.Close(); err != nil {
-			log.Printf("Error closing connection: %v\n", err)
+		device.ctx = nil
+	}()
+
+	if !usesSNMP(device) {
+		var err error
+		if device.Backend == BackendSSH {
+			err = device.getDeviceSSH()
+		} else {
+			err = device.getDeviceAPI()
 		}
+		if err != nil {
+			return err
+		}
+		device.CheckUpdate(nil)
+		device.detectCapabilities()
+		device.collect()
+		return nil
+	}
+
+	oids := make([]string, len(systemFields))
+	for i, field := range systemFields {
+		oids[i] = field.oid
+	}
+	oids = append(oids, device.prefetchOIDs()...)
+
+	release, err := device.connectSNMP()
+	if err != nil {
+		return fmt.Errorf("%s %w via SNMP: %w", device.Host, ErrConnect, err)
+	}
+	// a session which failed or was interrupted is connected again in the next poll
+	defer func() {
+		release(!device.Reached || ctx.Err() != nil)
 	}()
+	// gosnmp only checks the context between retries, an expired deadline ends a pending read right away
+	conn := device.snmp.Conn
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
 
-	result, err2 := gosnmp.Default.Get(oids)
+	var variables []gosnmp.SnmpPDU
+	err2 := device.SNMP.Retry.do(ctx, func() error {
+		var err error
+		start := time.Now()
+		variables, err = device.getBatched(oids)
+		device.Latency.SNMP = time.Since(start)
+		return err
+	})
 	if err2 != nil {
-		return fmt.Errorf("%s Fehler bei der SNMP-Anfrage: %v", device.Host, err2)
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s SNMP request cancelled: %w", device.Host, ctx.Err())
+		}
+		if err := device.Probe(); err != nil {
+			log.Println(err.Error())
+		}
+		return fmt.Errorf("%s %w: %w", device.Host, ErrSNMPRequest, err2)
 	}
 
 	device.Reached = true
+	device.Reachability.SNMPOK = true
+
+	device.setSystemFields(variables[:len(systemFields)])
+	device.scalars = map[string]gosnmp.SnmpPDU{}
+	for i := len(systemFields); i < len(oids); i++ {
+		device.scalars[oids[i]] = variables[i]
+	}
+	defer func() {
+		device.scalars = nil
+	}()
+
+	device.CheckUpdate(nil)
+
+	device.detectCapabilities()
+	device.collect()
+
+	return nil
+}
+
+// systemFields are the OIDs of the basic request of GetDevice.
+var systemFields = []struct {
+	oid  string
+	name string
+	set  func(device *Device, variable gosnmp.SnmpPDU)
+}{
+	{".1.3.6.1.4.1.14988.1.1.4.4.0", "RouterOS version", func(device *Device, variable gosnmp.SnmpPDU) {
+		device.Version.RouterOS, _ = AsString(variable)
+	}},
+	{".1.3.6.1.4.1.14988.1.1.7.4.0", "bootloader version", func(device *Device, variable gosnmp.SnmpPDU) {
+		device.Version.Bootloader, _ = AsString(variable)
+	}},
+	{".1.3.6.1.4.1.14988.1.1.7.7.0", "latest bootloader version", func(device *Device, variable gosnmp.SnmpPDU) {
+		device.Version.Latest, _ = AsString(variable)
+	}},
+	{".1.3.6.1.4.1.14988.1.1.7.3.0", "serial number", func(device *Device, variable gosnmp.SnmpPDU) {
+		device.SerialNumber, _ = AsString(variable)
+	}},
+	{".1.3.6.1.4.1.14988.1.1.4.1.0", "software ID", func(device *Device, variable gosnmp.SnmpPDU) {
+		device.SoftwareID, _ = AsString(variable)
+	}},
+	{".1.3.6.1.2.1.1.1.0", "sysDescr", func(device *Device, variable gosnmp.SnmpPDU) {
+		description, _ := AsString(variable)
+		device.Model = strings.Replace(description, "RouterOS ", "", 1)
+	}},
+	{".1.3.6.1.2.1.1.5.0", "sysName", func(device *Device, variable gosnmp.SnmpPDU) {
+		device.Name, _ = AsString(variable)
+	}},
+	{".1.3.6.1.2.1.1.3.0", "sysUpTime", func(device *Device, variable gosnmp.SnmpPDU) {
+		ticks, _ := AsInt(variable)
+		device.Uptime = time.Duration(ticks) * 10 * time.Millisecond
+	}},
+}
 
-	if len(result.Variables) > 0 {
-		for _, variable := range result.Variables {
-			switch variable.Name {
-			case ".1.3.6.1.4.1.14988.1.1.4.4.0":
-				device.Version.RouterOS = string(variable.Value.([]byte))
-			case ".1.3.6.1.4.1.14988.1.1.7.7.0":
-				device.Version.Latest = string(variable.Value.([]byte))
-			case ".1.3.6.1.4.1.14988.1.1.7.4.0":
-				device.Version.Bootloader = string(variable.Value.([]byte))
-			case ".1.3.6.1.2.1.1.1.0":
-				device.Model = strings.Replace(string(variable.Value.([]byte)), "RouterOS ", "", 1)
-			case ".1.3.6.1.2.1.1.5.0":
-				device.Name = string(variable.Value.([]byte))
-			default:
-				fmt.Println(variable.Name, ":", string(variable.Value.([]byte)))
+// setSystemFields sets the fields of the device from the variables of the basic request.
+// If the agent rejected the whole request, e.g. an SNMPv1 agent answering noSuchName for a single OID, getBatched
+// requested the OIDs one by one, so the values the agent knows are still recorded.
+// OIDs the agent doesn't know are reported in MissingOIDs.
+func (device *Device) setSystemFields(variables []gosnmp.SnmpPDU) {
+	found := map[string]bool{}
+	for _, variable := range variables {
+		if checkValue(variable) != nil {
+			continue
+		}
+		for _, field := range systemFields {
+			if variable.Name == field.oid {
+				field.set(device, variable)
+				found[field.oid] = true
 			}
 		}
 	}
 
-	return nil
+	device.MissingOIDs = nil
+	var names []string
+	for _, field := range systemFields {
+		if !found[field.oid] {
+			device.MissingOIDs = append(device.MissingOIDs, field.oid)
+			names = append(names, field.name+" "+field.oid)
+		}
+	}
+	if len(names) > 0 {
+		log.Printf("%s missing OIDs: %s", device.Host, strings.Join(names, ", "))
+	}
 }
 
+// DevicesSchema is the version of the schema of ResultJson and ResultJsonGrouped. The field names of the devices are
+// fixed by their json tags, the version changes whenever a field is renamed or removed. New fields don't change it.
+const DevicesSchema = "v1"
+
 // ResultJson marshals the Devices struct to JSON and returns it as a string.
+// The devices are wrapped in an envelope with the schema version and the time of generation,
+// e.g. {"schema":"v1","generated_at":"2024-01-01T12:00:00Z","devices":[...]}.
 // If there is an error during marshaling, the error will be logged and an empty string will be returned.
 func (devices *Devices) ResultJson() string {
 	var result struct {
-		Timestamp string
-		Devices   Devices
+		Schema      string    `json:"schema"`
+		GeneratedAt time.Time `json:"generated_at"`
+		Devices     Devices   `json:"devices"`
 	}
+	result.Schema = DevicesSchema
+	result.GeneratedAt = time.Now().UTC()
 	result.Devices = *devices
-	result.Timestamp = time.Now().Format(time.RFC3339)
 
 	d, err := json.Marshal(result)
 	if err != nil {
@@ -161,19 +489,71 @@ func (devices *Devices) ResultJson() string {
 	return string(d)
 }
 
-// SNMPConfigure configures the gosnmp.Default object for SNMP communication with the device.
+// ResultJsonGrouped marshals the Devices struct to JSON keyed by site, group or tag and returns it as a string.
+// With "tag" a device is listed below every tag it has. Per-site dashboards or per-customer exports can use
+// the part they need instead of filtering a flat list. The envelope is the one of ResultJson with by and groups
+// instead of devices.
+// If by is unknown or there is an error during marshaling, the error will be logged and an empty string will be returned.
+func (devices *Devices) ResultJsonGrouped(by string) string {
+	groups, err := devices.GroupBy(by)
+	if err != nil {
+		log.Println(err.Error())
+		return ""
+	}
+
+	var result struct {
+		Schema      string             `json:"schema"`
+		GeneratedAt time.Time          `json:"generated_at"`
+		By          string             `json:"by"`
+		Groups      map[string]Devices `json:"groups"`
+	}
+	result.Schema = DevicesSchema
+	result.GeneratedAt = time.Now().UTC()
+	result.By = by
+	result.Groups = groups
+
+	d, err := json.Marshal(result)
+	if err != nil {
+		log.Println(err.Error())
+	}
+
+	return string(d)
+}
+
+// SNMPConfigure creates the SNMP client of the device with the device's host and SNMP settings.
+// The client uses the context of the running request, which is set by GetDeviceContext and the collectors.
 func (device *Device) SNMPConfigure() {
-	gosnmp.Default.Timeout = 3 * time.Second // Timeout für SNMP-Anfragen
-	gosnmp.Default.Target = device.Host
-	gosnmp.Default.Community = device.SNMP.Community
+	ctx := device.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	device.snmp = &gosnmp.GoSNMP{
+		Target:             device.address(),
+		Port:               161,
+		Transport:          "udp",
+		Community:          device.SNMP.Community,
+		Version:            gosnmp.Version2c,
+		Timeout:            3 * time.Second, // timeout of SNMP requests
+		Retries:            3,
+		ExponentialTimeout: true,
+		MaxOids:            gosnmp.MaxOids,
+		Context:            ctx,
+		PreSend:            device.pace(),
+	}
+	if device.SNMP.Timeout > 0 {
+		device.snmp.Timeout = device.SNMP.Timeout
+	}
+	if device.SNMP.Transport != "" {
+		device.snmp.Transport = device.SNMP.Transport
+	}
+	if device.SNMP.MaxOids > 0 {
+		device.snmp.MaxOids = device.SNMP.MaxOids
+	}
 
-	switch device.SNMP.Version {
-	case "2c":
-		gosnmp.Default.Version = gosnmp.Version2c
-	case "3":
-		gosnmp.Default.Version = gosnmp.Version3
-		gosnmp.Default.SecurityModel = gosnmp.UserSecurityModel
-		gosnmp.Default.MsgFlags = gosnmp.AuthPriv
+	if device.SNMP.Version == "3" {
+		device.snmp.Version = gosnmp.Version3
+		device.snmp.SecurityModel = gosnmp.UserSecurityModel
+		device.snmp.MsgFlags = gosnmp.AuthPriv
 	}
 
 	if device.SNMP.Authentication.Active || device.SNMP.Privacy.Active {
@@ -191,6 +571,6 @@ func (device *Device) SNMPConfigure() {
 			usmSecurityParameters.PrivacyPassphrase = device.SNMP.Privacy.Passphrase
 		}
 
-		gosnmp.Default.SecurityParameters = &usmSecurityParameters
+		device.snmp.SecurityParameters = &usmSecurityParameters
 	}
 }
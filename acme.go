@@ -0,0 +1,67 @@
+package MikrotikMonitor
+
+import (
+	"crypto/tls"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"sync"
+	"time"
+)
+
+// LetsEncryptURL is the directory of the production ACME server of Let's Encrypt.
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+// ACME obtains and renews the certificates of the HTTPS server from an ACME server like Let's Encrypt, see TLSConfig,
+// with the autocert manager of golang.org/x/crypto. The domains are validated with the tls-alpn-01 challenge on the
+// HTTPS port itself, so the server must be reachable on port 443 under each of the Domains. A certificate is obtained
+// on the first request for its domain and renewed 30 days before it expires. The account key and the certificates are
+// stored in the Cache directory, which keeps a restarted monitor from running into the rate limits of the ACME server.
+type ACME struct {
+	Directory string
+	Email     string
+	Domains   []string
+	Cache     string
+
+	once    sync.Once
+	manager *autocert.Manager
+}
+
+// NewACME returns an ACME for the domains with Let's Encrypt as ACME server which stores its state in cache.
+func NewACME(cache string, domains ...string) *ACME {
+	return &ACME{
+		Directory: LetsEncryptURL,
+		Domains:   domains,
+		Cache:     cache,
+	}
+}
+
+// TLSConfig returns the TLS config of a server with the certificates of the ACME server,
+// e.g. for http.Server.TLSConfig.
+func (manager *ACME) TLSConfig() *tls.Config {
+	config := manager.autocert().TLSConfig()
+	config.MinVersion = tls.VersionTLS12
+
+	return config
+}
+
+// GetCertificate returns the certificate for the server name of the TLS handshake, obtained from the ACME server if
+// there is none yet, or the challenge certificate if the ACME server validates the domain.
+func (manager *ACME) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return manager.autocert().GetCertificate(hello)
+}
+
+// autocert returns the autocert manager, created on first use so the fields can be set after NewACME.
+func (manager *ACME) autocert() *autocert.Manager {
+	manager.once.Do(func() {
+		manager.manager = &autocert.Manager{
+			Prompt:      autocert.AcceptTOS,
+			Cache:       autocert.DirCache(manager.Cache),
+			HostPolicy:  autocert.HostWhitelist(manager.Domains...),
+			RenewBefore: 30 * 24 * time.Hour,
+			Client:      &acme.Client{DirectoryURL: manager.Directory},
+			Email:       manager.Email,
+		}
+	})
+
+	return manager.manager
+}
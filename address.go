@@ -0,0 +1,163 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNS is the resolution of the host names of a device, which are resolved at poll time. The address is cached
+// for TTL, default 5m, a negative TTL resolves the names in every poll. If the device doesn't answer at the
+// cached address, the name is resolved again, so a CPE with a dynamic DNS name is polled at its new address right away.
+type DNS struct {
+	TTL time.Duration
+}
+
+// dnsCache caches the resolved addresses of host names for all devices. It is safe for concurrent use.
+type dnsCache struct {
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	ips      []string
+	resolved time.Time
+}
+
+// resolved are the host names resolved by the polls.
+var resolved = &dnsCache{entries: map[string]dnsEntry{}}
+
+// transports returns the addresses the device is polled at in fallback order, Addresses if set, otherwise the host.
+// IPv6 addresses may be written in brackets, e.g. "[2001:db8::1]", and may have a zone, e.g. "fe80::1%ether1".
+func (device *Device) transports() []string {
+	if len(device.Addresses) > 0 {
+		return device.Addresses
+	}
+
+	return []string{device.Host}
+}
+
+// address returns the address of the running poll without brackets, the host if the device isn't polled.
+// Host names are replaced by the IP they resolved to in the poll.
+// It is used to connect to the device, net.JoinHostPort adds the brackets of IPv6 addresses again.
+func (device *Device) address() string {
+	if device.ResolvedIP != "" {
+		return device.ResolvedIP
+	}
+	if device.Address != "" {
+		return unbracket(device.Address)
+	}
+
+	return unbracket(device.Host)
+}
+
+// unbracket removes the brackets around an IPv6 address.
+func unbracket(address string) string {
+	if strings.HasPrefix(address, "[") && strings.HasSuffix(address, "]") {
+		return address[1 : len(address)-1]
+	}
+
+	return address
+}
+
+// urlHost returns the address as host of a URL, with brackets around IPv6 addresses and the zone escaped.
+func urlHost(address string, port string) string {
+	if strings.Contains(address, ":") {
+		address = strings.Replace(address, "%", "%25", 1)
+		if port == "" {
+			return "[" + address + "]"
+		}
+	}
+	if port == "" {
+		return address
+	}
+
+	return net.JoinHostPort(address, port)
+}
+
+// parseAddress returns the IP of an address, nil for host names. The zone of IPv6 addresses is ignored.
+func parseAddress(address string) net.IP {
+	ip, _, _ := strings.Cut(unbracket(address), "%")
+
+	return net.ParseIP(ip)
+}
+
+// resolve returns the IP of a host name of the device, the cached one unless it is older than the TTL or refresh is set.
+func (device *Device) resolve(ctx context.Context, name string, refresh bool) (string, error) {
+	ips, err := device.lookup(ctx, name, refresh)
+	if err != nil {
+		return "", err
+	}
+
+	return ips[0], nil
+}
+
+// lookup returns the IPs of a host name of the device, the cached ones unless they are older than the TTL of the
+// device or refresh is set.
+func (device *Device) lookup(ctx context.Context, name string, refresh bool) ([]string, error) {
+	resolved.mu.Lock()
+	entry, found := resolved.entries[name]
+	resolved.mu.Unlock()
+	if found && !refresh && time.Since(entry.resolved) < device.dnsTTL() {
+		return entry.ips, nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s unable to resolve %s: %v", device.Host, name, err)
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("%s unable to resolve %s: no addresses", device.Host, name)
+	}
+	ips := make([]string, len(addresses))
+	for i, address := range addresses {
+		ips[i] = address.String()
+	}
+
+	resolved.mu.Lock()
+	resolved.entries[name] = dnsEntry{ips: ips, resolved: time.Now()}
+	resolved.mu.Unlock()
+
+	return ips, nil
+}
+
+// dnsTTL returns the time the resolved host names of the device are cached.
+func (device *Device) dnsTTL() time.Duration {
+	if device.DNS.TTL == 0 {
+		return 5 * time.Minute
+	}
+
+	return device.DNS.TTL
+}
+
+// pollAddress polls the device at one of its addresses. A host name is resolved first and the IP recorded in
+// ResolvedIP, if the device doesn't answer at a cached IP the name is resolved again and polled at the new IP.
+func (device *Device) pollAddress(ctx context.Context, address string) error {
+	device.Address, device.ResolvedIP = address, ""
+	if parseAddress(address) != nil {
+		return device.getDevice(ctx)
+	}
+
+	ip, err := device.resolve(ctx, address, false)
+	if err != nil {
+		return err
+	}
+	device.ResolvedIP = ip
+	err = device.getDevice(ctx)
+	if err == nil || device.Reached || ctx.Err() != nil {
+		return err
+	}
+
+	fresh, resolveErr := device.resolve(ctx, address, true)
+	if resolveErr != nil || fresh == ip {
+		return err
+	}
+	log.Printf("%s %s resolves to %s instead of %s now", device.Host, address, fresh, ip)
+	device.ResolvedIP = fresh
+
+	return device.getDevice(ctx)
+}
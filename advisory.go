@@ -0,0 +1,212 @@
+package MikrotikMonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// EventAdvisory is the type of events raised when an advisory starts or stops affecting a device,
+// the subject is the ID of the advisory.
+const EventAdvisory = "Advisory"
+
+// Advisory is a known critical vulnerability of RouterOS or the end of life of RouterOS versions.
+// A version is affected if it is in one of the Affected ranges. It is the format of the AdvisoryFeed as well.
+type Advisory struct {
+	ID        string         `json:"id"`
+	Title     string         `json:"title"`
+	Severity  string         `json:"severity"`
+	EndOfLife bool           `json:"end_of_life,omitempty"`
+	URL       string         `json:"url,omitempty"`
+	Affected  []VersionRange `json:"affected"`
+}
+
+// VersionRange is a range of RouterOS versions from From up to, but not including, Fixed.
+// An empty From includes all older versions, an empty Fixed all newer versions.
+type VersionRange struct {
+	From  string `json:"from,omitempty"`
+	Fixed string `json:"fixed,omitempty"`
+}
+
+// DefaultAdvisories are the advisories built into the monitor, an AdvisoryFeed extends and overrides them.
+var DefaultAdvisories = []Advisory{
+	{
+		ID:       "CVE-2018-7445",
+		Title:    "SMB service buffer overflow allows remote code execution before authentication",
+		Severity: SeverityCritical,
+		URL:      "https://nvd.nist.gov/vuln/detail/CVE-2018-7445",
+		Affected: []VersionRange{{Fixed: "6.40.7"}, {From: "6.41", Fixed: "6.41.3"}},
+	},
+	{
+		ID:       "CVE-2018-14847",
+		Title:    "Winbox allows reading arbitrary files including the user database without authentication",
+		Severity: SeverityCritical,
+		URL:      "https://nvd.nist.gov/vuln/detail/CVE-2018-14847",
+		Affected: []VersionRange{{From: "6.29", Fixed: "6.40.8"}, {From: "6.41", Fixed: "6.42.1"}},
+	},
+	{
+		ID:       "CVE-2023-30799",
+		Title:    "Privilege escalation from admin to super-admin via Winbox or HTTP",
+		Severity: SeverityCritical,
+		URL:      "https://nvd.nist.gov/vuln/detail/CVE-2023-30799",
+		Affected: []VersionRange{{From: "6.0", Fixed: "6.49.7"}},
+	},
+	{
+		ID:       "CVE-2023-41570",
+		Title:    "REST API ignores the allowed addresses of the www services",
+		Severity: SeverityCritical,
+		URL:      "https://nvd.nist.gov/vuln/detail/CVE-2023-41570",
+		Affected: []VersionRange{{From: "7.1", Fixed: "7.12"}},
+	},
+	{
+		ID:        "EOL-ROUTEROS-5",
+		Title:     "RouterOS v5 and older are end of life",
+		Severity:  SeverityCritical,
+		EndOfLife: true,
+		Affected:  []VersionRange{{Fixed: "6.0"}},
+	},
+	{
+		ID:        "EOL-ROUTEROS-6-BEFORE-6.49",
+		Title:     "RouterOS v6 only receives fixes on 6.49",
+		Severity:  SeverityWarning,
+		EndOfLife: true,
+		Affected:  []VersionRange{{From: "6.0", Fixed: "6.49"}},
+	},
+}
+
+// Affects reports whether the RouterOS version is affected by the advisory. Unknown versions are never affected.
+func (advisory Advisory) Affects(version string) bool {
+	if version == "" {
+		return false
+	}
+	for _, r := range advisory.Affected {
+		if (r.From == "" || CompareVersions(version, r.From) >= 0) && (r.Fixed == "" || CompareVersions(version, r.Fixed) < 0) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckAdvisories sets Advisories to the IDs of the advisories affecting the installed RouterOS version.
+func (device *Device) CheckAdvisories(advisories []Advisory) {
+	device.Advisories = nil
+	for _, advisory := range advisories {
+		if advisory.Affects(device.Version.RouterOS) {
+			device.Advisories = append(device.Advisories, advisory.ID)
+		}
+	}
+}
+
+// advisoryChanges returns an event for every advisory which started or, e.g. after an upgrade, stopped affecting
+// the device since the previous poll.
+func advisoryChanges(previous, current Device, advisories []Advisory) []Event {
+	var events []Event
+	for _, advisory := range advisories {
+		before := slices.Contains(previous.Advisories, advisory.ID)
+		after := slices.Contains(current.Advisories, advisory.ID)
+		switch {
+		case after && !before:
+			events = append(events, current.NewEvent(EventAdvisory, advisory.Severity, advisory.ID,
+				fmt.Sprintf("RouterOS %s is affected: %s", current.Version.RouterOS, advisory.Title)))
+		case before && !after:
+			event := current.NewEvent(EventAdvisory, advisory.Severity, advisory.ID,
+				fmt.Sprintf("RouterOS %s isn't affected anymore", current.Version.RouterOS))
+			event.Resolved = true
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// AdvisoryFeed fetches advisories from a JSON feed, a list of Advisory, and caches them.
+// The advisories of the feed are merged into the DefaultAdvisories, an advisory of the feed replaces
+// a built-in advisory with the same ID, so the dataset can be kept current without a new release of the monitor.
+type AdvisoryFeed struct {
+	URL    string
+	TTL    time.Duration
+	Client *http.Client
+
+	mu         sync.Mutex
+	advisories []Advisory
+	fetched    time.Time
+}
+
+// NewAdvisoryFeed returns an AdvisoryFeed for the URL, which is fetched at most every 6 hours.
+func NewAdvisoryFeed(url string) *AdvisoryFeed {
+	return &AdvisoryFeed{
+		URL:    url,
+		TTL:    6 * time.Hour,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Advisories returns the cached advisories, they are fetched again if they are older than TTL.
+// If fetching fails, the previously fetched advisories, or the DefaultAdvisories, are returned together with the error.
+func (feed *AdvisoryFeed) Advisories() ([]Advisory, error) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	if feed.advisories != nil && time.Since(feed.fetched) < feed.TTL {
+		return feed.advisories, nil
+	}
+
+	fetched, err := feed.fetch()
+	if err != nil {
+		if feed.advisories == nil {
+			return DefaultAdvisories, err
+		}
+		return feed.advisories, err
+	}
+	feed.advisories = mergeAdvisories(DefaultAdvisories, fetched)
+	feed.fetched = time.Now()
+
+	return feed.advisories, nil
+}
+
+// fetch reads the advisories of the feed.
+func (feed *AdvisoryFeed) fetch() ([]Advisory, error) {
+	response, err := feed.Client.Get(feed.URL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch advisory feed: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch advisory feed: %s", response.Status)
+	}
+
+	var advisories []Advisory
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&advisories); err != nil {
+		return nil, fmt.Errorf("unable to parse advisory feed: %v", err)
+	}
+	for i := range advisories {
+		if advisories[i].ID == "" {
+			return nil, fmt.Errorf("advisory feed has an advisory without id")
+		}
+		if advisories[i].Severity == "" {
+			advisories[i].Severity = SeverityWarning
+		}
+	}
+
+	return advisories, nil
+}
+
+// mergeAdvisories returns the advisories with the updates, which replace advisories with the same ID.
+func mergeAdvisories(advisories []Advisory, updates []Advisory) []Advisory {
+	merged := slices.Clone(advisories)
+	for _, update := range updates {
+		index := slices.IndexFunc(merged, func(advisory Advisory) bool { return advisory.ID == update.ID })
+		if index < 0 {
+			merged = append(merged, update)
+			continue
+		}
+		merged[index] = update
+	}
+
+	return merged
+}
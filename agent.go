@@ -0,0 +1,255 @@
+package MikrotikMonitor
+
+import (
+	"errors"
+	"github.com/gosnmp/gosnmp"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AgentBaseOID is the default root of the fleet inventory served by the Agent.
+//
+//	<base>.1.1.0  number of devices
+//	<base>.1.2.0  number of reached devices
+//	<base>.1.3.0  number of devices with an available update
+//	<base>.1.4.0  number of wireless clients
+//	<base>.2.1.<column>.<index>  device table with the columns
+//	          1 index, 2 host, 3 name, 4 model, 5 reached (1 true, 2 false), 6 RouterOS version,
+//	          7 latest version, 8 site, 9 group, 10 wireless clients
+const AgentBaseOID = ".1.3.6.1.3.14988"
+
+// Agent is a read-only SNMPv2c agent which serves the aggregated inventory of the monitored devices,
+// so network management systems which only speak SNMP can ingest it.
+type Agent struct {
+	Address   string
+	Community string
+	BaseOID   string
+	Devices   func() Devices
+
+	mu   sync.Mutex
+	conn net.PacketConn
+}
+
+type agentVariable struct {
+	oid []int
+	pdu gosnmp.SnmpPDU
+}
+
+// NewAgent returns an Agent listening on address, e.g. ":1161", which answers requests with the given community.
+// The devices function is called for every request, e.g. Monitor.Devices.
+func NewAgent(address string, community string, devices func() Devices) *Agent {
+	return &Agent{Address: address, Community: community, BaseOID: AgentBaseOID, Devices: devices}
+}
+
+// ListenAndServe answers SNMP get, get-next and get-bulk requests until Close is called.
+// Requests with another version than v1 or v2c or a wrong community are ignored.
+func (agent *Agent) ListenAndServe() error {
+	conn, err := net.ListenPacket("udp", agent.Address)
+	if err != nil {
+		return err
+	}
+	agent.mu.Lock()
+	agent.conn = conn
+	agent.mu.Unlock()
+
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c}
+	buffer := make([]byte, 65535)
+	for {
+		n, address, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		request, err := decoder.SnmpDecodePacket(buffer[:n])
+		if err != nil || request.Version == gosnmp.Version3 || request.Community != agent.Community {
+			continue
+		}
+
+		response, err := agent.answer(request).MarshalMsg()
+		if err != nil {
+			log.Printf("unable to encode SNMP response, %v", err)
+			continue
+		}
+		if _, err := conn.WriteTo(response, address); err != nil {
+			log.Printf("unable to send SNMP response to %s, %v", address, err)
+		}
+	}
+}
+
+// Close stops ListenAndServe.
+func (agent *Agent) Close() error {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	if agent.conn == nil {
+		return nil
+	}
+
+	return agent.conn.Close()
+}
+
+// answer builds the response to a request from a snapshot of the inventory.
+func (agent *Agent) answer(request *gosnmp.SnmpPacket) *gosnmp.SnmpPacket {
+	variables := agent.variables()
+	response := &gosnmp.SnmpPacket{
+		Version:   request.Version,
+		Community: request.Community,
+		PDUType:   gosnmp.GetResponse,
+		RequestID: request.RequestID,
+	}
+
+	next := func(oid []int) gosnmp.SnmpPDU {
+		i := sort.Search(len(variables), func(i int) bool { return compareOID(variables[i].oid, oid) > 0 })
+		if i == len(variables) {
+			return gosnmp.SnmpPDU{Name: formatOID(oid), Type: gosnmp.EndOfMibView}
+		}
+		return variables[i].pdu
+	}
+
+	switch request.PDUType {
+	case gosnmp.GetRequest:
+		for _, requested := range request.Variables {
+			oid := parseOID(requested.Name)
+			i := sort.Search(len(variables), func(i int) bool { return compareOID(variables[i].oid, oid) >= 0 })
+			if i < len(variables) && compareOID(variables[i].oid, oid) == 0 {
+				response.Variables = append(response.Variables, variables[i].pdu)
+			} else {
+				response.Variables = append(response.Variables, gosnmp.SnmpPDU{Name: requested.Name, Type: gosnmp.NoSuchObject})
+			}
+		}
+	case gosnmp.GetNextRequest:
+		for _, requested := range request.Variables {
+			response.Variables = append(response.Variables, next(parseOID(requested.Name)))
+		}
+	case gosnmp.GetBulkRequest:
+		nonRepeaters := int(request.NonRepeaters)
+		maxRepetitions := int(request.MaxRepetitions)
+		if maxRepetitions > 50 {
+			// keep the response within a single datagram
+			maxRepetitions = 50
+		}
+		for i, requested := range request.Variables {
+			oid := parseOID(requested.Name)
+			if i < nonRepeaters {
+				response.Variables = append(response.Variables, next(oid))
+				continue
+			}
+			for r := 0; r < maxRepetitions; r++ {
+				pdu := next(oid)
+				response.Variables = append(response.Variables, pdu)
+				if pdu.Type == gosnmp.EndOfMibView {
+					break
+				}
+				oid = parseOID(pdu.Name)
+			}
+		}
+	default:
+		response.Error = gosnmp.GenErr
+	}
+
+	return response
+}
+
+// variables returns the inventory as variables sorted by OID.
+func (agent *Agent) variables() []agentVariable {
+	devices := agent.Devices()
+	var variables []agentVariable
+	add := func(oid string, pdu gosnmp.SnmpPDU) {
+		pdu.Name = agent.BaseOID + oid
+		variables = append(variables, agentVariable{oid: parseOID(pdu.Name), pdu: pdu})
+	}
+	integer := func(value int) gosnmp.SnmpPDU { return gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: value} }
+	gauge := func(value int) gosnmp.SnmpPDU { return gosnmp.SnmpPDU{Type: gosnmp.Gauge32, Value: uint32(value)} }
+	text := func(value string) gosnmp.SnmpPDU { return gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: value} }
+
+	reached, outdated := 0, 0
+	for _, device := range devices {
+		if device.Reached {
+			reached++
+		}
+		if device.Version.UpdateAvailable {
+			outdated++
+		}
+	}
+	add(".1.1.0", gauge(len(devices)))
+	add(".1.2.0", gauge(reached))
+	add(".1.3.0", gauge(outdated))
+	add(".1.4.0", gauge(devices.WirelessClients().Total))
+
+	columns := []func(device Device, index int) gosnmp.SnmpPDU{
+		func(device Device, index int) gosnmp.SnmpPDU { return integer(index) },
+		func(device Device, index int) gosnmp.SnmpPDU { return text(device.Host) },
+		func(device Device, index int) gosnmp.SnmpPDU { return text(device.Name) },
+		func(device Device, index int) gosnmp.SnmpPDU { return text(device.Model) },
+		func(device Device, index int) gosnmp.SnmpPDU {
+			if device.Reached {
+				return integer(1)
+			}
+			return integer(2)
+		},
+		func(device Device, index int) gosnmp.SnmpPDU { return text(device.Version.RouterOS) },
+		func(device Device, index int) gosnmp.SnmpPDU { return text(device.Version.Latest) },
+		func(device Device, index int) gosnmp.SnmpPDU { return text(device.Site) },
+		func(device Device, index int) gosnmp.SnmpPDU { return text(device.Group) },
+		func(device Device, index int) gosnmp.SnmpPDU { return gauge(device.Wireless.Clients) },
+	}
+	for c, column := range columns {
+		for i, device := range devices {
+			add(".2.1."+strconv.Itoa(c+1)+"."+strconv.Itoa(i+1), column(device, i+1))
+		}
+	}
+
+	sort.Slice(variables, func(i, j int) bool { return compareOID(variables[i].oid, variables[j].oid) < 0 })
+
+	return variables
+}
+
+// parseOID splits a dotted OID into its numbers, invalid parts are treated as 0.
+func parseOID(oid string) []int {
+	parts := strings.Split(strings.Trim(oid, "."), ".")
+	result := make([]int, 0, len(parts))
+	for _, part := range parts {
+		n, _ := strconv.Atoi(part)
+		result = append(result, n)
+	}
+
+	return result
+}
+
+// formatOID joins the numbers of an OID with a leading dot.
+func formatOID(oid []int) string {
+	var builder strings.Builder
+	for _, n := range oid {
+		builder.WriteString("." + strconv.Itoa(n))
+	}
+
+	return builder.String()
+}
+
+// compareOID compares two OIDs in lexicographical order and returns -1, 0 or 1.
+func compareOID(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+
+	return 0
+}
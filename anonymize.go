@@ -0,0 +1,136 @@
+package MikrotikMonitor
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// AnonymizedSchema is the version of the schema of anonymized exports.
+const AnonymizedSchema = "mikrotikmonitor.anonymized.v1"
+
+// Anonymizer turns the state of the devices into fleet statistics which can be shared with vendors or communities
+// without exposing network details. Hosts and sites are replaced by keyed hashes, names, tags, labels, credentials
+// and interface names are dropped, and metrics are rounded so single devices can't be fingerprinted by exact values.
+// With the same Salt the hashes are stable across exports, without one a random salt is used for every export.
+type Anonymizer struct {
+	Salt string
+}
+
+// AnonymizedDevice is a device in an anonymized export.
+type AnonymizedDevice struct {
+	ID              string
+	Site            string
+	Reached         bool
+	Model           string
+	RouterOS        string
+	Channel         string
+	UptimeDays      int
+	CPULoad         int
+	Temperature     float64
+	WirelessClients int
+	Interfaces      int
+	InBits          float64
+	OutBits         float64
+	SecurityScore   int
+}
+
+// AnonymizedExport is an anonymized export of a fleet, with the number of devices per model and RouterOS version.
+type AnonymizedExport struct {
+	Schema      string
+	GeneratedAt time.Time
+	Devices     []AnonymizedDevice
+	Models      map[string]int
+	Versions    map[string]int
+}
+
+// hash returns a keyed hash of the value, empty values stay empty.
+func (anonymizer Anonymizer) hash(salt []byte, value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// roundTo rounds the value to a multiple of step.
+func roundTo(value float64, step float64) float64 {
+	return math.Round(value/step) * step
+}
+
+// roundSignificant rounds the value to two significant digits, e.g. 123456 to 120000.
+func roundSignificant(value float64) float64 {
+	if value == 0 {
+		return 0
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(math.Abs(value)))-1)
+
+	return math.Round(value/magnitude) * magnitude
+}
+
+// Anonymize returns the anonymized export of the devices.
+func (anonymizer Anonymizer) Anonymize(devices Devices) AnonymizedExport {
+	salt := []byte(anonymizer.Salt)
+	if len(salt) == 0 {
+		salt = make([]byte, 32)
+		_, _ = rand.Read(salt)
+	}
+
+	export := AnonymizedExport{
+		Schema:      AnonymizedSchema,
+		GeneratedAt: time.Now().UTC().Truncate(time.Hour),
+		Devices:     []AnonymizedDevice{},
+		Models:      map[string]int{},
+		Versions:    map[string]int{},
+	}
+	for _, device := range devices {
+		anonymized := AnonymizedDevice{
+			ID:              anonymizer.hash(salt, device.Host),
+			Site:            anonymizer.hash(salt, device.Site),
+			Reached:         device.Reached,
+			Model:           device.Model,
+			RouterOS:        device.Version.RouterOS,
+			Channel:         device.Channel,
+			UptimeDays:      int(device.Uptime / (24 * time.Hour)),
+			CPULoad:         int(roundTo(float64(device.Health.CPULoad), 10)),
+			Temperature:     roundTo(device.Health.Temperature, 5),
+			WirelessClients: int(roundTo(float64(device.Wireless.Clients), 5)),
+			Interfaces:      len(device.Interfaces),
+			SecurityScore:   int(roundTo(float64(device.Audit.Score), 10)),
+		}
+		for _, iface := range device.Interfaces {
+			anonymized.InBits += iface.Rates.InBits
+			anonymized.OutBits += iface.Rates.OutBits
+		}
+		anonymized.InBits = roundSignificant(anonymized.InBits)
+		anonymized.OutBits = roundSignificant(anonymized.OutBits)
+
+		export.Devices = append(export.Devices, anonymized)
+		if device.Model != "" {
+			export.Models[device.Model]++
+		}
+		if device.Version.RouterOS != "" {
+			export.Versions[device.Version.RouterOS]++
+		}
+	}
+	// the order of the config file could tell devices apart
+	sort.Slice(export.Devices, func(i, j int) bool { return export.Devices[i].ID < export.Devices[j].ID })
+
+	return export
+}
+
+// Export writes the anonymized export of the devices as JSON.
+func (anonymizer Anonymizer) Export(w io.Writer, devices Devices) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(anonymizer.Anonymize(devices))
+}
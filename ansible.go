@@ -0,0 +1,342 @@
+package MikrotikMonitor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Ansible is an Inventory of the hosts of an Ansible inventory file in YAML or INI format. The inventory hostname
+// becomes the name of a device and ansible_host, or the hostname, its host. The first group listing the host becomes
+// its group, all its groups and their parent groups its tags. Fields maps host variables, including the variables
+// inherited from the groups, to settings of the devices block, e.g. snmp_community to snmp.community.
+// Host ranges like router[01:10] aren't expanded.
+type Ansible struct {
+	File   string
+	Fields map[string]string `yaml:"-"`
+}
+
+// ansibleGroup is a group of an Ansible inventory.
+type ansibleGroup struct {
+	hosts    []string
+	vars     map[string]string
+	children []string
+}
+
+// ansibleInventory are the groups and the variables of the hosts of an Ansible inventory.
+type ansibleInventory struct {
+	groups map[string]*ansibleGroup
+	order  []string
+	hosts  map[string]map[string]string
+}
+
+// ansibleHost is a host of an Ansible inventory with its variables and groups.
+type ansibleHost struct {
+	name   string
+	vars   map[string]string
+	groups []string
+}
+
+// Devices returns the hosts of the inventory file.
+func (ansible *Ansible) Devices(context.Context) ([]*yaml.Node, error) {
+	content, err := os.ReadFile(ansible.File)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read ansible inventory: %v", err)
+	}
+	inventory, err := parseAnsibleInventory(content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse ansible inventory %s: %v", ansible.File, err)
+	}
+
+	var nodes []*yaml.Node
+	for _, host := range inventory.resolve() {
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		address := host.vars["ansible_host"]
+		if address == "" {
+			address = host.name
+		}
+		setPath(node, "host", address, "!!str")
+		setPath(node, "name", host.name, "!!str")
+		if len(host.groups) > 0 {
+			setPath(node, "group", host.groups[0], "!!str")
+		}
+		setList(node, "tags", host.groups)
+		for variable, path := range ansible.Fields {
+			if value := host.vars[variable]; value != "" {
+				setPath(node, path, value, "")
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// parseAnsibleInventory parses an inventory in YAML format, or in INI format if it isn't a YAML mapping.
+func parseAnsibleInventory(content []byte) (*ansibleInventory, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err == nil && len(root.Content) == 1 && root.Content[0].Kind == yaml.MappingNode {
+		inventory := newAnsibleInventory()
+		for i := 0; i+1 < len(root.Content[0].Content); i += 2 {
+			inventory.parseYAMLGroup(root.Content[0].Content[i].Value, root.Content[0].Content[i+1])
+		}
+		return inventory, nil
+	}
+
+	return parseAnsibleINI(content)
+}
+
+// newAnsibleInventory returns an empty inventory.
+func newAnsibleInventory() *ansibleInventory {
+	return &ansibleInventory{groups: map[string]*ansibleGroup{}, hosts: map[string]map[string]string{}}
+}
+
+// group returns the group with the name, it is added if it doesn't exist.
+func (inventory *ansibleInventory) group(name string) *ansibleGroup {
+	group, found := inventory.groups[name]
+	if !found {
+		group = &ansibleGroup{vars: map[string]string{}}
+		inventory.groups[name] = group
+		inventory.order = append(inventory.order, name)
+	}
+
+	return group
+}
+
+// addHost adds the host to the group, its variables are added to the ones it already has.
+func (inventory *ansibleInventory) addHost(group string, host string, vars map[string]string) {
+	inventory.group(group).hosts = append(inventory.group(group).hosts, host)
+	if inventory.hosts[host] == nil {
+		inventory.hosts[host] = map[string]string{}
+	}
+	maps.Copy(inventory.hosts[host], vars)
+}
+
+// parseYAMLGroup adds a group of a YAML inventory with its hosts, variables and children.
+func (inventory *ansibleInventory) parseYAMLGroup(name string, node *yaml.Node) {
+	group := inventory.group(name)
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	if hosts := mappingValue(node, "hosts"); hosts != nil && hosts.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(hosts.Content); i += 2 {
+			inventory.addHost(name, hosts.Content[i].Value, ansibleVars(hosts.Content[i+1]))
+		}
+	}
+	maps.Copy(group.vars, ansibleVars(mappingValue(node, "vars")))
+	if children := mappingValue(node, "children"); children != nil && children.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(children.Content); i += 2 {
+			child := children.Content[i].Value
+			group.children = append(group.children, child)
+			inventory.parseYAMLGroup(child, children.Content[i+1])
+		}
+	}
+}
+
+// ansibleVars returns the scalar variables of a mapping of a YAML inventory, other variables are ignored.
+func ansibleVars(node *yaml.Node) map[string]string {
+	vars := map[string]string{}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return vars
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if value := node.Content[i+1]; value.Kind == yaml.ScalarNode && value.Tag != "!!null" {
+			vars[node.Content[i].Value] = value.Value
+		}
+	}
+
+	return vars
+}
+
+// parseAnsibleINI parses an inventory in INI format. Hosts before the first section are ungrouped,
+// [group:vars] sections set variables of a group and [group:children] sections list its children.
+func parseAnsibleINI(content []byte) (*ansibleInventory, error) {
+	inventory := newAnsibleInventory()
+	section, kind := "ungrouped", "hosts"
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: invalid section %s", line, text)
+			}
+			section, kind, _ = strings.Cut(text[1:len(text)-1], ":")
+			if kind == "" {
+				kind = "hosts"
+			}
+			inventory.group(section)
+			continue
+		}
+
+		switch kind {
+		case "hosts":
+			fields := strings.Fields(text)
+			vars := map[string]string{}
+			for _, field := range fields[1:] {
+				name, value, found := strings.Cut(field, "=")
+				if !found {
+					return nil, fmt.Errorf("line %d: invalid host variable %s", line, field)
+				}
+				vars[name] = strings.Trim(value, `"'`)
+			}
+			inventory.addHost(section, fields[0], vars)
+		case "vars":
+			name, value, found := strings.Cut(text, "=")
+			if !found {
+				return nil, fmt.Errorf("line %d: invalid group variable %s", line, text)
+			}
+			inventory.group(section).vars[strings.TrimSpace(name)] = strings.Trim(strings.TrimSpace(value), `"'`)
+		case "children":
+			inventory.group(text)
+			inventory.group(section).children = append(inventory.group(section).children, text)
+		default:
+			return nil, fmt.Errorf("line %d: unknown section type %s", line, kind)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return inventory, nil
+}
+
+// resolve returns the hosts in the order of the inventory with their variables and groups. Variables of a host take
+// precedence over the ones of its groups, variables of child groups over the ones of their parents, all and
+// ungrouped aren't groups of the hosts.
+func (inventory *ansibleInventory) resolve() []ansibleHost {
+	parents := map[string][]string{}
+	for _, name := range inventory.order {
+		for _, child := range inventory.groups[name].children {
+			parents[child] = append(parents[child], name)
+		}
+	}
+
+	// ancestors returns the group and its parents, parents first
+	var ancestors func(name string, seen map[string]bool) []string
+	ancestors = func(name string, seen map[string]bool) []string {
+		if seen[name] {
+			return nil
+		}
+		seen[name] = true
+		var result []string
+		for _, parent := range parents[name] {
+			result = append(result, ancestors(parent, seen)...)
+		}
+		return append(result, name)
+	}
+
+	var hosts []ansibleHost
+	listed := map[string]bool{}
+	for _, name := range inventory.order {
+		for _, hostname := range inventory.groups[name].hosts {
+			if listed[hostname] {
+				continue
+			}
+			listed[hostname] = true
+			hosts = append(hosts, ansibleHost{name: hostname})
+		}
+	}
+	for i := range hosts {
+		var groups []string
+		for _, name := range inventory.order {
+			for _, hostname := range inventory.groups[name].hosts {
+				if hostname == hosts[i].name {
+					groups = append(groups, name)
+				}
+			}
+		}
+
+		vars := map[string]string{}
+		if all, found := inventory.groups["all"]; found {
+			maps.Copy(vars, all.vars)
+		}
+		var chain []string
+		seen := map[string]bool{}
+		for _, group := range groups {
+			chain = append(chain, ancestors(group, seen)...)
+		}
+		for _, name := range chain {
+			maps.Copy(vars, inventory.groups[name].vars)
+		}
+		maps.Copy(vars, inventory.hosts[hosts[i].name])
+		hosts[i].vars = vars
+
+		// the group listing the host comes first
+		for _, name := range append([]string{groups[0]}, chain...) {
+			if name != "all" && name != "ungrouped" && !slices.Contains(hosts[i].groups, name) {
+				hosts[i].groups = append(hosts[i].groups, name)
+			}
+		}
+	}
+
+	return hosts
+}
+
+// AnsibleInventory returns the devices as Ansible inventory in YAML format. The devices are grouped by their group,
+// devices without group are ungrouped. The hostname is the name of the device, or its host if it has no name or the
+// name isn't unique, with ansible_host, ansible_network_os for the community.routeros collection and the site,
+// model, serial number, RouterOS version and tags of the device as host variables. Credentials aren't exported.
+func (devices Devices) AnsibleInventory() ([]byte, error) {
+	names := map[string]int{}
+	for _, device := range devices {
+		names[device.Name]++
+	}
+
+	groups := map[string]map[string]map[string]any{}
+	for _, device := range devices {
+		hostname := device.Name
+		if hostname == "" || names[hostname] > 1 {
+			hostname = device.Host
+		}
+		vars := map[string]any{
+			"ansible_host":       device.Host,
+			"ansible_network_os": "community.routeros.routeros",
+		}
+		for name, value := range map[string]string{
+			"site":             device.Site,
+			"model":            device.Model,
+			"serial_number":    device.SerialNumber,
+			"routeros_version": device.Version.RouterOS,
+		} {
+			if value != "" {
+				vars[name] = value
+			}
+		}
+		if len(device.Tags) > 0 {
+			vars["tags"] = device.Tags
+		}
+
+		group := device.Group
+		if group == "" {
+			group = "ungrouped"
+		}
+		if groups[group] == nil {
+			groups[group] = map[string]map[string]any{}
+		}
+		groups[group][hostname] = vars
+	}
+
+	children := map[string]any{}
+	for name, hosts := range groups {
+		children[name] = map[string]any{"hosts": hosts}
+	}
+
+	var output bytes.Buffer
+	encoder := yaml.NewEncoder(&output)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(map[string]any{"all": map[string]any{"children": children}}); err != nil {
+		return nil, err
+	}
+
+	return output.Bytes(), encoder.Close()
+}
@@ -0,0 +1,390 @@
+package MikrotikMonitor
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backends selecting how GetDevice reads the basic device information.
+const (
+	BackendSNMP = "snmp"
+	BackendREST = "rest"
+	BackendAPI  = "api"
+)
+
+type Package struct {
+	Name     string `json:"Name"`
+	Version  string `json:"Version"`
+	Disabled bool   `json:"Disabled"`
+}
+
+// apiConn is a connection to the binary RouterOS API on port 8728, or 8729 with TLS.
+type apiConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialAPI connects to the binary API of the device and logs in with the API credentials.
+func (device *Device) dialAPI() (*apiConn, error) {
+	timeout := device.API.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	port := device.API.Port
+	if port == 0 {
+		port = 8728
+		if device.API.TLS {
+			port = 8729
+		}
+	}
+	address := net.JoinHostPort(device.address(), strconv.Itoa(port))
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: timeout}
+	if device.API.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{InsecureSkipVerify: device.API.Insecure, ServerName: unbracket(device.Host)})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s %w to the API: %w", device.Host, ErrConnect, err)
+	}
+
+	_ = conn.SetDeadline(device.deadline(timeout))
+
+	api := &apiConn{conn: conn, reader: bufio.NewReader(conn)}
+	if _, err := api.run("/login", "=name="+device.API.User, "=password="+device.API.Password); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%s API login failed: %v", device.Host, err)
+	}
+
+	return api, nil
+}
+
+// deadline returns the time a connection of the device has to be finished, which is the end of the timeout
+// or the deadline of the running collector, whatever comes first.
+func (device *Device) deadline(timeout time.Duration) time.Time {
+	deadline := time.Now().Add(timeout)
+	if device.ctx != nil {
+		if ctxDeadline, ok := device.ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+	}
+
+	return deadline
+}
+
+func (api *apiConn) Close() error {
+	return api.conn.Close()
+}
+
+// run sends a command with its attributes and returns the attributes of all !re replies.
+// The return value of commands like /execute is part of the !done reply, which is returned as last item then.
+// A !trap reply is returned as error.
+func (api *apiConn) run(command string, words ...string) ([]map[string]string, error) {
+	if err := api.writeSentence(append([]string{command}, words...)); err != nil {
+		return nil, err
+	}
+
+	var result []map[string]string
+	var trap error
+	for {
+		sentence, err := api.readSentence()
+		if err != nil {
+			return nil, err
+		}
+		if len(sentence) == 0 {
+			continue
+		}
+
+		attributes := map[string]string{}
+		for _, word := range sentence[1:] {
+			if key, value, found := strings.Cut(strings.TrimPrefix(word, "="), "="); found && strings.HasPrefix(word, "=") {
+				attributes[key] = value
+			}
+		}
+
+		switch sentence[0] {
+		case "!re":
+			result = append(result, attributes)
+		case "!trap":
+			trap = errors.New(attributes["message"])
+		case "!fatal":
+			return nil, errors.New(strings.Join(sentence[1:], " "))
+		case "!done":
+			if len(attributes) > 0 {
+				result = append(result, attributes)
+			}
+			return result, trap
+		}
+	}
+}
+
+func (api *apiConn) writeSentence(words []string) error {
+	var buffer []byte
+	for _, word := range append(words, "") {
+		buffer = append(buffer, encodeAPILength(len(word))...)
+		buffer = append(buffer, word...)
+	}
+	_, err := api.conn.Write(buffer)
+
+	return err
+}
+
+func (api *apiConn) readSentence() ([]string, error) {
+	var words []string
+	for {
+		length, err := api.readLength()
+		if err != nil {
+			return nil, err
+		}
+		if length == 0 {
+			return words, nil
+		}
+		word := make([]byte, length)
+		if _, err := io.ReadFull(api.reader, word); err != nil {
+			return nil, err
+		}
+		words = append(words, string(word))
+	}
+}
+
+// encodeAPILength encodes the length of a word, the number of leading one bits of the first byte
+// is the number of additional bytes.
+func encodeAPILength(length int) []byte {
+	switch {
+	case length < 0x80:
+		return []byte{byte(length)}
+	case length < 0x4000:
+		return []byte{byte(length>>8) | 0x80, byte(length)}
+	case length < 0x200000:
+		return []byte{byte(length>>16) | 0xc0, byte(length >> 8), byte(length)}
+	case length < 0x10000000:
+		return []byte{byte(length>>24) | 0xe0, byte(length >> 16), byte(length >> 8), byte(length)}
+	}
+
+	return []byte{0xf0, byte(length >> 24), byte(length >> 16), byte(length >> 8), byte(length)}
+}
+
+func (api *apiConn) readLength() (int, error) {
+	first, err := api.reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	var extra int
+	var length int
+	switch {
+	case first&0x80 == 0:
+		return int(first), nil
+	case first&0xc0 == 0x80:
+		extra, length = 1, int(first&0x3f)
+	case first&0xe0 == 0xc0:
+		extra, length = 2, int(first&0x1f)
+	case first&0xf0 == 0xe0:
+		extra, length = 3, int(first&0x0f)
+	default:
+		extra, length = 4, 0
+	}
+
+	for i := 0; i < extra; i++ {
+		b, err := api.reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+
+	return length, nil
+}
+
+// Print returns the items of a menu path like "/system/resource" with all values as strings.
+// Devices with the api backend and devices known to run RouterOS v6, which has no REST API, are queried via the binary API,
+// all others via the REST API.
+func (device *Device) Print(path string) ([]map[string]string, error) {
+	if device.Backend != BackendAPI && (device.Capabilities.REST || device.Capabilities.Major == 0) {
+		return device.restPrint(path)
+	}
+
+	api, err := device.dialAPI()
+	if err != nil {
+		return nil, err
+	}
+	defer api.Close()
+
+	command := path + "/print"
+	if strings.HasSuffix(path, "/update") {
+		// settings menus without items don't know print, but get all values with getall
+		command = path + "/getall"
+	}
+	result, err := api.run(command)
+	if err != nil {
+		return nil, fmt.Errorf("%s API command %s failed: %v", device.Host, command, err)
+	}
+
+	return result, nil
+}
+
+// Execute runs a command with arguments, e.g. "/interface/ethernet/monitor" with numbers and once,
+// and returns its replies with all values as strings. The API is chosen like in Print.
+func (device *Device) Execute(command string, args map[string]string) ([]map[string]string, error) {
+	if device.Backend != BackendAPI && (device.Capabilities.REST || device.Capabilities.Major == 0) {
+		return device.restItems(http.MethodPost, command, args)
+	}
+
+	api, err := device.dialAPI()
+	if err != nil {
+		return nil, err
+	}
+	defer api.Close()
+
+	words := make([]string, 0, len(args))
+	for key, value := range args {
+		words = append(words, "="+key+"="+value)
+	}
+	result, err := api.run(command, words...)
+	if err != nil {
+		return nil, fmt.Errorf("%s API command %s failed: %v", device.Host, command, err)
+	}
+
+	return result, nil
+}
+
+// printOne returns the first item of a menu path, or an empty item if the path has none.
+func (device *Device) printOne(path string) (map[string]string, error) {
+	items, err := device.Print(path)
+	if err != nil || len(items) == 0 {
+		return map[string]string{}, err
+	}
+
+	return items[0], nil
+}
+
+// getDeviceAPI reads the device information via the REST API or the binary API instead of SNMP.
+// It populates the same fields as the SNMP request of GetDevice.
+func (device *Device) getDeviceAPI() error {
+	start := time.Now()
+	resource, err := device.printOne("/system/resource")
+	device.Latency.SNMP = time.Since(start)
+	if err != nil {
+		if err := device.Probe(); err != nil {
+			log.Println(err.Error())
+		}
+		return err
+	}
+
+	identity, err := device.printOne("/system/identity")
+	if err != nil {
+		return err
+	}
+
+	routerboard, err := device.printOne("/system/routerboard")
+	if err != nil {
+		return err
+	}
+
+	device.Reached = true
+	device.Name = identity["name"]
+	device.Model = resource["board-name"]
+	device.Uptime = ParseRouterOSDuration(resource["uptime"])
+	if fields := strings.Fields(resource["version"]); len(fields) > 0 {
+		device.Version.RouterOS = fields[0]
+	}
+	device.Version.Bootloader = routerboard["current-firmware"]
+	device.Version.Latest = routerboard["upgrade-firmware"]
+	device.SerialNumber = routerboard["serial-number"]
+	// CHR has no software ID and older versions deny reading the license to read-only users
+	if license, err := device.printOne("/system/license"); err == nil {
+		device.SoftwareID = license["software-id"]
+	}
+
+	return nil
+}
+
+// GetAPI reads data via the REST API or the binary API which SNMP doesn't provide:
+// the installed packages, the configured update channel with its newest release and the names of the scripts.
+// The main package is named routeros on RouterOS v6 as well, where it carries the architecture in its name.
+func (device *Device) GetAPI() error {
+	packages, err := device.Print("/system/package")
+	if err != nil {
+		return err
+	}
+	device.Packages = make([]Package, 0, len(packages))
+	for _, p := range packages {
+		device.Packages = append(device.Packages, Package{Name: packageName(p["name"]), Version: p["version"], Disabled: p["disabled"] == "true"})
+	}
+
+	update, err := device.printOne("/system/package/update")
+	if err != nil {
+		return err
+	}
+	device.UpdateChannel = update["channel"]
+	device.Version.LatestRelease = update["latest-version"]
+
+	scripts, err := device.Print("/system/script")
+	if err != nil {
+		return err
+	}
+	device.Scripts = make([]string, 0, len(scripts))
+	for _, script := range scripts {
+		device.Scripts = append(device.Scripts, script["name"])
+	}
+
+	return nil
+}
+
+// ParseRouterOSDuration parses durations as printed by RouterOS, e.g. "1w2d3h4m5s" or "2d03:04:05".
+// Unknown parts are ignored.
+func ParseRouterOSDuration(value string) time.Duration {
+	units := map[byte]time.Duration{'w': 7 * 24 * time.Hour, 'd': 24 * time.Hour, 'h': time.Hour, 'm': time.Minute, 's': time.Second}
+
+	var result time.Duration
+	number := 0
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c >= '0' && c <= '9':
+			number = number*10 + int(c-'0')
+		case c == ':':
+			// hh:mm:ss
+			parts := strings.Split(value[i-countDigits(value[:i]):], ":")
+			if len(parts) == 3 {
+				h, _ := strconv.Atoi(parts[0])
+				m, _ := strconv.Atoi(parts[1])
+				s, _ := strconv.Atoi(parts[2])
+				return result + time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+			}
+			return result
+		default:
+			if c == 'm' && i+1 < len(value) && value[i+1] == 's' {
+				result += time.Duration(number) * time.Millisecond
+				i++
+			} else {
+				result += time.Duration(number) * units[c]
+			}
+			number = 0
+		}
+	}
+
+	return result
+}
+
+// countDigits returns the number of digits at the end of value.
+func countDigits(value string) int {
+	n := 0
+	for n < len(value) && value[len(value)-1-n] >= '0' && value[len(value)-1-n] <= '9' {
+		n++
+	}
+
+	return n
+}
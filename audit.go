@@ -0,0 +1,94 @@
+package MikrotikMonitor
+
+import (
+	"strings"
+)
+
+// DefaultCommunity is the SNMP community of a RouterOS device in its factory-default state.
+const DefaultCommunity = "public"
+
+// Weights of the findings of an Audit, the score of a device starts at 100 and every finding deducts its weight.
+var (
+	AuditWeightDefaultCommunity = 40
+	AuditWeightDefaultAdmin     = 30
+	AuditWeightWriteAccess      = 30
+)
+
+// Audit is the security posture of a device.
+// Score is 100 for a device without findings and drops by the weight of every finding.
+type Audit struct {
+	DefaultCommunity bool `json:"DefaultCommunity"`
+	DefaultAdmin     bool `json:"DefaultAdmin"`
+	WriteAccess      bool `json:"WriteAccess"`
+	Score            int  `json:"Score"`
+}
+
+// String lists the findings, separated by commas.
+func (audit Audit) String() string {
+	var findings []string
+	if audit.DefaultCommunity {
+		findings = append(findings, "default community")
+	}
+	if audit.DefaultAdmin {
+		findings = append(findings, "default admin user")
+	}
+	if audit.WriteAccess {
+		findings = append(findings, "SNMP write access")
+	}
+
+	return strings.Join(findings, ", ")
+}
+
+// GetAudit checks the device for weak credentials: the SNMP community "public", an enabled admin user and
+// SNMP communities with write access. The configured community is checked for every device.
+// If API credentials are configured, the communities of the device are read via the REST or binary API as well,
+// the admin user is taken from the provisioning check.
+func (device *Device) GetAudit() error {
+	device.Audit = Audit{
+		DefaultCommunity: usesSNMP(device) && device.SNMP.Version != "3" && device.SNMP.Community == DefaultCommunity,
+		DefaultAdmin:     device.Provisioning.DefaultAdmin,
+	}
+	defer device.Audit.score()
+
+	if device.API.User == "" {
+		return nil
+	}
+
+	communities, err := device.Print("/snmp/community")
+	if err != nil {
+		return err
+	}
+	for _, community := range communities {
+		if community["disabled"] == "true" {
+			continue
+		}
+		if community["name"] == DefaultCommunity {
+			device.Audit.DefaultCommunity = true
+		}
+		if community["write-access"] == "true" || community["write-access"] == "yes" {
+			device.Audit.WriteAccess = true
+		}
+	}
+
+	return nil
+}
+
+// score computes the Score from the findings.
+func (audit *Audit) score() {
+	audit.Score = 100
+	for _, finding := range []struct {
+		found  bool
+		weight int
+	}{
+		{audit.DefaultCommunity, AuditWeightDefaultCommunity},
+		{audit.DefaultAdmin, AuditWeightDefaultAdmin},
+		{audit.WriteAccess, AuditWeightWriteAccess},
+	} {
+		if finding.found {
+			audit.Score -= finding.weight
+		}
+	}
+	if audit.Score < 0 {
+		audit.Score = 0
+	}
+}
@@ -0,0 +1,237 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Roles of the users of the HTTP API. A viewer may read, an admin may change the state of the monitor as well,
+// e.g. add silences or complete tasks.
+const (
+	RoleViewer = "viewer"
+	RoleAdmin  = "admin"
+)
+
+// Auth is the http_auth block of the config file, the users of the HTTP API. A request is authenticated with one of
+// the static Tokens as bearer token, as one of the Users with basic auth, or with an ID or access token of the OIDC
+// provider as bearer token. Requests without credentials get the Anonymous role, none if it is empty.
+// Tokens and passwords may reference environment variables like ${API_TOKEN}. Tokens and users with Sites only access
+// the devices of these sites and their events, silences, tasks and history, e.g. the customers of a managed service
+// provider. They can't change devices.
+type Auth struct {
+	Tokens    []AuthToken
+	Users     []AuthUser
+	OIDC      *OIDC
+	Anonymous string
+}
+
+// AuthToken is a static bearer token with its role, limited to the Sites unless empty.
+type AuthToken struct {
+	Name  string
+	Token string
+	Role  string
+	Sites []string
+}
+
+// AuthUser is a user of basic auth with its role, limited to the Sites unless empty.
+type AuthUser struct {
+	Name     string
+	Password string
+	Role     string
+	Sites    []string
+}
+
+// LoadAuth reads the http_auth block of the config file and validates it, nil if the block is missing.
+func LoadAuth(filename string) (*Auth, error) {
+	documents, err := readConfigDocuments(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadAuth(documents)
+}
+
+// loadAuth is LoadAuth with the parsed documents of the config files.
+func loadAuth(documents []configDocument) (*Auth, error) {
+	var parser struct {
+		Auth *Auth `yaml:"http_auth"`
+	}
+
+	if err := decodeConfig(documents, &parser); err != nil {
+		return nil, err
+	}
+	auth := parser.Auth
+	if auth == nil {
+		return nil, nil
+	}
+
+	var errs []error
+	fail := func(format string, a ...any) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+	validRole := func(role string) bool {
+		return role == RoleViewer || role == RoleAdmin
+	}
+	for i := range auth.Tokens {
+		token := &auth.Tokens[i]
+		if token.Token == "" {
+			fail("token %d: empty token", i+1)
+		}
+		if !validRole(token.Role) {
+			fail("token %d: unknown role %q, use viewer or admin", i+1, token.Role)
+		}
+		if slices.Contains(token.Sites, "") {
+			fail("token %d: empty site", i+1)
+		}
+	}
+	for i := range auth.Users {
+		user := &auth.Users[i]
+		if user.Name == "" || user.Password == "" {
+			fail("user %d: missing name or password", i+1)
+		}
+		if !validRole(user.Role) {
+			fail("user %s: unknown role %q, use viewer or admin", user.Name, user.Role)
+		}
+		if slices.Contains(user.Sites, "") {
+			fail("user %s: empty site", user.Name)
+		}
+	}
+	if auth.OIDC != nil && (auth.OIDC.Issuer == "" || auth.OIDC.Audience == "") {
+		fail("oidc: missing issuer or audience")
+	}
+	if auth.Anonymous != "" && !validRole(auth.Anonymous) {
+		fail("unknown anonymous role %q, use viewer or admin", auth.Anonymous)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid http_auth in config file:\n%v", err)
+	}
+
+	return auth, nil
+}
+
+// apiUser is the user of a request of the HTTP API with its Role, empty if it has none, and the Sites it is limited
+// to, nil for all sites. Name is the name of the user or token, the user of the OIDC token or anonymous.
+type apiUser struct {
+	Name  string
+	Role  string
+	Sites []string
+}
+
+type userKey struct{}
+
+// withUser returns the request with the name of its user.
+func withUser(r *http.Request, name string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, name))
+}
+
+// requestUser returns the name of the user of the request, empty without http_auth block.
+func requestUser(r *http.Request) string {
+	name, _ := r.Context().Value(userKey{}).(string)
+	return name
+}
+
+// user returns the user of the request. An error is returned for invalid credentials, with the name of the user for
+// basic auth.
+func (auth *Auth) user(r *http.Request) (apiUser, error) {
+	if user, password, ok := r.BasicAuth(); ok {
+		for _, candidate := range auth.Users {
+			if subtle.ConstantTimeCompare([]byte(user), []byte(candidate.Name)) == 1 &&
+				subtle.ConstantTimeCompare([]byte(password), []byte(candidate.Password)) == 1 {
+				return apiUser{Name: candidate.Name, Role: candidate.Role, Sites: scopeSites(candidate.Sites)}, nil
+			}
+		}
+		return apiUser{Name: user}, fmt.Errorf("invalid user or password")
+	}
+
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return apiUser{Name: "anonymous", Role: auth.Anonymous}, nil
+	}
+	for i, candidate := range auth.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate.Token)) == 1 {
+			name := candidate.Name
+			if name == "" {
+				name = fmt.Sprintf("token %d", i+1)
+			}
+			return apiUser{Name: name, Role: candidate.Role, Sites: scopeSites(candidate.Sites)}, nil
+		}
+	}
+	if auth.OIDC != nil {
+		return auth.OIDC.user(r.Context(), token)
+	}
+
+	return apiUser{}, fmt.Errorf("invalid token")
+}
+
+// scopeSites returns the sites of a token or user, nil for all sites if it has none.
+func scopeSites(sites []string) []string {
+	if len(sites) == 0 {
+		return nil
+	}
+
+	return sites
+}
+
+// requiredRole returns the role a request needs. Reading needs the viewer role, changes the admin role,
+// the Grafana datasource only reads, even with POST. gRPC calls need the admin role for the methods in grpcChanges.
+func requiredRole(r *http.Request) string {
+	if method, found := strings.CutPrefix(r.URL.Path, "/"+grpcService+"/"); found && !grpcChanges[method] {
+		return RoleViewer
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || strings.HasPrefix(r.URL.Path, "/grafana/") {
+		return RoleViewer
+	}
+	return RoleAdmin
+}
+
+// authenticate wraps the HTTP API with the authentication of the http_auth block of the config file.
+// Without the block everyone may do everything, /healthz is always open for probes.
+func (monitor *Monitor) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		monitor.mu.RLock()
+		auth := monitor.auth
+		monitor.mu.RUnlock()
+		if auth == nil || r.URL.Path == "/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := auth.user(r)
+		required := requiredRole(r)
+		// failed logins and rejected changes are added to the event log
+		if err != nil || required == RoleAdmin && user.Role != RoleAdmin {
+			defer func() {
+				message := "403 Forbidden, admin role required"
+				switch {
+				case err != nil:
+					message = "401 Unauthorized, " + err.Error()
+				case user.Role == "":
+					message = "401 Unauthorized, authentication required"
+				}
+				monitor.logRequest(r, user.Name, message)
+			}()
+		}
+		switch {
+		case err != nil || user.Role == "":
+			if len(auth.Users) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="MikrotikMonitor", charset="UTF-8"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="MikrotikMonitor"`)
+			}
+			message := "authentication required"
+			if err != nil {
+				message = err.Error()
+			}
+			http.Error(w, message, http.StatusUnauthorized)
+		case required == RoleAdmin && user.Role != RoleAdmin:
+			http.Error(w, "admin role required", http.StatusForbidden)
+		default:
+			next.ServeHTTP(w, withUser(withSites(r, user.Sites), user.Name))
+		}
+	})
+}
@@ -0,0 +1,607 @@
+package MikrotikMonitor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EventRestoreTest is the type of events raised with the result of a restore test.
+const EventRestoreTest = "RestoreTest"
+
+// restoreTestFile is the name of the file the export is uploaded to on the lab device.
+const restoreTestFile = "mikrotikmonitor-restore-test.rsc"
+
+// VerifyExport checks an /export of a device for basic sanity, so truncated or empty backups are noticed.
+// The export has to start with the RouterOS header comment, every command has to belong to a menu path,
+// quotes have to be balanced and the last line must not be continued.
+// All problems are returned together, nil means the export looks complete.
+func VerifyExport(export string) error {
+	var errs []error
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(export, "\r\n", "\n"), "\n"), "\n")
+	if len(lines) == 0 || strings.TrimSpace(export) == "" {
+		return errors.New("export is empty")
+	}
+	if !strings.HasPrefix(lines[0], "# ") || !strings.Contains(export, "by RouterOS") {
+		errs = append(errs, errors.New("line 1: missing RouterOS export header"))
+	}
+
+	path := ""
+	continued := false
+	commands := 0
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case continued:
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			continue
+		case strings.HasPrefix(trimmed, "/"):
+			path = strings.Fields(trimmed)[0]
+			if len(strings.Fields(trimmed)) > 1 {
+				commands++
+			}
+		case path == "":
+			errs = append(errs, fmt.Errorf("line %d: command outside of a menu path", i+1))
+		default:
+			commands++
+		}
+
+		if strings.Count(strings.ReplaceAll(line, `\"`, ""), `"`)%2 != 0 && !strings.HasSuffix(trimmed, `\`) {
+			errs = append(errs, fmt.Errorf("line %d: unbalanced quotes", i+1))
+		}
+		continued = strings.HasSuffix(trimmed, `\`)
+	}
+
+	if continued {
+		errs = append(errs, fmt.Errorf("line %d: export ends within a continued line, it is probably truncated", len(lines)))
+	}
+	if commands == 0 {
+		errs = append(errs, errors.New("export contains no commands"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// exportIdentity returns the identity set by an export, or an empty string if it doesn't set one.
+func exportIdentity(export string) string {
+	path := ""
+	for _, line := range strings.Split(strings.ReplaceAll(export, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "/") {
+			path = strings.Fields(trimmed)[0]
+			trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, path))
+		}
+		if path == "/system" && (trimmed == "identity" || strings.HasPrefix(trimmed, "identity ")) {
+			path = "/system identity"
+			trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, "identity"))
+		}
+		if path == "/system identity" && strings.HasPrefix(trimmed, "set name=") {
+			return strings.Trim(strings.TrimPrefix(trimmed, "set name="), `"`)
+		}
+	}
+
+	return ""
+}
+
+// RestoreExport uploads an export to the device and imports it via the REST API.
+// It is meant for a designated lab device, the imported configuration is applied to the running device.
+// If the export sets an identity, the identity of the device is compared with it afterwards.
+func (device *Device) RestoreExport(export string) error {
+	if err := VerifyExport(export); err != nil {
+		return fmt.Errorf("%s export is invalid: %v", device.Host, err)
+	}
+
+	file := map[string]string{"name": restoreTestFile, "contents": export}
+	if err := device.RESTRequest(http.MethodPut, "/file", file, nil); err != nil {
+		return err
+	}
+	defer func() {
+		_ = device.RESTRequest(http.MethodPost, "/file/remove", map[string]string{"numbers": restoreTestFile}, nil)
+	}()
+
+	if err := device.RESTRequest(http.MethodPost, "/import", map[string]string{"file-name": restoreTestFile}, nil); err != nil {
+		return err
+	}
+
+	if expected := exportIdentity(export); expected != "" {
+		var identity struct {
+			Name string
+		}
+		if err := device.RESTRequest(http.MethodGet, "/system/identity", nil, &identity); err != nil {
+			return err
+		}
+		if identity.Name != expected {
+			return fmt.Errorf("%s identity after restore is %q instead of %q", device.Host, identity.Name, expected)
+		}
+	}
+
+	return nil
+}
+
+// RestoreTest restores the export of the device with the given host to the lab device and reports the result as event.
+// A failed restore test is a critical event, a successful one is reported as resolved.
+func (monitor *Monitor) RestoreTest(host string, lab string, export string) error {
+	device, found := monitor.Device(host)
+	if !found {
+		return fmt.Errorf("%s unknown device", host)
+	}
+	labDevice, found := monitor.Device(lab)
+	if !found {
+		return fmt.Errorf("%s unknown lab device", lab)
+	}
+
+	err := labDevice.RestoreExport(export)
+	if err != nil {
+		monitor.Notify(device.NewEvent(EventRestoreTest, SeverityCritical, lab, fmt.Sprintf("restore test failed: %v", err)))
+		return err
+	}
+
+	event := device.NewEvent(EventRestoreTest, SeverityCritical, lab, "restore test succeeded")
+	event.Resolved = true
+	monitor.Notify(event)
+
+	return nil
+}
+
+// Event types of the backup collection, the subject is the name of the stored export.
+const (
+	EventBackup        = "Backup"
+	EventConfigChanged = "ConfigChanged"
+)
+
+// BackupStore stores the exports collected by the backups, the names are like "router1/router1-20241015T020000Z.rsc".
+// List returns the sorted names starting with the prefix, so the last name of a device is its newest export.
+type BackupStore interface {
+	Put(name string, content []byte) error
+	Get(name string) ([]byte, error)
+	List(prefix string) ([]string, error)
+	Delete(name string) error
+}
+
+// DirectoryStore is a BackupStore in a local directory, every device gets its own subdirectory.
+type DirectoryStore string
+
+// Put writes the content to the file of the name, only readable by the owner.
+func (store DirectoryStore) Put(name string, content []byte) error {
+	path := filepath.Join(string(store), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, content, 0o600)
+}
+
+// Get reads the file of the name.
+func (store DirectoryStore) Get(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(store), filepath.FromSlash(name)))
+}
+
+// Delete removes the file of the name.
+func (store DirectoryStore) Delete(name string) error {
+	return os.Remove(filepath.Join(string(store), filepath.FromSlash(name)))
+}
+
+// List returns the sorted names of the files starting with the prefix. A missing directory has no files.
+func (store DirectoryStore) List(prefix string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(string(store), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(string(store), path)
+		if err != nil {
+			return err
+		}
+		if name = filepath.ToSlash(name); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	sort.Strings(names)
+
+	return names, err
+}
+
+// Backups collects the configuration exports of the devices, defined in the backups block of the config file.
+// The export of every device selected by Host, Site, Group and Tag, empty fields match all, is stored Every interval
+// in the Directory or the S3 bucket, the newest Keep exports per device are kept. Differences to the previous export
+// are reported as ConfigChanged events. With Drift the export is compared every poll, so changes are reported
+// within one poll, and a changed export is stored right away.
+type Backups struct {
+	Every     time.Duration
+	Keep      int
+	Drift     bool
+	Directory string
+	S3        *S3Store
+	Host      string
+	Site      string
+	Group     string
+	Tag       string
+}
+
+// Store returns the BackupStore of the backups.
+func (backups *Backups) Store() BackupStore {
+	if backups.S3 != nil {
+		return backups.S3
+	}
+
+	return DirectoryStore(backups.Directory)
+}
+
+// matches reports whether the device is backed up.
+func (backups *Backups) matches(device Device) bool {
+	return (backups.Host == "" || backups.Host == device.Host) && (backups.Site == "" || backups.Site == device.Site) &&
+		(backups.Group == "" || backups.Group == device.Group) && (backups.Tag == "" || device.HasTag(backups.Tag))
+}
+
+// LoadBackups reads the backups block of the config file and validates it, nil if the config file has none.
+// Every defaults to 24h and Keep to 30. The keys of the s3 block may reference environment variables like the passwords of the devices.
+func LoadBackups(filename string) (*Backups, error) {
+	documents, err := readConfigDocuments(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadBackups(documents)
+}
+
+// loadBackups is LoadBackups with the parsed documents of the config files.
+func loadBackups(documents []configDocument) (*Backups, error) {
+	var parser struct {
+		Backups *Backups `yaml:"backups"`
+	}
+
+	if err := decodeConfig(documents, &parser); err != nil {
+		return nil, err
+	}
+	backups := parser.Backups
+	if backups == nil {
+		return nil, nil
+	}
+
+	var errs []error
+	fail := func(format string, a ...any) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+	if backups.Every == 0 {
+		backups.Every = 24 * time.Hour
+	} else if backups.Every < time.Hour {
+		fail("every %s is shorter than 1h", backups.Every)
+	}
+	if backups.Keep == 0 {
+		backups.Keep = 30
+	} else if backups.Keep < 0 {
+		fail("keep %d is negative", backups.Keep)
+	}
+	switch {
+	case backups.Directory == "" && backups.S3 == nil:
+		fail("missing directory or s3")
+	case backups.Directory != "" && backups.S3 != nil:
+		fail("directory and s3 are exclusive")
+	case backups.S3 != nil:
+		if backups.S3.Endpoint == "" {
+			fail("missing s3 endpoint")
+		}
+		if backups.S3.Bucket == "" {
+			fail("missing s3 bucket")
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid backups in config file:\n%v", err)
+	}
+
+	return backups, nil
+}
+
+// Export returns the configuration export of the device, read via the API with /execute or via SSH for devices with
+// the ssh backend or only an ssh block. The binary API and the REST API only return the export as string on RouterOS v7.
+func (device *Device) Export() (string, error) {
+	if device.usesSSH() {
+		return device.RunSSH("/export")
+	}
+	if device.API.User == "" {
+		return "", fmt.Errorf("%s unable to export: neither api nor ssh configured", device.Host)
+	}
+
+	result, err := device.Execute("/execute", map[string]string{"script": "/export", "as-string": ""})
+	if err != nil {
+		return "", err
+	}
+	if len(result) == 0 {
+		return "", fmt.Errorf("%s unable to export: empty reply", device.Host)
+	}
+
+	return result[len(result)-1]["ret"], nil
+}
+
+// exportCommands are the commands of an export which end a menu path.
+var exportCommands = map[string]bool{"add": true, "set": true, "remove": true, "enable": true, "disable": true, "move": true, "unset": true}
+
+// exportLines returns the normalized commands of an export: continued lines are joined, whitespace is collapsed and
+// every command is prefixed with its menu path, e.g. "/ip address add address=10.0.0.1/24 interface=ether1".
+// Comments and empty lines are dropped, the comments contain the time of the export, which differs between every two exports.
+func exportLines(export string) []string {
+	var lines []string
+	path := ""
+	var continued strings.Builder
+	for _, line := range strings.Split(strings.ReplaceAll(export, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if continued.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+			continue
+		}
+		if before, found := strings.CutSuffix(trimmed, `\`); found {
+			continued.WriteString(before + " ")
+			continue
+		}
+		continued.WriteString(trimmed)
+		line := strings.Join(strings.Fields(continued.String()), " ")
+		continued.Reset()
+		if strings.HasPrefix(line, "/") {
+			// the menu path ends with the first command, e.g. "/ip address" or "/user add name=x"
+			fields := strings.Fields(line)
+			n := 1
+			for n < len(fields) && !exportCommands[fields[n]] && !strings.Contains(fields[n], "=") {
+				n++
+			}
+			path = strings.Join(fields[:n], " ")
+			if n == len(fields) {
+				continue
+			}
+		} else {
+			line = path + " " + line
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// DiffExports returns the commands removed from the old export, prefixed with "- ", and the commands added by the new
+// one, prefixed with "+ ", in the order of the exports. The exports are normalized before, so differences in comments,
+// e.g. the time of the export, in whitespace and in line continuations are ignored.
+// Moved commands, e.g. reordered firewall rules, are reported as removed and added.
+func DiffExports(old string, new string) []string {
+	a, b := exportLines(old), exportLines(new)
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	// longest common subsequence of the differing middle part
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lengths[i+1][j] >= lengths[i][j+1]):
+			diff = append(diff, "- "+a[i])
+			i++
+		default:
+			diff = append(diff, "+ "+b[j])
+			j++
+		}
+	}
+
+	return diff
+}
+
+// Backup stores the export of the device with the given host according to the backups block of the config file,
+// deletes the exports exceeding Keep and reports differences to the previous export as ConfigChanged event.
+// A failed backup, e.g. an unreachable device or an incomplete export, is a critical Backup event.
+func (monitor *Monitor) Backup(host string) error {
+	device, found := monitor.Device(host)
+	if !found {
+		return fmt.Errorf("%s unknown device", host)
+	}
+	monitor.mu.RLock()
+	backups := monitor.backups
+	monitor.mu.RUnlock()
+	if backups == nil {
+		return fmt.Errorf("no backups block in config file")
+	}
+
+	now := time.Now()
+	name := backupName(host, now)
+	_, err := monitor.backup(device, backups, name, false)
+	if err != nil {
+		monitor.Notify(device.NewEvent(EventBackup, SeverityCritical, name, fmt.Sprintf("backup failed: %v", err)))
+		return err
+	}
+
+	monitor.mu.Lock()
+	if monitor.backedUp == nil {
+		monitor.backedUp = map[string]time.Time{}
+	}
+	monitor.backedUp[host] = now
+	monitor.mu.Unlock()
+
+	event := device.NewEvent(EventBackup, SeverityCritical, name, "backup stored")
+	event.Resolved = true
+	monitor.Notify(event)
+
+	return nil
+}
+
+// backupName returns the name of an export of the host taken at the time.
+func backupName(host string, t time.Time) string {
+	return fmt.Sprintf("%s/%s-%s.rsc", host, host, t.UTC().Format("20060102T150405Z"))
+}
+
+// storedExport is the newest stored export of a device.
+type storedExport struct {
+	name   string
+	export string
+}
+
+// backup exports the device and stores the export under the name. Differences to the previous export are reported as
+// ConfigChanged event with the diff as Details. With changedOnly an unchanged export isn't stored.
+// It reports whether the export was stored.
+func (monitor *Monitor) backup(device Device, backups *Backups, name string, changedOnly bool) (bool, error) {
+	export, err := device.Export()
+	if err != nil {
+		return false, err
+	}
+	if err := VerifyExport(export); err != nil {
+		return false, fmt.Errorf("%s export is invalid: %v", device.Host, err)
+	}
+
+	store := backups.Store()
+	previous, err := monitor.previousExport(device.Host, store)
+	if err != nil {
+		return false, err
+	}
+	var diff []string
+	if previous.name != "" {
+		diff = DiffExports(previous.export, export)
+	}
+	if changedOnly && previous.name != "" && len(diff) == 0 {
+		return false, nil
+	}
+	if len(diff) > 0 {
+		event := device.NewEvent(EventConfigChanged, SeverityWarning, name, changeMessage(diff, previous.name))
+		event.Details = strings.Join(diff, "\n")
+		monitor.Notify(event)
+	}
+
+	if err := store.Put(name, []byte(export)); err != nil {
+		return false, err
+	}
+	monitor.mu.Lock()
+	if monitor.exports == nil {
+		monitor.exports = map[string]storedExport{}
+	}
+	monitor.exports[device.Host] = storedExport{name: name, export: export}
+	monitor.mu.Unlock()
+
+	names, err := store.List(device.Host + "/")
+	if err != nil {
+		log.Printf("%s unable to list exports: %v", device.Host, err)
+	}
+	for len(names) > backups.Keep {
+		if err := store.Delete(names[0]); err != nil {
+			log.Printf("%s unable to delete old export %s: %v", device.Host, names[0], err)
+		}
+		names = names[1:]
+	}
+
+	return true, nil
+}
+
+// previousExport returns the newest stored export of the host, which is read from the store once and cached.
+// The name is empty if the host has no stored export.
+func (monitor *Monitor) previousExport(host string, store BackupStore) (storedExport, error) {
+	monitor.mu.RLock()
+	previous, cached := monitor.exports[host]
+	monitor.mu.RUnlock()
+	if cached {
+		return previous, nil
+	}
+
+	names, err := store.List(host + "/")
+	if err != nil || len(names) == 0 {
+		return storedExport{}, err
+	}
+	content, err := store.Get(names[len(names)-1])
+	if err != nil {
+		return storedExport{}, err
+	}
+
+	return storedExport{name: names[len(names)-1], export: string(content)}, nil
+}
+
+// checkDrift compares the export of a polled device with its previous export if the backups block enables Drift.
+// A changed export is stored and reported as ConfigChanged event. Failures are only logged, a failing device would
+// raise them every poll.
+func (monitor *Monitor) checkDrift(device Device) {
+	monitor.mu.RLock()
+	backups := monitor.backups
+	monitor.mu.RUnlock()
+	if backups == nil || !backups.Drift || !device.Reached || !backups.matches(device) {
+		return
+	}
+
+	if _, err := monitor.backup(device, backups, backupName(device.Host, time.Now()), true); err != nil {
+		log.Printf("%s unable to check the configuration for changes: %v", device.Host, err)
+	}
+}
+
+// changeMessage summarizes the differences to the previous export with the first changed commands.
+func changeMessage(diff []string, previous string) string {
+	var added, removed int
+	for _, line := range diff {
+		if strings.HasPrefix(line, "+") {
+			added++
+		} else {
+			removed++
+		}
+	}
+	shown := diff[:min(len(diff), 5)]
+	message := fmt.Sprintf("configuration changed since %s, %d commands added, %d removed: %s", previous, added, removed, strings.Join(shown, "; "))
+	if len(diff) > len(shown) {
+		message += "; ..."
+	}
+
+	return message
+}
+
+// Backups returns the sorted names of the stored exports of the device with the given host.
+func (monitor *Monitor) Backups(host string) ([]string, error) {
+	monitor.mu.RLock()
+	backups := monitor.backups
+	monitor.mu.RUnlock()
+	if backups == nil {
+		return nil, fmt.Errorf("no backups block in config file")
+	}
+
+	return backups.Store().List(host + "/")
+}
+
+// backupDue backs up the reached devices selected by the backups block whose last backup is older than Every.
+// Devices which aren't reached aren't backed up, their Down event reports them already.
+func (monitor *Monitor) backupDue(now time.Time) {
+	monitor.mu.RLock()
+	backups := monitor.backups
+	var due []string
+	for _, device := range monitor.devices {
+		if backups != nil && device.Reached && backups.matches(device) && now.Sub(monitor.backedUp[device.Host]) >= backups.Every {
+			due = append(due, device.Host)
+		}
+	}
+	monitor.mu.RUnlock()
+
+	for _, host := range due {
+		if err := monitor.Backup(host); err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"sync"
+	"time"
+)
+
+// batchConcurrency is the number of batches getBatched requests at the same time.
+const batchConcurrency = 4
+
+// getBatched reads the scalar OIDs with as few Get requests as the agent allows and returns the variables in the
+// order of the OIDs. The OIDs are split into batches of MaxOids of the SNMP settings, default 60, up to
+// batchConcurrency batches are requested at the same time, the first with the session of the device and the others
+// with connections of their own, see cloneSNMP. With a Delay of the SNMP settings the batches are requested one after
+// another with the session, whose PreSend hook keeps the delay between the requests. If the agent answers tooBig, the
+// batch is split in halves and the smaller size is kept for the following requests of the session.
+// If the agent rejects a batch, e.g. an SNMPv1 agent answering noSuchName for a single OID, its OIDs are requested
+// one by one, OIDs which fail then are returned as noSuchObject.
+func (device *Device) getBatched(oids []string) ([]gosnmp.SnmpPDU, error) {
+	size := device.snmp.MaxOids
+	if size <= 0 {
+		size = gosnmp.MaxOids
+	}
+	var batches [][]string
+	for start := 0; start < len(oids); start += size {
+		batches = append(batches, oids[start:min(start+size, len(oids))])
+	}
+
+	// the requests of a device with a delay can't overlap anyway
+	concurrency := batchConcurrency
+	if device.SNMP.Delay > 0 {
+		concurrency = 1
+	}
+	// the connections are opened before any request, which would change the SNMPv3 engine of the session
+	clients := []*gosnmp.GoSNMP{device.snmp}
+	for len(clients) < min(len(batches), concurrency) {
+		client, release, err := device.cloneSNMP()
+		if err != nil {
+			// the batches are requested with the connections which are open
+			break
+		}
+		defer release()
+		clients = append(clients, client)
+	}
+
+	next := make(chan int, len(batches))
+	for i := range batches {
+		next <- i
+	}
+	close(next)
+	results := make([][]gosnmp.SnmpPDU, len(batches))
+	sizes := make([]int, len(batches))
+	errs := make([]error, len(batches))
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *gosnmp.GoSNMP) {
+			defer wg.Done()
+			for i := range next {
+				results[i], sizes[i], errs[i] = getBatch(client, batches[i])
+			}
+		}(client)
+	}
+	wg.Wait()
+
+	variables := make([]gosnmp.SnmpPDU, 0, len(oids))
+	for i := range batches {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if sizes[i] > 0 && sizes[i] < device.snmp.MaxOids {
+			device.snmp.MaxOids = sizes[i]
+		}
+		variables = append(variables, results[i]...)
+	}
+
+	return variables, nil
+}
+
+// getBatch requests a batch of OIDs with the client, see getBatched. It returns the variables and, if the agent
+// answered tooBig, the size of the batches it accepted, 0 otherwise.
+func getBatch(client *gosnmp.GoSNMP, batch []string) ([]gosnmp.SnmpPDU, int, error) {
+	result, err := client.Get(batch)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case result.Error == gosnmp.TooBig && len(batch) > 1:
+		half := (len(batch) + 1) / 2
+		first, size, err := getBatch(client, batch[:half])
+		if err != nil {
+			return nil, 0, err
+		}
+		second, other, err := getBatch(client, batch[half:])
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, accepted := range []int{size, other} {
+			if accepted > 0 {
+				half = min(half, accepted)
+			}
+		}
+		return append(first, second...), half, nil
+	case result.Error != gosnmp.NoError:
+		variables := make([]gosnmp.SnmpPDU, 0, len(batch))
+		for _, oid := range batch {
+			single, err := client.Get([]string{oid})
+			if err != nil {
+				return nil, 0, err
+			}
+			if single.Error != gosnmp.NoError || len(single.Variables) == 0 {
+				variables = append(variables, gosnmp.SnmpPDU{Name: oid, Type: gosnmp.NoSuchObject})
+				continue
+			}
+			variables = append(variables, single.Variables[0])
+		}
+		return variables, 0, nil
+	case len(result.Variables) != len(batch):
+		return nil, 0, fmt.Errorf("agent returned %d variables for %d OIDs", len(result.Variables), len(batch))
+	}
+
+	return result.Variables, 0, nil
+}
+
+// cloneSNMP connects a new SNMP client with the settings of the session of the device, for requests at the same time
+// as the session. It uses a copy of the SNMPv3 engine the session discovered, so it doesn't repeat the discovery.
+// The returned function closes the client.
+func (device *Device) cloneSNMP() (*gosnmp.GoSNMP, func(), error) {
+	clone := *device
+	clone.SNMPConfigure()
+	client := clone.snmp
+	client.Target, client.Port, client.MaxOids = device.snmp.Target, device.snmp.Port, device.snmp.MaxOids
+	if device.snmp.SecurityParameters != nil {
+		client.SecurityParameters = device.snmp.SecurityParameters.Copy()
+	}
+	if err := client.Connect(); err != nil {
+		return nil, nil, err
+	}
+	// like the session, an expired deadline ends a pending read right away
+	conn := client.Conn
+	stop := context.AfterFunc(client.Context, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+
+	return client, func() {
+		stop()
+		closeSNMP(client)
+	}, nil
+}
+
+// getScalars returns the variables of the scalar OIDs in their order. OIDs prefetched with the basic request of
+// GetDevice are taken from it, the others are read with getBatched.
+func (device *Device) getScalars(oids []string) ([]gosnmp.SnmpPDU, error) {
+	variables := make([]gosnmp.SnmpPDU, len(oids))
+	var missing []string
+	var positions []int
+	for i, oid := range oids {
+		if variable, found := device.scalars[oid]; found {
+			variables[i] = variable
+			continue
+		}
+		missing = append(missing, oid)
+		positions = append(positions, i)
+	}
+	if len(missing) == 0 {
+		return variables, nil
+	}
+
+	fetched, err := device.getBatched(missing)
+	if err != nil {
+		return nil, err
+	}
+	for i, variable := range fetched {
+		variables[positions[i]] = variable
+	}
+
+	return variables, nil
+}
+
+// prefetchOIDs returns the scalar OIDs of the collectors which will run in this poll, which are requested
+// together with the basic request.
+func (device *Device) prefetchOIDs() []string {
+	var oids []string
+	for _, collector := range Collectors {
+		if collector.Scalars == nil || !device.runs(collector) {
+			continue
+		}
+		oids = append(oids, collector.Scalars(device)...)
+	}
+
+	return oids
+}
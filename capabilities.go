@@ -0,0 +1,72 @@
+package MikrotikMonitor
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Wireless packages reported in Capabilities.
+// The legacy wireless package is part of the MikroTik MIB, the wifi packages of RouterOS v7 (wifiwave2, wifi-qcom) are not.
+const (
+	WirelessLegacy = "wireless"
+	WirelessWiFi   = "wifi"
+)
+
+// Capabilities describes which data sources a device offers, depending on its RouterOS major version and packages.
+// The collectors use it to skip what a device can't provide, so mixed v6/v7 fleets don't produce partial errors.
+// Wireless stays empty until the packages were read once via the API.
+// Flags and SwitchChip are set by the features collector, see GetFeatures.
+type Capabilities struct {
+	Major      int             `json:"Major"`
+	REST       bool            `json:"REST"`
+	Wireless   string          `json:"Wireless"`
+	Flags      map[string]bool `json:"Flags"`
+	SwitchChip string          `json:"SwitchChip"`
+}
+
+// detectCapabilities derives the capabilities from the RouterOS version and the installed packages of the device.
+// The REST API exists since RouterOS v7, older devices are read via the binary API instead.
+func (device *Device) detectCapabilities() {
+	// the features are kept until the features collector ran again
+	capabilities := Capabilities{
+		Major:      routerOSMajor(device.Version.RouterOS),
+		Flags:      device.Capabilities.Flags,
+		SwitchChip: device.Capabilities.SwitchChip,
+	}
+	capabilities.REST = capabilities.Major >= 7
+
+	for _, p := range device.Packages {
+		if p.Disabled {
+			continue
+		}
+		switch {
+		case p.Name == "wireless":
+			capabilities.Wireless = WirelessLegacy
+		case (p.Name == "wifiwave2" || strings.HasPrefix(p.Name, "wifi-")) && capabilities.Wireless == "":
+			capabilities.Wireless = WirelessWiFi
+		}
+	}
+
+	device.Capabilities = capabilities
+}
+
+// routerOSMajor returns the major version of a RouterOS version like "6.49.10" or "7.12 (stable)", 0 if unknown.
+func routerOSMajor(version string) int {
+	major, _, _ := strings.Cut(strings.TrimSpace(version), ".")
+	value, err := strconv.Atoi(major)
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+// packageName returns the name of a package independent of the RouterOS major version.
+// RouterOS v6 names the main package after the architecture, e.g. "routeros-mipsbe", v7 only "routeros".
+func packageName(name string) string {
+	if strings.HasPrefix(name, "routeros-") {
+		return "routeros"
+	}
+
+	return name
+}
@@ -0,0 +1,193 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OIDs of the CAPsMAN interface table of the MikroTik MIB, indexed by the interface index.
+const (
+	oidCAPsMANClients = ".1.3.6.1.4.1.14988.1.1.1.5.1.1"
+	oidCAPsMANState   = ".1.3.6.1.4.1.14988.1.1.1.5.1.3"
+	oidCAPsMANChannel = ".1.3.6.1.4.1.14988.1.1.1.5.1.4"
+)
+
+// CAPsMAN is the wireless estate managed by a device running the CAPsMAN controller.
+// CAPs are only read via the API, SNMP reports the interfaces the controller created for the radios of the CAPs.
+// Devices without CAPsMAN have neither CAPs nor interfaces.
+type CAPsMAN struct {
+	CAPs       []CAP          `json:"CAPs"`
+	Interfaces []CAPInterface `json:"Interfaces"`
+	Clients    int            `json:"Clients"`
+}
+
+// CAP is an access point managed by CAPsMAN, State is its registration state, e.g. "Run".
+type CAP struct {
+	Identity string `json:"Identity"`
+	Address  string `json:"Address"`
+	Board    string `json:"Board"`
+	Version  string `json:"Version"`
+	State    string `json:"State"`
+	Radios   int    `json:"Radios"`
+}
+
+// CAPInterface is an interface of a radio of a CAP with its channel and the number of registered clients.
+type CAPInterface struct {
+	Name    string `json:"Name"`
+	State   string `json:"State"`
+	Channel string `json:"Channel"`
+	Clients int    `json:"Clients"`
+}
+
+// GetCAPsMAN reads the CAPs managed by the device and the clients of their interfaces.
+// Via the API the legacy /caps-man menu or, with the wifi package, /interface/wifi/capsman is read depending on
+// the wireless package of the device. Devices read via SNMP without an api block only report the interfaces.
+func (device *Device) GetCAPsMAN() error {
+	if device.Capabilities.Wireless != "" && (device.API.User != "" || !usesSNMP(device)) {
+		return device.getCAPsMANAPI()
+	}
+	if !usesSNMP(device) {
+		device.CAPsMAN = CAPsMAN{}
+		return nil
+	}
+
+	names := map[int]string{}
+	for _, iface := range device.Interfaces {
+		names[iface.Index] = iface.Name
+	}
+
+	interfaces := map[int]*CAPInterface{}
+	columns := []struct {
+		oid string
+		set func(iface *CAPInterface, variable gosnmp.SnmpPDU)
+	}{
+		{oidCAPsMANClients, func(iface *CAPInterface, variable gosnmp.SnmpPDU) {
+			clients, _ := AsInt(variable)
+			iface.Clients = int(clients)
+		}},
+		{oidCAPsMANState, func(iface *CAPInterface, variable gosnmp.SnmpPDU) {
+			iface.State, _ = AsString(variable)
+		}},
+		{oidCAPsMANChannel, func(iface *CAPInterface, variable gosnmp.SnmpPDU) {
+			iface.Channel, _ = AsString(variable)
+		}},
+	}
+	for _, column := range columns {
+		err := device.snmp.BulkWalk(column.oid, func(variable gosnmp.SnmpPDU) error {
+			index, err := strconv.Atoi(strings.TrimPrefix(variable.Name, column.oid+"."))
+			if err != nil {
+				return nil
+			}
+			if interfaces[index] == nil {
+				interfaces[index] = &CAPInterface{Name: names[index]}
+				if interfaces[index].Name == "" {
+					interfaces[index].Name = strconv.Itoa(index)
+				}
+			}
+			column.set(interfaces[index], variable)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s unable to read CAPsMAN interfaces: %v", device.Host, err)
+		}
+	}
+
+	capsman := CAPsMAN{}
+	for _, iface := range interfaces {
+		capsman.Interfaces = append(capsman.Interfaces, *iface)
+		capsman.Clients += iface.Clients
+	}
+	sortCAPsMAN(&capsman)
+	device.CAPsMAN = capsman
+
+	return nil
+}
+
+// getCAPsMANAPI reads the remote CAPs, the interfaces and the registration table of CAPsMAN via the API.
+// A device without the CAPsMAN menu, e.g. a CAP itself, has no CAPsMAN.
+func (device *Device) getCAPsMANAPI() error {
+	paths := [3]string{"/caps-man/remote-cap", "/caps-man/interface", "/caps-man/registration-table"}
+	if device.Capabilities.Wireless == WirelessWiFi {
+		paths = [3]string{"/interface/wifi/capsman/remote-cap", "/interface/wifi", "/interface/wifi/registration-table"}
+	}
+
+	caps, err := device.Print(paths[0])
+	if err != nil {
+		if device.Capabilities.Wireless == WirelessWiFi {
+			// RouterOS before 7.13 has no capsman menu in /interface/wifi
+			device.CAPsMAN = CAPsMAN{}
+			return nil
+		}
+		return err
+	}
+	if len(caps) == 0 {
+		device.CAPsMAN = CAPsMAN{}
+		return nil
+	}
+	interfaces, err := device.Print(paths[1])
+	if err != nil {
+		return err
+	}
+	registrations, err := device.Print(paths[2])
+	if err != nil {
+		return err
+	}
+
+	capsman := CAPsMAN{}
+	for _, item := range caps {
+		radios, _ := strconv.Atoi(item["radios"])
+		capsman.CAPs = append(capsman.CAPs, CAP{
+			Identity: item["identity"],
+			Address:  strings.Split(item["address"], "/")[0],
+			Board:    firstValue(item, "board", "board-name"),
+			Version:  item["version"],
+			State:    item["state"],
+			Radios:   radios,
+		})
+	}
+
+	clients := map[string]int{}
+	for _, registration := range registrations {
+		clients[registration["interface"]]++
+	}
+	for _, item := range interfaces {
+		state := firstValue(item, "current-state", "state")
+		if state == "" {
+			state = "disabled"
+			if item["running"] == "true" {
+				state = "running"
+			}
+		}
+		capsman.Interfaces = append(capsman.Interfaces, CAPInterface{
+			Name:    item["name"],
+			State:   state,
+			Channel: firstValue(item, "current-channel", "channel", "channel.frequency"),
+			Clients: clients[item["name"]],
+		})
+	}
+	capsman.Clients = len(registrations)
+	sortCAPsMAN(&capsman)
+	device.CAPsMAN = capsman
+
+	return nil
+}
+
+// firstValue returns the first non-empty value of the keys of an item.
+func firstValue(item map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := item[key]; value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// sortCAPsMAN sorts the CAPs by identity and the interfaces by name.
+func sortCAPsMAN(capsman *CAPsMAN) {
+	sort.Slice(capsman.CAPs, func(i, j int) bool { return capsman.CAPs[i].Identity < capsman.CAPs[j].Identity })
+	sort.Slice(capsman.Interfaces, func(i, j int) bool { return capsman.Interfaces[i].Name < capsman.Interfaces[j].Name })
+}
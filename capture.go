@@ -0,0 +1,140 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// EventCapture is the type of events raised when a packet capture starts and ends.
+const EventCapture = "Capture"
+
+// CaptureOptions configures a packet capture with /tool sniffer.
+// Target is the TZSP receiver, e.g. "10.0.0.5:37008", where the device streams the captured packets to.
+// Interface and Filter limit the capture to one interface and an IP address, both are optional.
+type CaptureOptions struct {
+	Target    string
+	Interface string
+	Filter    string
+	Duration  time.Duration
+}
+
+// StartCapture configures /tool sniffer of the device to stream packets to the target and starts it.
+// It uses the RouterOS REST API, so the API credentials of the device have to be configured.
+func (device *Device) StartCapture(options CaptureOptions) error {
+	settings := map[string]string{
+		"streaming-enabled": "yes",
+		"streaming-server":  options.Target,
+		"filter-interface":  "all",
+		"filter-ip-address": "",
+	}
+	if options.Interface != "" {
+		settings["filter-interface"] = options.Interface
+	}
+	if options.Filter != "" {
+		settings["filter-ip-address"] = options.Filter
+	}
+
+	if err := device.RESTRequest(http.MethodPost, "/tool/sniffer/set", settings, nil); err != nil {
+		return err
+	}
+
+	return device.RESTRequest(http.MethodPost, "/tool/sniffer/start", map[string]string{}, nil)
+}
+
+// StopCapture stops /tool sniffer of the device.
+func (device *Device) StopCapture() error {
+	return device.RESTRequest(http.MethodPost, "/tool/sniffer/stop", map[string]string{}, nil)
+}
+
+// Capture starts a time-limited packet capture on the device with the given host.
+// Only one capture per device can run at a time, it is stopped automatically after the duration,
+// when the monitor is stopped or when StopCapture is called. Start and end are reported as events.
+func (monitor *Monitor) Capture(host string, options CaptureOptions) error {
+	if options.Target == "" {
+		return fmt.Errorf("%s capture target is missing", host)
+	}
+	if options.Duration <= 0 {
+		return fmt.Errorf("%s capture duration is missing", host)
+	}
+
+	device, found := monitor.Device(host)
+	if !found {
+		return fmt.Errorf("%s unknown device", host)
+	}
+
+	monitor.mu.Lock()
+	if monitor.captures == nil {
+		monitor.captures = map[string]chan struct{}{}
+	}
+	if _, running := monitor.captures[host]; running {
+		monitor.mu.Unlock()
+		return fmt.Errorf("%s capture is already running", host)
+	}
+	cancel := make(chan struct{})
+	monitor.captures[host] = cancel
+	// the capture ends with the monitor, Stop waits for it
+	stop := monitor.stop
+	if stop != nil {
+		monitor.wg.Add(1)
+	}
+	monitor.mu.Unlock()
+
+	if err := device.StartCapture(options); err != nil {
+		monitor.mu.Lock()
+		delete(monitor.captures, host)
+		monitor.mu.Unlock()
+		if stop != nil {
+			monitor.wg.Done()
+		}
+		return err
+	}
+	monitor.Notify(device.NewEvent(EventCapture, SeverityInfo, options.Interface,
+		fmt.Sprintf("capture to %s started for %s", options.Target, options.Duration)))
+
+	go func() {
+		if stop != nil {
+			defer monitor.wg.Done()
+		}
+		timer := time.NewTimer(options.Duration)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-cancel:
+		case <-stop:
+		}
+
+		message := fmt.Sprintf("capture to %s stopped", options.Target)
+		if err := device.StopCapture(); err != nil {
+			message = fmt.Sprintf("capture to %s could not be stopped, %v", options.Target, err)
+		}
+
+		monitor.mu.Lock()
+		if monitor.captures[host] == cancel {
+			delete(monitor.captures, host)
+		}
+		monitor.mu.Unlock()
+
+		event := device.NewEvent(EventCapture, SeverityInfo, options.Interface, message)
+		event.Resolved = true
+		monitor.Notify(event)
+	}()
+
+	return nil
+}
+
+// StopCapture ends a running capture on the device with the given host before its duration has elapsed.
+func (monitor *Monitor) StopCapture(host string) error {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	cancel, running := monitor.captures[host]
+	if !running {
+		return fmt.Errorf("%s no capture is running", host)
+	}
+	close(cancel)
+	delete(monitor.captures, host)
+
+	return nil
+}
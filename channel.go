@@ -0,0 +1,116 @@
+package MikrotikMonitor
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Update channels of RouterOS.
+const (
+	ChannelLongTerm    = "long-term"
+	ChannelStable      = "stable"
+	ChannelTesting     = "testing"
+	ChannelDevelopment = "development"
+)
+
+// Releases maps an update channel to the newest RouterOS version released on it.
+// Releases of an older major version are keyed by the major version, "/" and the channel, e.g. "6/long-term".
+type Releases map[string]string
+
+// CompareVersions compares two RouterOS versions like "6.49.10", "7.15beta4" or "7.15rc1".
+// It returns -1 if a is older than b, 1 if a is newer and 0 if both are equal.
+// Pre-releases are older than the release with the same number, beta is older than rc.
+func CompareVersions(a, b string) int {
+	numbersA, stageA, preA := splitVersion(a)
+	numbersB, stageB, preB := splitVersion(b)
+
+	for i := 0; i < len(numbersA) || i < len(numbersB); i++ {
+		var x, y int
+		if i < len(numbersA) {
+			x = numbersA[i]
+		}
+		if i < len(numbersB) {
+			y = numbersB[i]
+		}
+		if x != y {
+			return compareInt(x, y)
+		}
+	}
+
+	if stageA != stageB {
+		return compareInt(stageA, stageB)
+	}
+
+	return compareInt(preA, preB)
+}
+
+// splitVersion returns the numbers of a version, the stage of a pre-release (0 beta, 1 rc, 2 release)
+// and the number of the pre-release.
+func splitVersion(version string) ([]int, int, int) {
+	if fields := strings.Fields(version); len(fields) > 0 {
+		// e.g. "7.14.2 (stable)"
+		version = fields[0]
+	}
+	stage, pre := 2, 0
+	for i, name := range []string{"beta", "rc"} {
+		if index := strings.Index(version, name); index >= 0 {
+			stage = i
+			pre, _ = strconv.Atoi(version[index+len(name):])
+			version = version[:index]
+			break
+		}
+	}
+
+	var numbers []int
+	for _, part := range strings.Split(version, ".") {
+		n, _ := strconv.Atoi(part)
+		numbers = append(numbers, n)
+	}
+
+	return numbers, stage, pre
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+// CheckUpdate sets UpdateAvailable if the installed RouterOS version is older than the newest release
+// of the device's channel. Without a configured channel the update channel set on the device is used.
+// Releases of the major version of the device are preferred, e.g. "6/long-term" for a device running RouterOS v6.
+// If the channel is unknown to releases, the LatestRelease found by the device is used, but only if the device is set
+// to that channel, so a device pinned to long-term isn't flagged outdated by the newest release of stable.
+// Devices with an unknown channel, e.g. read via SNMP only, fall back to the Latest version reported by the device.
+func (device *Device) CheckUpdate(releases Releases) {
+	channel := device.UpdateChannel
+	if device.Channel != "" {
+		channel = device.Channel
+	}
+
+	var latest string
+	if release, ok := releases[strconv.Itoa(routerOSMajor(device.Version.RouterOS))+"/"+channel]; ok && channel != "" {
+		latest = release
+	} else if release, ok := releases[channel]; ok && channel != "" && routerOSMajor(device.Version.RouterOS) == routerOSMajor(release) {
+		latest = release
+	} else if channel != "" && channel == device.UpdateChannel {
+		latest = device.Version.LatestRelease
+	} else if channel == "" {
+		latest = device.Version.Latest
+	}
+
+	device.Version.UpdateAvailable = device.Version.RouterOS != "" && latest != "" &&
+		CompareVersions(device.Version.RouterOS, latest) < 0
+}
+
+// CheckUpdates calls CheckUpdate for all devices.
+func (devices *Devices) CheckUpdates(releases Releases) {
+	for i := range *devices {
+		(*devices)[i].CheckUpdate(releases)
+	}
+}
@@ -0,0 +1,313 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Slack posts events to a channel of Slack. With a Token of a bot and a Channel the messages are sent via the Web API,
+// further events of a problem are replies in the thread of its first message, which is updated when the problem is
+// resolved. With a Webhook only, every event is posted as a new message. URL defaults to the Web API of Slack.
+// Values returns the recent values of the metric of an event for a sparkline, e.g. Monitor.RecentValues.
+type Slack struct {
+	Webhook string                      `yaml:"webhook"`
+	Token   string                      `yaml:"token"`
+	Channel string                      `yaml:"channel"`
+	URL     string                      `yaml:"url"`
+	Values  func(event Event) []float64 `yaml:"-"`
+	Client  *http.Client                `yaml:"-"`
+
+	threads chatThreads
+}
+
+// Notify posts the event, in the thread of its problem if there is one.
+func (slack *Slack) Notify(event Event) error {
+	text := chatMessage(event, chatValues(slack.Values, event), func(s string) string { return "*" + s + "*" },
+		strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace)
+	if slack.Token == "" {
+		return jsonRequest(slack.Client, http.MethodPost, slack.Webhook, nil, map[string]string{"text": text}, nil)
+	}
+
+	address := slack.URL
+	if address == "" {
+		address = "https://slack.com/api"
+	}
+	address = strings.TrimSuffix(address, "/")
+	header := http.Header{"Authorization": {"Bearer " + slack.Token}}
+	request := func(method string, body map[string]string) (map[string]string, error) {
+		var result struct {
+			OK      bool
+			Error   string
+			Channel string
+			TS      string
+		}
+		if err := jsonRequest(slack.Client, http.MethodPost, address+"/"+method, header, body, &result); err != nil {
+			return nil, err
+		}
+		if !result.OK {
+			return nil, fmt.Errorf("slack %s failed: %s", method, result.Error)
+		}
+		return map[string]string{"channel": result.Channel, "ts": result.TS}, nil
+	}
+
+	return slack.threads.notify(event, func(thread map[string]string) (map[string]string, error) {
+		body := map[string]string{"channel": slack.Channel, "text": text}
+		if thread != nil {
+			body["channel"], body["thread_ts"] = thread["channel"], thread["ts"]
+		}
+		return request("chat.postMessage", body)
+	}, func(thread map[string]string) error {
+		_, err := request("chat.update", map[string]string{"channel": thread["channel"], "ts": thread["ts"], "text": text})
+		return err
+	})
+}
+
+// Mattermost posts events to a channel of Mattermost. With the URL of the server, a Token of a bot or user and the
+// ChannelID the messages are sent via the REST API, further events of a problem are replies in the thread of its
+// first message, which is updated when the problem is resolved. With a Webhook only, every event is posted as a new
+// message. Values returns the recent values of the metric of an event for a sparkline, e.g. Monitor.RecentValues.
+type Mattermost struct {
+	Webhook   string                      `yaml:"webhook"`
+	URL       string                      `yaml:"url"`
+	Token     string                      `yaml:"token"`
+	ChannelID string                      `yaml:"channel_id"`
+	Values    func(event Event) []float64 `yaml:"-"`
+	Client    *http.Client                `yaml:"-"`
+
+	threads chatThreads
+}
+
+// Notify posts the event, in the thread of its problem if there is one.
+func (mattermost *Mattermost) Notify(event Event) error {
+	text := chatMessage(event, chatValues(mattermost.Values, event), func(s string) string { return "**" + s + "**" }, nil)
+	if mattermost.Token == "" {
+		return jsonRequest(mattermost.Client, http.MethodPost, mattermost.Webhook, nil, map[string]string{"text": text}, nil)
+	}
+
+	address := strings.TrimSuffix(mattermost.URL, "/") + "/api/v4/posts"
+	header := http.Header{"Authorization": {"Bearer " + mattermost.Token}}
+
+	return mattermost.threads.notify(event, func(thread map[string]string) (map[string]string, error) {
+		body := map[string]string{"channel_id": mattermost.ChannelID, "message": text}
+		if thread != nil {
+			body["root_id"] = thread["id"]
+		}
+		var result struct {
+			ID string
+		}
+		if err := jsonRequest(mattermost.Client, http.MethodPost, address, header, body, &result); err != nil {
+			return nil, err
+		}
+		return map[string]string{"id": result.ID}, nil
+	}, func(thread map[string]string) error {
+		return jsonRequest(mattermost.Client, http.MethodPut, address+"/"+url.PathEscape(thread["id"])+"/patch", header,
+			map[string]string{"message": text}, nil)
+	})
+}
+
+// Matrix sends events to a Room, its ID like !abc:example.com, of Matrix via the client-server API of the Homeserver
+// with the access Token of a user. Further events of a problem are replies in the thread of its first message, which
+// is edited when the problem is resolved. Values returns the recent values of the metric of an event for a sparkline,
+// e.g. Monitor.RecentValues.
+type Matrix struct {
+	Homeserver string                      `yaml:"homeserver"`
+	Token      string                      `yaml:"token"`
+	Room       string                      `yaml:"room"`
+	Values     func(event Event) []float64 `yaml:"-"`
+	Client     *http.Client                `yaml:"-"`
+
+	threads      chatThreads
+	transactions atomic.Int64
+}
+
+// Notify sends the event, in the thread of its problem if there is one.
+func (matrix *Matrix) Notify(event Event) error {
+	values := chatValues(matrix.Values, event)
+	text := chatMessage(event, values, nil, nil)
+	formatted := chatMessage(event, values, func(s string) string { return "<b>" + s + "</b>" }, html.EscapeString)
+	content := map[string]any{
+		"msgtype":        "m.text",
+		"body":           text,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": strings.ReplaceAll(formatted, "\n", "<br>"),
+	}
+
+	header := http.Header{"Authorization": {"Bearer " + matrix.Token}}
+	send := func(body map[string]any) (string, error) {
+		// transaction IDs make retries of the same message idempotent, they only have to be unique per access token
+		id := fmt.Sprintf("mikrotikmonitor.%d.%d", time.Now().UnixNano(), matrix.transactions.Add(1))
+		var result struct {
+			EventID string `json:"event_id"`
+		}
+		err := jsonRequest(matrix.Client, http.MethodPut, strings.TrimSuffix(matrix.Homeserver, "/")+"/_matrix/client/v3/rooms/"+
+			url.PathEscape(matrix.Room)+"/send/m.room.message/"+id, header, body, &result)
+		return result.EventID, err
+	}
+
+	return matrix.threads.notify(event, func(thread map[string]string) (map[string]string, error) {
+		body := content
+		if thread != nil {
+			body = map[string]any{"m.relates_to": map[string]any{
+				"rel_type":        "m.thread",
+				"event_id":        thread["event_id"],
+				"is_falling_back": true,
+				"m.in_reply_to":   map[string]string{"event_id": thread["event_id"]},
+			}}
+			for key, value := range content {
+				body[key] = value
+			}
+		}
+		id, err := send(body)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"event_id": id}, nil
+	}, func(thread map[string]string) error {
+		_, err := send(map[string]any{
+			"msgtype":       "m.text",
+			"body":          "* " + text,
+			"m.new_content": content,
+			"m.relates_to":  map[string]string{"rel_type": "m.replace", "event_id": thread["event_id"]},
+		})
+		return err
+	})
+}
+
+// chatThreads are the first messages of the unresolved problems posted to a chat, by host, type and subject.
+// A message is a map of the IDs the chat needs to reply to it and update it.
+type chatThreads struct {
+	mu       sync.Mutex
+	messages map[[3]string]map[string]string
+}
+
+// notify posts the event with post, in the thread of the first message of its problem if there is one. The first
+// message is updated with the resolved event by update, which is also posted in the thread.
+func (threads *chatThreads) notify(event Event, post func(thread map[string]string) (map[string]string, error),
+	update func(thread map[string]string) error) error {
+	threads.mu.Lock()
+	defer threads.mu.Unlock()
+
+	if threads.messages == nil {
+		threads.messages = map[[3]string]map[string]string{}
+	}
+	key := [3]string{event.Host, event.Type, event.Subject}
+	thread := threads.messages[key]
+
+	if thread == nil {
+		message, err := post(nil)
+		if err == nil && !event.Resolved {
+			threads.messages[key] = message
+		}
+		return err
+	}
+	if event.Resolved {
+		delete(threads.messages, key)
+		if err := update(thread); err != nil {
+			return err
+		}
+	}
+	_, err := post(thread)
+
+	return err
+}
+
+// chatMessage formats an event for a chat, the title in bold, followed by the site, group and tags of the device and
+// the metric of the rule with a sparkline of the values. bold formats the title in the markup of the chat and escape
+// escapes text for it, nil if the chat has no markup.
+func chatMessage(event Event, values []float64, bold func(string) string, escape func(string) string) string {
+	if escape == nil {
+		escape = func(s string) string { return s }
+	}
+	title := escape(eventSummary(event))
+	if bold != nil {
+		title = bold(title)
+	}
+	lines := []string{title}
+
+	var labels []string
+	if event.Site != "" {
+		labels = append(labels, "Site: "+event.Site)
+	}
+	if event.Group != "" {
+		labels = append(labels, "Group: "+event.Group)
+	}
+	if len(event.Tags) > 0 {
+		labels = append(labels, "Tags: "+strings.Join(event.Tags, ", "))
+	}
+	if len(labels) > 0 {
+		lines = append(lines, escape(strings.Join(labels, " · ")))
+	}
+	if event.Metric != "" {
+		line := "Metric: " + escape(event.Metric)
+		if len(values) > 1 {
+			line += " " + sparkline(values)
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// sparkline returns the values as a line of block characters, scaled from the lowest to the highest value.
+func sparkline(values []float64) string {
+	blocks := []rune("▁▂▃▄▅▆▇█")
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, value := range values {
+		low, high = math.Min(low, value), math.Max(high, value)
+	}
+
+	var b strings.Builder
+	for _, value := range values {
+		i := 0
+		if high > low {
+			i = int((value - low) / (high - low) * float64(len(blocks)-1))
+		}
+		b.WriteRune(blocks[i])
+	}
+
+	return b.String()
+}
+
+// chatValues returns the values of the metric of the event for a sparkline, none without a function.
+func chatValues(values func(event Event) []float64, event Event) []float64 {
+	if values == nil || event.Metric == "" {
+		return nil
+	}
+
+	return values(event)
+}
+
+// ruleHistoryKeys are the prefixes of the keys of the history by the metrics of rules which are recorded.
+var ruleHistoryKeys = map[string]string{
+	"down":        "up",
+	"cpu":         "cpu_load_percent",
+	"temperature": "temperature_celsius",
+	"snmp_rtt_ms": "snmp_rtt_seconds",
+}
+
+// RecentValues returns up to the last 20 values of the metric of an event within the last hour from the history,
+// e.g. for a sparkline in a chat message. Events of metrics which aren't recorded have none.
+func (monitor *Monitor) RecentValues(event Event) []float64 {
+	prefix, found := ruleHistoryKeys[event.Metric]
+	if monitor.History == nil || !found {
+		return nil
+	}
+
+	samples := monitor.History.Get(prefix+":"+event.Host, event.Time.Add(-time.Hour), event.Time)
+	if len(samples) > 20 {
+		samples = samples[len(samples)-20:]
+	}
+	values := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		values = append(values, sample.Value)
+	}
+
+	return values
+}
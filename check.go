@@ -0,0 +1,167 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Return codes of Nagios plugins, the states of the result of a Check.
+const (
+	CheckOK       = 0
+	CheckWarning  = 1
+	CheckCritical = 2
+	CheckUnknown  = 3
+)
+
+// checkStates are the names of the return codes in the output of a check.
+var checkStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// checkUnits are the units of measurement of the RuleMetrics in the perfdata, metrics without unit are missing.
+var checkUnits = map[string]string{
+	"cpu":             "%",
+	"snmp_rtt_ms":     "ms",
+	"ping_loss":       "%",
+	"conntrack_usage": "%",
+	"disk_usage":      "%",
+	"memory_usage":    "%",
+}
+
+// NagiosRange is a threshold range of the Nagios plugin guidelines, [@]start:end, e.g. "80" for values outside
+// of 0 to 80, "10:" for values below 10, "~:10" for values above 10 and "@10:20" for values inside of 10 to 20.
+type NagiosRange struct {
+	Start  float64
+	End    float64
+	Inside bool
+	text   string
+}
+
+// ParseNagiosRange parses a threshold range, an empty range never alerts.
+func ParseNagiosRange(value string) (NagiosRange, error) {
+	r := NagiosRange{Start: math.Inf(-1), End: math.Inf(1), text: value}
+	if value == "" {
+		return r, nil
+	}
+
+	text := value
+	if strings.HasPrefix(text, "@") {
+		r.Inside, text = true, text[1:]
+	}
+	start, end, found := strings.Cut(text, ":")
+	if !found {
+		start, end = "0", text
+	}
+	var err error
+	if start != "~" {
+		if r.Start, err = strconv.ParseFloat(start, 64); err != nil {
+			return r, fmt.Errorf("invalid range %q", value)
+		}
+	}
+	if end != "" {
+		if r.End, err = strconv.ParseFloat(end, 64); err != nil {
+			return r, fmt.Errorf("invalid range %q", value)
+		}
+	}
+	if r.Start > r.End {
+		return r, fmt.Errorf("invalid range %q, start is greater than end", value)
+	}
+
+	return r, nil
+}
+
+// Alert returns true if the value is outside of the range, or inside of it if the range starts with @.
+func (r NagiosRange) Alert(value float64) bool {
+	inside := value >= r.Start && value <= r.End
+
+	return inside == r.Inside
+}
+
+// String returns the range as it was parsed, as it is written to the perfdata.
+func (r NagiosRange) String() string {
+	return r.text
+}
+
+// CheckResult is the result of a Check: the return code and the line Nagios plugins print, the status text
+// followed by the perfdata.
+type CheckResult struct {
+	Status int
+	Output string
+}
+
+// Check polls a device once and checks the value of one of the RuleMetrics against the warning and critical
+// ranges like a Nagios plugin, so the monitor can be used as check command of Nagios or Icinga2.
+// The device is the host of a device in the config or, if no host matches, the name the device reported, which
+// polls the devices one after the other until it is found. Metrics based on the previous poll, like
+// interface_errors, have no value within a single poll and are UNKNOWN, as are other metrics of unreachable devices.
+// Use the down metric to check if a device is reachable.
+func (devices Devices) Check(name string, metric string, warning string, critical string) CheckResult {
+	value, ok := RuleMetrics[metric]
+	if !ok {
+		return checkResult(CheckUnknown, "unknown metric %q", metric)
+	}
+	warn, err := ParseNagiosRange(warning)
+	if err != nil {
+		return checkResult(CheckUnknown, "warning %v", err)
+	}
+	crit, err := ParseNagiosRange(critical)
+	if err != nil {
+		return checkResult(CheckUnknown, "critical %v", err)
+	}
+
+	var device *Device
+	for i := range devices {
+		if devices[i].Host == name {
+			device = &devices[i]
+			device.checkPoll()
+			break
+		}
+	}
+	for i := 0; i < len(devices) && device == nil; i++ {
+		devices[i].checkPoll()
+		if devices[i].Name == name {
+			device = &devices[i]
+		}
+	}
+	if device == nil {
+		return checkResult(CheckUnknown, "device %s not found", name)
+	}
+
+	current, ok := value(Device{}, *device)
+	if !ok {
+		if device.LastError != "" {
+			return checkResult(CheckUnknown, "%s %s has no value: %s", device.publishKey(), metric, device.LastError)
+		}
+		return checkResult(CheckUnknown, "%s %s has no value", device.publishKey(), metric)
+	}
+
+	status := CheckOK
+	switch {
+	case crit.Alert(current):
+		status = CheckCritical
+	case warn.Alert(current):
+		status = CheckWarning
+	}
+	formatted := strconv.FormatFloat(current, 'f', -1, 64)
+	result := checkResult(status, "%s %s is %s%s", device.publishKey(), metric, formatted, checkUnits[metric])
+	result.Output += fmt.Sprintf(" | %s=%s%s;%s;%s", metric, formatted, checkUnits[metric], warn, crit)
+
+	return result
+}
+
+// checkPoll polls the device like a poll of the Monitor, without its notifications and history.
+func (device *Device) checkPoll() {
+	device.Reached = false
+	err := device.GetDevice()
+	device.LastPolled = time.Now()
+	device.LastError = ""
+	if err != nil {
+		device.LastError = err.Error()
+	}
+}
+
+// checkResult returns a result with the output "MIKROTIK <STATE> - <message>".
+func checkResult(status int, format string, args ...any) CheckResult {
+	return CheckResult{Status: status, Output: "MIKROTIK " + checkStates[status] + " - " + fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,714 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/mcules/MikrotikMonitor"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const usage = `usage: mikrotikmonitor <command> [flags]
+
+commands:
+  run        poll the devices of a config file periodically and store the history
+  poll       poll the devices of a config file once and print their state
+  inventory  poll the devices of a config file once and count them by model, version or other columns
+  check      poll a device once and check a metric like a Nagios plugin
+  upgrade    upgrade RouterOS of the outdated devices of a config file
+  export     dump the stored history for offline analysis
+  sla        report the availability, outages and MTTR of the devices from the stored history
+  log        print the entries of the event log, e.g. the changes via the HTTP API
+  anonymize  poll the devices once and write anonymized fleet statistics for sharing
+  secret     generate a key, encrypt a value or rotate the encrypted values of a config file
+  update     check for a newer release of the monitor and install it
+  version    print the version of the monitor
+
+Run "mikrotikmonitor <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "run":
+		err = run(os.Args[2:])
+	case "poll":
+		err = poll(os.Args[2:])
+	case "inventory":
+		err = inventory(os.Args[2:])
+	case "check":
+		os.Exit(check(os.Args[2:]))
+	case "upgrade":
+		err = upgrade(os.Args[2:])
+	case "export":
+		err = export(os.Args[2:])
+	case "sla":
+		err = sla(os.Args[2:])
+	case "log":
+		err = eventLog(os.Args[2:])
+	case "anonymize":
+		err = anonymize(os.Args[2:])
+	case "secret":
+		err = secret(os.Args[2:])
+	case "update":
+		err = update(os.Args[2:])
+	case "version":
+		fmt.Println(MikrotikMonitor.MonitorVersion)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run starts the monitor and blocks until SIGINT or SIGTERM is received.
+func run(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	config := flags.String("config", "devices.yml", "config file with the devices")
+	interval := flags.Duration("interval", time.Minute, "interval between two polls")
+	rate := flags.Float64("rate", 0, "maximum SNMP requests per second to all devices, unlimited if 0")
+	history := flags.String("history", "", "JSON lines file to store the history in, kept in memory only if empty")
+	retention := flags.Duration("retention", 30*24*time.Hour, "how long samples are kept in the history")
+	state := flags.String("state", "", "JSON file to save the state of the devices and alerts in across restarts, disabled if empty")
+	feed := flags.Bool("feed", false, "check for updates against the MikroTik upgrade feed")
+	advisories := flags.String("advisories", "", "URL of a JSON feed of advisories extending the built-in CVE and end of life advisories")
+	traps := flags.String("traps", "", "UDP address to receive SNMP traps on, e.g. :162, disabled if empty")
+	syslog := flags.String("syslog", "", "UDP and TCP address to receive the remote logging of the devices on, e.g. :514, disabled if empty")
+	listen := flags.String("listen", "", "TCP address of the HTTP API, e.g. :8080, disabled if empty")
+	tlsCert := flags.String("tls-cert", "", "PEM file with the certificate chain to serve the HTTP API with HTTPS, requires -tls-key")
+	tlsKey := flags.String("tls-key", "", "PEM file with the key of the -tls-cert certificate")
+	acmeDomains := flags.String("acme", "", "comma separated domains to serve the HTTP API with HTTPS for, with certificates obtained via ACME, e.g. from Let's Encrypt")
+	acmeEmail := flags.String("acme-email", "", "contact email address of the ACME account")
+	acmeCache := flags.String("acme-cache", "acme", "directory to store the ACME account and certificates in")
+	acmeDirectory := flags.String("acme-directory", MikrotikMonitor.LetsEncryptURL, "directory URL of the ACME server")
+	updateCheck := flags.Bool("update-check", false, "log once a day if a newer release of the monitor is available")
+	natsAddress := flags.String("nats", "", "NATS server to publish the results to, e.g. localhost:4222, disabled if empty")
+	natsSubject := flags.String("nats-subject", "mikrotik.results", "NATS subject prefix, the name of the device is appended")
+	kafkaBrokers := flags.String("kafka", "", "comma separated Kafka brokers to publish the results to, disabled if empty")
+	kafkaTopic := flags.String("kafka-topic", "mikrotik-results", "Kafka topic of the results, partitioned by device name")
+	encoding := flags.String("publish-encoding", MikrotikMonitor.EncodingJSON, "encoding of published results: json or avro")
+	publishSites := flags.String("publish-sites", "", "comma separated sites whose results are published to NATS, Kafka, Zabbix and OTLP, all sites if empty")
+	zabbix := flags.String("zabbix", "", "Zabbix server or proxy to send the results to, e.g. zabbix:10051, disabled if empty")
+	zabbixDiscovery := flags.String("zabbix-discovery-host", "", "Zabbix host which discovers all devices, disabled if empty")
+	otlp := flags.String("otlp", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP endpoint to export metrics and traces to, e.g. http://localhost:4318, disabled if empty")
+	_ = flags.Parse(args)
+
+	var tlsConfig *tls.Config
+	switch {
+	case *tlsCert != "" && *acmeDomains != "":
+		return fmt.Errorf("-tls-cert and -acme are mutually exclusive")
+	case (*tlsCert == "") != (*tlsKey == ""):
+		return fmt.Errorf("-tls-cert and -tls-key must be given together")
+	case *tlsCert != "":
+		var err error
+		if tlsConfig, err = MikrotikMonitor.CertificateFiles(*tlsCert, *tlsKey); err != nil {
+			return err
+		}
+	case *acmeDomains != "":
+		acme := MikrotikMonitor.NewACME(*acmeCache, strings.Split(*acmeDomains, ",")...)
+		acme.Email, acme.Directory = *acmeEmail, *acmeDirectory
+		tlsConfig = acme.TLSConfig()
+	}
+
+	monitor := MikrotikMonitor.NewMonitor(*config, *interval)
+	monitor.RateLimit = *rate
+	monitor.StateFile = *state
+	if *history != "" {
+		stored, err := MikrotikMonitor.OpenHistory(*history, *retention)
+		if err != nil {
+			return err
+		}
+		defer stored.Close()
+		monitor.History = stored
+	}
+
+	if *advisories != "" {
+		monitor.Advisories = MikrotikMonitor.NewAdvisoryFeed(*advisories)
+	}
+	if *feed {
+		monitor.Feed = MikrotikMonitor.NewReleaseFeed()
+	}
+
+	publish := func(publisher MikrotikMonitor.Publisher) {
+		if *publishSites != "" {
+			publisher = MikrotikMonitor.SitePublisher{Sites: strings.Split(*publishSites, ","), Publisher: publisher}
+		}
+		monitor.Publish(publisher)
+	}
+	if *natsAddress != "" {
+		publisher := MikrotikMonitor.NewNATSPublisher(*natsAddress, *natsSubject)
+		publisher.Encoding = *encoding
+		publisher.User, publisher.Password = os.Getenv("NATS_USER"), os.Getenv("NATS_PASSWORD")
+		publisher.Token = os.Getenv("NATS_TOKEN")
+		defer publisher.Close()
+		publish(publisher)
+	}
+	if *kafkaBrokers != "" {
+		publisher := MikrotikMonitor.NewKafkaPublisher(strings.Split(*kafkaBrokers, ","), *kafkaTopic)
+		publisher.Encoding = *encoding
+		defer publisher.Close()
+		publish(publisher)
+	}
+	if *zabbix != "" {
+		sender := MikrotikMonitor.NewZabbixSender(*zabbix)
+		sender.DiscoveryHost, sender.Devices = *zabbixDiscovery, monitor.Devices
+		publish(sender)
+	}
+	if *otlp != "" {
+		exporter := MikrotikMonitor.NewOTLPExporter(*otlp)
+		// e.g. "authorization=Bearer token,x-scope-orgid=ops" like the OpenTelemetry SDKs
+		for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+			if key, value, found := strings.Cut(header, "="); found {
+				exporter.Headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+		publish(exporter)
+	}
+
+	if err := monitor.Start(); err != nil {
+		return err
+	}
+
+	if *traps != "" {
+		listener := MikrotikMonitor.NewTrapListener(monitor)
+		defer listener.Close()
+		go func() {
+			if err := listener.Listen(*traps); err != nil {
+				log.Println(err.Error())
+			}
+		}()
+	}
+
+	if *syslog != "" {
+		listener := MikrotikMonitor.NewSyslogListener(monitor)
+		defer listener.Close()
+		for _, listen := range []func(string) error{listener.ListenUDP, listener.ListenTCP} {
+			go func(listen func(string) error) {
+				if err := listen(*syslog); err != nil {
+					log.Println(err.Error())
+				}
+			}(listen)
+		}
+	}
+
+	if *listen != "" {
+		server := &http.Server{Addr: *listen, Handler: monitor.Handler(), TLSConfig: tlsConfig, ReadHeaderTimeout: 10 * time.Second}
+		defer server.Close()
+		go func() {
+			serve := server.ListenAndServe
+			if tlsConfig != nil {
+				serve = func() error { return server.ListenAndServeTLS("", "") }
+			}
+			if err := serve(); err != nil && err != http.ErrServerClosed {
+				log.Println(err.Error())
+			}
+		}()
+	}
+
+	if *updateCheck {
+		updater, err := MikrotikMonitor.NewUpdater(MikrotikMonitor.DefaultUpdateRepository, "")
+		if err != nil {
+			return err
+		}
+		go func() {
+			for ; ; time.Sleep(24 * time.Hour) {
+				release, newer, err := updater.Check()
+				if err != nil {
+					log.Println(err.Error())
+				} else if newer {
+					log.Printf("monitor %s is available, running %s, see %s", release.Version, MikrotikMonitor.MonitorVersion, release.URL)
+				}
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	monitor.Stop()
+
+	return nil
+}
+
+// export writes the stored history of a time range in the requested format.
+func export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	history := flags.String("history", "history.jsonl", "JSON lines file with the stored history")
+	from := flags.String("from", "", "start of the range, RFC 3339 or YYYY-MM-DD, open if empty")
+	to := flags.String("to", "", "end of the range, RFC 3339 or YYYY-MM-DD, open if empty")
+	format := flags.String("format", "csv", "output format: csv, jsonl or parquet")
+	output := flags.String("output", "", "output file, standard output if empty")
+	_ = flags.Parse(args)
+
+	start, err := parseTime(*from)
+	if err != nil {
+		return err
+	}
+	end, err := parseTime(*to)
+	if err != nil {
+		return err
+	}
+
+	stored, err := MikrotikMonitor.LoadHistory(*history, 0)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	return stored.Export(w, start, end, *format)
+}
+
+// sla writes the availability report of the devices for a range of the stored history. With a config file
+// the report is limited to its devices and has their groups.
+func sla(args []string) error {
+	flags := flag.NewFlagSet("sla", flag.ExitOnError)
+	history := flags.String("history", "history.jsonl", "JSON lines file with the stored history")
+	config := flags.String("config", "", "config file with the devices and their groups, all devices of the history if empty")
+	from := flags.String("from", "", "start of the range, RFC 3339 or YYYY-MM-DD, open if empty")
+	to := flags.String("to", "", "end of the range, RFC 3339 or YYYY-MM-DD, open if empty")
+	format := flags.String("format", "csv", "output format: csv, json or html")
+	output := flags.String("output", "", "output file, standard output if empty")
+	_ = flags.Parse(args)
+
+	start, err := parseTime(*from)
+	if err != nil {
+		return err
+	}
+	end, err := parseTime(*to)
+	if err != nil {
+		return err
+	}
+
+	var devices MikrotikMonitor.Devices
+	if *config != "" {
+		if err := devices.LoadConfig(*config); err != nil {
+			return err
+		}
+	}
+	stored, err := MikrotikMonitor.LoadHistory(*history, 0)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	return stored.SLAReport(devices, start, end).Write(w, *format)
+}
+
+// eventLog prints the entries of the event log of a config file selected by the flags, one per line.
+func eventLog(args []string) error {
+	flags := flag.NewFlagSet("log", flag.ExitOnError)
+	config := flags.String("config", "devices.yml", "config file with the event_log block")
+	file := flags.String("file", "", "JSON lines file of the event log, the file of the config file if empty")
+	since := flags.Duration("since", 0, "only entries of this last duration, e.g. 24h, overrides from")
+	from := flags.String("from", "", "start of the range, RFC 3339 or YYYY-MM-DD, open if empty")
+	to := flags.String("to", "", "end of the range, RFC 3339 or YYYY-MM-DD, open if empty")
+	var query MikrotikMonitor.LogQuery
+	flags.StringVar(&query.Kind, "kind", "", "only entries of this kind: event, alert, upgrade, reload or api")
+	flags.StringVar(&query.Host, "host", "", "only entries of the device with this host")
+	flags.StringVar(&query.Site, "site", "", "only entries of the devices of this site")
+	flags.StringVar(&query.User, "user", "", "only changes via the HTTP API of this user")
+	format := flags.String("format", "text", "output format: text or json for JSON lines")
+	_ = flags.Parse(args)
+
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+	var err error
+	if query.From, err = parseTime(*from); err != nil {
+		return err
+	}
+	if query.To, err = parseTime(*to); err != nil {
+		return err
+	}
+	if *since > 0 {
+		query.From = time.Now().Add(-*since)
+	}
+	if *file == "" {
+		eventLog, err := MikrotikMonitor.LoadEventLog(*config)
+		if err != nil {
+			return err
+		}
+		if eventLog == nil || eventLog.File == "" {
+			return fmt.Errorf("no event_log file in config file %s", *config)
+		}
+		*file = eventLog.File
+	}
+
+	entries, err := MikrotikMonitor.ReadEventLog(*file, query)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	for _, entry := range entries {
+		if *format == "json" {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Time.Local().Format(time.RFC3339), entry.Kind, entry.Action,
+			entry.Severity, entry.Host, entry.User, entry.Message)
+	}
+
+	return nil
+}
+
+// poll polls the devices of a config file once and prints their state in the requested format.
+func poll(args []string) error {
+	flags := flag.NewFlagSet("poll", flag.ExitOnError)
+	config := flags.String("config", "devices.yml", "config file with the devices")
+	format := flags.String("format", "table", "output format: table, csv, json or yaml")
+	templateFile := flags.String("template", "", "text/template file to render the devices with instead of the format")
+	columns := flags.String("columns", "Host,Name,Reached,Model,Version.RouterOS,Uptime,LastError",
+		"comma separated columns of the table and csv formats, all columns if empty")
+	_ = flags.Parse(args)
+
+	monitor := MikrotikMonitor.NewMonitor(*config, 0)
+	monitor.Notifiers = nil
+	monitor.Quiet = true
+	if err := monitor.Reload(); err != nil {
+		return err
+	}
+	monitor.Poll()
+	devices := monitor.Devices()
+
+	var selected []string
+	if *columns != "" {
+		selected = strings.Split(*columns, ",")
+	}
+	var output string
+	switch {
+	case *templateFile != "":
+		tmpl, err := os.ReadFile(*templateFile)
+		if err != nil {
+			return err
+		}
+		if output, err = devices.Render(string(tmpl)); err != nil {
+			return err
+		}
+		fmt.Print(output)
+		return nil
+	case *format == "table":
+		output = devices.ResultTable(selected...)
+	case *format == "csv":
+		output = devices.ResultCSV(selected...)
+	case *format == "json":
+		output = devices.ResultJson() + "\n"
+	case *format == "yaml":
+		output = devices.ResultYAML()
+	default:
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+	if output == "" {
+		return fmt.Errorf("unable to render the devices as %s", *format)
+	}
+	fmt.Print(output)
+
+	return nil
+}
+
+// inventory polls the devices of a config file once and prints the number of devices per value of the columns.
+func inventory(args []string) error {
+	flags := flag.NewFlagSet("inventory", flag.ExitOnError)
+	config := flags.String("config", "devices.yml", "config file with the devices")
+	by := flags.String("by", "Hardware.BoardName,Capabilities.Major", "comma separated columns to count the devices by")
+	format := flags.String("format", "table", "output format: table, json or ansible for an Ansible inventory of the devices")
+	_ = flags.Parse(args)
+
+	monitor := MikrotikMonitor.NewMonitor(*config, 0)
+	monitor.Notifiers = nil
+	monitor.Quiet = true
+	if err := monitor.Reload(); err != nil {
+		return err
+	}
+	monitor.Poll()
+	devices := monitor.Devices()
+
+	switch *format {
+	case "table":
+		output, err := devices.ResultInventory(strings.Split(*by, ",")...)
+		if err != nil {
+			return err
+		}
+		fmt.Print(output)
+	case "json":
+		inventory, err := devices.Inventory(strings.Split(*by, ",")...)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(inventory)
+	case "ansible":
+		output, err := devices.AnsibleInventory()
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(output))
+	default:
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+
+	return nil
+}
+
+// check polls a device once, prints the result of the check of a metric like a Nagios plugin and returns its
+// return code. Log messages are discarded, Nagios and Icinga2 take the first line of the output as status.
+func check(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	config := flags.String("config", "devices.yml", "config file with the devices")
+	device := flags.String("device", "", "host or name of the device to check")
+	metric := flags.String("metric", "down", "metric to check, one of the metrics of the rules")
+	warn := flags.String("warn", "", "warning range, e.g. 80 for values above 80, never warns if empty")
+	crit := flags.String("crit", "", "critical range, e.g. 95 for values above 95, never critical if empty")
+	_ = flags.Parse(args)
+	log.SetOutput(io.Discard)
+
+	var devices MikrotikMonitor.Devices
+	if err := devices.LoadConfig(*config); err != nil {
+		fmt.Printf("MIKROTIK UNKNOWN - %v\n", err)
+		return MikrotikMonitor.CheckUnknown
+	}
+	result := devices.Check(*device, *metric, *warn, *crit)
+	fmt.Println(result.Output)
+
+	return result.Status
+}
+
+// upgrade polls the devices of a config file once, upgrades the outdated devices selected by the flags and prints
+// the result of every device. It fails if the upgrade of a device failed.
+func upgrade(args []string) error {
+	flags := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	config := flags.String("config", "devices.yml", "config file with the devices")
+	var plan MikrotikMonitor.UpgradePlan
+	flags.StringVar(&plan.Version, "version", "", "RouterOS version to upgrade to, the newest release of the update channel")
+	flags.StringVar(&plan.Channel, "channel", "", "update channel to set on the devices before, keeps their channel if empty")
+	flags.StringVar(&plan.Host, "host", "", "only upgrade the device with this host")
+	flags.StringVar(&plan.Site, "site", "", "only upgrade the devices of this site")
+	flags.StringVar(&plan.Group, "group", "", "only upgrade the devices of this group")
+	flags.StringVar(&plan.Tag, "tag", "", "only upgrade the devices with this tag")
+	flags.StringVar(&plan.Canary, "canary", "", "group upgraded first, the other devices are skipped if one of them fails")
+	flags.IntVar(&plan.Concurrency, "concurrency", 1, "number of devices upgraded at the same time")
+	flags.DurationVar(&plan.VerifyTimeout, "verify-timeout", 15*time.Minute, "time a device has to run the version after the install")
+	flags.BoolVar(&plan.DryRun, "dry-run", false, "only print the devices which would be upgraded")
+	_ = flags.Parse(args)
+
+	monitor := MikrotikMonitor.NewMonitor(*config, 0)
+	if err := monitor.Reload(); err != nil {
+		return err
+	}
+	monitor.Poll()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	results, err := monitor.Upgrade(ctx, plan)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		fmt.Printf("%s\t%s\t%s", result.Host, result.From, result.Result)
+		if result.Err != nil {
+			fmt.Printf("\t%v", result.Err)
+		}
+		fmt.Println()
+		if result.Result == MikrotikMonitor.UpgradeFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("upgrade of %d devices failed", failed)
+	}
+
+	return nil
+}
+
+// anonymize polls the devices of a config file and writes the anonymized export of their state.
+// With a sample duration the devices are polled twice to include the traffic rates.
+func anonymize(args []string) error {
+	flags := flag.NewFlagSet("anonymize", flag.ExitOnError)
+	config := flags.String("config", "devices.yml", "config file with the devices")
+	salt := flags.String("salt", os.Getenv("MIKROTIKMONITOR_SALT"), "secret salt of the hashes, keeps them stable across exports, random if empty")
+	sample := flags.Duration("sample", 0, "poll twice with this delay to include traffic rates, e.g. 10s")
+	output := flags.String("output", "", "output file, standard output if empty")
+	_ = flags.Parse(args)
+
+	monitor := MikrotikMonitor.NewMonitor(*config, 0)
+	monitor.Notifiers = nil
+	monitor.Quiet = true
+	if err := monitor.Reload(); err != nil {
+		return err
+	}
+	monitor.Poll()
+	if *sample > 0 {
+		time.Sleep(*sample)
+		monitor.Poll()
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	return MikrotikMonitor.Anonymizer{Salt: *salt}.Export(w, monitor.Devices())
+}
+
+// secret manages the encrypted values of a config file. keygen prints a new key, encrypt encrypts a value read from
+// standard input, so it doesn't end up in the shell history, and rotate encrypts all values of a config file with a new key.
+func secret(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: mikrotikmonitor secret keygen|encrypt|rotate [flags]")
+	}
+	flags := flag.NewFlagSet("secret "+args[0], flag.ExitOnError)
+	key := flags.String("key", os.Getenv(MikrotikMonitor.SecretKeyEnv), "base64 encoded key of the encrypted values")
+	config := flags.String("config", "devices.yml", "config file whose values are rotated")
+	newKey := flags.String("new-key", os.Getenv("MIKROTIKMONITOR_NEW_KEY"), "key the values are rotated to, generated if empty")
+	_ = flags.Parse(args[1:])
+
+	switch args[0] {
+	case "keygen":
+		generated, err := MikrotikMonitor.GenerateSecretKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(generated)
+	case "encrypt":
+		value, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		encrypted, err := MikrotikMonitor.EncryptSecret(*key, strings.TrimRight(string(value), "\r\n"))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("!secret %s\n", encrypted)
+	case "rotate":
+		if *newKey == "" {
+			generated, err := MikrotikMonitor.GenerateSecretKey()
+			if err != nil {
+				return err
+			}
+			*newKey = generated
+			fmt.Printf("new key: %s\n", generated)
+		}
+		rotated, err := MikrotikMonitor.RotateSecretsFile(*config, *key, *newKey)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rotated %d values of %s, set %s to the new key\n", rotated, *config, MikrotikMonitor.SecretKeyEnv)
+	default:
+		return fmt.Errorf("unknown secret command %q, use keygen, encrypt or rotate", args[0])
+	}
+
+	return nil
+}
+
+// update checks the GitHub releases for a newer version of the monitor and replaces the running binary with it.
+// The binary is only installed if the signature of its manifest is valid for the public key.
+func update(args []string) error {
+	flags := flag.NewFlagSet("update", flag.ExitOnError)
+	check := flags.Bool("check", false, "only report whether a newer release is available")
+	force := flags.Bool("force", false, "install the newest release even if it isn't newer")
+	repository := flags.String("repository", MikrotikMonitor.DefaultUpdateRepository, "GitHub repository of the releases")
+	key := flags.String("key", defaultUpdateKey(), "base64 encoded ed25519 public key the releases are signed with")
+	_ = flags.Parse(args)
+
+	updater, err := MikrotikMonitor.NewUpdater(*repository, *key)
+	if err != nil {
+		return err
+	}
+	release, newer, err := updater.Check()
+	if err != nil {
+		return err
+	}
+	if !newer && !*force {
+		fmt.Printf("monitor %s is up to date, newest release is %s\n", MikrotikMonitor.MonitorVersion, release.Version)
+		return nil
+	}
+	fmt.Printf("monitor %s is available, running %s\n", release.Version, MikrotikMonitor.MonitorVersion)
+	if *check {
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return err
+	}
+	if err := updater.Update(release, executable); err != nil {
+		return err
+	}
+	fmt.Printf("installed %s to %s, restart the monitor to run it\n", release.Version, executable)
+
+	return nil
+}
+
+// defaultUpdateKey returns the public key of the environment, or the one built into the binary.
+func defaultUpdateKey() string {
+	if key := os.Getenv("MIKROTIKMONITOR_UPDATE_KEY"); key != "" {
+		return key
+	}
+
+	return MikrotikMonitor.UpdatePublicKey
+}
+
+// parseTime parses an RFC 3339 timestamp or a date, an empty value is the zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use RFC 3339 or YYYY-MM-DD", value)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,239 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"time"
+)
+
+// Collector gathers one area of data of a device after the basic SNMP request of GetDevice succeeded.
+// Enabled decides whether the collector runs for a device, nil means always.
+// Timeout limits the time of all requests of the collector, devices can override it with their timeouts block.
+// Scalars returns the scalar OIDs the collector reads via SNMP, which are requested in batches together with the
+// basic request, the collector reads them with getScalars. OIDs whose Get has side effects, e.g. running a script, don't belong there.
+type Collector struct {
+	Name    string
+	Timeout time.Duration
+	Enabled func(device *Device) bool
+	Scalars func(device *Device) []string
+	Collect func(device *Device) error
+}
+
+// CollectorState is the circuit breaker state of a collector on a device.
+// After BreakerThreshold consecutive failures the collector is skipped until OpenUntil,
+// afterwards it is tried once again and closed on success.
+// LastRun and Duration are the start and the run time of the last run of the collector.
+type CollectorState struct {
+	Failures  int           `json:"Failures"`
+	OpenUntil time.Time     `json:"OpenUntil,omitempty"`
+	LastError string        `json:"LastError,omitempty"`
+	LastRun   time.Time     `json:"LastRun,omitempty"`
+	Duration  time.Duration `json:"Duration,omitempty"`
+}
+
+var (
+	// BreakerThreshold is the number of consecutive failures which open the circuit breaker of a collector.
+	BreakerThreshold = 3
+	// BreakerCooldown is the time a collector is skipped after its circuit breaker opened.
+	BreakerCooldown = 15 * time.Minute
+)
+
+// Collectors are run by GetDevice in this order.
+var Collectors = []Collector{
+	{Name: "interfaces", Timeout: 10 * time.Second, Enabled: usesSNMP, Collect: (*Device).GetInterfaces},
+	{
+		Name:    "queues",
+		Timeout: 30 * time.Second,
+		Enabled: func(device *Device) bool { return usesSNMP(device) || device.API.User != "" },
+		Collect: (*Device).GetQueues,
+	},
+	{
+		Name:    "wireless",
+		Timeout: 5 * time.Second,
+		Enabled: func(device *Device) bool { return device.Capabilities.Wireless != WirelessWiFi && usesSNMP(device) },
+		Collect: (*Device).GetWireless,
+	},
+	{
+		Name:    "capsman",
+		Timeout: 15 * time.Second,
+		Enabled: func(device *Device) bool { return usesSNMP(device) || device.API.User != "" },
+		Collect: (*Device).GetCAPsMAN,
+	},
+	{
+		Name:    "health",
+		Timeout: 10 * time.Second,
+		Enabled: func(device *Device) bool { return usesSNMP(device) || device.API.User != "" },
+		Scalars: func(device *Device) []string {
+			if !usesSNMP(device) {
+				return nil
+			}
+			return []string{oidTemperature}
+		},
+		Collect: (*Device).GetHealth,
+	},
+	{
+		Name:    "storage",
+		Timeout: 10 * time.Second,
+		Enabled: func(device *Device) bool { return usesSNMP(device) || device.API.User != "" },
+		Collect: (*Device).GetStorage,
+	},
+	{
+		Name:    "hardware",
+		Timeout: 10 * time.Second,
+		Enabled: func(device *Device) bool { return usesSNMP(device) || device.API.User != "" },
+		Scalars: func(device *Device) []string {
+			if !usesSNMP(device) || device.API.User != "" {
+				return nil
+			}
+			return hardwareOIDs
+		},
+		Collect: (*Device).GetHardware,
+	},
+	{
+		Name:    "latency",
+		Timeout: 30 * time.Second,
+		Enabled: func(device *Device) bool { return device.Latency.Samples > 0 },
+		Collect: (*Device).MeasureLatency,
+	},
+	{Name: "provisioning", Timeout: 10 * time.Second, Collect: (*Device).GetProvisioning},
+	{Name: "audit", Timeout: 10 * time.Second, Collect: (*Device).GetAudit},
+	{
+		Name:    "script",
+		Timeout: 10 * time.Second,
+		Enabled: func(device *Device) bool { return device.Script.Active && usesSNMP(device) },
+		Collect: (*Device).GetScript,
+	},
+	{
+		Name:    "api",
+		Timeout: 10 * time.Second,
+		Enabled: func(device *Device) bool { return device.API.User != "" },
+		Collect: (*Device).GetAPI,
+	},
+	{
+		Name:    "tables",
+		Timeout: 30 * time.Second,
+		Enabled: func(device *Device) bool { return usesSNMP(device) || device.API.User != "" },
+		Collect: (*Device).GetTables,
+	},
+	{
+		Name:    "firewall",
+		Timeout: 15 * time.Second,
+		Enabled: func(device *Device) bool { return device.API.User != "" },
+		Collect: (*Device).GetFirewall,
+	},
+	{
+		Name:    "routing",
+		Timeout: 15 * time.Second,
+		Enabled: func(device *Device) bool { return usesSNMP(device) || device.API.User != "" },
+		Collect: (*Device).GetRouting,
+	},
+	{
+		Name:    "vpn",
+		Timeout: 15 * time.Second,
+		Enabled: func(device *Device) bool { return device.API.User != "" },
+		Collect: (*Device).GetVPN,
+	},
+	{
+		Name:    "sessions",
+		Timeout: 30 * time.Second,
+		Enabled: func(device *Device) bool { return device.API.User != "" },
+		Collect: (*Device).GetSessions,
+	},
+	{Name: "poe", Timeout: 10 * time.Second, Enabled: usesSNMP, Collect: (*Device).GetPOE},
+	{
+		Name:    "optics",
+		Timeout: 15 * time.Second,
+		Enabled: func(device *Device) bool { return usesSNMP(device) || device.API.User != "" },
+		Collect: (*Device).GetOptics,
+	},
+	{
+		Name:    "custom",
+		Timeout: 10 * time.Second,
+		Enabled: func(device *Device) bool { return usesSNMP(device) && len(device.OIDs) > 0 },
+		Scalars: (*Device).customOIDs,
+		Collect: (*Device).GetCustom,
+	},
+	{Name: "features", Timeout: 10 * time.Second, Enabled: func(device *Device) bool { return device.Backend != BackendSSH }, Collect: (*Device).GetFeatures},
+}
+
+// runs reports whether the collector is enabled for the device and its circuit breaker is closed.
+func (device *Device) runs(collector Collector) bool {
+	if collector.Enabled != nil && !collector.Enabled(device) || !device.profileEnabled(collector.Name) {
+		return false
+	}
+
+	return !time.Now().Before(device.Collectors[collector.Name].OpenUntil)
+}
+
+// usesSNMP reports whether the device is read via SNMP.
+func usesSNMP(device *Device) bool {
+	return device.Backend == "" || device.Backend == BackendSNMP
+}
+
+// collect runs all enabled collectors whose circuit breaker is closed, each with its own timeout.
+// A failing collector doesn't stop the others, its error is logged and recorded in the Collectors state.
+// Cancelling the context of the poll skips the remaining collectors without counting it as failure.
+func (device *Device) collect() {
+	device.Collectors = maps.Clone(device.Collectors)
+	if device.Collectors == nil {
+		device.Collectors = map[string]CollectorState{}
+	}
+	parent := device.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	defer func() {
+		device.ctx = parent
+		if device.snmp != nil {
+			device.snmp.Context = parent
+		}
+	}()
+
+	now := time.Now()
+	for _, collector := range Collectors {
+		if !device.runs(collector) {
+			continue
+		}
+
+		state := device.Collectors[collector.Name]
+
+		timeout := collector.Timeout
+		if override, ok := device.Timeouts[collector.Name]; ok {
+			timeout = override
+		}
+		ctx, cancel := context.WithTimeout(parent, timeout)
+		if device.snmp != nil {
+			device.snmp.Context = ctx
+		}
+		device.ctx = ctx
+		start := time.Now()
+		err := collector.Collect(device)
+		duration := time.Since(start)
+		timedOut := ctx.Err() != nil
+		cancel()
+		if parent.Err() != nil {
+			// the poll was cancelled, which is no failure of the collector
+			return
+		}
+		if err == nil && timedOut {
+			err = fmt.Errorf("%s collector %s timed out after %s", device.Host, collector.Name, timeout)
+		}
+
+		if err == nil {
+			device.Collectors[collector.Name] = CollectorState{LastRun: start, Duration: duration}
+			continue
+		}
+
+		log.Println(err.Error())
+		state.Failures++
+		state.LastError = err.Error()
+		state.LastRun, state.Duration = start, duration
+		if state.Failures >= BreakerThreshold {
+			state.OpenUntil = now.Add(BreakerCooldown)
+			log.Printf("%s collector %s disabled for %s after %d failures", device.Host, collector.Name, BreakerCooldown, state.Failures)
+		}
+		device.Collectors[collector.Name] = state
+	}
+}
@@ -0,0 +1,482 @@
+package MikrotikMonitor
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ValidationError describes a single problem of a device in the config file.
+// Line is the line of the device in the YAML file, or 0 if unknown. File is the file of the device
+// if the config consists of several files.
+type ValidationError struct {
+	File    string
+	Line    int
+	Host    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	prefix := ""
+	if e.File != "" {
+		prefix = e.File + " "
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("%sline %d: %s: %s", prefix, e.Line, e.Host, e.Message)
+	}
+	return fmt.Sprintf("%s%s: %s", prefix, e.Host, e.Message)
+}
+
+// configDocument is the parsed content of a config file.
+type configDocument struct {
+	file string
+	root *yaml.Node
+}
+
+// configFiles returns the files of a config, which is a file, a directory, whose .yml and .yaml files are read,
+// or a glob pattern like conf.d/*.yaml. The files are sorted by name.
+func configFiles(name string) ([]string, error) {
+	if info, err := os.Stat(name); err == nil {
+		if !info.IsDir() {
+			return []string{name}, nil
+		}
+		var files []string
+		for _, pattern := range []string{"*.yml", "*.yaml"} {
+			matches, _ := filepath.Glob(filepath.Join(name, pattern))
+			files = append(files, matches...)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no config files in directory %s", name)
+		}
+		sort.Strings(files)
+		return files, nil
+	} else if !strings.ContainsAny(name, "*?[") {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no config files match %s", name)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// readConfigDocuments reads and parses the files of a config, values tagged with !secret are decrypted.
+func readConfigDocuments(name string) ([]configDocument, error) {
+	files, err := configFiles(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file, %v", err)
+	}
+
+	var documents []configDocument
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config file, %v", err)
+		}
+		document, err := parseConfigDocument(name, file, content)
+		if err != nil {
+			return nil, err
+		}
+		if document != nil {
+			documents = append(documents, *document)
+		}
+	}
+
+	return documents, nil
+}
+
+// parseConfigDocument parses the content of a file of a config, references of environment variables like ${NAME} in
+// its values are expanded and values tagged with !secret are decrypted afterwards. An empty file returns nil.
+func parseConfigDocument(name string, file string, content []byte) (*configDocument, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, configParseError(name, file, err)
+	}
+	missing := map[string]bool{}
+	expandNodes(&document, missing)
+	if err := missingEnv(missing); err != nil {
+		return nil, configParseError(name, file, err)
+	}
+	if err := decryptSecrets(&document, os.Getenv(SecretKeyEnv)); err != nil {
+		return nil, configParseError(name, file, err)
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+	if document.Content[0].Kind != yaml.MappingNode {
+		return nil, configParseError(name, file, fmt.Errorf("the config has to be a mapping of blocks"))
+	}
+
+	return &configDocument{file: file, root: document.Content[0]}, nil
+}
+
+// configParseError wraps an error of a config file into ErrConfigParse, with the file if the config consists of several files.
+func configParseError(name string, file string, err error) error {
+	if file != name {
+		return fmt.Errorf("%w: %s: %w", ErrConfigParse, file, err)
+	}
+	return fmt.Errorf("%w: %w", ErrConfigParse, err)
+}
+
+// mergeDocuments merges the blocks of the config files in their order. Lists like devices or rules are concatenated,
+// mappings like snmp_defaults are merged key by key and other values are taken from the first file setting them.
+func mergeDocuments(documents []configDocument) *yaml.Node {
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, document := range documents {
+		for i := 0; i+1 < len(document.root.Content); i += 2 {
+			key, value := document.root.Content[i], document.root.Content[i+1]
+			existing := mappingValue(merged, key.Value)
+			switch {
+			case existing == nil:
+				if value.Kind == yaml.SequenceNode || value.Kind == yaml.MappingNode {
+					// the merged blocks must not modify the documents
+					clone := *value
+					clone.Content = slices.Clone(value.Content)
+					value = &clone
+				}
+				merged.Content = append(merged.Content, key, value)
+			case existing.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+				existing.Content = append(existing.Content, value.Content...)
+			case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+				mergeMapping(existing, value)
+			}
+		}
+	}
+
+	return merged
+}
+
+// decodeConfig decodes the blocks of the documents of a config into out like yaml.Unmarshal, the blocks of several
+// files are merged with mergeDocuments.
+func decodeConfig(documents []configDocument, out any) error {
+	if err := mergeDocuments(documents).Decode(out); err != nil {
+		return fmt.Errorf("%w: %w", ErrConfigParse, err)
+	}
+
+	return nil
+}
+
+// configStat returns the names, modification times and sizes of the files of a config, which change with any of the files.
+func configStat(name string) (string, error) {
+	files, err := configFiles(name)
+	if err != nil {
+		return "", err
+	}
+
+	var stat strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&stat, "%s %d %d\n", file, info.ModTime().UnixNano(), info.Size())
+	}
+
+	return stat.String(), nil
+}
+
+// UnmarshalYAML decodes a device from the config file and remembers its line for validation errors.
+func (device *Device) UnmarshalYAML(value *yaml.Node) error {
+	type plain Device
+	if err := value.Decode((*plain)(device)); err != nil {
+		return err
+	}
+	device.line = value.Line
+
+	return nil
+}
+
+// applyDefaults copies all settings of the defaults mapping into the snmp mapping of a device node,
+// which are not set there already. Nested mappings like authentication are merged key by key.
+func applyDefaults(device *yaml.Node, defaults *yaml.Node) {
+	if device.Kind != yaml.MappingNode || defaults.Kind != yaml.MappingNode {
+		return
+	}
+
+	snmp := mappingValue(device, "snmp")
+	if snmp == nil {
+		snmp = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: device.Line}
+		device.Content = append(device.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "snmp"}, snmp)
+	}
+	mergeMapping(snmp, defaults)
+}
+
+// mergeMapping adds all keys of src to dst which dst doesn't contain, mappings existing in both are merged recursively.
+func mergeMapping(dst *yaml.Node, src *yaml.Node) {
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		if existing := mappingValue(dst, key.Value); existing != nil {
+			mergeMapping(existing, value)
+			continue
+		}
+		dst.Content = append(dst.Content, key, value)
+	}
+}
+
+// mappingValue returns the value of a key in a mapping node, or nil if the key doesn't exist.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// location returns the file of the device for messages, empty if the config is a single file.
+func (device *Device) location() string {
+	if device.file == "" {
+		return ""
+	}
+	return " in " + device.file
+}
+
+// Validate checks the devices for configuration errors.
+// It reports duplicate hosts and names, empty or duplicate addresses, unknown SNMP versions, transports, protocols, backends and update channels, a missing community,
+// missing passphrases for active SNMPv3 authentication or privacy, unknown profiles and invalid or duplicate custom OIDs.
+// Devices with the ssh backend or an ssh block need SSH credentials and a hostkey or known_hosts.
+// All problems are returned together as joined ValidationError values, nil means the config is valid.
+func (devices *Devices) Validate() error {
+	var errs []error
+	hosts := map[string]int{}
+	names := map[string]int{}
+
+	for i, device := range *devices {
+		fail := func(format string, a ...any) {
+			errs = append(errs, &ValidationError{File: device.file, Line: device.line, Host: device.Host, Message: fmt.Sprintf(format, a...)})
+		}
+
+		if device.Host == "" {
+			fail("missing host")
+		} else if j, ok := hosts[device.Host]; ok {
+			fail("duplicate host, already used by device %d%s", j+1, (*devices)[j].location())
+		} else {
+			hosts[device.Host] = i
+		}
+		seen := map[string]bool{}
+		for _, address := range device.Addresses {
+			switch {
+			case address == "":
+				fail("empty address")
+			case seen[address]:
+				fail("duplicate address %s", address)
+			}
+			seen[address] = true
+		}
+
+		if device.Name != "" {
+			if j, ok := names[device.Name]; ok {
+				fail("duplicate name %s, already used by device %d%s", device.Name, j+1, (*devices)[j].location())
+			} else {
+				names[device.Name] = i
+			}
+		}
+
+		// devices read via the API or SSH don't need SNMP settings
+		if usesSNMP(&device) {
+			switch device.SNMP.Version {
+			case "", "2", "2c":
+				if device.SNMP.Community == "" {
+					fail("missing community for SNMP version 2c")
+				}
+			case "3":
+				if device.SNMP.Community == "" {
+					fail("missing user name (community) for SNMP version 3")
+				}
+			default:
+				fail("unknown SNMP version %q", device.SNMP.Version)
+			}
+			switch device.SNMP.Transport {
+			case "", "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+			default:
+				fail("unknown SNMP transport %q, use udp, tcp, udp6 or tcp6", device.SNMP.Transport)
+			}
+		}
+
+		switch device.Backend {
+		case "", BackendSNMP:
+		case BackendREST, BackendAPI:
+			if device.API.User == "" {
+				fail("missing api user for the %s backend", device.Backend)
+			}
+		case BackendSSH:
+			if device.SSH.User == "" {
+				fail("missing ssh user for the ssh backend")
+			}
+		default:
+			fail("unknown backend %q", device.Backend)
+		}
+		// upgrades and exports run via SSH as well, see usesSSH
+		if device.Backend == BackendSSH || device.SSH.User != "" {
+			if device.SSH.Password == "" && device.SSH.KeyFile == "" {
+				fail("missing ssh password or keyfile")
+			}
+			if device.SSH.HostKey == "" && device.SSH.KnownHosts == "" {
+				fail("missing ssh hostkey or known_hosts")
+			}
+		}
+
+		switch device.Channel {
+		case "", ChannelLongTerm, ChannelStable, ChannelTesting, ChannelDevelopment:
+		default:
+			fail("unknown update channel %q", device.Channel)
+		}
+
+		if retry := device.SNMP.Retry; retry.Attempts < 0 || retry.Delay < 0 || retry.MaxDelay < 0 {
+			fail("negative retry attempts or delay")
+		}
+
+		for _, profile := range device.Profiles {
+			if !knownProfile(profile) {
+				fail("unknown profile %q", profile)
+			}
+		}
+
+		customNames := map[string]bool{}
+		for _, custom := range device.OIDs {
+			for _, problem := range custom.validate() {
+				fail("%s", problem)
+			}
+			if customNames[custom.Name] {
+				fail("duplicate custom OID %s", custom.Name)
+			}
+			customNames[custom.Name] = true
+		}
+
+		serviceNames := map[string]bool{}
+		for _, check := range device.Services {
+			for _, problem := range check.validate() {
+				fail("%s", problem)
+			}
+			if serviceNames[check.Name] {
+				fail("duplicate service check %s", check.Name)
+			}
+			serviceNames[check.Name] = true
+		}
+
+		if auth := device.SNMP.Authentication; auth.Active {
+			if auth.Passphrase == "" {
+				fail("missing authentication passphrase")
+			}
+			if auth.Protocol != "" && auth.Protocol != "SHA1" && auth.Protocol != "MD5" {
+				fail("unknown authentication protocol %q", auth.Protocol)
+			}
+		}
+
+		if priv := device.SNMP.Privacy; priv.Active {
+			if priv.Passphrase == "" {
+				fail("missing privacy passphrase")
+			}
+			if priv.Protocol != "" && priv.Protocol != "DES" && priv.Protocol != "AES" {
+				fail("unknown privacy protocol %q", priv.Protocol)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ExpandEnv replaces ${NAME} references in the host, the SNMP credentials and the API and SSH passwords of the devices
+// and in the files of the credentials with the values of the corresponding environment variables, e.g. of devices
+// created in code. LoadConfig expands the references of the config file when it reads it.
+// It returns the sorted names of all referenced variables which are not set.
+func (devices *Devices) ExpandEnv() []string {
+	unique := map[string]bool{}
+	expand := func(value string) string {
+		return expandEnv(value, unique)
+	}
+
+	for i := range *devices {
+		device := &(*devices)[i]
+		device.Host = expand(device.Host)
+		for j, address := range device.Addresses {
+			device.Addresses[j] = expand(address)
+		}
+		device.SNMP.Community = expand(device.SNMP.Community)
+		device.SNMP.CommunityFile = expand(device.SNMP.CommunityFile)
+		device.SNMP.Authentication.PassphraseFile = expand(device.SNMP.Authentication.PassphraseFile)
+		device.SNMP.Privacy.PassphraseFile = expand(device.SNMP.Privacy.PassphraseFile)
+		device.API.PasswordFile = expand(device.API.PasswordFile)
+		device.SSH.PasswordFile = expand(device.SSH.PasswordFile)
+		device.SNMP.Authentication.Passphrase = expand(device.SNMP.Authentication.Passphrase)
+		device.SNMP.Privacy.Passphrase = expand(device.SNMP.Privacy.Passphrase)
+		device.API.Password = expand(device.API.Password)
+		device.SSH.Password = expand(device.SSH.Password)
+	}
+
+	missing := make([]string, 0, len(unique))
+	for name := range unique {
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+
+	return missing
+}
+
+// envReference is a reference of an environment variable, ${NAME}.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${NAME} references in the value with the environment variables, any other $ is kept as it is,
+// e.g. in a password. The names of the variables which are not set are added to missing unless it is nil.
+func expandEnv(value string, missing map[string]bool) string {
+	return envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReference.FindStringSubmatch(reference)[1]
+		env, ok := os.LookupEnv(name)
+		if !ok && missing != nil {
+			missing[name] = true
+		}
+		return env
+	})
+}
+
+// missingEnv returns the error of the referenced environment variables which are not set, nil if there are none.
+func missingEnv(missing map[string]bool) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return fmt.Errorf("missing environment variables in config file: %s", strings.Join(names, ", "))
+}
+
+// expandNodes expands the references of environment variables in the values of the node and its children, see
+// expandEnv. Values tagged with !secret are left to decryptSecrets, their plaintext is never expanded.
+func expandNodes(node *yaml.Node, missing map[string]bool) {
+	if node.Kind == yaml.ScalarNode && node.Tag != secretTag {
+		if value := expandEnv(node.Value, missing); value != node.Value {
+			node.Value = value
+			if node.Style == 0 {
+				// plain values are resolved again, e.g. port: ${SNMP_PORT} is a number
+				node.Tag = ""
+			}
+		}
+	}
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			// keys aren't expanded
+			continue
+		}
+		expandNodes(child, missing)
+	}
+}
@@ -0,0 +1,108 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Types of custom OIDs.
+const (
+	CustomGauge   = "gauge"
+	CustomCounter = "counter"
+)
+
+var customNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// CustomOID is an additional numeric OID read in every poll, e.g. a sensor of a niche device which the monitor
+// doesn't know. The value is multiplied by Scale, zero means 1, and stored in Device.Custom under Name.
+// Type is gauge or counter, Unit is informational, e.g. "volts".
+// Custom OIDs of the top-level custom_oids block apply to all devices with the Tag and in the Group, empty matches all.
+type CustomOID struct {
+	Name  string  `json:"Name"`
+	OID   string  `json:"OID"`
+	Type  string  `json:"Type"`
+	Scale float64 `json:"Scale"`
+	Unit  string  `json:"Unit"`
+	Tag   string  `json:"Tag"`
+	Group string  `json:"Group"`
+}
+
+// matches reports whether a custom OID of the top-level block applies to the device.
+func (custom CustomOID) matches(device Device) bool {
+	return (custom.Group == "" || custom.Group == device.Group) && (custom.Tag == "" || slices.Contains(device.Tags, custom.Tag))
+}
+
+// validate returns the problems of a custom OID.
+func (custom CustomOID) validate() []string {
+	var problems []string
+	if !customNamePattern.MatchString(custom.Name) {
+		problems = append(problems, fmt.Sprintf("invalid custom OID name %q, use lower case letters, digits and underscores", custom.Name))
+	}
+	if strings.Trim(custom.OID, ".0123456789") != "" || strings.Trim(custom.OID, ".") == "" {
+		problems = append(problems, fmt.Sprintf("invalid OID %q of custom OID %s", custom.OID, custom.Name))
+	}
+	switch custom.Type {
+	case "", CustomGauge, CustomCounter:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown type %q of custom OID %s", custom.Type, custom.Name))
+	}
+
+	return problems
+}
+
+// GetCustom reads the custom OIDs of the device. OIDs the device doesn't know are missing in Custom.
+// The SNMP connection of the device has to be established already.
+func (device *Device) GetCustom() error {
+	variables, err := device.getScalars(device.customOIDs())
+	if err != nil {
+		return fmt.Errorf("%s unable to read custom OIDs: %v", device.Host, err)
+	}
+
+	values := map[string]float64{}
+	for i, variable := range variables {
+		value, ok := customValue(variable)
+		if !ok {
+			// OIDs the device doesn't know have no value
+			continue
+		}
+		scale := device.OIDs[i].Scale
+		if scale == 0 {
+			scale = 1
+		}
+		values[device.OIDs[i].Name] = value * scale
+	}
+	device.Custom = values
+
+	return nil
+}
+
+// customOIDs returns the OIDs of the custom OIDs of the device with a leading dot, like the agent returns them.
+func (device *Device) customOIDs() []string {
+	oids := make([]string, len(device.OIDs))
+	for i, custom := range device.OIDs {
+		oids[i] = "." + strings.TrimPrefix(custom.OID, ".")
+	}
+
+	return oids
+}
+
+// customValue returns the numeric value of a variable, strings like "12.5" are parsed.
+func customValue(variable gosnmp.SnmpPDU) (float64, bool) {
+	if variable.Type == gosnmp.OctetString {
+		value, err := AsString(variable)
+		if err != nil {
+			return 0, false
+		}
+		var number float64
+		if _, err := fmt.Sscan(strings.TrimSpace(value), &number); err != nil {
+			return 0, false
+		}
+		return number, true
+	}
+	value, err := AsFloat(variable)
+
+	return value, err == nil
+}
@@ -0,0 +1,186 @@
+package MikrotikMonitor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// EventFlapping is the type of events raised when the reachability of a device starts or stops flapping.
+const EventFlapping = "Flapping"
+
+// Dampening are the settings which stop unstable devices, e.g. behind a wireless link, from raising alert storms.
+// A device is down after Down consecutive failed polls and up again after Up consecutive successful polls,
+// default 1. Every change between up and down adds 1 to the penalty of the device, which halves every HalfLife,
+// default 15m. Once the penalty reaches Suppress the device is flapping: its state is held until the penalty decayed
+// below Reuse, default half of Suppress, so the more it flaps the longer it is suppressed. Zero Suppress disables it.
+type Dampening struct {
+	Down     int
+	Up       int
+	HalfLife time.Duration `yaml:"half_life"`
+	Suppress float64
+	Reuse    float64
+}
+
+// DampeningConfig is the dampening block of the config file, the settings of the first tag of a device found in Tags
+// override the global ones.
+type DampeningConfig struct {
+	Dampening `yaml:",inline"`
+	Tags      map[string]Dampening
+}
+
+// Availability is the dampened reachability of a device as kept by the monitor. Down is the state alerts are
+// based on, Failing the state after the Down and Up polls of the Dampening, which Down follows unless it is Suppressed.
+// Since is the time Down changed last.
+type Availability struct {
+	Down       bool      `json:"Down"`
+	Since      time.Time `json:"Since"`
+	Failing    bool      `json:"Failing"`
+	Failures   int       `json:"Failures"`
+	Successes  int       `json:"Successes"`
+	Penalty    float64   `json:"Penalty"`
+	Suppressed bool      `json:"Suppressed"`
+	Updated    time.Time `json:"Updated"`
+}
+
+// LoadDampening reads the dampening block of the config file and validates it, nil if the block is missing.
+func LoadDampening(filename string) (*DampeningConfig, error) {
+	documents, err := readConfigDocuments(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadDampening(documents)
+}
+
+// loadDampening is LoadDampening with the parsed documents of the config files.
+func loadDampening(documents []configDocument) (*DampeningConfig, error) {
+	var parser struct {
+		Dampening *DampeningConfig `yaml:"dampening"`
+	}
+
+	if err := decodeConfig(documents, &parser); err != nil {
+		return nil, err
+	}
+	if parser.Dampening == nil {
+		return nil, nil
+	}
+
+	errs := []error{parser.Dampening.validate()}
+	for tag, dampening := range parser.Dampening.Tags {
+		if err := dampening.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("tag %s: %v", tag, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid dampening in config file:\n%v", err)
+	}
+
+	return parser.Dampening, nil
+}
+
+// validate checks the settings.
+func (dampening Dampening) validate() error {
+	switch {
+	case dampening.Down < 0 || dampening.Up < 0:
+		return fmt.Errorf("negative number of polls")
+	case dampening.HalfLife < 0:
+		return fmt.Errorf("negative half_life %s", dampening.HalfLife)
+	case dampening.Suppress < 0 || dampening.Reuse < 0:
+		return fmt.Errorf("negative penalty")
+	case dampening.Reuse > 0 && dampening.Reuse >= dampening.Suppress:
+		return fmt.Errorf("reuse %g isn't below suppress %g", dampening.Reuse, dampening.Suppress)
+	}
+
+	return nil
+}
+
+// settings returns the dampening of the device, the global settings overridden by the first of its tags with settings.
+func (config *DampeningConfig) settings(device Device) Dampening {
+	if config == nil {
+		return Dampening{}
+	}
+
+	dampening := config.Dampening
+	for _, tag := range device.Tags {
+		override, found := config.Tags[tag]
+		if !found {
+			continue
+		}
+		if override.Down != 0 {
+			dampening.Down = override.Down
+		}
+		if override.Up != 0 {
+			dampening.Up = override.Up
+		}
+		if override.HalfLife != 0 {
+			dampening.HalfLife = override.HalfLife
+		}
+		if override.Suppress != 0 {
+			dampening.Suppress, dampening.Reuse = override.Suppress, override.Reuse
+		}
+		break
+	}
+
+	return dampening
+}
+
+// update applies a poll of the device, reached or not, at the given time.
+func (availability *Availability) update(reached bool, dampening Dampening, now time.Time) {
+	halfLife := dampening.HalfLife
+	if halfLife == 0 {
+		halfLife = 15 * time.Minute
+	}
+	if !availability.Updated.IsZero() {
+		availability.Penalty *= math.Pow(0.5, now.Sub(availability.Updated).Seconds()/halfLife.Seconds())
+	}
+	availability.Updated = now
+
+	if reached {
+		availability.Successes++
+		availability.Failures = 0
+	} else {
+		availability.Failures++
+		availability.Successes = 0
+	}
+	switch {
+	case !availability.Failing && availability.Failures >= max(dampening.Down, 1),
+		availability.Failing && availability.Successes >= max(dampening.Up, 1):
+		availability.Failing = !availability.Failing
+		availability.Penalty++
+	}
+
+	reuse := dampening.Reuse
+	if reuse == 0 {
+		reuse = dampening.Suppress / 2
+	}
+	switch {
+	case dampening.Suppress == 0:
+		availability.Suppressed = false
+	case !availability.Suppressed && availability.Penalty >= dampening.Suppress:
+		availability.Suppressed = true
+	case availability.Suppressed && availability.Penalty < reuse:
+		availability.Suppressed = false
+	}
+
+	if !availability.Suppressed && availability.Down != availability.Failing {
+		availability.Down = availability.Failing
+		availability.Since = now
+	}
+}
+
+// flappingChanges returns the event of a device which started or stopped flapping with the poll.
+func flappingChanges(previous, current Device) []Event {
+	switch {
+	case current.Availability.Suppressed && !previous.Availability.Suppressed:
+		return []Event{current.NewEvent(EventFlapping, SeverityWarning, "",
+			fmt.Sprintf("reachability is flapping, penalty %.1f, changes are suppressed", current.Availability.Penalty))}
+	case !current.Availability.Suppressed && previous.Availability.Suppressed:
+		event := current.NewEvent(EventFlapping, SeverityWarning, "", "reachability is stable again")
+		event.Resolved = true
+		return []Event{event}
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package MikrotikMonitor
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// dashboardHTML is the single page of the web dashboard, it reads the devices and the history from the HTTP API.
+//
+//go:embed dashboard/index.html
+var dashboardHTML []byte
+
+// dashboardHandler serves the web dashboard at the root of the HTTP API, other unknown paths are not found.
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(dashboardHTML)
+}
@@ -0,0 +1,344 @@
+package MikrotikMonitor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// configFile is a file of the config as written, values tagged with !secret are still encrypted.
+type configFile struct {
+	name     string
+	content  []byte
+	document yaml.Node
+}
+
+// AddDevice adds a device to the config and polls it right away. The config of the device is YAML or JSON like an
+// entry of the devices list of the config file, e.g. {"host": "10.0.0.5", "snmp": {"community": "public"}}. It is
+// appended to the config file, or to the first file with a devices list if the config consists of several files.
+// The config is validated with the device before the file is replaced atomically, comments of the file are kept.
+// Credentials are encrypted with !secret if SecretKeyEnv is set. The returned device is the device as configured.
+func (monitor *Monitor) AddDevice(config []byte) (Device, error) {
+	node, host, err := parseDeviceConfig(config, "")
+	if err != nil {
+		return Device{}, err
+	}
+	if _, found := monitor.Device(host); found {
+		return Device{}, ErrDeviceExists
+	}
+
+	return monitor.editDevice(host, func(files []*configFile) (*configFile, error) {
+		var target *configFile
+		for _, file := range files {
+			list := file.devices(false)
+			if list == nil {
+				continue
+			}
+			if deviceIndex(list, host) >= 0 {
+				return nil, ErrDeviceExists
+			}
+			if target == nil {
+				target = file
+			}
+		}
+		if target == nil {
+			target = files[0]
+		}
+		list := target.devices(true)
+		if list == nil {
+			return nil, fmt.Errorf("%w: devices of %s is no list", ErrInvalidDevice, target.name)
+		}
+		list.Content = append(list.Content, node)
+		return target, nil
+	})
+}
+
+// UpdateDevice replaces the config of the device with the host by config in the file it is configured in, see
+// AddDevice. The host of the config can be omitted, but not changed.
+func (monitor *Monitor) UpdateDevice(host string, config []byte) (Device, error) {
+	node, _, err := parseDeviceConfig(config, host)
+	if err != nil {
+		return Device{}, err
+	}
+
+	return monitor.editDevice(host, func(files []*configFile) (*configFile, error) {
+		file, list, index, err := monitor.findDevice(files, host)
+		if err != nil {
+			return nil, err
+		}
+		node.HeadComment = list.Content[index].HeadComment
+		list.Content[index] = node
+		return file, nil
+	})
+}
+
+// PatchDevice changes the settings of config in the config of the device with the host, the other settings are kept,
+// e.g. the credentials, see UpdateDevice.
+func (monitor *Monitor) PatchDevice(host string, config []byte) (Device, error) {
+	node, _, err := parseDeviceConfig(config, host)
+	if err != nil {
+		return Device{}, err
+	}
+
+	return monitor.editDevice(host, func(files []*configFile) (*configFile, error) {
+		file, list, index, err := monitor.findDevice(files, host)
+		if err != nil {
+			return nil, err
+		}
+		patchMapping(list.Content[index], node)
+		return file, nil
+	})
+}
+
+// DeleteDevice removes the device with the host from the file it is configured in.
+func (monitor *Monitor) DeleteDevice(host string) error {
+	_, err := monitor.editDevice(host, func(files []*configFile) (*configFile, error) {
+		file, list, index, err := monitor.findDevice(files, host)
+		if err != nil {
+			return nil, err
+		}
+		list.Content = slices.Delete(list.Content, index, index+1)
+		return file, nil
+	})
+
+	return err
+}
+
+// editDevice applies edit to the files of the config, validates the config with the file edit returns and replaces
+// that file. The monitor is reloaded and the device with the host polled right away if it still exists.
+func (monitor *Monitor) editDevice(host string, edit func(files []*configFile) (*configFile, error)) (Device, error) {
+	monitor.editing.Lock()
+	defer monitor.editing.Unlock()
+
+	names, err := configFiles(monitor.ConfigFile)
+	if err != nil {
+		return Device{}, fmt.Errorf("unable to read config file, %v", err)
+	}
+	files := make([]*configFile, 0, len(names))
+	for _, name := range names {
+		file := &configFile{name: name}
+		if file.content, err = os.ReadFile(name); err != nil {
+			return Device{}, fmt.Errorf("unable to read config file, %v", err)
+		}
+		if err := yaml.Unmarshal(file.content, &file.document); err != nil {
+			return Device{}, configParseError(monitor.ConfigFile, name, err)
+		}
+		files = append(files, file)
+	}
+
+	changed, err := edit(files)
+	if err != nil {
+		return Device{}, err
+	}
+	content, err := changed.encode()
+	if err != nil {
+		return Device{}, err
+	}
+
+	var documents []configDocument
+	for _, file := range files {
+		document, err := parseConfigDocument(monitor.ConfigFile, file.name, file.content)
+		if file == changed {
+			document, err = parseConfigDocument(monitor.ConfigFile, file.name, content)
+		}
+		if err != nil {
+			return Device{}, fmt.Errorf("%w: %w", ErrInvalidDevice, err)
+		}
+		if document != nil {
+			documents = append(documents, *document)
+		}
+	}
+	var devices Devices
+	if err := devices.loadConfig(context.Background(), monitor.ConfigFile, documents); err != nil {
+		return Device{}, fmt.Errorf("%w: %w", ErrInvalidDevice, err)
+	}
+
+	if err := replaceFile(changed.name, content); err != nil {
+		return Device{}, err
+	}
+	log.Printf("device %s changed in %s via the API", host, changed.name)
+	if err := monitor.Reload(); err != nil {
+		log.Printf("config not reloaded, %v", err)
+	}
+
+	for _, device := range devices {
+		if device.Host == host {
+			go func() {
+				if err := monitor.PollDevice(context.Background(), host); err != nil {
+					log.Printf("device %s not polled, %v", host, err)
+				}
+			}()
+			return device, nil
+		}
+	}
+
+	return Device{}, nil
+}
+
+// findDevice returns the file, the devices list and the index in it of the device with the host.
+// Devices which aren't part of a file, e.g. those of an inventory, are ErrDeviceReadOnly.
+func (monitor *Monitor) findDevice(files []*configFile, host string) (*configFile, *yaml.Node, int, error) {
+	for _, file := range files {
+		list := file.devices(false)
+		if list == nil {
+			continue
+		}
+		if index := deviceIndex(list, host); index >= 0 {
+			return file, list, index, nil
+		}
+	}
+	if _, found := monitor.Device(host); found {
+		return nil, nil, 0, ErrDeviceReadOnly
+	}
+
+	return nil, nil, 0, ErrDeviceNotFound
+}
+
+// parseDeviceConfig parses the config of a single device and returns it with its host. The host defaults to host,
+// if both are given they have to match.
+func parseDeviceConfig(config []byte, host string) (*yaml.Node, string, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(config, &document); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidDevice, err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, "", fmt.Errorf("%w: the device has to be a mapping of its settings", ErrInvalidDevice)
+	}
+	node := document.Content[0]
+	// JSON is valid YAML, but written as block YAML like the rest of the config
+	blockStyle(node)
+
+	value := mappingValue(node, "host")
+	switch {
+	case value == nil && host == "":
+		return nil, "", fmt.Errorf("%w: missing host", ErrInvalidDevice)
+	case value == nil:
+		node.Content = append([]*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "host"},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: host},
+		}, node.Content...)
+	case host != "" && value.Value != host:
+		return nil, "", fmt.Errorf("%w: the host can't be changed, delete the device and add it again", ErrInvalidDevice)
+	default:
+		host = value.Value
+	}
+
+	if key := os.Getenv(SecretKeyEnv); key != "" {
+		if err := encryptSecrets(node, key); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return node, host, nil
+}
+
+// patchMapping sets the keys of src in dst, mappings existing in both are patched recursively. Unlike mergeMapping the
+// values of src win, the other keys of dst and their order are kept.
+func patchMapping(dst *yaml.Node, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		index := slices.IndexFunc(dst.Content, func(node *yaml.Node) bool { return node.Value == key.Value })
+		switch {
+		case index < 0 || index%2 != 0:
+			dst.Content = append(dst.Content, key, value)
+		case dst.Content[index+1].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			patchMapping(dst.Content[index+1], value)
+		default:
+			dst.Content[index+1] = value
+		}
+	}
+}
+
+// deviceIndex returns the index of the device with the host in a devices list, -1 if it isn't in the list.
+// Hosts referencing environment variables are expanded.
+func deviceIndex(list *yaml.Node, host string) int {
+	return slices.IndexFunc(list.Content, func(node *yaml.Node) bool {
+		value := mappingValue(node, "host")
+		return value != nil && expandEnv(value.Value, nil) == host
+	})
+}
+
+// devices returns the devices list of the file, nil if it has none unless create is set.
+func (file *configFile) devices(create bool) *yaml.Node {
+	if len(file.document.Content) == 0 {
+		if !create {
+			return nil
+		}
+		file.document = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := file.document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil
+	}
+	list := mappingValue(root, "devices")
+	if list != nil && list.Kind == yaml.SequenceNode {
+		// an empty list written as [] gets the block style of the added devices
+		list.Style = 0
+		return list
+	}
+	if !create || list != nil {
+		return nil
+	}
+	list = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "devices"}, list)
+
+	return list
+}
+
+// encode returns the content of the edited file, indented like the file was.
+func (file *configFile) encode() ([]byte, error) {
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(indentation(file.content))
+	if err := encoder.Encode(&file.document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// indentation returns the indentation of the first indented line of YAML content, 4 like yaml.v3 if there is none.
+func indentation(content []byte) int {
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if indent := len(line) - len(trimmed); indent > 0 && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return indent
+		}
+	}
+
+	return 4
+}
+
+// replaceFile replaces the content of a file atomically, the file keeps its permissions.
+func replaceFile(filename string, content []byte) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(content); err != nil {
+		_ = temp.Close()
+		_ = os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), filename)
+}
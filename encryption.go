@@ -0,0 +1,191 @@
+package MikrotikMonitor
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// SecretKeyEnv is the environment variable with the key of the encrypted values of the config file,
+// a base64 encoded 256 bit AES key as printed by GenerateSecretKey.
+const SecretKeyEnv = "MIKROTIKMONITOR_KEY"
+
+// secretTag is the YAML tag of encrypted values, e.g. community: !secret 3q2+7w...
+const secretTag = "!secret"
+
+// secretValue matches an encrypted value in the text of a config file.
+var secretValue = regexp.MustCompile(`!secret\s+"?([A-Za-z0-9+/=]+)"?`)
+
+// GenerateSecretKey returns a new random key for the encrypted values of the config file.
+func GenerateSecretKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// secretCipher returns the AES-GCM cipher of a base64 encoded key.
+func secretCipher(key string) (cipher.AEAD, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("invalid secret key, expected 32 base64 encoded bytes")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// EncryptSecret encrypts a value of the config file with AES-256-GCM and returns it base64 encoded with its nonce,
+// the config file tags it with !secret.
+func EncryptSecret(key string, plaintext string) (string, error) {
+	aead, err := secretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+// DecryptSecret decrypts a value encrypted by EncryptSecret.
+func DecryptSecret(key string, ciphertext string) (string, error) {
+	aead, err := secretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	raw, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(raw) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+	plaintext, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt value, wrong key?")
+	}
+
+	return string(plaintext), nil
+}
+
+// RotateSecrets encrypts all !secret values of the content of a config file with the new key and returns the
+// content and the number of rotated values. The rest of the file, including comments and formatting, is kept.
+func RotateSecrets(content []byte, oldKey string, newKey string) ([]byte, int, error) {
+	var rotated int
+	var failure error
+	result := secretValue.ReplaceAllFunc(content, func(match []byte) []byte {
+		ciphertext := string(secretValue.FindSubmatch(match)[1])
+		plaintext, err := DecryptSecret(oldKey, ciphertext)
+		if err == nil {
+			ciphertext, err = EncryptSecret(newKey, plaintext)
+		}
+		if err != nil {
+			failure = err
+			return match
+		}
+		rotated++
+		return []byte(secretTag + " " + ciphertext)
+	})
+	if failure != nil {
+		return nil, 0, failure
+	}
+
+	return result, rotated, nil
+}
+
+// RotateSecretsFile rotates the encrypted values of a config in place, see RotateSecrets. Like the config file, the
+// filename may be a directory or a glob pattern, the values of all its files are rotated. The files are only replaced
+// once all values could be decrypted, each atomically and keeping its permissions.
+func RotateSecretsFile(filename string, oldKey string, newKey string) (int, error) {
+	files, err := configFiles(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	contents := make([][]byte, len(files))
+	for i, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return 0, err
+		}
+		rotated, count, err := RotateSecrets(content, oldKey, newKey)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", file, err)
+		}
+		if count > 0 {
+			contents[i] = rotated
+		}
+		total += count
+	}
+
+	for i, file := range files {
+		if contents[i] == nil {
+			continue
+		}
+		if err := replaceFile(file, contents[i]); err != nil {
+			return 0, err
+		}
+	}
+
+	return total, nil
+}
+
+// decryptSecrets replaces the values tagged with !secret in the node and its children with their plaintext.
+func decryptSecrets(node *yaml.Node, key string) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == secretTag {
+		if key == "" {
+			return fmt.Errorf("line %d: encrypted value, but %s isn't set", node.Line, SecretKeyEnv)
+		}
+		plaintext, err := DecryptSecret(key, node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", node.Line, err)
+		}
+		node.Tag, node.Value, node.Style = "!!str", plaintext, 0
+	}
+	for _, child := range node.Content {
+		if err := decryptSecrets(child, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// secretKeys are the keys of the credentials of a device, see encryptSecrets.
+var secretKeys = map[string]bool{"community": true, "passphrase": true, "password": true}
+
+// encryptSecrets encrypts the plaintext credentials in the config of a device and tags them with !secret.
+// References of environment variables are kept as they are.
+func encryptSecrets(node *yaml.Node, key string) error {
+	for i := 0; i+1 < len(node.Content) && node.Kind == yaml.MappingNode; i += 2 {
+		value := node.Content[i+1]
+		if value.Kind != yaml.ScalarNode {
+			if err := encryptSecrets(value, key); err != nil {
+				return err
+			}
+			continue
+		}
+		if !secretKeys[node.Content[i].Value] || value.Tag == secretTag || value.Value == "" || strings.Contains(value.Value, "${") {
+			continue
+		}
+		ciphertext, err := EncryptSecret(key, value.Value)
+		if err != nil {
+			return err
+		}
+		value.Tag, value.Value, value.Style = secretTag, ciphertext, 0
+	}
+
+	return nil
+}
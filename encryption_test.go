@@ -0,0 +1,139 @@
+package MikrotikMonitor
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	key, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, plaintext := range []string{"", "public", "pässwörd with $ and ${HOME}", strings.Repeat("x", 4096)} {
+		ciphertext, err := EncryptSecret(key, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext != "" && strings.Contains(ciphertext, plaintext) {
+			t.Errorf("ciphertext %s contains the plaintext", ciphertext)
+		}
+		decrypted, err := DecryptSecret(key, ciphertext)
+		if err != nil {
+			t.Fatalf("decrypt %q: %v", plaintext, err)
+		}
+		if decrypted != plaintext {
+			t.Errorf("decrypted %q, want %q", decrypted, plaintext)
+		}
+	}
+
+	// every encryption uses a new nonce
+	first, _ := EncryptSecret(key, "public")
+	second, _ := EncryptSecret(key, "public")
+	if first == second {
+		t.Errorf("same ciphertext %s for two encryptions", first)
+	}
+}
+
+func TestDecryptSecretRejects(t *testing.T) {
+	key, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := EncryptSecret(key, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := func(i int) string {
+		tampered := append([]byte{}, raw...)
+		tampered[i] ^= 0x01
+		return base64.StdEncoding.EncodeToString(tampered)
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		ciphertext string
+	}{
+		{"wrong key", otherKey, ciphertext},
+		{"modified nonce", key, modified(0)},
+		{"modified ciphertext", key, modified(12)},
+		{"modified tag", key, modified(len(raw) - 1)},
+		{"truncated", key, base64.StdEncoding.EncodeToString(raw[:len(raw)-1])},
+		{"appended", key, base64.StdEncoding.EncodeToString(append(append([]byte{}, raw...), 0))},
+		{"shorter than nonce", key, base64.StdEncoding.EncodeToString(raw[:8])},
+		{"not base64", key, "not base64!"},
+		{"invalid key", "c2hvcnQ=", ciphertext},
+		{"key not base64", "not base64!", ciphertext},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plaintext, err := DecryptSecret(test.key, test.ciphertext)
+			if err == nil {
+				t.Fatalf("decrypted %q, want an error", plaintext)
+			}
+		})
+	}
+}
+
+func TestRotateSecrets(t *testing.T) {
+	oldKey, _ := GenerateSecretKey()
+	newKey, _ := GenerateSecretKey()
+	community, err := EncryptSecret(oldKey, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, err := EncryptSecret(oldKey, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := "# devices\ndevices:\n  - host: r1\n    snmp:\n      community: !secret " + community +
+		"\n    api:\n      password: !secret \"" + password + "\"\n"
+
+	rotated, count, err := RotateSecrets([]byte(content), oldKey, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("rotated %d values, want 2", count)
+	}
+	if !strings.HasPrefix(string(rotated), "# devices\n") {
+		t.Errorf("comment not kept:\n%s", rotated)
+	}
+
+	t.Setenv(SecretKeyEnv, oldKey)
+	document, err := parseConfigDocument("config.yaml", "config.yaml", rotated)
+	if err == nil {
+		t.Fatalf("rotated config decrypted with the old key")
+	}
+	t.Setenv(SecretKeyEnv, newKey)
+	if document, err = parseConfigDocument("config.yaml", "config.yaml", rotated); err != nil {
+		t.Fatal(err)
+	}
+	var parser struct {
+		Devices []struct {
+			SNMP struct{ Community string }
+			API  struct{ Password string }
+		}
+	}
+	if err := document.root.Decode(&parser); err != nil {
+		t.Fatal(err)
+	}
+	if len(parser.Devices) != 1 || parser.Devices[0].SNMP.Community != "public" || parser.Devices[0].API.Password != "secret" {
+		t.Errorf("decrypted %+v, want community public and password secret", parser.Devices)
+	}
+
+	if _, _, err := RotateSecrets(rotated, oldKey, newKey); err == nil {
+		t.Errorf("rotated values encrypted with another key")
+	}
+}
@@ -0,0 +1,125 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// EventInterfaceErrorRate is the type of events raised by the ErrorRateDetector.
+const EventInterfaceErrorRate = "InterfaceErrorRate"
+
+// ErrorRateDetector computes the share of errors and discards in the traffic of every interface between two polls
+// and raises an event when it exceeds a threshold derived from the interface's own baseline.
+// The baseline is an exponentially weighted moving average and variance of the rate,
+// the threshold is the average plus Deviations standard deviations, but at least MinRate percent.
+// It is safe for concurrent use.
+type ErrorRateDetector struct {
+	// Alpha is the weight of a new sample in the moving average.
+	Alpha float64
+	// Deviations is the number of standard deviations above the average which trigger an alert.
+	Deviations float64
+	// MinRate is the minimum error rate in percent which triggers an alert.
+	MinRate float64
+	// MinPackets is the minimum number of packets between two polls to compute a rate.
+	MinPackets uint64
+	// Warmup is the number of samples collected before alerts are raised.
+	Warmup int
+
+	mu        sync.Mutex
+	baselines map[string]*errorBaseline
+}
+
+type errorBaseline struct {
+	previous Interface
+	samples  int
+	mean     float64
+	variance float64
+	alerting bool
+}
+
+// NewErrorRateDetector returns an ErrorRateDetector with defaults suitable for polling intervals of a few minutes.
+func NewErrorRateDetector() *ErrorRateDetector {
+	return &ErrorRateDetector{
+		Alpha:      0.1,
+		Deviations: 4,
+		MinRate:    0.5,
+		MinPackets: 1000,
+		Warmup:     10,
+	}
+}
+
+// ErrorRate returns the errors and discards between two samples of an interface as a percentage of all packets.
+// The second return value is false if the counters were reset or not enough packets were transferred.
+func (detector *ErrorRateDetector) ErrorRate(previous, current Interface) (float64, bool) {
+	if current.InPackets < previous.InPackets || current.OutPackets < previous.OutPackets ||
+		current.InErrors < previous.InErrors || current.OutErrors < previous.OutErrors ||
+		current.InDiscards < previous.InDiscards || current.OutDiscards < previous.OutDiscards {
+		return 0, false
+	}
+
+	failed := current.InErrors - previous.InErrors + current.OutErrors - previous.OutErrors +
+		current.InDiscards - previous.InDiscards + current.OutDiscards - previous.OutDiscards
+	packets := current.InPackets - previous.InPackets + current.OutPackets - previous.OutPackets + failed
+	if packets < detector.MinPackets {
+		return 0, false
+	}
+
+	return float64(failed) / float64(packets) * 100, true
+}
+
+// Update compares the interfaces of a polled device with the previous poll and returns the resulting events.
+// An alert is raised once when the threshold is exceeded and resolved once the rate is below it again.
+// The baseline is only updated while the interface is not alerting.
+func (detector *ErrorRateDetector) Update(device Device) []Event {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+
+	if detector.baselines == nil {
+		detector.baselines = map[string]*errorBaseline{}
+	}
+
+	var events []Event
+	for _, iface := range device.Interfaces {
+		key := fmt.Sprintf("%s/%d", device.Host, iface.Index)
+		baseline, found := detector.baselines[key]
+		if !found {
+			detector.baselines[key] = &errorBaseline{previous: iface}
+			continue
+		}
+
+		rate, ok := detector.ErrorRate(baseline.previous, iface)
+		baseline.previous = iface
+		if !ok {
+			continue
+		}
+
+		threshold := math.Max(detector.MinRate, baseline.mean+detector.Deviations*math.Sqrt(baseline.variance))
+		switch {
+		case baseline.samples >= detector.Warmup && rate > threshold:
+			if !baseline.alerting {
+				baseline.alerting = true
+				events = append(events, device.NewEvent(EventInterfaceErrorRate, SeverityWarning, iface.Name,
+					fmt.Sprintf("error rate %.2f%% exceeds baseline threshold %.2f%%", rate, threshold)))
+			}
+			continue
+		case baseline.alerting:
+			baseline.alerting = false
+			event := device.NewEvent(EventInterfaceErrorRate, SeverityWarning, iface.Name,
+				fmt.Sprintf("error rate %.2f%% is below baseline threshold %.2f%% again", rate, threshold))
+			event.Resolved = true
+			events = append(events, event)
+		}
+
+		if baseline.samples == 0 {
+			baseline.mean = rate
+		} else {
+			diff := rate - baseline.mean
+			baseline.mean += detector.Alpha * diff
+			baseline.variance = (1 - detector.Alpha) * (baseline.variance + detector.Alpha*diff*diff)
+		}
+		baseline.samples++
+	}
+
+	return events
+}
@@ -0,0 +1,22 @@
+package MikrotikMonitor
+
+import "errors"
+
+// Error classes of failed polls, config files and changes of devices, the returned errors wrap them together with the cause,
+// so callers can tell them apart with errors.Is, e.g. errors.Is(err, ErrConnect).
+var (
+	// ErrConnect is wrapped by errors of connections to a device which couldn't be established via SNMP, the API or SSH.
+	ErrConnect = errors.New("unable to connect")
+	// ErrSNMPRequest is wrapped by errors of the basic SNMP request of GetDevice which failed after all retries.
+	ErrSNMPRequest = errors.New("SNMP request failed")
+	// ErrConfigParse is wrapped by errors of config files which aren't valid YAML or don't match the expected structure.
+	ErrConfigParse = errors.New("unable to parse config file")
+	// ErrInvalidDevice is wrapped by errors of devices added or updated via the API which would make the config invalid.
+	ErrInvalidDevice = errors.New("invalid device")
+	// ErrDeviceNotFound is returned for devices which aren't configured.
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrDeviceExists is returned for devices added via the API whose host is configured already.
+	ErrDeviceExists = errors.New("device exists already")
+	// ErrDeviceReadOnly is returned for changes of devices which aren't part of a config file, e.g. those of NetBox.
+	ErrDeviceReadOnly = errors.New("device isn't part of a config file")
+)
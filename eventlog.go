@@ -0,0 +1,351 @@
+package MikrotikMonitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of the entries of the EventLog: events of the devices, alerts of the rules fired and resolved, upgrades of
+// RouterOS, reloads of the config file and changes via the HTTP API.
+const (
+	LogEvent   = "event"
+	LogAlert   = "alert"
+	LogUpgrade = "upgrade"
+	LogReload  = "reload"
+	LogAPI     = "api"
+)
+
+// LogEntry is an entry of the EventLog. Action is the type and subject of an event, e.g. "Rule cpu-high", or the
+// method and path of a change via the HTTP API. Severity is the severity of an event, resolved for resolved events.
+// User and Address are the user and the client address of a change via the HTTP API.
+type LogEntry struct {
+	Time     time.Time
+	Kind     string
+	Action   string
+	Severity string `json:",omitempty"`
+	Host     string `json:",omitempty"`
+	Site     string `json:",omitempty"`
+	User     string `json:",omitempty"`
+	Address  string `json:",omitempty"`
+	Message  string
+}
+
+// EventLog is the event_log block of the config file, an append-only log of everything significant that happened,
+// for audits and postmortems. The entries are appended as JSON lines to File and sent to the Syslog server, e.g.
+// udp://syslog.example.com:514 or tcp://syslog.example.com:601, as RFC 5424 messages with the entry as JSON.
+type EventLog struct {
+	File   string
+	Syslog string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// LogQuery selects entries of the EventLog, by the range From to To and by their Kind, Host, Site and User.
+// Empty fields match all entries.
+type LogQuery struct {
+	From time.Time
+	To   time.Time
+	Kind string
+	Host string
+	Site string
+	User string
+}
+
+// LoadEventLog reads the event_log block of the config file and validates it, nil if the block is missing.
+func LoadEventLog(filename string) (*EventLog, error) {
+	documents, err := readConfigDocuments(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadEventLog(documents)
+}
+
+// loadEventLog is LoadEventLog with the parsed documents of the config files.
+func loadEventLog(documents []configDocument) (*EventLog, error) {
+	var parser struct {
+		EventLog *EventLog `yaml:"event_log"`
+	}
+
+	if err := decodeConfig(documents, &parser); err != nil {
+		return nil, err
+	}
+	eventLog := parser.EventLog
+	if eventLog == nil {
+		return nil, nil
+	}
+
+	var errs []error
+	if eventLog.File == "" && eventLog.Syslog == "" {
+		errs = append(errs, fmt.Errorf("missing file or syslog"))
+	}
+	if eventLog.Syslog != "" {
+		if _, _, err := syslogAddress(eventLog.Syslog); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid event_log in config file:\n%v", err)
+	}
+
+	return eventLog, nil
+}
+
+// Add appends the entry to the file and sends it to the syslog server.
+func (eventLog *EventLog) Add(entry LogEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	eventLog.mu.Lock()
+	defer eventLog.mu.Unlock()
+
+	var errs []error
+	if eventLog.File != "" {
+		errs = append(errs, appendLine(eventLog.File, content))
+	}
+	if eventLog.Syslog != "" {
+		errs = append(errs, eventLog.send(entry, content))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close closes the connection to the syslog server.
+func (eventLog *EventLog) Close() error {
+	eventLog.mu.Lock()
+	defer eventLog.mu.Unlock()
+
+	if eventLog.conn == nil {
+		return nil
+	}
+	err := eventLog.conn.Close()
+	eventLog.conn = nil
+
+	return err
+}
+
+// appendLine appends the line to the file, which is created if it doesn't exist. The file is opened for every line,
+// so several processes, e.g. the monitor and an upgrade on the command line, can append to it.
+func appendLine(filename string, line []byte) error {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// send sends the entry to the syslog server, the connection is opened again after an error.
+// The caller has to hold the lock.
+func (eventLog *EventLog) send(entry LogEntry, content []byte) error {
+	network, address, err := syslogAddress(eventLog.Syslog)
+	if err != nil {
+		return err
+	}
+	if eventLog.conn == nil {
+		eventLog.conn, err = net.DialTimeout(network, address, 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("unable to connect to syslog server %s, %v", eventLog.Syslog, err)
+		}
+	}
+
+	// facility log audit (13) with the severity of the event, notice for the other entries
+	severity := 5
+	switch entry.Severity {
+	case SeverityCritical:
+		severity = 2
+	case SeverityWarning:
+		severity = 4
+	case SeverityInfo, "resolved":
+		severity = 6
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	message := fmt.Sprintf("<%d>1 %s %s mikrotikmonitor %d %s - %s", 13*8+severity,
+		entry.Time.UTC().Format(time.RFC3339Nano), hostname, os.Getpid(), entry.Kind, content)
+	if network == "tcp" {
+		// octet counting of RFC 6587
+		message = fmt.Sprintf("%d %s", len(message), message)
+	}
+
+	_ = eventLog.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := eventLog.conn.Write([]byte(message)); err != nil {
+		_ = eventLog.conn.Close()
+		eventLog.conn = nil
+		return fmt.Errorf("unable to send to syslog server %s, %v", eventLog.Syslog, err)
+	}
+
+	return nil
+}
+
+// syslogAddress returns the network, udp or tcp, and the address of a syslog server like udp://host:514.
+func syslogAddress(server string) (string, string, error) {
+	address, err := url.Parse(server)
+	if err != nil || address.Scheme != "udp" && address.Scheme != "tcp" || address.Port() == "" {
+		return "", "", fmt.Errorf("syslog %q is not udp://<host>:<port> or tcp://<host>:<port>", server)
+	}
+
+	return address.Scheme, address.Host, nil
+}
+
+// ReadEventLog returns the entries of the JSON lines file of an EventLog selected by the query, the oldest first.
+// A missing file has no entries.
+func ReadEventLog(filename string, query LogQuery) ([]LogEntry, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []LogEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if query.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// matches reports whether the query selects the entry.
+func (query LogQuery) matches(entry LogEntry) bool {
+	return (query.From.IsZero() || !entry.Time.Before(query.From)) && (query.To.IsZero() || entry.Time.Before(query.To)) &&
+		(query.Kind == "" || query.Kind == entry.Kind) && (query.Host == "" || query.Host == entry.Host) &&
+		(query.Site == "" || query.Site == entry.Site) && (query.User == "" || query.User == entry.User)
+}
+
+// eventLogEntry returns the entry of the event log of an event.
+func eventLogEntry(event Event) LogEntry {
+	kind := LogEvent
+	switch event.Type {
+	case EventRule:
+		kind = LogAlert
+	case EventUpgrade:
+		kind = LogUpgrade
+	}
+	severity := event.Severity
+	if event.Resolved {
+		severity = "resolved"
+	}
+
+	return LogEntry{
+		Time:     event.Time,
+		Kind:     kind,
+		Action:   strings.TrimSpace(event.Type + " " + event.Subject),
+		Severity: severity,
+		Host:     event.Host,
+		Site:     event.Site,
+		Message:  event.Message,
+	}
+}
+
+// EventLog returns the entries of the file of the event log of the config file selected by the query, none without
+// event log or file.
+func (monitor *Monitor) EventLog(query LogQuery) ([]LogEntry, error) {
+	monitor.mu.RLock()
+	eventLog := monitor.eventLog
+	monitor.mu.RUnlock()
+	if eventLog == nil || eventLog.File == "" {
+		return nil, nil
+	}
+
+	return ReadEventLog(eventLog.File, query)
+}
+
+// logEntry adds the entry to the event log of the config file, errors are logged.
+func (monitor *Monitor) logEntry(entry LogEntry) {
+	monitor.mu.RLock()
+	eventLog := monitor.eventLog
+	monitor.mu.RUnlock()
+	if eventLog == nil {
+		return
+	}
+
+	if err := eventLog.Add(entry); err != nil {
+		log.Printf("unable to add %s entry to event log, %v", entry.Kind, err)
+	}
+}
+
+// logChanges wraps the HTTP API with the event log of the requests which change the state of the monitor, those
+// which need the admin role. Requests of other methods don't change anything and aren't logged. Requests rejected by
+// the authentication are logged by authenticate.
+func (monitor *Monitor) logChanges(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requiredRole(r) != RoleAdmin {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		message := fmt.Sprintf("%d %s", recorder.status, http.StatusText(recorder.status))
+		if status := w.Header().Get(http.TrailerPrefix + "Grpc-Status"); status != "" {
+			message += ", grpc-status " + status
+		}
+		monitor.logRequest(r, requestUser(r), message)
+	})
+}
+
+// logRequest adds a request of the HTTP API by the user with the message, e.g. its status, to the event log.
+func (monitor *Monitor) logRequest(r *http.Request, user string, message string) {
+	entry := LogEntry{
+		Kind:    LogAPI,
+		Action:  r.Method + " " + r.URL.Path,
+		User:    user,
+		Address: r.RemoteAddr,
+		Message: message,
+	}
+	if host, found := strings.CutPrefix(r.URL.Path, "/devices/"); found {
+		entry.Host = host
+	}
+	monitor.logEntry(entry)
+}
+
+// statusRecorder records the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code and writes it.
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap returns the ResponseWriter for http.ResponseController.
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
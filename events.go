@@ -0,0 +1,110 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// MaxEvents is the number of recent events a Monitor keeps for Events and Event.
+var MaxEvents = 1000
+
+var eventSequence atomic.Uint64
+
+type eventCount struct {
+	host  string
+	kind  string
+	count int
+	last  Event
+}
+
+// newEventID returns a unique ID for an event, based on the time and a sequence number.
+func newEventID(timestamp time.Time) string {
+	return fmt.Sprintf("%x-%x", timestamp.UnixMilli(), eventSequence.Add(1))
+}
+
+// recordEvent assigns an ID to the event and stores it in the recent events and the event counters.
+func (monitor *Monitor) recordEvent(event *Event) {
+	if event.ID == "" {
+		event.ID = newEventID(event.Time)
+	}
+
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	monitor.events = append(monitor.events, *event)
+	if len(monitor.events) > MaxEvents {
+		monitor.events = monitor.events[len(monitor.events)-MaxEvents:]
+	}
+
+	if monitor.eventCounts == nil {
+		monitor.eventCounts = map[[2]string]*eventCount{}
+	}
+	key := [2]string{event.Host, event.Type}
+	if monitor.eventCounts[key] == nil {
+		monitor.eventCounts[key] = &eventCount{host: event.Host, kind: event.Type}
+	}
+	monitor.eventCounts[key].count++
+	monitor.eventCounts[key].last = *event
+}
+
+// Events returns a copy of the recent events, the oldest first.
+func (monitor *Monitor) Events() []Event {
+	monitor.mu.RLock()
+	defer monitor.mu.RUnlock()
+
+	events := make([]Event, len(monitor.events))
+	copy(events, monitor.events)
+
+	return events
+}
+
+// Event returns the recent event with the given ID.
+// The second return value is false if the event doesn't exist or is not recent anymore.
+func (monitor *Monitor) Event(id string) (Event, bool) {
+	monitor.mu.RLock()
+	defer monitor.mu.RUnlock()
+
+	for _, event := range monitor.events {
+		if event.ID == id {
+			return event, true
+		}
+	}
+
+	return Event{}, false
+}
+
+// ResultOpenMetrics returns the devices in the OpenMetrics text format together with the counter
+// mikrotik_events_total of the events per device and type. Every counter carries the ID of the latest event
+// as exemplar, so dashboards can link a state change to the event returned by Event.
+// The metrics of the monitor itself follow, named mikrotik_monitor_*, e.g. the poll duration histograms.
+func (monitor *Monitor) ResultOpenMetrics() string {
+	return monitor.openMetrics(monitor.Devices(), true)
+}
+
+// openMetrics returns the devices and their events in the OpenMetrics text format, followed by the metrics of the
+// monitor itself with self.
+func (monitor *Monitor) openMetrics(devices Devices, self bool) string {
+	w := &metricsWriter{openMetrics: true}
+	devices.writeMetrics(w)
+
+	monitor.mu.RLock()
+	w.metric("mikrotik_events_total", "Number of events per device and type.", "counter")
+	for _, device := range devices {
+		for _, count := range monitor.eventCounts {
+			if count.host != device.Host {
+				continue
+			}
+			w.exemplar("mikrotik_events_total", append(device.labels(), [2]string{"type", count.kind}), float64(count.count),
+				[][2]string{{"event_id", count.last.ID}}, count.last.Time)
+		}
+	}
+	monitor.mu.RUnlock()
+	if self {
+		monitor.writeSelfMetrics(w)
+	}
+
+	w.WriteString("# EOF\n")
+
+	return w.String()
+}
@@ -0,0 +1,140 @@
+package MikrotikMonitor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistorySchema is the version of the schema of history exports.
+const HistorySchema = "mikrotikmonitor.history.v1"
+
+// ExportField describes a column of a history export.
+type ExportField struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// ExportFields are the columns of every history export.
+var ExportFields = []ExportField{
+	{"time", "timestamp", "time of the sample, RFC 3339 in CSV and JSON lines, milliseconds since the epoch in Parquet"},
+	{"key", "string", "key of the series in the history"},
+	{"metric", "string", "metric of the series, the part of the key before the first colon"},
+	{"subject", "string", "host, site or other subject of the series, the part of the key after the first colon"},
+	{"value", "double", "value of the sample"},
+}
+
+// ExportMetadata describes a history export, it is written as header of every format.
+type ExportMetadata struct {
+	Schema      string        `json:"schema"`
+	GeneratedAt time.Time     `json:"generated_at"`
+	From        *time.Time    `json:"from,omitempty"`
+	To          *time.Time    `json:"to,omitempty"`
+	Records     int           `json:"records"`
+	Fields      []ExportField `json:"fields"`
+}
+
+// Export writes the samples of the history between from and to in the given format, csv, jsonl or parquet.
+// A zero from or to leaves that side of the range open.
+// CSV starts with the metadata as comment lines starting with #, JSON lines with a metadata object
+// and Parquet stores the metadata as key/value pairs in the footer.
+func (history *History) Export(w io.Writer, from, to time.Time, format string) error {
+	records := history.Records("", from, to)
+	metadata := ExportMetadata{
+		Schema:      HistorySchema,
+		GeneratedAt: time.Now().UTC(),
+		Records:     len(records),
+		Fields:      ExportFields,
+	}
+	if !from.IsZero() {
+		metadata.From = &from
+	}
+	if !to.IsZero() {
+		metadata.To = &to
+	}
+	header, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "csv":
+		if _, err := fmt.Fprintf(w, "# %s\n", header); err != nil {
+			return err
+		}
+		writer := csv.NewWriter(w)
+		names := make([]string, 0, len(ExportFields))
+		for _, field := range ExportFields {
+			names = append(names, field.Name)
+		}
+		if err := writer.Write(names); err != nil {
+			return err
+		}
+		for _, record := range records {
+			metric, subject := record.split()
+			row := []string{record.Time.UTC().Format(time.RFC3339Nano), record.Key, metric, subject, strconv.FormatFloat(record.Value, 'g', -1, 64)}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case "jsonl":
+		if _, err := fmt.Fprintf(w, "{\"metadata\":%s}\n", header); err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			metric, subject := record.split()
+			line := map[string]any{"time": record.Time.UTC(), "key": record.Key, "metric": metric, "subject": subject, "value": record.Value}
+			if err := encoder.Encode(line); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "parquet":
+		columns := []ParquetColumn{
+			{Name: "time", Int64s: make([]int64, 0, len(records)), Timestamp: true},
+			{Name: "key", Strings: make([]string, 0, len(records))},
+			{Name: "metric", Strings: make([]string, 0, len(records))},
+			{Name: "subject", Strings: make([]string, 0, len(records))},
+			{Name: "value", Doubles: make([]float64, 0, len(records))},
+		}
+		for _, record := range records {
+			metric, subject := record.split()
+			columns[0].Int64s = append(columns[0].Int64s, record.Time.UnixMilli())
+			columns[1].Strings = append(columns[1].Strings, record.Key)
+			columns[2].Strings = append(columns[2].Strings, metric)
+			columns[3].Strings = append(columns[3].Strings, subject)
+			columns[4].Doubles = append(columns[4].Doubles, record.Value)
+		}
+		return WriteParquet(w, columns, map[string]string{"mikrotikmonitor.metadata": string(header)})
+	}
+
+	return fmt.Errorf("unknown export format %q, use csv, jsonl or parquet", format)
+}
+
+// split returns the metric and the subject of the key of the record.
+func (record Record) split() (string, string) {
+	metric, subject, _ := strings.Cut(record.Key, ":")
+	return metric, subject
+}
+
+// sortedKeys returns the keys of a map in ascending order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
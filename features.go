@@ -0,0 +1,65 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Feature flags reported in Capabilities.Flags.
+const (
+	FeatureWireless  = "has_wireless"
+	FeaturePoE       = "has_poe"
+	FeatureLTE       = "has_lte"
+	FeatureContainer = "container_support"
+)
+
+// GetFeatures derives the feature flags of the device from the collected interfaces and packages, so automation
+// can branch on them instead of matching model names. Devices read via SNMP have PoE-out if the poe collector found
+// PoE ports. The switch chip is read via the API, so SwitchChip stays empty on devices without an api block.
+func (device *Device) GetFeatures() error {
+	flags := map[string]bool{
+		FeatureWireless:  device.Capabilities.Wireless != "" || device.Wireless.Clients > 0,
+		FeatureLTE:       false,
+		FeaturePoE:       len(device.POE) > 0,
+		FeatureContainer: false,
+	}
+	for _, iface := range device.Interfaces {
+		name := strings.ToLower(iface.Name)
+		flags[FeatureWireless] = flags[FeatureWireless] || strings.HasPrefix(name, "wlan") || strings.HasPrefix(name, "wifi")
+		flags[FeatureLTE] = flags[FeatureLTE] || strings.HasPrefix(name, "lte")
+	}
+	for _, p := range device.Packages {
+		if p.Disabled {
+			continue
+		}
+		flags[FeatureContainer] = flags[FeatureContainer] || p.Name == "container"
+		flags[FeatureLTE] = flags[FeatureLTE] || p.Name == "lte"
+	}
+
+	var errs []string
+	if device.API.User != "" || !usesSNMP(device) && device.Backend != BackendSSH {
+		switches, err := device.Print("/interface/ethernet/switch")
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		device.Capabilities.SwitchChip = ""
+		for _, item := range switches {
+			if item["type"] != "" {
+				device.Capabilities.SwitchChip = item["type"]
+				break
+			}
+		}
+		if !usesSNMP(device) {
+			// devices without PoE-out don't know the menu, so an error only means no PoE
+			poe, _ := device.Print("/interface/ethernet/poe")
+			flags[FeaturePoE] = len(poe) > 0
+		}
+	}
+
+	device.Capabilities.Flags = flags
+	if len(errs) > 0 {
+		return fmt.Errorf("%s unable to read features: %s", device.Host, strings.Join(errs, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultFeedURL is the base URL of the upgrade feed RouterOS itself uses for check-for-updates.
+const DefaultFeedURL = "https://upgrade.mikrotik.com/routeros"
+
+// ReleaseFeed fetches the newest RouterOS release of every update channel from MikroTik's upgrade feed and caches it.
+// It verifies updates independent of the device, so devices with check-for-updates disabled are covered as well.
+// Releases of RouterOS v7 are keyed by the channel, releases of RouterOS v6 by "6/" and the channel.
+type ReleaseFeed struct {
+	URL    string
+	TTL    time.Duration
+	Client *http.Client
+
+	mu       sync.Mutex
+	releases Releases
+	fetched  time.Time
+}
+
+// NewReleaseFeed returns a ReleaseFeed for the MikroTik upgrade feed, which is fetched at most every 6 hours.
+func NewReleaseFeed() *ReleaseFeed {
+	return &ReleaseFeed{
+		URL:    DefaultFeedURL,
+		TTL:    6 * time.Hour,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Releases returns the cached releases, they are fetched again if they are older than TTL.
+// If fetching fails, the previously fetched releases are returned together with the error.
+func (feed *ReleaseFeed) Releases() (Releases, error) {
+	return feed.ReleasesContext(context.Background())
+}
+
+// ReleasesContext is Releases with a context, cancelling it aborts fetching the feed. The lock isn't held while the
+// feed is fetched, so other callers get the cached releases meanwhile.
+func (feed *ReleaseFeed) ReleasesContext(ctx context.Context) (Releases, error) {
+	feed.mu.Lock()
+	cached, fetched := feed.releases, feed.fetched
+	feed.mu.Unlock()
+	if cached != nil && time.Since(fetched) < feed.TTL {
+		return cached, nil
+	}
+
+	releases := Releases{}
+	var errs []error
+	for _, major := range []string{"6", "7"} {
+		for _, channel := range []string{ChannelLongTerm, ChannelStable, ChannelTesting, ChannelDevelopment} {
+			version, err := feed.fetch(ctx, major, channel)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if version == "" {
+				continue
+			}
+			if major == "6" {
+				releases[major+"/"+channel] = version
+			} else {
+				releases[channel] = version
+			}
+		}
+	}
+
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	if len(releases) == 0 {
+		return feed.releases, errors.Join(errs...)
+	}
+	feed.releases = releases
+	feed.fetched = time.Now()
+
+	return releases, errors.Join(errs...)
+}
+
+// fetch reads the newest version of a channel. The feed answers with the version and the release time, e.g. "7.16.1 1729500000".
+// RouterOS v6 has no development channel, its missing feed is not an error.
+func (feed *ReleaseFeed) fetch(ctx context.Context, major string, channel string) (string, error) {
+	name := "NEWESTa7." + channel
+	if major == "6" {
+		if channel == ChannelDevelopment {
+			return "", nil
+		}
+		name = "NEWEST6." + channel
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(feed.URL, "/")+"/"+name, nil)
+	if err != nil {
+		return "", err
+	}
+	response, err := feed.Client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch release feed %s: %v", name, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to fetch release feed %s: %s", name, response.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1024))
+	if err != nil {
+		return "", fmt.Errorf("unable to read release feed %s: %v", name, err)
+	}
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("release feed %s is empty", name)
+	}
+
+	return fields[0], nil
+}
@@ -0,0 +1,72 @@
+package MikrotikMonitor
+
+import "fmt"
+
+// HasTag reports whether the device is tagged with the given tag.
+func (device *Device) HasTag(tag string) bool {
+	for _, t := range device.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filter returns the devices for which keep returns true.
+func (devices *Devices) Filter(keep func(device *Device) bool) Devices {
+	var result Devices
+	for i := range *devices {
+		if keep(&(*devices)[i]) {
+			result = append(result, (*devices)[i])
+		}
+	}
+
+	return result
+}
+
+// FilterByTag returns the devices tagged with the given tag.
+func (devices *Devices) FilterByTag(tag string) Devices {
+	return devices.Filter(func(device *Device) bool {
+		return device.HasTag(tag)
+	})
+}
+
+// FilterByGroup returns the devices of the given group.
+func (devices *Devices) FilterByGroup(group string) Devices {
+	return devices.Filter(func(device *Device) bool {
+		return device.Group == group
+	})
+}
+
+// GroupBy returns the devices keyed by their site, group or tag, depending on by.
+// With "tag" a device is part of every tag it has, devices without a site, group or tag are keyed by an empty string.
+func (devices *Devices) GroupBy(by string) (map[string]Devices, error) {
+	result := map[string]Devices{}
+	for _, device := range *devices {
+		switch by {
+		case "site":
+			result[device.Site] = append(result[device.Site], device)
+		case "group":
+			result[device.Group] = append(result[device.Group], device)
+		case "tag":
+			if len(device.Tags) == 0 {
+				result[""] = append(result[""], device)
+			}
+			for _, tag := range device.Tags {
+				result[tag] = append(result[tag], device)
+			}
+		default:
+			return nil, fmt.Errorf("unknown grouping %q, use site, group or tag", by)
+		}
+	}
+
+	return result, nil
+}
+
+// FilterBySite returns the devices of the given site.
+func (devices *Devices) FilterBySite(site string) Devices {
+	return devices.Filter(func(device *Device) bool {
+		return device.Site == site
+	})
+}
@@ -0,0 +1,95 @@
+package MikrotikMonitor
+
+import (
+	"strconv"
+	"strings"
+)
+
+// FirewallTables are the firewall tables whose tagged rules are read.
+var FirewallTables = []string{"filter", "nat", "mangle", "raw"}
+
+// Firewall is the connection tracking table and the counters of tagged firewall rules of the device.
+// Rules whose comment contains Tag are read, e.g. "monitor", no rules are read without a tag.
+type Firewall struct {
+	Tag            string         `json:"Tag"`
+	Connections    int            `json:"Connections"`
+	MaxConnections int            `json:"MaxConnections"`
+	Rules          []FirewallRule `json:"Rules"`
+}
+
+// FirewallRule is a tagged firewall rule with its counters. ID is the RouterOS ID of the rule, e.g. "*1A".
+type FirewallRule struct {
+	ID       string `json:"ID"`
+	Table    string `json:"Table"`
+	Chain    string `json:"Chain"`
+	Action   string `json:"Action"`
+	Comment  string `json:"Comment"`
+	Disabled bool   `json:"Disabled"`
+	Packets  uint64 `json:"Packets"`
+	Bytes    uint64 `json:"Bytes"`
+}
+
+// GetFirewall reads the size of the connection tracking table and the counters of the tagged firewall rules via the API,
+// so the pressure on the NAT table can be graphed and important rules can be verified to match traffic.
+func (device *Device) GetFirewall() error {
+	tracking, err := device.printOne("/ip/firewall/connection/tracking")
+	if err != nil {
+		return err
+	}
+	device.Firewall.Connections, _ = strconv.Atoi(tracking["total-entries"])
+	device.Firewall.MaxConnections, _ = strconv.Atoi(tracking["max-entries"])
+
+	device.Firewall.Rules = nil
+	if device.Firewall.Tag == "" {
+		return nil
+	}
+	for _, table := range FirewallTables {
+		items, err := device.Print("/ip/firewall/" + table)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if !strings.Contains(item["comment"], device.Firewall.Tag) {
+				continue
+			}
+			rule := FirewallRule{
+				ID:       item[".id"],
+				Table:    table,
+				Chain:    item["chain"],
+				Action:   item["action"],
+				Comment:  item["comment"],
+				Disabled: item["disabled"] == "true",
+			}
+			rule.Packets, _ = strconv.ParseUint(item["packets"], 10, 64)
+			rule.Bytes, _ = strconv.ParseUint(item["bytes"], 10, 64)
+			device.Firewall.Rules = append(device.Firewall.Rules, rule)
+		}
+	}
+
+	return nil
+}
+
+// unmatchedRules returns the number of enabled tagged rules which matched no packet since the previous poll.
+// Rules whose counters were reset, e.g. by a reboot, are not counted.
+func unmatchedRules(previous, current Device) (float64, bool) {
+	if !previous.Reached || !current.Reached || len(current.Firewall.Rules) == 0 {
+		return 0, false
+	}
+	before := map[string]FirewallRule{}
+	for _, rule := range previous.Firewall.Rules {
+		before[rule.Table+rule.ID] = rule
+	}
+
+	unmatched := 0
+	for _, rule := range current.Firewall.Rules {
+		old, found := before[rule.Table+rule.ID]
+		if !found || rule.Disabled || rule.Packets < old.Packets {
+			continue
+		}
+		if rule.Packets == old.Packets {
+			unmatched++
+		}
+	}
+
+	return float64(unmatched), true
+}
@@ -0,0 +1,216 @@
+package MikrotikMonitor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"log"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Column is a column of the CSV and table output, named like the field in the JSON output.
+// Fields of nested structs are flattened with a dot, e.g. Version.RouterOS or Latency.SNMP.
+type Column struct {
+	Name  string
+	index []int
+}
+
+// Columns returns the columns of the CSV and table output in the order of the fields of Device.
+// They are derived from the same fields as the JSON output, so fields hidden there, e.g. credentials, aren't columns
+// and new fields of Device are columns without further changes.
+func Columns() []Column {
+	return structColumns(reflect.TypeOf(Device{}), "", nil)
+}
+
+// structColumns returns the columns of the exported fields of a struct type, recursing into nested structs.
+func structColumns(structType reflect.Type, prefix string, index []int) []Column {
+	var columns []Column
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name := field.Name
+		if tag != "" {
+			name = tag
+		}
+		fieldIndex := append(slices.Clone(index), i)
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Time{}) {
+			columns = append(columns, structColumns(field.Type, prefix+name+".", fieldIndex)...)
+			continue
+		}
+		columns = append(columns, Column{Name: prefix + name, index: fieldIndex})
+	}
+
+	return columns
+}
+
+// Value returns the value of the column of a device as text. Lists of strings are joined with commas,
+// other lists and maps are represented by their number of entries, e.g. the number of interfaces.
+func (column Column) Value(device Device) string {
+	return formatValue(reflect.ValueOf(device).FieldByIndex(column.index))
+}
+
+// formatValue returns a field value as text.
+func formatValue(value reflect.Value) string {
+	switch typed := value.Interface().(type) {
+	case time.Time:
+		if typed.IsZero() {
+			return ""
+		}
+		return typed.Format(time.RFC3339)
+	case time.Duration:
+		return typed.String()
+	}
+
+	switch value.Kind() {
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.String {
+			items := make([]string, value.Len())
+			for i := range items {
+				items[i] = value.Index(i).String()
+			}
+			return strings.Join(items, ",")
+		}
+		return strconv.Itoa(value.Len())
+	case reflect.Map:
+		return strconv.Itoa(value.Len())
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 64)
+	}
+
+	return fmt.Sprint(value.Interface())
+}
+
+// selectColumns returns the columns with the given names, all columns without names.
+// A name of a nested struct selects all of its columns, e.g. Version selects Version.RouterOS and the other versions.
+func selectColumns(names []string) ([]Column, error) {
+	all := Columns()
+	if len(names) == 0 {
+		return all, nil
+	}
+
+	var columns []Column
+	for _, name := range names {
+		found := false
+		for _, column := range all {
+			if strings.EqualFold(column.Name, name) || strings.HasPrefix(strings.ToLower(column.Name), strings.ToLower(name)+".") {
+				columns = append(columns, column)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+
+	return columns, nil
+}
+
+// ResultYAML returns the same document as ResultJson as YAML, with the fields in the same order.
+// If there is an error during marshaling, the error will be logged and an empty string will be returned.
+func (devices *Devices) ResultYAML() string {
+	// JSON is valid YAML, decoding it into a node keeps the order of the fields
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(devices.ResultJson()), &document); err != nil {
+		log.Println(err.Error())
+		return ""
+	}
+	blockStyle(&document)
+
+	var b strings.Builder
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		log.Println(err.Error())
+		return ""
+	}
+
+	return b.String()
+}
+
+// blockStyle resets the flow and quoting style of the decoded JSON, so the node is written as block YAML.
+// Strings which would be read as another type, e.g. "true", are still quoted by the encoder.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// ResultCSV returns the devices as CSV with a header line of the column names and a line per device.
+// Without columns all Columns are written, names of nested structs select all of their columns.
+// If a column is unknown or there is an error during writing, the error will be logged and an empty string will be returned.
+func (devices *Devices) ResultCSV(columns ...string) string {
+	selected, err := selectColumns(columns)
+	if err != nil {
+		log.Println(err.Error())
+		return ""
+	}
+
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	_ = w.Write(columnNames(selected))
+	for _, device := range *devices {
+		_ = w.Write(columnValues(selected, device))
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Println(err.Error())
+		return ""
+	}
+
+	return b.String()
+}
+
+// ResultTable returns the devices as a table with aligned columns for reading on a terminal.
+// The columns are selected like those of ResultCSV, e.g. ResultTable("Host", "Name", "Reached", "Version.RouterOS").
+// If a column is unknown, the error will be logged and an empty string will be returned.
+func (devices *Devices) ResultTable(columns ...string) string {
+	selected, err := selectColumns(columns)
+	if err != nil {
+		log.Println(err.Error())
+		return ""
+	}
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columnNames(selected), "\t"))
+	for _, device := range *devices {
+		values := columnValues(selected, device)
+		for i, value := range values {
+			// tabs and line breaks of values would break the alignment
+			values[i] = strings.Join(strings.Fields(value), " ")
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+	_ = w.Flush()
+
+	return b.String()
+}
+
+// columnNames returns the names of the columns.
+func columnNames(columns []Column) []string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+
+	return names
+}
+
+// columnValues returns the values of the columns of a device.
+func columnValues(columns []Column, device Device) []string {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		values[i] = column.Value(device)
+	}
+
+	return values
+}
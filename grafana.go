@@ -0,0 +1,216 @@
+package MikrotikMonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GrafanaDevicesTarget is the target of the Grafana datasource which returns the current state of the devices as table.
+const GrafanaDevicesTarget = "devices"
+
+// GrafanaColumns are the columns of the devices table of the Grafana datasource if a query doesn't select columns.
+var GrafanaColumns = []string{"Host", "Name", "Site", "Group", "Reached", "Model", "Version.RouterOS", "Uptime", "LastPolled", "LastError"}
+
+// GrafanaHandler returns the endpoints of the SimpleJSON datasource of Grafana, which the Infinity datasource
+// understands as well, so dashboards query the monitor without an intermediate database:
+//
+//	GET  /        answers the connection test of the datasource
+//	POST /search  the targets, the series of the history and "devices", filtered by the target of the request
+//	POST /query   the samples of the history in the time range of the request, or the devices as table
+//
+// A target of the history ending with * selects all series starting with it, e.g. up:* for the reachability of
+// all devices. The columns of the devices table are selected by the data of the target, e.g. {"columns": ["Host",
+// "Health"]}, as the columns of ResultCSV, GrafanaColumns without.
+func (monitor *Monitor) GrafanaHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		var request struct {
+			Target string `json:"target"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&request); err != nil && err != io.EOF {
+			http.Error(w, fmt.Sprintf("invalid search: %v", err), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, monitor.grafanaSearch(requestScope(r), request.Target))
+	})
+	mux.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		var request grafanaQuery
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf("invalid query: %v", err), http.StatusBadRequest)
+			return
+		}
+		response, err := monitor.grafanaQuery(requestScope(r), request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, response)
+	})
+
+	return mux
+}
+
+// grafanaQuery is the request of the /query endpoint.
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+		RefID  string `json:"refId"`
+		Type   string `json:"type"`
+		Data   struct {
+			Columns []string `json:"columns"`
+		} `json:"data"`
+	} `json:"targets"`
+}
+
+// grafanaSeries is a series of the history in the response of the /query endpoint,
+// the datapoints are pairs of value and milliseconds since the epoch.
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	RefID      string       `json:"refId,omitempty"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// grafanaTable is a table in the response of the /query endpoint.
+type grafanaTable struct {
+	Type    string              `json:"type"`
+	RefID   string              `json:"refId,omitempty"`
+	Columns []map[string]string `json:"columns"`
+	Rows    [][]any             `json:"rows"`
+}
+
+// grafanaSearch returns the sorted targets of the sites of the scope containing the text.
+func (monitor *Monitor) grafanaSearch(scope siteScope, text string) []string {
+	targets := []string{}
+	if strings.Contains(GrafanaDevicesTarget, text) {
+		targets = append(targets, GrafanaDevicesTarget)
+	}
+	var keys []string
+	if monitor.History != nil {
+		keys = monitor.scopeKeys(scope, monitor.History.Keys())
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.Contains(key, text) {
+			targets = append(targets, key)
+		}
+	}
+
+	return targets
+}
+
+// grafanaQuery returns the series and tables of the targets of a query, limited to the sites of the scope.
+func (monitor *Monitor) grafanaQuery(scope siteScope, request grafanaQuery) ([]any, error) {
+	response := []any{}
+	for _, target := range request.Targets {
+		if target.Target == GrafanaDevicesTarget || target.Type == "table" {
+			table, err := monitor.grafanaTable(scope, target.Data.Columns)
+			if err != nil {
+				return nil, err
+			}
+			table.RefID = target.RefID
+			response = append(response, table)
+			continue
+		}
+		if monitor.History == nil || target.Target == "" {
+			continue
+		}
+
+		keys := []string{target.Target}
+		if prefix, found := strings.CutSuffix(target.Target, "*"); found {
+			keys = nil
+			for _, key := range monitor.History.Keys() {
+				if strings.HasPrefix(key, prefix) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+		}
+		keys = monitor.scopeKeys(scope, keys)
+		for _, key := range keys {
+			series := grafanaSeries{Target: key, RefID: target.RefID, Datapoints: [][2]float64{}}
+			for _, sample := range monitor.History.Get(key, request.Range.From, request.Range.To) {
+				series.Datapoints = append(series.Datapoints, [2]float64{sample.Value, float64(sample.Time.UnixMilli())})
+			}
+			response = append(response, series)
+		}
+	}
+
+	return response, nil
+}
+
+// grafanaTable returns the current state of the devices of the sites of the scope as table with the columns, GrafanaColumns without.
+// Numbers and times are typed columns, so Grafana can format and sort them, all other values are text.
+func (monitor *Monitor) grafanaTable(scope siteScope, names []string) (grafanaTable, error) {
+	if len(names) == 0 {
+		names = GrafanaColumns
+	}
+	columns, err := selectColumns(names)
+	if err != nil {
+		return grafanaTable{}, err
+	}
+
+	table := grafanaTable{Type: "table", Rows: [][]any{}}
+	for _, column := range columns {
+		table.Columns = append(table.Columns, map[string]string{"text": column.Name, "type": grafanaType(column)})
+	}
+	for _, device := range scope.devices(monitor.Devices()) {
+		row := make([]any, len(columns))
+		for i, column := range columns {
+			value := reflect.ValueOf(device).FieldByIndex(column.index)
+			switch grafanaType(column) {
+			case "time":
+				if t := value.Interface().(time.Time); !t.IsZero() {
+					row[i] = t.UnixMilli()
+				}
+			case "number":
+				row[i] = value.Interface()
+			default:
+				row[i] = formatValue(value)
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table, nil
+}
+
+// grafanaType returns the Grafana type of a column, time, number or string.
+func grafanaType(column Column) string {
+	fieldType := reflect.TypeOf(Device{}).FieldByIndex(column.index).Type
+	switch {
+	case fieldType == reflect.TypeOf(time.Time{}):
+		return "time"
+	case fieldType == reflect.TypeOf(time.Duration(0)):
+		return "string"
+	case fieldType.Kind() >= reflect.Int && fieldType.Kind() <= reflect.Float64:
+		return "number"
+	}
+
+	return "string"
+}
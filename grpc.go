@@ -0,0 +1,475 @@
+package MikrotikMonitor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// grpcService is the name of the gRPC service defined in proto/mikrotikmonitor.proto.
+const grpcService = "mikrotikmonitor.v1.MikrotikMonitor"
+
+// Status codes of gRPC.
+const (
+	grpcOK                 = 0
+	grpcInvalidArgument    = 3
+	grpcNotFound           = 5
+	grpcAlreadyExists      = 6
+	grpcPermissionDenied   = 7
+	grpcResourceExhausted  = 8
+	grpcFailedPrecondition = 9
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+)
+
+// grpcMaxMessage is the size of the largest request message, the default of gRPC.
+const grpcMaxMessage = 4 << 20
+
+// grpcChanges are the methods of the gRPC service which change the state of the monitor and need the admin role.
+var grpcChanges = map[string]bool{
+	"AddDevice":     true,
+	"UpdateDevice":  true,
+	"DeleteDevice":  true,
+	"AddSilence":    true,
+	"RemoveSilence": true,
+	"CompleteTask":  true,
+}
+
+// grpcError is an error of a gRPC call with its status code.
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (err grpcError) Error() string {
+	return err.message
+}
+
+// grpcRequest is a decoded request message.
+type grpcRequest []protoField
+
+// grpcHandler serves the gRPC service of proto/mikrotikmonitor.proto. gRPC needs HTTP/2, which net/http only
+// negotiates over TLS. Compressed messages aren't supported, clients have to send them uncompressed.
+func (monitor *Monitor) grpcHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/grpc" && contentType != "application/grpc+proto" {
+		http.Error(w, fmt.Sprintf("unsupported content type %q", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.ProtoMajor != 2 {
+		http.Error(w, "gRPC needs HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Accept-Encoding", "identity")
+	w.WriteHeader(http.StatusOK)
+
+	method := strings.TrimPrefix(r.URL.Path, "/"+grpcService+"/")
+	request, err := readGRPCMessage(r.Body)
+	if err == nil && method == "WatchDevices" {
+		monitor.watchDevices(w, r, request)
+		return
+	}
+	var response *protoWriter
+	if err == nil {
+		response, err = monitor.grpcCall(requestScope(r), method, request)
+	}
+	if err == nil {
+		err = writeGRPCMessage(w, response)
+	}
+	writeGRPCStatus(w, err)
+}
+
+// grpcCall calls a unary method of the gRPC service for a caller limited to the sites of the scope.
+func (monitor *Monitor) grpcCall(scope siteScope, method string, request grpcRequest) (*protoWriter, error) {
+	if (method == "AddDevice" || method == "UpdateDevice" || method == "DeleteDevice") && !scope.all() {
+		return nil, grpcError{grpcPermissionDenied, errAllSites.Error()}
+	}
+	var response protoWriter
+	switch method {
+	case "ListDevices":
+		hosts := request.strings(1)
+		for _, device := range scope.devices(monitor.Devices()) {
+			if len(hosts) == 0 || slices.Contains(hosts, device.Host) {
+				response.message(1, func(p *protoWriter) { writeDevice(p, device) })
+			}
+		}
+	case "GetDevice":
+		device, found := monitor.Device(request.string(1))
+		if !found || !scope.allows(device.Site) {
+			return nil, grpcError{grpcNotFound, ErrDeviceNotFound.Error()}
+		}
+		writeDevice(&response, device)
+	case "AddDevice":
+		device, err := monitor.AddDevice([]byte(request.string(1)))
+		if err != nil {
+			return nil, deviceError(err)
+		}
+		writeDevice(&response, device)
+	case "UpdateDevice":
+		update := monitor.UpdateDevice
+		if request.bool(3) {
+			update = monitor.PatchDevice
+		}
+		device, err := update(request.string(1), []byte(request.string(2)))
+		if err != nil {
+			return nil, deviceError(err)
+		}
+		writeDevice(&response, device)
+	case "DeleteDevice":
+		if err := monitor.DeleteDevice(request.string(1)); err != nil {
+			return nil, deviceError(err)
+		}
+	case "ListEvents":
+		host := request.string(1)
+		for _, event := range monitor.Events() {
+			if (host == "" || event.Host == host) && scope.allows(event.Site) {
+				response.message(1, func(p *protoWriter) { writeEvent(p, event) })
+			}
+		}
+	case "ListSilences":
+		for _, silence := range filterSites(scope, monitor.Silences(), func(silence Silence) string { return silence.Site }) {
+			response.message(1, func(p *protoWriter) { writeSilence(p, silence) })
+		}
+	case "AddSilence":
+		silence, err := request.silence()
+		if err != nil {
+			return nil, err
+		}
+		if silence, err = scope.silence(silence); err != nil {
+			return nil, grpcError{grpcPermissionDenied, err.Error()}
+		}
+		if silence, err = monitor.AddSilence(silence); err != nil {
+			return nil, grpcError{grpcInvalidArgument, fmt.Sprintf("invalid silence: %v", err)}
+		}
+		writeSilence(&response, silence)
+	case "RemoveSilence":
+		if err := monitor.removeSilence(scope, request.string(1)); err != nil {
+			return nil, grpcError{grpcNotFound, err.Error()}
+		}
+	case "ListTasks":
+		for _, task := range filterSites(scope, monitor.Tasks(), func(task TaskStatus) string { return task.Site }) {
+			response.message(1, func(p *protoWriter) {
+				p.string(1, task.Task)
+				p.string(2, task.Scope)
+				p.time(3, task.Due)
+				p.time(4, task.Next)
+				p.time(5, task.Completed)
+				p.string(6, task.Site)
+			})
+		}
+	case "CompleteTask":
+		if err := monitor.completeTask(scope, request.string(1), request.string(2)); err != nil {
+			return nil, grpcError{grpcNotFound, err.Error()}
+		}
+	default:
+		return nil, grpcError{grpcUnimplemented, fmt.Sprintf("unknown method %s", method)}
+	}
+
+	return &response, nil
+}
+
+// watchDevices streams the current state of the devices and their state after every poll until the client cancels
+// the call. Devices whose polls the stream misses because the client is too slow are sent with their next poll.
+func (monitor *Monitor) watchDevices(w http.ResponseWriter, r *http.Request, request grpcRequest) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeGRPCStatus(w, grpcError{grpcInternal, "streaming unsupported"})
+		return
+	}
+	// subscribe first so no poll gets lost between the current state and the stream
+	messages, unsubscribe := monitor.subscribe()
+	defer unsubscribe()
+	hosts := request.strings(1)
+	scope := requestScope(r)
+
+	for _, device := range scope.devices(monitor.Devices()) {
+		if len(hosts) == 0 || slices.Contains(hosts, device.Host) {
+			if err := writeGRPCDevice(w, device); err != nil {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case message := <-messages:
+			if message.kind != "device" || len(hosts) > 0 && !slices.Contains(hosts, message.host) || !scope.allows(message.site) {
+				continue
+			}
+			device, found := monitor.Device(message.host)
+			if !found {
+				continue
+			}
+			if err := writeGRPCDevice(w, device); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// readGRPCMessage reads the single message of a request.
+func readGRPCMessage(body io.Reader) (grpcRequest, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(body, header[:]); err != nil {
+		return nil, grpcError{grpcInvalidArgument, fmt.Sprintf("unable to read request message, %v", err)}
+	}
+	if header[0] != 0 {
+		return nil, grpcError{grpcUnimplemented, "compressed messages are unsupported"}
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > grpcMaxMessage {
+		return nil, grpcError{grpcResourceExhausted, fmt.Sprintf("request message larger than %d bytes", grpcMaxMessage)}
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(body, message); err != nil {
+		return nil, grpcError{grpcInvalidArgument, fmt.Sprintf("unable to read request message, %v", err)}
+	}
+	fields, err := protoFields(message)
+	if err != nil {
+		return nil, grpcError{grpcInvalidArgument, err.Error()}
+	}
+
+	return fields, nil
+}
+
+// writeGRPCMessage writes a message of the response with its length prefix.
+func writeGRPCMessage(w io.Writer, message *protoWriter) error {
+	header := binary.BigEndian.AppendUint32([]byte{0}, uint32(message.Len()))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(message.Bytes())
+
+	return err
+}
+
+// writeGRPCDevice writes a device as message of the response.
+func writeGRPCDevice(w io.Writer, device Device) error {
+	var message protoWriter
+	writeDevice(&message, device)
+
+	return writeGRPCMessage(w, &message)
+}
+
+// writeGRPCStatus ends the response with the status of the call as trailers.
+func writeGRPCStatus(w http.ResponseWriter, err error) {
+	code, message := grpcOK, ""
+	if err != nil {
+		code, message = grpcInternal, err.Error()
+		var status grpcError
+		if errors.As(err, &status) {
+			code = status.code
+		}
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", grpcPercentEncode(message))
+	}
+}
+
+// grpcPercentEncode encodes the status message of a call like gRPC: the bytes besides printable ASCII and %
+// are percent-encoded.
+func grpcPercentEncode(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// deviceError returns the gRPC status of an error of a change of a device, see deviceStatus.
+func deviceError(err error) error {
+	code := grpcInternal
+	switch {
+	case errors.Is(err, ErrDeviceNotFound):
+		code = grpcNotFound
+	case errors.Is(err, ErrDeviceExists):
+		code = grpcAlreadyExists
+	case errors.Is(err, ErrDeviceReadOnly):
+		code = grpcFailedPrecondition
+	case errors.Is(err, ErrInvalidDevice):
+		code = grpcInvalidArgument
+	}
+
+	return grpcError{code, err.Error()}
+}
+
+// string returns the last value of a string field like protobuf does.
+func (request grpcRequest) string(number int) string {
+	value := ""
+	for _, field := range request {
+		if field.Number == number {
+			value = string(field.Data)
+		}
+	}
+
+	return value
+}
+
+// strings returns the values of a repeated string field.
+func (request grpcRequest) strings(number int) []string {
+	var values []string
+	for _, field := range request {
+		if field.Number == number {
+			values = append(values, string(field.Data))
+		}
+	}
+
+	return values
+}
+
+// bool returns the value of a bool field.
+func (request grpcRequest) bool(number int) bool {
+	value := false
+	for _, field := range request {
+		if field.Number == number {
+			value = field.Value != 0
+		}
+	}
+
+	return value
+}
+
+// silence decodes a Silence message.
+func (request grpcRequest) silence() (Silence, error) {
+	var silence Silence
+	for _, field := range request {
+		var err error
+		switch field.Number {
+		case 2:
+			silence.Host = string(field.Data)
+		case 3:
+			silence.Group = string(field.Data)
+		case 4:
+			silence.Tag = string(field.Data)
+		case 5:
+			silence.Type = string(field.Data)
+		case 6:
+			silence.Start, err = protoTime(field.Data)
+		case 7:
+			silence.End, err = protoTime(field.Data)
+		case 8:
+			silence.Weekly = string(field.Data)
+		case 9:
+			silence.Duration, err = protoDuration(field.Data)
+		case 10:
+			silence.Comment = string(field.Data)
+		case 11:
+			silence.Site = string(field.Data)
+		}
+		if err != nil {
+			return Silence{}, grpcError{grpcInvalidArgument, fmt.Sprintf("invalid silence: %v", err)}
+		}
+	}
+
+	return silence, nil
+}
+
+// writeDevice encodes a Device message.
+func writeDevice(p *protoWriter, device Device) {
+	p.string(1, device.Host)
+	p.string(2, device.Name)
+	p.string(3, device.Site)
+	p.string(4, device.Group)
+	p.strings(5, device.Tags)
+	p.stringMap(6, device.Labels)
+	p.bool(7, device.Reached)
+	p.time(8, device.LastPolled)
+	p.string(9, device.LastError)
+	p.string(10, device.Model)
+	p.string(11, device.SerialNumber)
+	p.message(12, func(p *protoWriter) {
+		p.string(1, device.Version.RouterOS)
+		p.string(2, device.Version.Bootloader)
+		p.string(3, device.Version.Latest)
+		p.string(4, device.Version.LatestRelease)
+		p.bool(5, device.Version.UpdateAvailable)
+	})
+	p.duration(13, device.Uptime)
+	p.message(14, func(p *protoWriter) {
+		p.bool(1, device.Availability.Down)
+		p.time(2, device.Availability.Since)
+		p.bool(3, device.Availability.Suppressed)
+		p.double(4, device.Availability.Penalty)
+	})
+	p.message(15, func(p *protoWriter) {
+		p.int64(1, int64(device.Health.CPULoad))
+		p.double(2, device.Health.Temperature)
+	})
+	for _, iface := range device.Interfaces {
+		p.message(16, func(p *protoWriter) {
+			p.int64(1, int64(iface.Index))
+			p.string(2, iface.Name)
+			p.uint64(3, iface.InOctets)
+			p.uint64(4, iface.OutOctets)
+			p.uint64(5, iface.InPackets)
+			p.uint64(6, iface.OutPackets)
+			p.uint64(7, iface.InErrors)
+			p.uint64(8, iface.OutErrors)
+			p.uint64(9, iface.InDiscards)
+			p.uint64(10, iface.OutDiscards)
+			p.message(11, func(p *protoWriter) {
+				p.double(1, iface.Rates.InBits)
+				p.double(2, iface.Rates.OutBits)
+				p.double(3, iface.Rates.InPackets)
+				p.double(4, iface.Rates.OutPackets)
+			})
+		})
+	}
+	p.doubleMap(17, device.Custom)
+	p.strings(18, device.Advisories)
+	p.string(19, device.Channel)
+	p.string(20, device.Backend)
+	p.string(21, device.UpdateChannel)
+}
+
+// writeEvent encodes an Event message.
+func writeEvent(p *protoWriter, event Event) {
+	p.string(1, event.ID)
+	p.string(2, event.Type)
+	p.string(3, event.Severity)
+	p.string(4, event.Host)
+	p.string(5, event.Name)
+	p.string(6, event.Group)
+	p.strings(7, event.Tags)
+	p.string(8, event.Subject)
+	p.string(9, event.Message)
+	p.string(10, event.Details)
+	p.time(11, event.Time)
+	p.bool(12, event.Resolved)
+	p.string(13, event.Site)
+	p.string(14, event.Metric)
+}
+
+// writeSilence encodes a Silence message.
+func writeSilence(p *protoWriter, silence Silence) {
+	p.string(1, silence.ID)
+	p.string(2, silence.Host)
+	p.string(3, silence.Group)
+	p.string(4, silence.Tag)
+	p.string(5, silence.Type)
+	p.time(6, silence.Start)
+	p.time(7, silence.End)
+	p.string(8, silence.Weekly)
+	p.duration(9, silence.Duration)
+	p.string(10, silence.Comment)
+	p.string(11, silence.Site)
+}
@@ -0,0 +1,159 @@
+package MikrotikMonitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadGRPCMessage(t *testing.T) {
+	message := func(flag byte, length uint32, content string) string {
+		return string(append(binary.BigEndian.AppendUint32([]byte{flag}, length), content...))
+	}
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"message", message(0, 4, "\x0a\x02r1"), grpcOK},
+		{"empty message", message(0, 0, ""), grpcOK},
+		{"compressed", message(1, 4, "\x0a\x02r1"), grpcUnimplemented},
+		{"larger than the maximum", message(0, grpcMaxMessage+1, ""), grpcResourceExhausted},
+		{"truncated prefix", message(0, 4, "")[:3], grpcInvalidArgument},
+		{"truncated message", message(0, 4, "\x0a\x02"), grpcInvalidArgument},
+		{"invalid message", message(0, 2, "\x0a\x02"), grpcInvalidArgument},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := readGRPCMessage(strings.NewReader(test.body))
+			if test.code == grpcOK {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if host := request.string(1); test.name == "message" && host != "r1" {
+					t.Errorf("host %q, want r1", host)
+				}
+				return
+			}
+			var status grpcError
+			if !errors.As(err, &status) || status.code != test.code {
+				t.Errorf("error %v, want status %d", err, test.code)
+			}
+		})
+	}
+}
+
+func TestWriteGRPCMessage(t *testing.T) {
+	var message protoWriter
+	message.string(1, "r1")
+	var b bytes.Buffer
+	if err := writeGRPCMessage(&b, &message); err != nil {
+		t.Fatal(err)
+	}
+	// uncompressed, the length as big endian uint32 and the message
+	if got, want := hex.EncodeToString(b.Bytes()), "00"+"00000004"+"0a027231"; got != want {
+		t.Errorf("framed %s, want %s", got, want)
+	}
+}
+
+func TestGRPCPercentEncode(t *testing.T) {
+	tests := map[string]string{
+		"device not found":   "device not found",
+		"100% down":          "100%25 down",
+		"line\nbreak":        "line%0Abreak",
+		"größe":              "gr%C3%B6%C3%9Fe",
+		"~ and space are ok": "~ and space are ok",
+	}
+	for message, want := range tests {
+		if got := grpcPercentEncode(message); got != want {
+			t.Errorf("grpcPercentEncode(%q) = %q, want %q", message, got, want)
+		}
+	}
+}
+
+func TestGRPCHandler(t *testing.T) {
+	monitor := NewMonitor("", time.Minute)
+	monitor.devices = Devices{{Host: "r1", Name: "core-1", Site: "acme"}}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(monitor.grpcHandler))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	call := func(method string, body string) (*http.Response, []byte) {
+		t.Helper()
+		request, err := http.NewRequest(http.MethodPost, server.URL+"/"+grpcService+"/"+method, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/grpc")
+		request.Header.Set("TE", "trailers")
+		response, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		// the trailers are only available after the body was read
+		content, err := io.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response, content
+	}
+	frame := func(message string) string {
+		return string(append(binary.BigEndian.AppendUint32([]byte{0}, uint32(len(message))), message...))
+	}
+	var device protoWriter
+	writeDevice(&device, Device{Host: "r1", Name: "core-1", Site: "acme"})
+
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		want    string
+		status  string
+		message string
+	}{
+		{"unary call", "GetDevice", frame("\x0a\x02r1"), frame(device.String()), "0", ""},
+		{"not found", "GetDevice", frame("\x0a\x07unknown"), "", "5", "device not found"},
+		{"unknown method", "Unknown", frame(""), "", "12", "unknown method Unknown"},
+		{"compressed", "GetDevice", "\x01\x00\x00\x00\x04\x0a\x02r1", "", "12", "compressed messages are unsupported"},
+		{"truncated", "GetDevice", "\x00\x00\x00\x00\x04\x0a", "", "3", "unable to read request message, unexpected EOF"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, content := call(test.method, test.body)
+			if response.ProtoMajor != 2 || response.StatusCode != http.StatusOK {
+				t.Fatalf("%s %s, want HTTP/2.0 200", response.Proto, response.Status)
+			}
+			if contentType := response.Header.Get("Content-Type"); contentType != "application/grpc" {
+				t.Errorf("content type %q, want application/grpc", contentType)
+			}
+			if string(content) != test.want {
+				t.Errorf("messages %x, want %x", content, test.want)
+			}
+			if status := response.Trailer.Get("Grpc-Status"); status != test.status {
+				t.Errorf("grpc-status %q, want %q", status, test.status)
+			}
+			if message := response.Trailer.Get("Grpc-Message"); message != test.message {
+				t.Errorf("grpc-message %q, want %q", message, test.message)
+			}
+		})
+	}
+
+	// without HTTP/2 there are no trailers, the call is refused before it starts
+	request := httptest.NewRequest(http.MethodPost, "/"+grpcService+"/GetDevice", strings.NewReader(frame("\x0a\x02r1")))
+	request.Header.Set("Content-Type", "application/grpc")
+	w := httptest.NewRecorder()
+	monitor.grpcHandler(w, request)
+	if w.Code != http.StatusHTTPVersionNotSupported {
+		t.Errorf("HTTP/1.1 status %d, want %d", w.Code, http.StatusHTTPVersionNotSupported)
+	}
+}
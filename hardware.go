@@ -0,0 +1,172 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// OIDs of the hardware scalars of the MikroTik MIB and the HOST-RESOURCES MIB.
+const (
+	oidBoardName          = ".1.3.6.1.4.1.14988.1.1.7.8.0"
+	oidLicenseLevel       = ".1.3.6.1.4.1.14988.1.1.4.3.0"
+	oidProcessorFrequency = ".1.3.6.1.4.1.14988.1.1.3.14.0"
+	oidMemorySize         = ".1.3.6.1.2.1.25.2.2.0"
+)
+
+// hardwareOIDs are the scalars read by GetHardware.
+var hardwareOIDs = []string{oidBoardName, oidLicenseLevel, oidProcessorFrequency, oidMemorySize}
+
+// Hardware is the hardware inventory of the device. CPUFrequency is in MHz, TotalMemory in bytes.
+// Architecture and FirmwareType, e.g. arm64 and al2, are only known if the device is read via the API.
+type Hardware struct {
+	BoardName    string `json:"BoardName"`
+	Architecture string `json:"Architecture"`
+	FirmwareType string `json:"FirmwareType"`
+	CPU          string `json:"CPU"`
+	CPUCount     int    `json:"CPUCount"`
+	CPUFrequency int    `json:"CPUFrequency"`
+	TotalMemory  uint64 `json:"TotalMemory"`
+	LicenseLevel string `json:"LicenseLevel"`
+}
+
+// GetHardware reads the hardware inventory of the device, so asset reports can be built from the devices,
+// see Inventory. Via SNMP it reads the MikroTik MIB and counts the processors of the HOST-RESOURCES MIB,
+// devices with an api block read /system/resource, /system/routerboard and /system/license instead.
+func (device *Device) GetHardware() error {
+	if !usesSNMP(device) || device.API.User != "" {
+		return device.getHardwareAPI()
+	}
+
+	hardware := Hardware{BoardName: device.Model}
+	variables, err := device.getScalars(hardwareOIDs)
+	if err != nil {
+		return fmt.Errorf("%s unable to read hardware: %v", device.Host, err)
+	}
+	for _, variable := range variables {
+		if checkValue(variable) != nil {
+			continue
+		}
+		switch variable.Name {
+		case oidBoardName:
+			if name, _ := AsString(variable); name != "" {
+				hardware.BoardName = name
+			}
+		case oidLicenseLevel:
+			if level, err := AsInt(variable); err == nil {
+				hardware.LicenseLevel = strconv.FormatInt(level, 10)
+			}
+		case oidProcessorFrequency:
+			frequency, _ := AsInt(variable)
+			hardware.CPUFrequency = int(frequency)
+		case oidMemorySize:
+			// hrMemorySize is reported in KiB
+			size, _ := AsCounter64(variable)
+			hardware.TotalMemory = size * 1024
+		}
+	}
+
+	err = device.snmp.BulkWalk(oidProcessorLoad, func(variable gosnmp.SnmpPDU) error {
+		hardware.CPUCount++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s unable to read processors: %v", device.Host, err)
+	}
+	device.Hardware = hardware
+
+	return nil
+}
+
+// getHardwareAPI reads the hardware inventory via the REST API or the binary API.
+// CHR has no RouterBOARD firmware and older versions deny reading the license to read-only users,
+// those values are left empty.
+func (device *Device) getHardwareAPI() error {
+	resource, err := device.printOne("/system/resource")
+	if err != nil {
+		return err
+	}
+
+	hardware := Hardware{
+		BoardName:    resource["board-name"],
+		Architecture: resource["architecture-name"],
+		CPU:          resource["cpu"],
+	}
+	hardware.CPUCount, _ = strconv.Atoi(resource["cpu-count"])
+	hardware.CPUFrequency, _ = strconv.Atoi(resource["cpu-frequency"])
+	hardware.TotalMemory, _ = strconv.ParseUint(resource["total-memory"], 10, 64)
+	if routerboard, err := device.printOne("/system/routerboard"); err == nil {
+		hardware.FirmwareType = routerboard["firmware-type"]
+	}
+	if license, err := device.printOne("/system/license"); err == nil {
+		// RouterBOARDs report their level as nlevel, CHR as level, e.g. p1
+		hardware.LicenseLevel = license["nlevel"]
+		if hardware.LicenseLevel == "" {
+			hardware.LicenseLevel = license["level"]
+		}
+	}
+	device.Hardware = hardware
+
+	return nil
+}
+
+// InventoryCount is the number of devices with the same values of the columns of an Inventory.
+type InventoryCount struct {
+	Values []string `json:"Values"`
+	Count  int      `json:"Count"`
+}
+
+// Inventory counts the devices by the values of the columns, e.g. Inventory("Hardware.BoardName",
+// "Capabilities.Major") for the number of devices per board and RouterOS major version. The columns are named like
+// those of ResultCSV. The counts are sorted by the values.
+func (devices *Devices) Inventory(columns ...string) ([]InventoryCount, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns to count the devices by")
+	}
+	selected, err := selectColumns(columns)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]*InventoryCount{}
+	for _, device := range *devices {
+		values := columnValues(selected, device)
+		key := strings.Join(values, "\x00")
+		if counts[key] == nil {
+			counts[key] = &InventoryCount{Values: values}
+		}
+		counts[key].Count++
+	}
+
+	inventory := make([]InventoryCount, 0, len(counts))
+	for _, count := range counts {
+		inventory = append(inventory, *count)
+	}
+	sort.Slice(inventory, func(i, j int) bool {
+		return strings.Join(inventory[i].Values, "\x00") < strings.Join(inventory[j].Values, "\x00")
+	})
+
+	return inventory, nil
+}
+
+// ResultInventory returns the Inventory of the devices as a table with aligned columns and the count as last column.
+func (devices *Devices) ResultInventory(columns ...string) (string, error) {
+	inventory, err := devices.Inventory(columns...)
+	if err != nil {
+		return "", err
+	}
+	selected, _ := selectColumns(columns)
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(append(columnNames(selected), "Count"), "\t"))
+	for _, count := range inventory {
+		fmt.Fprintln(w, strings.Join(append(count.Values, strconv.Itoa(count.Count)), "\t"))
+	}
+	_ = w.Flush()
+
+	return b.String(), nil
+}
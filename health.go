@@ -0,0 +1,116 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"strconv"
+	"strings"
+)
+
+const (
+	oidProcessorLoad = ".1.3.6.1.2.1.25.3.3.1.2"
+	oidTemperature   = ".1.3.6.1.4.1.14988.1.1.3.10.0"
+	oidGaugeName     = ".1.3.6.1.4.1.14988.1.1.3.100.1.2"
+	oidGaugeValue    = ".1.3.6.1.4.1.14988.1.1.3.100.1.3"
+)
+
+// Health is the load of the device, Temperature is in degrees Celsius and zero if the device has no sensor.
+type Health struct {
+	CPULoad     int     `json:"CPULoad"`
+	Temperature float64 `json:"Temperature"`
+}
+
+// GetHealth reads the CPU load and the temperature of the device.
+// Via SNMP the CPU load is the average of the HOST-RESOURCES processor loads, the temperature is read from
+// the MikroTik health MIB or, on RouterOS v7, from its gauge table. Other backends read /system/resource and /system/health.
+func (device *Device) GetHealth() error {
+	if !usesSNMP(device) {
+		return device.getHealthAPI()
+	}
+
+	load, cpus := 0, 0
+	err := device.snmp.BulkWalk(oidProcessorLoad, func(variable gosnmp.SnmpPDU) error {
+		value, err := AsInt(variable)
+		if err != nil {
+			return nil
+		}
+		load += int(value)
+		cpus++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s unable to read CPU load: %v", device.Host, err)
+	}
+	device.Health.CPULoad = 0
+	if cpus > 0 {
+		device.Health.CPULoad = load / cpus
+	}
+
+	variables, err := device.getScalars([]string{oidTemperature})
+	if err != nil {
+		return fmt.Errorf("%s unable to read temperature: %v", device.Host, err)
+	}
+	device.Health.Temperature = 0
+	if len(variables) > 0 {
+		if temperature, err := AsFloat(variables[0]); err == nil {
+			// the temperature is reported in tenths of a degree
+			device.Health.Temperature = temperature / 10
+			return nil
+		}
+	}
+
+	gauges := map[string]string{}
+	err = device.snmp.BulkWalk(oidGaugeName, func(variable gosnmp.SnmpPDU) error {
+		if value, err := AsString(variable); err == nil {
+			gauges[strings.TrimPrefix(variable.Name, oidGaugeName)] = value
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s unable to read gauges: %v", device.Host, err)
+	}
+	for index, name := range gauges {
+		if name != "temperature" && name != "cpu-temperature" {
+			continue
+		}
+		result, err := device.snmp.Get([]string{oidGaugeValue + index})
+		if err != nil {
+			return fmt.Errorf("%s unable to read gauge %s: %v", device.Host, name, err)
+		}
+		if len(result.Variables) > 0 {
+			device.Health.Temperature, _ = AsFloat(result.Variables[0])
+		}
+		if name == "temperature" {
+			break
+		}
+	}
+
+	return nil
+}
+
+// getHealthAPI reads the health via the REST API or the binary API.
+// RouterOS v7 lists every sensor as an item with name and value, v6 returns a single item with all sensors as keys.
+func (device *Device) getHealthAPI() error {
+	resource, err := device.printOne("/system/resource")
+	if err != nil {
+		return err
+	}
+	device.Health.CPULoad, _ = strconv.Atoi(resource["cpu-load"])
+
+	sensors, err := device.Print("/system/health")
+	if err != nil {
+		return err
+	}
+	device.Health.Temperature = 0
+	for _, sensor := range sensors {
+		value, found := sensor["temperature"]
+		if name := sensor["name"]; name == "temperature" || name == "cpu-temperature" && device.Health.Temperature == 0 {
+			value, found = sensor["value"], true
+		}
+		if found {
+			device.Health.Temperature, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package MikrotikMonitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sample is a single value of a time series.
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Record is a sample together with the key of its series, as stored in a history file.
+type Record struct {
+	Key   string
+	Time  time.Time
+	Value float64
+}
+
+// History keeps time series of collected values in memory.
+// Samples older than Retention are dropped when new samples are added, a Retention of 0 keeps everything.
+// A History opened with OpenHistory additionally appends every sample to a JSON lines file.
+// It is safe for concurrent use.
+type History struct {
+	Retention time.Duration
+
+	mu     sync.Mutex
+	series map[string][]Sample
+	file   *os.File
+	writer *json.Encoder
+}
+
+// NewHistory returns an empty History which keeps samples for the given retention.
+func NewHistory(retention time.Duration) *History {
+	return &History{Retention: retention, series: map[string][]Sample{}}
+}
+
+// LoadHistory returns a History with the samples of a JSON lines file with one Record per line.
+// The file is only read, a missing file results in an empty History.
+func LoadHistory(filename string, retention time.Duration) (*History, error) {
+	history := NewHistory(retention)
+
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		history.Add(record.Key, record.Time, record.Value)
+	}
+
+	return history, scanner.Err()
+}
+
+// OpenHistory returns a History stored in a JSON lines file with one Record per line.
+// Samples of an existing file are loaded, the file is rewritten without samples older than the retention.
+// New samples are appended to the file until the History is closed.
+func OpenHistory(filename string, retention time.Duration) (*History, error) {
+	history, err := LoadHistory(filename, retention)
+	if err != nil {
+		return nil, err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return nil, err
+	}
+	encoder := json.NewEncoder(temp)
+	for _, record := range history.Records("", time.Time{}, time.Time{}) {
+		if err := encoder.Encode(record); err != nil {
+			_ = temp.Close()
+			_ = os.Remove(temp.Name())
+			return nil, err
+		}
+	}
+	if err := temp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(temp.Name(), filename); err != nil {
+		return nil, err
+	}
+
+	history.file, err = os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	history.writer = json.NewEncoder(history.file)
+
+	return history, nil
+}
+
+// Close closes the file of a History opened with OpenHistory.
+func (history *History) Close() error {
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if history.file == nil {
+		return nil
+	}
+	err := history.file.Close()
+	history.file, history.writer = nil, nil
+
+	return err
+}
+
+// Add appends a sample to the series with the given key.
+// Samples have to be added in chronological order per series.
+func (history *History) Add(key string, timestamp time.Time, value float64) {
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if history.series == nil {
+		history.series = map[string][]Sample{}
+	}
+
+	if history.writer != nil {
+		if err := history.writer.Encode(Record{Key: key, Time: timestamp, Value: value}); err != nil {
+			log.Printf("unable to store history, %v", err)
+		}
+	}
+
+	samples := append(history.series[key], Sample{Time: timestamp, Value: value})
+	if history.Retention > 0 {
+		cutoff := timestamp.Add(-history.Retention)
+		first := 0
+		for first < len(samples) && samples[first].Time.Before(cutoff) {
+			first++
+		}
+		samples = samples[first:]
+	}
+	history.series[key] = samples
+}
+
+// Get returns a copy of the samples of a series between from and to, both inclusive.
+// A zero from or to leaves that side of the range open.
+func (history *History) Get(key string, from, to time.Time) []Sample {
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	var result []Sample
+	for _, sample := range history.series[key] {
+		if !from.IsZero() && sample.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && sample.Time.After(to) {
+			continue
+		}
+		result = append(result, sample)
+	}
+
+	return result
+}
+
+// Peak returns the sample with the highest value of a series between from and to.
+// The second return value is false if the range contains no samples.
+func (history *History) Peak(key string, from, to time.Time) (Sample, bool) {
+	var peak Sample
+	found := false
+	for _, sample := range history.Get(key, from, to) {
+		if !found || sample.Value > peak.Value {
+			peak = sample
+			found = true
+		}
+	}
+
+	return peak, found
+}
+
+// Rename renames the series with the old key, appending its samples to a series with the new key.
+// The file of a History opened with OpenHistory isn't changed, after a restart the old samples are found under
+// the old key again.
+func (history *History) Rename(old, new string) {
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	samples, found := history.series[old]
+	if !found || old == new {
+		return
+	}
+	delete(history.series, old)
+	merged := append(samples, history.series[new]...)
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Time.Before(merged[j].Time) })
+	history.series[new] = merged
+}
+
+// Keys returns the keys of all series in the history.
+func (history *History) Keys() []string {
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	keys := make([]string, 0, len(history.series))
+	for key := range history.series {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// Records returns the samples of all series with the given prefix between from and to, sorted by time and key.
+// An empty prefix returns all series, a zero from or to leaves that side of the range open.
+func (history *History) Records(prefix string, from, to time.Time) []Record {
+	var records []Record
+	for _, key := range history.Keys() {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		for _, sample := range history.Get(key, from, to) {
+			records = append(records, Record{Key: key, Time: sample.Time, Value: sample.Value})
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].Time.Equal(records[j].Time) {
+			return records[i].Time.Before(records[j].Time)
+		}
+		return records[i].Key < records[j].Key
+	})
+
+	return records
+}
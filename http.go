@@ -0,0 +1,498 @@
+package MikrotikMonitor
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPageLimit is the number of items of a list endpoint without limit parameter, MaxPageLimit the largest allowed limit.
+var (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
+// Page is a page of the items of a list endpoint. Total is the number of all items.
+type Page struct {
+	Total  int
+	Offset int
+	Limit  int
+	Items  any
+}
+
+// Handler returns the HTTP API of the monitor:
+//
+//	GET    /                the web dashboard with the devices and charts of their history
+//	GET    /devices         the devices as JSON
+//	POST   /devices         adds a device to the config file, e.g. {"host": "10.0.0.5", "snmp": {"community": "public"}}
+//	GET    /devices/<host>  the device as JSON
+//	PUT    /devices/<host>  replaces the config of the device, PATCH changes the given settings, see UpdateDevice
+//	DELETE /devices/<host>  removes the device from the config file
+//	GET    /metrics         the devices, event counters and metrics of the monitor itself in the OpenMetrics text format,
+//	                        of the devices of a single site with ?site=acme
+//	GET    /healthz         the MonitorHealth as JSON, 503 Service Unavailable if it is unhealthy
+//	GET    /inventory       the number of devices per value of the columns given as by, e.g. ?by=Hardware.BoardName,Capabilities.Major
+//	GET    /events          the recent events as JSON
+//	GET    /stream          the polled devices and the events as Server-Sent Events, see streamHandler
+//	GET    /log             the entries of the event log as JSON, filtered by from and to in RFC 3339, kind, host, site
+//	                        and user, see EventLog
+//	GET    /history         the samples of the history as JSON, filtered by the key prefix and from and to in RFC 3339
+//	GET    /sla             the SLAReport of the devices, from and to in RFC 3339, format json, csv or html
+//	GET    /silences        the active and upcoming silences as JSON
+//	POST   /silences        adds a silence, e.g. {"Host": "10.0.0.1", "For": "2h", "Comment": "upgrade"}
+//	DELETE /silences/<id>   removes a silence added via the API
+//	GET    /tasks           the maintenance tasks per device or site as JSON
+//	GET    /syslog          the recent syslog entries as JSON, of a single device with ?host=10.0.0.1
+//	POST   /tasks/complete  marks a task as done, e.g. {"Task": "ups-battery", "Scope": "office"}
+//	*      /grafana/        the Grafana datasource of GrafanaHandler
+//	POST   /mikrotikmonitor.v1.MikrotikMonitor/<method>  the gRPC service of proto/mikrotikmonitor.proto, see grpcHandler
+//
+// The list endpoints return a Page of at most limit items starting at offset, sorted by the field given as sort,
+// e.g. ?limit=50&offset=100&sort=-Time for the events from the newest. A leading minus sorts descending.
+// With an http_auth block in the config file the requests need the viewer role, the ones which change the state of the
+// monitor the admin role, see Auth. Users limited to some sites only get the devices of their sites and their events,
+// silences, tasks, syslog entries, history and entries of the event log. Requests which change the state of the
+// monitor are added to the event log with their user.
+func (monitor *Monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", dashboardHandler)
+	mux.HandleFunc("/devices", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			writePage(w, r, requestScope(r).devices(monitor.Devices()), "Host")
+		case http.MethodPost:
+			if !requestScope(r).all() {
+				http.Error(w, errAllSites.Error(), http.StatusForbidden)
+				return
+			}
+			config, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			device, err := monitor.AddDevice(config)
+			if err != nil {
+				http.Error(w, err.Error(), deviceStatus(err))
+				return
+			}
+			writeJSON(w, http.StatusCreated, device)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/devices/", monitor.deviceHandler)
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		scope := requestScope(r)
+		if site := r.URL.Query().Get("site"); site != "" {
+			if !scope.allows(site) {
+				http.Error(w, errSiteScope.Error(), http.StatusForbidden)
+				return
+			}
+			scope = siteScope{site}
+		}
+		if scope.all() {
+			_, _ = io.WriteString(w, monitor.ResultOpenMetrics())
+			return
+		}
+		_, _ = io.WriteString(w, monitor.openMetrics(scope.devices(monitor.Devices()), false))
+	})
+	mux.HandleFunc("/healthz", monitor.healthHandler)
+	mux.HandleFunc("/inventory", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		devices := requestScope(r).devices(monitor.Devices())
+		inventory, err := devices.Inventory(strings.Split(r.URL.Query().Get("by"), ",")...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, inventory)
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		events := filterSites(requestScope(r), monitor.Events(), func(event Event) string { return event.Site })
+		writePage(w, r, events, "Time")
+	})
+	mux.HandleFunc("/stream", monitor.streamHandler)
+	mux.HandleFunc("/log", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		from, to, ok := queryRange(w, r)
+		if !ok {
+			return
+		}
+		query := r.URL.Query()
+		entries, err := monitor.EventLog(LogQuery{From: from, To: to, Kind: query.Get("kind"), Host: query.Get("host"),
+			Site: query.Get("site"), User: query.Get("user")})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writePage(w, r, filterSites(requestScope(r), entries, func(entry LogEntry) string { return entry.Site }), "Time")
+	})
+	mux.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		from, to, ok := queryRange(w, r)
+		if !ok {
+			return
+		}
+		var records []Record
+		if monitor.History != nil {
+			records = monitor.History.Records(r.URL.Query().Get("key"), from, to)
+		}
+		sites := sitesByHost(monitor.Devices())
+		records = filterSites(requestScope(r), records, func(record Record) string { return historyKeySite(record.Key, sites) })
+		writePage(w, r, records, "Time")
+	})
+	mux.HandleFunc("/sla", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		from, to, ok := queryRange(w, r)
+		if !ok {
+			return
+		}
+		if monitor.History == nil {
+			http.Error(w, "no history", http.StatusNotFound)
+			return
+		}
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "json"
+		}
+		contentTypes := map[string]string{"json": "application/json", "csv": "text/csv; charset=utf-8", "html": "text/html; charset=utf-8"}
+		if contentTypes[format] == "" {
+			http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", contentTypes[format])
+		devices := append(Devices{}, requestScope(r).devices(monitor.Devices())...)
+		_ = monitor.History.SLAReport(devices, from, to).Write(w, format)
+	})
+	mux.HandleFunc("/silences", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			silences := filterSites(requestScope(r), monitor.Silences(), func(silence Silence) string { return silence.Site })
+			writePage(w, r, silences, "ID")
+		case http.MethodPost:
+			monitor.postSilence(w, r)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/silences/", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodDelete) {
+			return
+		}
+		if err := monitor.removeSilence(requestScope(r), strings.TrimPrefix(r.URL.Path, "/silences/")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/tasks", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		writePage(w, r, filterSites(requestScope(r), monitor.Tasks(), func(task TaskStatus) string { return task.Site }), "Task")
+	})
+	mux.HandleFunc("/syslog", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		sites := sitesByHost(monitor.Devices())
+		entries := filterSites(requestScope(r), monitor.SyslogEntries(r.URL.Query().Get("host")),
+			func(entry SyslogEntry) string { return sites[entry.Host] })
+		writePage(w, r, entries, "Time")
+	})
+	mux.HandleFunc("/tasks/complete", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		var request struct {
+			Task  string
+			Scope string
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := monitor.completeTask(requestScope(r), request.Task, request.Scope); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.Handle("/grafana/", http.StripPrefix("/grafana", monitor.GrafanaHandler()))
+	mux.HandleFunc("/"+grpcService+"/", monitor.grpcHandler)
+
+	return monitor.authenticate(monitor.logChanges(mux))
+}
+
+// deviceHandler serves a single device, which is read, changed in the config file or removed from it.
+func (monitor *Monitor) deviceHandler(w http.ResponseWriter, r *http.Request) {
+	host := strings.TrimPrefix(r.URL.Path, "/devices/")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && !requestScope(r).all() {
+		http.Error(w, errAllSites.Error(), http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		device, found := monitor.Device(host)
+		if !found || !requestScope(r).allows(device.Site) {
+			http.Error(w, ErrDeviceNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, device)
+	case http.MethodPut, http.MethodPatch:
+		config, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		update := monitor.UpdateDevice
+		if r.Method == http.MethodPatch {
+			update = monitor.PatchDevice
+		}
+		device, err := update(host, config)
+		if err != nil {
+			http.Error(w, err.Error(), deviceStatus(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, device)
+	case http.MethodDelete:
+		if err := monitor.DeleteDevice(host); err != nil {
+			http.Error(w, err.Error(), deviceStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, PATCH, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// deviceStatus returns the HTTP status of an error of a change of a device.
+func deviceStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrDeviceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrDeviceExists), errors.Is(err, ErrDeviceReadOnly):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidDevice):
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+// postSilence adds the silence of the request body. Besides the fields of Silence, For sets the end relative
+// to the start, and Duration of weekly maintenance windows can be given as a string like "2h" as well.
+func (monitor *Monitor) postSilence(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Silence
+		For      string
+		Duration json.RawMessage
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid silence: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	silence := request.Silence
+	if len(request.Duration) > 0 {
+		var duration any
+		_ = json.Unmarshal(request.Duration, &duration)
+		switch value := duration.(type) {
+		case float64:
+			silence.Duration = time.Duration(value)
+		case string:
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid duration %q", value), http.StatusBadRequest)
+				return
+			}
+			silence.Duration = parsed
+		}
+	}
+	if request.For != "" {
+		length, err := time.ParseDuration(request.For)
+		if err != nil || length <= 0 {
+			http.Error(w, fmt.Sprintf("invalid for %q", request.For), http.StatusBadRequest)
+			return
+		}
+		if silence.Start.IsZero() {
+			silence.Start = time.Now()
+		}
+		silence.End = silence.Start.Add(length)
+	}
+
+	silence, err := requestScope(r).silence(silence)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	silence, err = monitor.AddSilence(silence)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid silence: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, silence)
+}
+
+// allowMethod reports whether the request uses the method, otherwise it responds with 405 Method Not Allowed.
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method || method == http.MethodGet && r.Method == http.MethodHead {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+	return false
+}
+
+// writePage responds with the page of the items requested by the limit, offset and sort parameters.
+// The items are sorted by defaultSort if the request has no sort parameter, the order is stable.
+func writePage[T any](w http.ResponseWriter, r *http.Request, items []T, defaultSort string) {
+	query := r.URL.Query()
+	limit, offset := DefaultPageLimit, 0
+	for _, parameter := range []struct {
+		name  string
+		value *int
+	}{{"limit", &limit}, {"offset", &offset}} {
+		if value := query.Get(parameter.name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				http.Error(w, fmt.Sprintf("invalid %s %q", parameter.name, value), http.StatusBadRequest)
+				return
+			}
+			*parameter.value = parsed
+		}
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+
+	field := query.Get("sort")
+	if field == "" {
+		field = defaultSort
+	}
+	if err := sortByField(items, field); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page := Page{Total: len(items), Offset: offset, Limit: limit}
+	// offset+limit may overflow for huge offsets
+	start := min(offset, len(items))
+	end := start + min(limit, len(items)-start)
+	page.Items = append([]T{}, items[start:end]...)
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	writeJSON(w, http.StatusOK, page)
+}
+
+// sortByField sorts the items by the exported field with the name, ignoring case, descending with a leading minus.
+// Strings, numbers, booleans and times can be sorted by.
+func sortByField[T any](items []T, field string) error {
+	descending := strings.HasPrefix(field, "-")
+	field = strings.TrimPrefix(field, "-")
+
+	var itemType T
+	structType := reflect.TypeOf(itemType)
+	if structType == nil || structType.Kind() != reflect.Struct {
+		return fmt.Errorf("unable to sort by %s", field)
+	}
+	index := -1
+	for i := 0; i < structType.NumField(); i++ {
+		if structType.Field(i).IsExported() && strings.EqualFold(structType.Field(i).Name, field) {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("unknown sort field %q", field)
+	}
+
+	var compare func(a, b reflect.Value) int
+	switch fieldType := structType.Field(index).Type; {
+	case fieldType == reflect.TypeOf(time.Time{}):
+		compare = func(a, b reflect.Value) int { return a.Interface().(time.Time).Compare(b.Interface().(time.Time)) }
+	case fieldType.Kind() == reflect.String:
+		compare = func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) }
+	case fieldType.Kind() >= reflect.Int && fieldType.Kind() <= reflect.Int64:
+		compare = func(a, b reflect.Value) int { return cmp.Compare(a.Int(), b.Int()) }
+	case fieldType.Kind() >= reflect.Uint && fieldType.Kind() <= reflect.Uint64:
+		compare = func(a, b reflect.Value) int { return cmp.Compare(a.Uint(), b.Uint()) }
+	case fieldType.Kind() == reflect.Float32 || fieldType.Kind() == reflect.Float64:
+		compare = func(a, b reflect.Value) int { return cmp.Compare(a.Float(), b.Float()) }
+	case fieldType.Kind() == reflect.Bool:
+		compare = func(a, b reflect.Value) int {
+			if a.Bool() == b.Bool() {
+				return 0
+			} else if a.Bool() {
+				return 1
+			}
+			return -1
+		}
+	default:
+		return fmt.Errorf("unable to sort by %s", field)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		result := compare(reflect.ValueOf(items[i]).Field(index), reflect.ValueOf(items[j]).Field(index))
+		if descending {
+			return result > 0
+		}
+		return result < 0
+	})
+
+	return nil
+}
+
+// queryRange returns the from and to parameters of the request in RFC 3339, zero if they are missing.
+// An invalid parameter is answered with 400 Bad Request and ok is false.
+func queryRange(w http.ResponseWriter, r *http.Request) (from, to time.Time, ok bool) {
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if value := r.URL.Query().Get(bound.name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid %s %q, use RFC 3339", bound.name, value), http.StatusBadRequest)
+				return from, to, false
+			}
+			*bound.value = parsed
+		}
+	}
+
+	return from, to, true
+}
+
+// writeJSON responds with the value marshaled to JSON.
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,67 @@
+package MikrotikMonitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestWritePage(t *testing.T) {
+	type item struct {
+		Name string
+	}
+	items := []item{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}}
+
+	tests := []struct {
+		query  string
+		status int
+		names  []string
+	}{
+		{"", http.StatusOK, []string{"a", "b", "c", "d", "e"}},
+		{"?limit=2", http.StatusOK, []string{"a", "b"}},
+		{"?limit=2&offset=2", http.StatusOK, []string{"c", "d"}},
+		{"?limit=2&offset=4", http.StatusOK, []string{"e"}},
+		{"?offset=5", http.StatusOK, []string{}},
+		{"?offset=100", http.StatusOK, []string{}},
+		{"?offset=9223372036854775807", http.StatusOK, []string{}},
+		{"?limit=9223372036854775807&offset=1", http.StatusOK, []string{"b", "c", "d", "e"}},
+		{"?limit=0", http.StatusOK, []string{}},
+		{"?sort=-Name&limit=2", http.StatusOK, []string{"e", "d"}},
+		{"?offset=-1", http.StatusBadRequest, nil},
+		{"?limit=x", http.StatusBadRequest, nil},
+		{"?offset=9223372036854775808", http.StatusBadRequest, nil},
+		{"?sort=Unknown", http.StatusBadRequest, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writePage(w, httptest.NewRequest(http.MethodGet, "/items"+test.query, nil), append([]item{}, items...), "Name")
+
+			if w.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			var page struct {
+				Total int
+				Items []item
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			if page.Total != len(items) {
+				t.Errorf("total %d, want %d", page.Total, len(items))
+			}
+			names := []string{}
+			for _, item := range page.Items {
+				names = append(names, item.Name)
+			}
+			if !slices.Equal(names, test.names) {
+				t.Errorf("items %v, want %v", names, test.names)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// EventIdentityMoved is the type of events raised when a device shows up under another host, the subject is
+// the Identity of the device.
+const EventIdentityMoved = "IdentityMoved"
+
+// Identity returns the stable identity of the device: its serial number, the software ID of its license for devices
+// without serial number like CHR, or its host as long as neither is known.
+func (device *Device) Identity() string {
+	switch {
+	case device.SerialNumber != "":
+		return device.SerialNumber
+	case device.SoftwareID != "":
+		return device.SoftwareID
+	}
+
+	return device.Host
+}
+
+// reconcile remembers the host of a polled device by its Identity. If the device was polled under another host
+// before, which isn't part of the config anymore, e.g. after a change of its IP address or host name, the history,
+// the recent events and the alert states of the old host are moved to the new host and an IdentityMoved event is
+// returned. The identities are only known while the monitor is running.
+func (monitor *Monitor) reconcile(device Device) []Event {
+	identity := device.Identity()
+	if !device.Reached || identity == device.Host {
+		return nil
+	}
+
+	monitor.mu.Lock()
+	if monitor.identities == nil {
+		monitor.identities = map[string]string{}
+	}
+	old, known := monitor.identities[identity]
+	monitor.identities[identity] = device.Host
+	_, configured := monitor.configs[old]
+	moved := known && old != device.Host && !configured
+	if moved {
+		monitor.moveHost(old, device.Host)
+	}
+	monitor.mu.Unlock()
+
+	if !moved {
+		return nil
+	}
+	if monitor.History != nil {
+		for _, key := range monitor.History.Keys() {
+			if name, found := strings.CutSuffix(key, ":"+old); found {
+				monitor.History.Rename(key, name+":"+device.Host)
+			}
+		}
+	}
+	if monitor.Rules != nil {
+		monitor.Rules.moveHost(old, device.Host)
+	}
+	log.Printf("%s is the device %s polled as %s before", device.Host, identity, old)
+
+	return []Event{device.NewEvent(EventIdentityMoved, SeverityInfo, identity, fmt.Sprintf("device moved from %s to %s", old, device.Host))}
+}
+
+// moveHost moves the recent events, the event counters and the notification states of a host to another host.
+// The caller has to hold the lock.
+func (monitor *Monitor) moveHost(old, new string) {
+	for i := range monitor.events {
+		if monitor.events[i].Host == old {
+			monitor.events[i].Host = new
+		}
+	}
+	for key, count := range monitor.eventCounts {
+		if key[0] == old {
+			delete(monitor.eventCounts, key)
+			count.host = new
+			monitor.eventCounts[[2]string{new, key[1]}] = count
+		}
+	}
+	for key, state := range monitor.delivered {
+		if key[0] == old {
+			delete(monitor.delivered, key)
+			monitor.delivered[[3]string{new, key[1], key[2]}] = state
+		}
+	}
+}
+
+// moveHost moves the states of the rules of a host to another host, so firing rules aren't raised again.
+func (engine *RuleEngine) moveHost(old, new string) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	for key, state := range engine.states {
+		if name, found := strings.CutSuffix(key, "\x00"+old); found {
+			delete(engine.states, key)
+			engine.states[name+"\x00"+new] = state
+		}
+	}
+}
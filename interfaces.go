@@ -0,0 +1,105 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	oidIfName        = ".1.3.6.1.2.1.31.1.1.1.1"
+	oidIfHCInOctets  = ".1.3.6.1.2.1.31.1.1.1.6"
+	oidIfHCOutOctets = ".1.3.6.1.2.1.31.1.1.1.10"
+	oidIfInUcastPkts = ".1.3.6.1.2.1.2.2.1.11"
+	oidIfInDiscards  = ".1.3.6.1.2.1.2.2.1.13"
+	oidIfInErrors    = ".1.3.6.1.2.1.2.2.1.14"
+	oidIfOutUcast    = ".1.3.6.1.2.1.2.2.1.17"
+	oidIfOutDiscards = ".1.3.6.1.2.1.2.2.1.19"
+	oidIfOutErrors   = ".1.3.6.1.2.1.2.2.1.20"
+)
+
+type Interface struct {
+	Index       int    `json:"Index"`
+	Name        string `json:"Name"`
+	InOctets    uint64 `json:"InOctets"`
+	OutOctets   uint64 `json:"OutOctets"`
+	InPackets   uint64 `json:"InPackets"`
+	OutPackets  uint64 `json:"OutPackets"`
+	InErrors    uint64 `json:"InErrors"`
+	OutErrors   uint64 `json:"OutErrors"`
+	InDiscards  uint64 `json:"InDiscards"`
+	OutDiscards uint64 `json:"OutDiscards"`
+	Rates       Rates  `json:"Rates"`
+}
+
+// GetInterfaces walks the IF-MIB and populates the Interfaces slice with the counters of every interface.
+// The interfaces are sorted by their index.
+// The SNMP connection of the device has to be established already.
+func (device *Device) GetInterfaces() error {
+	interfaces := map[int]*Interface{}
+	get := func(index int) *Interface {
+		if _, ok := interfaces[index]; !ok {
+			interfaces[index] = &Interface{Index: index}
+		}
+		return interfaces[index]
+	}
+
+	columns := []struct {
+		oid string
+		set func(iface *Interface, variable gosnmp.SnmpPDU)
+	}{
+		{oidIfName, func(iface *Interface, variable gosnmp.SnmpPDU) {
+			iface.Name, _ = AsString(variable)
+		}},
+		{oidIfHCInOctets, func(iface *Interface, variable gosnmp.SnmpPDU) {
+			iface.InOctets, _ = AsCounter64(variable)
+		}},
+		{oidIfHCOutOctets, func(iface *Interface, variable gosnmp.SnmpPDU) {
+			iface.OutOctets, _ = AsCounter64(variable)
+		}},
+		{oidIfInUcastPkts, func(iface *Interface, variable gosnmp.SnmpPDU) {
+			iface.InPackets, _ = AsCounter64(variable)
+		}},
+		{oidIfOutUcast, func(iface *Interface, variable gosnmp.SnmpPDU) {
+			iface.OutPackets, _ = AsCounter64(variable)
+		}},
+		{oidIfInErrors, func(iface *Interface, variable gosnmp.SnmpPDU) {
+			iface.InErrors, _ = AsCounter64(variable)
+		}},
+		{oidIfOutErrors, func(iface *Interface, variable gosnmp.SnmpPDU) {
+			iface.OutErrors, _ = AsCounter64(variable)
+		}},
+		{oidIfInDiscards, func(iface *Interface, variable gosnmp.SnmpPDU) {
+			iface.InDiscards, _ = AsCounter64(variable)
+		}},
+		{oidIfOutDiscards, func(iface *Interface, variable gosnmp.SnmpPDU) {
+			iface.OutDiscards, _ = AsCounter64(variable)
+		}},
+	}
+
+	for _, column := range columns {
+		err := device.snmp.BulkWalk(column.oid, func(variable gosnmp.SnmpPDU) error {
+			index, err := strconv.Atoi(strings.TrimPrefix(variable.Name, column.oid+"."))
+			if err != nil {
+				return nil
+			}
+			column.set(get(index), variable)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s unable to read interfaces: %v", device.Host, err)
+		}
+	}
+
+	device.Interfaces = make([]Interface, 0, len(interfaces))
+	for _, iface := range interfaces {
+		device.Interfaces = append(device.Interfaces, *iface)
+	}
+	sort.Slice(device.Interfaces, func(i, j int) bool {
+		return device.Interfaces[i].Index < device.Interfaces[j].Index
+	})
+
+	return nil
+}
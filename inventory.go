@@ -0,0 +1,296 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Inventory is a source of devices besides the config file, e.g. an IPAM. Devices returns the devices as YAML
+// mappings with the keys of the devices block, so they get the snmp_defaults, group channels, custom OIDs and
+// service checks, environment variables and secrets like the devices of the config file.
+type Inventory interface {
+	Devices(ctx context.Context) ([]*yaml.Node, error)
+}
+
+// InventorySource is an entry of the inventory block of the config file. Type selects the inventory, netbox or
+// ansible, its settings are in the same entry. Fields maps fields of the inventory, custom fields of NetBox or host
+// variables of Ansible, to settings of the devices block, e.g. snmp_community to snmp.community. The inventory is
+// read again every Refresh, default 5m, while the monitor is running.
+type InventorySource struct {
+	Type    string
+	Refresh time.Duration
+	Fields  map[string]string
+	NetBox  `yaml:",inline"`
+	Ansible `yaml:",inline"`
+}
+
+// inventory returns the Inventory of the source.
+func (source InventorySource) inventory() (Inventory, error) {
+	switch source.Type {
+	case "netbox":
+		if source.URL == "" {
+			return nil, fmt.Errorf("netbox inventory without url")
+		}
+		netbox := source.NetBox
+		netbox.Fields = source.Fields
+		return &netbox, nil
+	case "ansible":
+		if source.File == "" {
+			return nil, fmt.Errorf("ansible inventory without file")
+		}
+		ansible := source.Ansible
+		ansible.Fields = source.Fields
+		return &ansible, nil
+	default:
+		return nil, fmt.Errorf("unknown inventory type %q", source.Type)
+	}
+}
+
+// inventoryTimeout is the time reading the devices of a source may take, so a hanging source doesn't block a reload.
+const inventoryTimeout = 2 * time.Minute
+
+// refresh returns the interval the source is read again.
+func (source InventorySource) refresh() time.Duration {
+	if source.Refresh <= 0 {
+		return 5 * time.Minute
+	}
+	return source.Refresh
+}
+
+// LoadInventory reads the inventory block of the config file and validates it.
+func LoadInventory(filename string) ([]InventorySource, error) {
+	documents, err := readConfigDocuments(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadInventory(documents)
+}
+
+// loadInventory is LoadInventory with the parsed documents of the config files.
+func loadInventory(documents []configDocument) ([]InventorySource, error) {
+	var parser struct {
+		Inventory []InventorySource `yaml:"inventory"`
+	}
+
+	if err := decodeConfig(documents, &parser); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for i, source := range parser.Inventory {
+		if _, err := source.inventory(); err != nil {
+			errs = append(errs, fmt.Errorf("inventory %d: %v", i+1, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid inventory in config file:\n%v", err)
+	}
+
+	return parser.Inventory, nil
+}
+
+// inventoryRefresh returns the shortest refresh interval of the sources, zero without sources.
+func inventoryRefresh(sources []InventorySource) time.Duration {
+	var refresh time.Duration
+	for _, source := range sources {
+		if refresh == 0 || source.refresh() < refresh {
+			refresh = source.refresh()
+		}
+	}
+
+	return refresh
+}
+
+// NetBox is an Inventory of the devices of NetBox, e.g. the routers of a role with a monitoring tag. Devices are
+// filtered by the slugs of Roles, Tags and Sites and by Status, default active, and need a primary IP, which becomes
+// their host. Their name, site slug, role slug as group and tag slugs are taken over. Fields maps custom fields of
+// the devices to settings of the devices block, e.g. snmp_community to snmp.community or snmp_version to snmp.version.
+// Token defaults to the NETBOX_TOKEN environment variable.
+type NetBox struct {
+	URL    string
+	Token  string
+	Roles  []string
+	Tags   []string
+	Sites  []string
+	Status string
+	Fields map[string]string `yaml:"-"`
+
+	Client *http.Client `yaml:"-"`
+}
+
+// netboxDevice is a device of the NetBox API.
+type netboxDevice struct {
+	Name      string `json:"name"`
+	PrimaryIP *struct {
+		Address string `json:"address"`
+	} `json:"primary_ip"`
+	Site *struct {
+		Slug string `json:"slug"`
+	} `json:"site"`
+	Role *struct {
+		Slug string `json:"slug"`
+	} `json:"role"`
+	Tags []struct {
+		Slug string `json:"slug"`
+	} `json:"tags"`
+	CustomFields map[string]any `json:"custom_fields"`
+}
+
+// Devices returns the devices of NetBox which match the filters.
+func (netbox *NetBox) Devices(ctx context.Context) ([]*yaml.Node, error) {
+	query := url.Values{"limit": {"1000"}}
+	query["role"] = netbox.Roles
+	query["tag"] = netbox.Tags
+	query["site"] = netbox.Sites
+	query.Set("status", "active")
+	if netbox.Status != "" {
+		query.Set("status", netbox.Status)
+	}
+
+	var nodes []*yaml.Node
+	next := strings.TrimSuffix(netbox.URL, "/") + "/api/dcim/devices/?" + query.Encode()
+	for next != "" {
+		var page struct {
+			Next    string         `json:"next"`
+			Results []netboxDevice `json:"results"`
+		}
+		if err := netbox.get(ctx, next, &page); err != nil {
+			return nil, err
+		}
+		for _, device := range page.Results {
+			if device.PrimaryIP == nil || device.PrimaryIP.Address == "" {
+				continue
+			}
+			node, err := netbox.node(device)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		}
+		next = page.Next
+	}
+
+	return nodes, nil
+}
+
+// get reads a page of the NetBox API.
+func (netbox *NetBox) get(ctx context.Context, address string, out any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return err
+	}
+	token := netbox.Token
+	if token == "" {
+		token = os.Getenv("NETBOX_TOKEN")
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Token "+token)
+	}
+	request.Header.Set("Accept", "application/json")
+
+	client := netbox.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("unable to read netbox devices: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to read netbox devices: %s", response.Status)
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("unable to parse netbox devices: %v", err)
+	}
+
+	return nil
+}
+
+// node returns the device as an entry of the devices block.
+func (netbox *NetBox) node(device netboxDevice) (*yaml.Node, error) {
+	host, _, _ := strings.Cut(device.PrimaryIP.Address, "/")
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setPath(node, "host", host, "!!str")
+	if device.Name != "" {
+		setPath(node, "name", device.Name, "!!str")
+	}
+	if device.Site != nil {
+		setPath(node, "site", device.Site.Slug, "!!str")
+	}
+	if device.Role != nil {
+		setPath(node, "group", device.Role.Slug, "!!str")
+	}
+	var tags []string
+	for _, tag := range device.Tags {
+		tags = append(tags, tag.Slug)
+	}
+	setList(node, "tags", tags)
+
+	for field, path := range netbox.Fields {
+		var value string
+		switch typed := device.CustomFields[field].(type) {
+		case nil:
+			continue
+		case string:
+			value = typed
+		case float64:
+			value = strconv.FormatFloat(typed, 'f', -1, 64)
+		case bool:
+			value = strconv.FormatBool(typed)
+		default:
+			return nil, fmt.Errorf("%s: custom field %s is no string, number or boolean", host, field)
+		}
+		if value != "" {
+			setPath(node, path, value, "")
+		}
+	}
+
+	return node, nil
+}
+
+// setPath sets the value at a path of keys separated by dots like snmp.authentication.passphrase in the mapping,
+// missing mappings are added. An empty tag resolves the type of the value when the node is decoded.
+func setPath(node *yaml.Node, path string, value string, tag string) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		child := mappingValue(node, key)
+		if child == nil || child.Kind != yaml.MappingNode {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+		}
+		node = child
+	}
+
+	scalar := &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+	key := keys[len(keys)-1]
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = scalar
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, scalar)
+}
+
+// setList sets a key of the mapping to a list of strings, nothing is set for an empty list.
+func setList(node *yaml.Node, key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, value := range values {
+		list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, list)
+}
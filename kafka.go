@@ -0,0 +1,429 @@
+package MikrotikMonitor
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kafka API keys and versions used by the KafkaPublisher. Produce v3 is the oldest version with record batches,
+// which every broker since Kafka 0.11 supports.
+const (
+	kafkaProduce         = 0
+	kafkaProduceVersion  = 3
+	kafkaMetadata        = 3
+	kafkaMetadataVersion = 4
+)
+
+// Kafka error codes which are resolved by reading the metadata again.
+const (
+	kafkaUnknownTopicOrPartition = 3
+	kafkaLeaderNotAvailable      = 5
+	kafkaNotLeaderForPartition   = 6
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// KafkaPublisher publishes the results of devices to a Kafka topic. The host of the device is the key of the
+// record and selects the partition like the default partitioner of the Java client, so all results of a device
+// end up in the same partition in order. Unlike the name, which is only known once the device was reached, the host
+// never changes.
+// It speaks the Kafka protocol itself, keeps a connection to every partition leader and waits for the leader
+// to acknowledge every record.
+type KafkaPublisher struct {
+	Brokers  []string
+	Topic    string
+	Encoding string
+	TLS      bool
+	Timeout  time.Duration
+
+	mu          sync.Mutex
+	correlation int32
+	conns       map[string]*kafkaConn
+	leaders     map[int32]string
+	partitions  []int32
+}
+
+// kafkaConn is a connection to a broker.
+type kafkaConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewKafkaPublisher returns a publisher of JSON encoded results to the topic, the brokers are the bootstrap
+// servers, e.g. "kafka1.example.com:9092". The topic has to exist.
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{Brokers: brokers, Topic: topic, Encoding: EncodingJSON, Timeout: 10 * time.Second}
+}
+
+// Publish sends the result of a device to the leader of its partition. If the leadership moved, the metadata is
+// read again and the record is sent once more.
+func (publisher *KafkaPublisher) Publish(result DeviceResult) error {
+	payload, err := encodeResult(result, publisher.Encoding)
+	if err != nil {
+		return err
+	}
+	key := []byte(result.Device.Host)
+
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if publisher.partitions == nil {
+			if err := publisher.metadata(); err != nil {
+				return err
+			}
+		}
+		partition := publisher.partitions[int(murmur2(key)&0x7fffffff)%len(publisher.partitions)]
+		code, err := publisher.produce(partition, key, payload, time.Now())
+		if err == nil && code == 0 {
+			return nil
+		}
+		// the next attempt reads the metadata and connects again
+		publisher.partitions = nil
+		if err != nil {
+			publisher.drop(publisher.leaders[partition])
+		}
+		retry := err != nil || code == kafkaUnknownTopicOrPartition || code == kafkaLeaderNotAvailable || code == kafkaNotLeaderForPartition
+		if attempt > 0 || !retry {
+			if err == nil {
+				err = fmt.Errorf("error code %d", code)
+			}
+			return fmt.Errorf("Kafka unable to publish to %s partition %d: %w", publisher.Topic, partition, err)
+		}
+	}
+}
+
+// Close closes the connections to the brokers.
+func (publisher *KafkaPublisher) Close() error {
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+
+	for address := range publisher.conns {
+		publisher.drop(address)
+	}
+	publisher.partitions = nil
+
+	return nil
+}
+
+// drop closes the connection to a broker.
+func (publisher *KafkaPublisher) drop(address string) {
+	if conn := publisher.conns[address]; conn != nil {
+		_ = conn.conn.Close()
+		delete(publisher.conns, address)
+	}
+}
+
+// metadata reads the partitions of the topic and their leaders from the first broker which answers.
+func (publisher *KafkaPublisher) metadata() error {
+	var body []byte
+	body = binary.BigEndian.AppendUint32(body, 1)
+	body = kafkaString(body, publisher.Topic)
+	// allow_auto_topic_creation
+	body = append(body, 0)
+
+	var errs []error
+	for _, address := range publisher.Brokers {
+		response, err := publisher.request(address, kafkaMetadata, kafkaMetadataVersion, body)
+		if err != nil {
+			publisher.drop(address)
+			errs = append(errs, err)
+			continue
+		}
+		err = publisher.parseMetadata(&kafkaReader{data: response})
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+
+	return fmt.Errorf("Kafka unable to read the metadata of %s: %w", publisher.Topic, errors.Join(errs...))
+}
+
+// parseMetadata reads the brokers and the partition leaders of the topic from a metadata response v4.
+func (publisher *KafkaPublisher) parseMetadata(r *kafkaReader) error {
+	// throttle_time_ms
+	r.int32()
+	brokers := map[int32]string{}
+	for i := r.int32(); i > 0; i-- {
+		id := r.int32()
+		host := r.string()
+		port := r.int32()
+		// rack
+		r.string()
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	// cluster_id and controller_id
+	r.string()
+	r.int32()
+
+	leaders := map[int32]string{}
+	var partitions []int32
+	for i := r.int32(); i > 0; i-- {
+		code := r.int16()
+		name := r.string()
+		// is_internal
+		r.bytes(1)
+		for j := r.int32(); j > 0; j-- {
+			r.int16()
+			partition := r.int32()
+			leader := r.int32()
+			// replica_nodes and isr_nodes
+			for k := r.int32(); k > 0; k-- {
+				r.int32()
+			}
+			for k := r.int32(); k > 0; k-- {
+				r.int32()
+			}
+			if name == publisher.Topic {
+				leaders[partition] = brokers[leader]
+				partitions = append(partitions, partition)
+			}
+		}
+		if name == publisher.Topic && code != 0 {
+			return fmt.Errorf("error code %d", code)
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("topic %s not found", publisher.Topic)
+	}
+
+	// the brokers list the partitions in any order, the hash of a key selects the partition by its ID
+	slices.Sort(partitions)
+	publisher.leaders = leaders
+	publisher.partitions = partitions
+	return nil
+}
+
+// produce sends a record to a partition with acks from the leader and returns the error code of the partition.
+func (publisher *KafkaPublisher) produce(partition int32, key []byte, value []byte, timestamp time.Time) (int16, error) {
+	batch := kafkaRecordBatch(key, value, timestamp)
+
+	var body []byte
+	// transactional_id, acks and timeout_ms
+	body = binary.BigEndian.AppendUint16(body, 0xffff)
+	body = binary.BigEndian.AppendUint16(body, 1)
+	body = binary.BigEndian.AppendUint32(body, uint32(publisher.Timeout.Milliseconds()))
+	body = binary.BigEndian.AppendUint32(body, 1)
+	body = kafkaString(body, publisher.Topic)
+	body = binary.BigEndian.AppendUint32(body, 1)
+	body = binary.BigEndian.AppendUint32(body, uint32(partition))
+	body = binary.BigEndian.AppendUint32(body, uint32(len(batch)))
+	body = append(body, batch...)
+
+	address := publisher.leaders[partition]
+	if address == "" {
+		return kafkaLeaderNotAvailable, nil
+	}
+	response, err := publisher.request(address, kafkaProduce, kafkaProduceVersion, body)
+	if err != nil {
+		return 0, err
+	}
+
+	r := &kafkaReader{data: response}
+	for i := r.int32(); i > 0; i-- {
+		r.string()
+		for j := r.int32(); j > 0; j-- {
+			index := r.int32()
+			code := r.int16()
+			// base_offset and log_append_time_ms
+			r.bytes(16)
+			if r.err == nil && index == partition {
+				return code, nil
+			}
+		}
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	return 0, fmt.Errorf("no response for partition %d", partition)
+}
+
+// request sends a request to a broker and returns the body of the response.
+func (publisher *KafkaPublisher) request(address string, apiKey int16, version int16, body []byte) ([]byte, error) {
+	conn := publisher.conns[address]
+	if conn == nil {
+		dialer := &net.Dialer{Timeout: publisher.Timeout}
+		var c net.Conn
+		var err error
+		if publisher.TLS {
+			host, _, _ := net.SplitHostPort(address)
+			c, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: host})
+		} else {
+			c, err = dialer.Dial("tcp", address)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Kafka %s %w: %w", address, ErrConnect, err)
+		}
+		conn = &kafkaConn{conn: c, reader: bufio.NewReader(c)}
+		if publisher.conns == nil {
+			publisher.conns = map[string]*kafkaConn{}
+		}
+		publisher.conns[address] = conn
+	}
+	_ = conn.conn.SetDeadline(time.Now().Add(publisher.Timeout))
+
+	publisher.correlation++
+	var header []byte
+	header = binary.BigEndian.AppendUint16(header, uint16(apiKey))
+	header = binary.BigEndian.AppendUint16(header, uint16(version))
+	header = binary.BigEndian.AppendUint32(header, uint32(publisher.correlation))
+	header = kafkaString(header, "mikrotikmonitor")
+
+	request := binary.BigEndian.AppendUint32(nil, uint32(len(header)+len(body)))
+	request = append(append(request, header...), body...)
+	if _, err := conn.conn.Write(request); err != nil {
+		return nil, fmt.Errorf("Kafka %s request failed: %w", address, err)
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(conn.reader, size[:]); err != nil {
+		return nil, fmt.Errorf("Kafka %s request failed: %w", address, err)
+	}
+	response := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(conn.reader, response); err != nil {
+		return nil, fmt.Errorf("Kafka %s request failed: %w", address, err)
+	}
+	if len(response) < 4 || int32(binary.BigEndian.Uint32(response)) != publisher.correlation {
+		return nil, fmt.Errorf("Kafka %s request failed: unexpected correlation id", address)
+	}
+
+	return response[4:], nil
+}
+
+// kafkaRecordBatch returns a record batch of magic 2 with a single record.
+func kafkaRecordBatch(key []byte, value []byte, timestamp time.Time) []byte {
+	var record []byte
+	// attributes, timestamp_delta and offset_delta
+	record = append(record, 0)
+	record = binary.AppendVarint(record, 0)
+	record = binary.AppendVarint(record, 0)
+	record = binary.AppendVarint(record, int64(len(key)))
+	record = append(record, key...)
+	record = binary.AppendVarint(record, int64(len(value)))
+	record = append(record, value...)
+	// headers
+	record = binary.AppendVarint(record, 0)
+
+	// the part of the batch covered by the CRC, starting with the attributes
+	var crcPart []byte
+	crcPart = binary.BigEndian.AppendUint16(crcPart, 0)
+	// last_offset_delta, base_timestamp and max_timestamp
+	crcPart = binary.BigEndian.AppendUint32(crcPart, 0)
+	crcPart = binary.BigEndian.AppendUint64(crcPart, uint64(timestamp.UnixMilli()))
+	crcPart = binary.BigEndian.AppendUint64(crcPart, uint64(timestamp.UnixMilli()))
+	// producer_id, producer_epoch and base_sequence of a producer without idempotence
+	crcPart = binary.BigEndian.AppendUint64(crcPart, 0xffffffffffffffff)
+	crcPart = binary.BigEndian.AppendUint16(crcPart, 0xffff)
+	crcPart = binary.BigEndian.AppendUint32(crcPart, 0xffffffff)
+	crcPart = binary.BigEndian.AppendUint32(crcPart, 1)
+	crcPart = binary.AppendVarint(crcPart, int64(len(record)))
+	crcPart = append(crcPart, record...)
+
+	var batch []byte
+	// base_offset, batch_length, partition_leader_epoch, magic and crc
+	batch = binary.BigEndian.AppendUint64(batch, 0)
+	batch = binary.BigEndian.AppendUint32(batch, uint32(4+1+4+len(crcPart)))
+	batch = binary.BigEndian.AppendUint32(batch, 0xffffffff)
+	batch = append(batch, 2)
+	batch = binary.BigEndian.AppendUint32(batch, crc32.Checksum(crcPart, crc32c))
+
+	return append(batch, crcPart...)
+}
+
+// kafkaString appends a string with its length as int16.
+func kafkaString(b []byte, value string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(value)))
+	return append(b, value...)
+}
+
+// kafkaReader reads the fields of a response, after the first error all reads return zero values.
+type kafkaReader struct {
+	data []byte
+	err  error
+}
+
+// bytes returns the next n bytes.
+func (r *kafkaReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || len(r.data) < n {
+		r.err = errors.New("truncated response")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+
+	return b
+}
+
+func (r *kafkaReader) int16() int16 {
+	if b := r.bytes(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if b := r.bytes(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+
+	return 0
+}
+
+// string reads a nullable string, null is returned as empty string.
+func (r *kafkaReader) string() string {
+	length := r.int16()
+	if length < 0 {
+		return ""
+	}
+
+	return string(r.bytes(int(length)))
+}
+
+// murmur2 is the hash of the default partitioner of the Kafka Java client.
+func murmur2(data []byte) int32 {
+	const m = 0x5bd1e995
+	length := len(data)
+	h := uint32(0x9747b28c) ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> 24
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+
+	return int32(h)
+}
@@ -0,0 +1,205 @@
+package MikrotikMonitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMurmur2(t *testing.T) {
+	// the vectors of the tests of the Java client
+	tests := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+	for data, want := range tests {
+		if got := murmur2([]byte(data)); got != want {
+			t.Errorf("murmur2(%q) = %d, want %d", data, got, want)
+		}
+	}
+}
+
+func TestKafkaRecordBatch(t *testing.T) {
+	want := strings.Join([]string{
+		// base_offset, batch_length, partition_leader_epoch, magic and CRC-32C
+		"0000000000000000", "0000003c", "ffffffff", "02", "0bd9a17c",
+		// attributes, last_offset_delta, base_timestamp and max_timestamp
+		"0000", "00000000", "0000018bcfe56800", "0000018bcfe56800",
+		// producer_id, producer_epoch, base_sequence and the number of records
+		"ffffffffffffffff", "ffff", "ffffffff", "00000001",
+		// length, attributes, timestamp_delta, offset_delta, key, value and headers of the record
+		"14", "00", "00", "00", "04" + "7231", "04" + "7b7d", "00",
+	}, "")
+
+	got := hex.EncodeToString(kafkaRecordBatch([]byte("r1"), []byte("{}"), time.UnixMilli(1700000000000)))
+	if got != want {
+		t.Errorf("record batch\n%s, want\n%s", got, want)
+	}
+}
+
+// kafkaBroker is a fake broker which answers Metadata v4 with the partitions in the given order, all led by itself,
+// and Produce v3 with success. It passes the requests to check.
+type kafkaBroker struct {
+	listener   net.Listener
+	partitions []int32
+	check      func(apiKey int16, version int16, clientID string, body []byte)
+}
+
+func (broker *kafkaBroker) serve(t *testing.T) {
+	conn, err := broker.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	host, port, _ := net.SplitHostPort(broker.listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		request := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		r := &kafkaReader{data: request}
+		apiKey, version, correlation, clientID := r.int16(), r.int16(), r.int32(), r.string()
+		if r.err != nil {
+			t.Errorf("invalid request header: %v", r.err)
+			return
+		}
+		broker.check(apiKey, version, clientID, r.data)
+
+		response := binary.BigEndian.AppendUint32(nil, uint32(correlation))
+		switch apiKey {
+		case kafkaMetadata:
+			// throttle_time_ms and the broker with its rack
+			response = binary.BigEndian.AppendUint32(response, 0)
+			response = binary.BigEndian.AppendUint32(response, 1)
+			response = binary.BigEndian.AppendUint32(response, 7)
+			response = kafkaString(response, host)
+			response = binary.BigEndian.AppendUint32(response, uint32(portNumber))
+			response = binary.BigEndian.AppendUint16(response, 0xffff)
+			// cluster_id and controller_id
+			response = kafkaString(response, "cluster")
+			response = binary.BigEndian.AppendUint32(response, 7)
+			// the topic with its partitions, each with replicas and isr
+			response = binary.BigEndian.AppendUint32(response, 1)
+			response = binary.BigEndian.AppendUint16(response, 0)
+			response = kafkaString(response, "results")
+			response = append(response, 0)
+			response = binary.BigEndian.AppendUint32(response, uint32(len(broker.partitions)))
+			for _, partition := range broker.partitions {
+				response = binary.BigEndian.AppendUint16(response, 0)
+				response = binary.BigEndian.AppendUint32(response, uint32(partition))
+				response = binary.BigEndian.AppendUint32(response, 7)
+				response = binary.BigEndian.AppendUint32(response, 1)
+				response = binary.BigEndian.AppendUint32(response, 7)
+				response = binary.BigEndian.AppendUint32(response, 1)
+				response = binary.BigEndian.AppendUint32(response, 7)
+			}
+		case kafkaProduce:
+			body := &kafkaReader{data: r.data}
+			// transactional_id, acks, timeout_ms, the topic and the partition of the request
+			body.string()
+			body.int16()
+			body.int32()
+			body.int32()
+			body.string()
+			body.int32()
+			partition := body.int32()
+			response = binary.BigEndian.AppendUint32(response, 1)
+			response = kafkaString(response, "results")
+			response = binary.BigEndian.AppendUint32(response, 1)
+			response = binary.BigEndian.AppendUint32(response, uint32(partition))
+			response = binary.BigEndian.AppendUint16(response, 0)
+			// base_offset, log_append_time_ms and throttle_time_ms
+			response = binary.BigEndian.AppendUint64(response, 0)
+			response = binary.BigEndian.AppendUint64(response, 0xffffffffffffffff)
+			response = binary.BigEndian.AppendUint32(response, 0)
+		}
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(response))), response...)); err != nil {
+			return
+		}
+	}
+}
+
+func TestKafkaPublisher(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var metadata, produce [][]byte
+	broker := &kafkaBroker{listener: listener, partitions: []int32{2, 0, 1}}
+	broker.check = func(apiKey int16, version int16, clientID string, body []byte) {
+		if clientID != "mikrotikmonitor" {
+			t.Errorf("client id %q, want mikrotikmonitor", clientID)
+		}
+		switch {
+		case apiKey == kafkaMetadata && version == 4:
+			metadata = append(metadata, body)
+		case apiKey == kafkaProduce && version == 3:
+			produce = append(produce, body)
+		default:
+			t.Errorf("unexpected request of API key %d version %d", apiKey, version)
+		}
+	}
+	go broker.serve(t)
+
+	publisher := NewKafkaPublisher([]string{listener.Addr().String()}, "results")
+	defer publisher.Close()
+	// the name is only known after the first poll, the host selects the partition before and after
+	for _, name := range []string{"", "core-1"} {
+		device := Device{Host: "router1.example.com", Name: name}
+		if err := publisher.Publish(DeviceResult{Device: device}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the topic, allow_auto_topic_creation false
+	wantMetadata := "00000001" + "0007" + hex.EncodeToString([]byte("results")) + "00"
+	if len(metadata) != 1 || hex.EncodeToString(metadata[0]) != wantMetadata {
+		t.Fatalf("metadata requests %x, want one of %s", metadata, wantMetadata)
+	}
+
+	key := []byte("router1.example.com")
+	wantPartition := int32(murmur2(key)&0x7fffffff) % 3
+	if len(produce) != 2 {
+		t.Fatalf("%d produce requests, want 2", len(produce))
+	}
+	for i, body := range produce {
+		r := &kafkaReader{data: body}
+		transactionalID, acks, timeout := r.int16(), r.int16(), r.int32()
+		topics, topic, partitions, partition, size := r.int32(), r.string(), r.int32(), r.int32(), r.int32()
+		batch := r.bytes(int(size))
+		switch {
+		case r.err != nil:
+			t.Fatalf("produce request %d: %v", i, r.err)
+		case transactionalID != -1 || acks != 1 || timeout != 10000:
+			t.Errorf("produce request %d: transactional id %d, acks %d, timeout %d, want -1, 1, 10000", i, transactionalID, acks, timeout)
+		case topics != 1 || topic != "results" || partitions != 1:
+			t.Errorf("produce request %d: %d topics %q with %d partitions, want 1 results with 1", i, topics, topic, partitions)
+		case partition != wantPartition:
+			t.Errorf("produce request %d: partition %d, want %d", i, partition, wantPartition)
+		case len(r.data) != 0:
+			t.Errorf("produce request %d: %d trailing bytes", i, len(r.data))
+		}
+		// the key follows the length, attributes, timestamp_delta and offset_delta of the record
+		if !bytes.Contains(batch, append([]byte{0, 0, 0, byte(len(key) * 2)}, key...)) {
+			t.Errorf("produce request %d: record without key %s", i, key)
+		}
+	}
+}
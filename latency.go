@@ -0,0 +1,59 @@
+package MikrotikMonitor
+
+import (
+	"time"
+)
+
+type Latency struct {
+	Samples int           `json:"Samples"`
+	SNMP    time.Duration `json:"SNMP"`
+	Ping    time.Duration `json:"Ping"`
+	Jitter  time.Duration `json:"Jitter"`
+	Loss    float64       `json:"Loss"`
+}
+
+// MeasureLatency sends Samples ICMP echo requests to the device one after the other
+// and records the average round trip time, the jitter and the share of lost requests.
+// The jitter is the average difference between the round trip times of consecutive replies.
+// Like Ping, it needs root or CAP_NET_RAW.
+func (device *Device) MeasureLatency() error {
+	timeout := device.SNMP.Timeout
+	if timeout == 0 {
+		timeout = 3 * time.Second
+	}
+
+	var rtts []time.Duration
+	var lastErr error
+	for i := 0; i < device.Latency.Samples; i++ {
+		rtt, err := Ping(device.address(), timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		rtts = append(rtts, rtt)
+	}
+
+	device.Latency.Ping, device.Latency.Jitter = 0, 0
+	device.Latency.Loss = 1 - float64(len(rtts))/float64(device.Latency.Samples)
+	if len(rtts) == 0 {
+		return lastErr
+	}
+
+	var sum, variation time.Duration
+	for i, rtt := range rtts {
+		sum += rtt
+		if i > 0 {
+			diff := rtt - rtts[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			variation += diff
+		}
+	}
+	device.Latency.Ping = sum / time.Duration(len(rtts))
+	if len(rtts) > 1 {
+		device.Latency.Jitter = variation / time.Duration(len(rtts)-1)
+	}
+
+	return nil
+}
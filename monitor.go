@@ -0,0 +1,657 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Monitor polls the devices of a config file periodically and keeps their latest state.
+// The config file is watched while the monitor is running and reloaded on changes,
+// added, removed and modified devices are applied without restarting polls in progress.
+// RateLimit spaces the SNMP requests to all devices to at most that many per second, zero means unlimited.
+// With a StateFile the state of the devices and the alerts are saved after every poll cycle and restored by Start,
+// so a restart neither loses the baselines of the rates nor raises or resolves alerts again.
+// Quiet doesn't pass events to the receivers of the notifications block of the config file, e.g. for one-off polls.
+type Monitor struct {
+	ConfigFile     string
+	Interval       time.Duration
+	ReloadInterval time.Duration
+	History        *History
+	Notifiers      []Notifier
+	ErrorRates     *ErrorRateDetector
+	Rates          *RateCalculator
+	Rules          *RuleEngine
+	DedupWindow    time.Duration
+	FlapWindow     time.Duration
+	FlapThreshold  int
+	Releases       Releases
+	Feed           *ReleaseFeed
+	Advisories     *AdvisoryFeed
+	RateLimit      float64
+	StateFile      string
+	Quiet          bool
+
+	mu      sync.RWMutex
+	devices Devices
+	configs map[string]Device
+	stat    string
+	loaded  time.Time
+	refresh time.Duration
+
+	captures       map[string]chan struct{}
+	events         []Event
+	eventCounts    map[[2]string]*eventCount
+	silences       []Silence
+	configSilences []Silence
+	delivered      map[[3]string]*deliveryState
+	tasks          []Task
+	reminded       map[[2]string]time.Time
+	completed      map[[2]string]time.Time
+	results        []chan DeviceResult
+	streams        map[chan streamMessage]struct{}
+	syslogRules    []SyslogRule
+	backups        *Backups
+	dampening      *DampeningConfig
+	auth           *Auth
+	notifications  *Notifications
+	eventLog       *EventLog
+	backedUp       map[string]time.Time
+	exports        map[string]storedExport
+	identities     map[string]string
+	syslog         []SyslogEntry
+	stats          monitorStats
+	pacer          *pacer
+	sessions       *sessionPool
+	started        time.Time
+
+	lifecycle sync.Mutex
+	editing   sync.Mutex
+	stop      chan struct{}
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewMonitor returns a Monitor for the given config file which polls all devices every interval.
+// The config file is checked for changes every 10 seconds.
+func NewMonitor(configFile string, interval time.Duration) *Monitor {
+	return &Monitor{
+		ConfigFile:     configFile,
+		Interval:       interval,
+		ReloadInterval: 10 * time.Second,
+		History:        NewHistory(7 * 24 * time.Hour),
+		Notifiers:      []Notifier{LogNotifier{}},
+		ErrorRates:     NewErrorRateDetector(),
+		Rates:          NewRateCalculator(),
+		Rules:          NewRuleEngine(nil),
+		DedupWindow:    time.Hour,
+		FlapWindow:     30 * time.Minute,
+		FlapThreshold:  4,
+	}
+}
+
+// Start loads the config file and starts the scheduler and the config watcher in the background.
+// It returns an error if the initial config can't be loaded or the monitor is running already.
+// A stopped monitor can be started again, e.g. with another ConfigFile.
+func (monitor *Monitor) Start() error {
+	monitor.lifecycle.Lock()
+	defer monitor.lifecycle.Unlock()
+
+	monitor.mu.Lock()
+	running := monitor.stop != nil
+	monitor.mu.Unlock()
+	if running {
+		return errors.New("monitor is running already")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := monitor.ReloadContext(ctx); err != nil {
+		cancel()
+		return err
+	}
+	if err := monitor.restoreState(); err != nil {
+		log.Printf("state not restored, %v", err)
+	}
+
+	stop := make(chan struct{})
+	monitor.mu.Lock()
+	monitor.stop = stop
+	monitor.cancel = cancel
+	monitor.started = time.Now()
+	monitor.mu.Unlock()
+
+	monitor.wg.Add(3)
+	go monitor.schedule(ctx, stop)
+	go monitor.watch(ctx, stop)
+	go monitor.backupSchedule(stop)
+
+	return nil
+}
+
+// Stop ends the scheduler, the config watcher and running captures and waits until they have finished.
+// A running poll is cancelled, the channels of Results, the SNMP sessions and the connection to the syslog server of the
+// event log are closed. Stopping a monitor which isn't running does nothing.
+func (monitor *Monitor) Stop() {
+	monitor.lifecycle.Lock()
+	defer monitor.lifecycle.Unlock()
+
+	monitor.mu.Lock()
+	stop, cancel := monitor.stop, monitor.cancel
+	monitor.stop, monitor.cancel = nil, nil
+	monitor.mu.Unlock()
+	if stop == nil {
+		return
+	}
+
+	cancel()
+	close(stop)
+	monitor.wg.Wait()
+	monitor.saveState()
+	monitor.closeResults()
+
+	monitor.mu.RLock()
+	sessions, eventLog := monitor.sessions, monitor.eventLog
+	monitor.mu.RUnlock()
+	if sessions != nil {
+		sessions.close()
+	}
+	if eventLog != nil {
+		_ = eventLog.Close()
+	}
+}
+
+// Devices returns a copy of the current state of all devices.
+func (monitor *Monitor) Devices() Devices {
+	monitor.mu.RLock()
+	defer monitor.mu.RUnlock()
+
+	devices := make(Devices, len(monitor.devices))
+	copy(devices, monitor.devices)
+
+	return devices
+}
+
+// Device returns a copy of the current state of the device with the given host.
+// The second return value is false if the device doesn't exist.
+func (monitor *Monitor) Device(host string) (Device, bool) {
+	monitor.mu.RLock()
+	defer monitor.mu.RUnlock()
+
+	if device := monitor.device(host); device != nil {
+		return *device, true
+	}
+
+	return Device{}, false
+}
+
+// Reload reads the config file and applies the differences to the device list.
+// New devices are added, removed devices are dropped and modified devices are reset to their new config.
+// Unchanged devices keep their collected state. The rules, maintenance windows, tasks, syslog rules and backups are reloaded
+// as well. If the config file is invalid, the device list, the rules, the maintenance windows and the tasks are kept.
+// Changes of the devices and failed reloads are added to the event log.
+func (monitor *Monitor) Reload() error {
+	return monitor.ReloadContext(context.Background())
+}
+
+// ReloadContext is Reload with a context, cancelling it aborts reading the sources of the inventory block.
+// The running monitor reloads with the context of its scheduler, which Stop cancels.
+func (monitor *Monitor) ReloadContext(ctx context.Context) error {
+	changes, err := monitor.reload(ctx)
+	monitor.stats.observeReload(err)
+	switch {
+	case err != nil:
+		monitor.logEntry(LogEntry{Kind: LogReload, Action: "failed", Message: err.Error()})
+	case changes != "":
+		monitor.logEntry(LogEntry{Kind: LogReload, Action: "reloaded", Message: changes})
+	}
+
+	return err
+}
+
+// reload is Reload without recording its result in the metrics of the monitor. It returns the changes of the devices,
+// empty for the first load and refreshes of the inventory without changes.
+func (monitor *Monitor) reload(ctx context.Context) (string, error) {
+	stat, err := configStat(monitor.ConfigFile)
+	if err != nil {
+		return "", err
+	}
+
+	// the files are read once, so all blocks are of the same version of the files
+	documents, err := readConfigDocuments(monitor.ConfigFile)
+	var devices Devices
+	if err == nil {
+		err = devices.loadConfig(ctx, monitor.ConfigFile, documents)
+	}
+	var rules []Rule
+	if err == nil {
+		rules, err = loadRules(documents)
+	}
+	var silences []Silence
+	if err == nil {
+		silences, err = loadSilences(documents)
+	}
+	var tasks []Task
+	if err == nil {
+		tasks, err = loadTasks(documents)
+	}
+	var syslogRules []SyslogRule
+	if err == nil {
+		syslogRules, err = loadSyslogRules(documents)
+	}
+	var backups *Backups
+	if err == nil {
+		backups, err = loadBackups(documents)
+	}
+	var inventory []InventorySource
+	if err == nil {
+		inventory, err = loadInventory(documents)
+	}
+	var dampening *DampeningConfig
+	if err == nil {
+		dampening, err = loadDampening(documents)
+	}
+	var auth *Auth
+	if err == nil {
+		auth, err = loadAuth(documents)
+	}
+	var notifications *Notifications
+	if err == nil {
+		notifications, err = loadNotifications(documents)
+	}
+	if notifications != nil {
+		notifications.setValues(monitor.RecentValues)
+	}
+	var eventLog *EventLog
+	if err == nil {
+		eventLog, err = loadEventLog(documents)
+	}
+	if err != nil {
+		monitor.mu.Lock()
+		monitor.stat = stat
+		monitor.loaded = time.Now()
+		monitor.mu.Unlock()
+		return "", err
+	}
+	if monitor.Rules != nil {
+		monitor.Rules.SetRules(rules)
+	}
+
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	edited := stat != monitor.stat
+	monitor.stat = stat
+	monitor.loaded = time.Now()
+	monitor.refresh = inventoryRefresh(inventory)
+	monitor.configSilences = silences
+	monitor.tasks = tasks
+	monitor.syslogRules = syslogRules
+	monitor.backups = backups
+	monitor.dampening = dampening
+	monitor.auth = auth
+	// the threads of the chats are kept unless their receiver changed
+	notifications.keep(monitor.notifications)
+	monitor.notifications = notifications
+	// the connection to the syslog server is kept unless the event log changed
+	if current := monitor.eventLog; current != nil {
+		if eventLog != nil && current.File == eventLog.File && current.Syslog == eventLog.Syslog {
+			eventLog = current
+		} else {
+			_ = current.Close()
+		}
+	}
+	monitor.eventLog = eventLog
+	configs := map[string]Device{}
+	var added, removed, modified int
+	state := make(Devices, 0, len(devices))
+	for _, device := range devices {
+		device.line = 0
+		configs[device.Host] = device
+
+		old, found := monitor.configs[device.Host]
+		switch {
+		case !found:
+			added++
+			state = append(state, device)
+		case !reflect.DeepEqual(old, device):
+			modified++
+			state = append(state, device)
+		default:
+			state = append(state, *monitor.device(device.Host))
+		}
+	}
+	for host := range monitor.configs {
+		if _, found := configs[host]; !found {
+			removed++
+		}
+	}
+
+	// refreshes of the inventory without changes aren't logged
+	var changes string
+	if monitor.configs != nil && (edited || added+removed+modified > 0) {
+		changes = fmt.Sprintf("%d added, %d removed, %d modified", added, removed, modified)
+		log.Printf("config reloaded: %s", changes)
+	}
+	monitor.devices = state
+	monitor.configs = configs
+
+	return changes, nil
+}
+
+// Poll requests all devices once, one after the other.
+// Devices are polled on a copy, results of devices removed or modified by a reload in the meantime are dropped.
+func (monitor *Monitor) Poll() {
+	monitor.poll(context.Background())
+}
+
+// PollDevice requests a single device now instead of waiting for the next poll, e.g. after it was added to the config.
+// It returns ErrDeviceNotFound if the device isn't configured.
+func (monitor *Monitor) PollDevice(ctx context.Context, host string) error {
+	device, found := monitor.Device(host)
+	if !found {
+		return ErrDeviceNotFound
+	}
+	monitor.pollDevice(ctx, device, monitor.releases(ctx), monitor.advisories(), monitor.pacing())
+
+	return ctx.Err()
+}
+
+// poll is Poll with a context, which stops the poll when it is cancelled.
+// Results of the device polled at that moment are dropped.
+func (monitor *Monitor) poll(ctx context.Context) {
+	releases := monitor.releases(ctx)
+	advisories := monitor.advisories()
+	pacer := monitor.pacing()
+	devices := monitor.Devices()
+	cycle := time.Now()
+	monitor.stats.setQueue(len(devices))
+	defer monitor.stats.setQueue(0)
+	for i, device := range devices {
+		if ctx.Err() != nil || !monitor.pollDevice(ctx, device, releases, advisories, pacer) {
+			return
+		}
+		monitor.stats.setQueue(len(devices) - i - 1)
+	}
+
+	monitor.stats.observeCycle(cycle)
+	monitor.Notify(monitor.remind(time.Now())...)
+
+	if monitor.History != nil {
+		devices := monitor.Devices()
+		devices.WirelessClients().Record(monitor.History)
+	}
+}
+
+// pollDevice requests a device and applies the result unless the device was removed or modified meanwhile.
+// It returns false if the context was cancelled during the request.
+func (monitor *Monitor) pollDevice(ctx context.Context, device Device, releases Releases, advisories []Advisory, pacer *pacer) bool {
+	previous := device
+	config := monitor.config(device.Host)
+	device.Reached = false
+	device.pacer = pacer
+	device.sessions = monitor.snmpSessions()
+	start := time.Now()
+	err := device.GetDeviceContext(ctx)
+	if ctx.Err() != nil {
+		return false
+	}
+	device.LastPolled = time.Now()
+	device.LastError = ""
+	if err != nil {
+		log.Println(err.Error())
+		device.LastError = err.Error()
+	}
+	monitor.stats.observePoll(device.LastPolled.Sub(start), err)
+	monitor.mu.RLock()
+	dampening := monitor.dampening.settings(device)
+	monitor.mu.RUnlock()
+	device.Availability.update(device.Reached, dampening, device.LastPolled)
+	device.CheckUpdate(releases)
+	device.CheckAdvisories(advisories)
+	if device.Reached && monitor.Rates != nil {
+		monitor.Rates.Update(&device, time.Now())
+	}
+
+	monitor.mu.Lock()
+	current, found := monitor.configs[device.Host]
+	found = found && reflect.DeepEqual(current, config)
+	if found {
+		*monitor.device(device.Host) = device
+	}
+	monitor.mu.Unlock()
+
+	if found {
+		monitor.Notify(monitor.reconcile(device)...)
+		monitor.record(device)
+		monitor.Notify(monitor.changes(previous, device)...)
+		monitor.Notify(advisoryChanges(previous, device, advisories)...)
+		monitor.checkDrift(device)
+		monitor.publish(DeviceResult{Device: device, Err: err, Duration: device.LastPolled.Sub(start)})
+		monitor.broadcast("device", device.Host, device.Site, device)
+	}
+
+	return true
+}
+
+// releases returns the releases of the Feed, overridden by the Releases of the monitor.
+// If the feed can't be fetched, the error is logged and the cached releases of the feed are used.
+func (monitor *Monitor) releases(ctx context.Context) Releases {
+	releases := Releases{}
+	if monitor.Feed != nil {
+		fetched, err := monitor.Feed.ReleasesContext(ctx)
+		if err != nil {
+			log.Println(err.Error())
+		}
+		maps.Copy(releases, fetched)
+	}
+	maps.Copy(releases, monitor.Releases)
+
+	return releases
+}
+
+// advisories returns the advisories of the Advisories feed, the DefaultAdvisories without feed.
+// If the feed can't be fetched, the error is logged and the cached advisories of the feed are used.
+func (monitor *Monitor) advisories() []Advisory {
+	if monitor.Advisories == nil {
+		return DefaultAdvisories
+	}
+	advisories, err := monitor.Advisories.Advisories()
+	if err != nil {
+		log.Println(err.Error())
+	}
+
+	return advisories
+}
+
+// record stores the values of a polled device in the history.
+func (monitor *Monitor) record(device Device) {
+	if monitor.History == nil {
+		return
+	}
+
+	now := time.Now()
+	up := 0.0
+	if device.Reached {
+		up = 1
+		monitor.History.Add("snmp_rtt_seconds:"+device.Host, now, device.Latency.SNMP.Seconds())
+		monitor.History.Add("uptime_seconds:"+device.Host, now, device.Uptime.Seconds())
+		monitor.History.Add("cpu_load_percent:"+device.Host, now, float64(device.Health.CPULoad))
+		if device.Health.Temperature != 0 {
+			monitor.History.Add("temperature_celsius:"+device.Host, now, device.Health.Temperature)
+		}
+		for name, value := range device.Custom {
+			monitor.History.Add("custom_"+name+":"+device.Host, now, value)
+		}
+	}
+	monitor.History.Add("up:"+device.Host, now, up)
+}
+
+// changes returns the events caused by a poll of a device, based on the state of the device before the poll.
+func (monitor *Monitor) changes(previous, current Device) []Event {
+	var events []Event
+
+	if current.Reached && monitor.ErrorRates != nil {
+		events = append(events, monitor.ErrorRates.Update(current)...)
+	}
+
+	if monitor.Rules != nil {
+		events = append(events, monitor.Rules.Update(previous, current)...)
+	}
+
+	events = append(events, serviceChanges(previous, current)...)
+	events = append(events, flappingChanges(previous, current)...)
+
+	if previous.Reached && current.Reached {
+		events = append(events, poeChanges(previous, current)...)
+		events = append(events, routingChanges(previous, current)...)
+	}
+
+	if previous.Reached && current.Reached && current.Uptime < previous.Uptime {
+		events = append(events, current.NewEvent(EventRebootDetected, SeverityWarning, "",
+			fmt.Sprintf("device rebooted, uptime %s after %s", current.Uptime, previous.Uptime)))
+	}
+
+	switch {
+	case current.Provisioning.Incomplete() && current.Provisioning != previous.Provisioning:
+		events = append(events, current.NewEvent(EventProvisioning, SeverityWarning, "",
+			"device is not fully provisioned: "+current.Provisioning.String()))
+	case !current.Provisioning.Incomplete() && previous.Provisioning.Incomplete():
+		event := current.NewEvent(EventProvisioning, SeverityWarning, "", "device is fully provisioned")
+		event.Resolved = true
+		events = append(events, event)
+	}
+
+	return events
+}
+
+// Notify records the events and passes them to all notifiers and the receivers of their routes in the notifications
+// block of the config file, errors of notifiers are logged.
+// Silenced, duplicate and flapping events are recorded, but not passed to the notifiers.
+// A Quiet monitor doesn't notify the receivers.
+func (monitor *Monitor) Notify(events ...Event) {
+	monitor.mu.RLock()
+	notifications := monitor.notifications
+	monitor.mu.RUnlock()
+	if monitor.Quiet {
+		notifications = nil
+	}
+
+	for _, event := range events {
+		monitor.recordEvent(&event)
+		monitor.logEntry(eventLogEntry(event))
+		monitor.broadcast("event", event.Host, event.Site, event)
+		if reason := monitor.suppressed(event); reason != "" {
+			log.Printf("notification of %s event %s for %s suppressed, %s", event.Type, event.ID, event.Host, reason)
+			continue
+		}
+		for _, notifier := range monitor.Notifiers {
+			if err := notifier.Notify(event); err != nil {
+				log.Printf("unable to notify %s event for %s, %v", event.Type, event.Host, err)
+			}
+		}
+		if notifications == nil {
+			continue
+		}
+		for _, receiver := range notifications.receivers(event, time.Now()) {
+			if err := receiver.Notify(event); err != nil {
+				log.Printf("unable to notify %s event for %s via %s, %v", event.Type, event.Host, receiver.Name, err)
+			}
+		}
+	}
+}
+
+// schedule polls the devices every Interval until the monitor is stopped.
+func (monitor *Monitor) schedule(ctx context.Context, stop chan struct{}) {
+	defer monitor.wg.Done()
+
+	ticker := time.NewTicker(monitor.Interval)
+	defer ticker.Stop()
+
+	for {
+		monitor.poll(ctx)
+		monitor.saveState()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backupSchedule backs up the devices which are due every minute, see Backups.
+func (monitor *Monitor) backupSchedule(stop chan struct{}) {
+	defer monitor.wg.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		monitor.backupDue(time.Now())
+	}
+}
+
+// watch checks the modification time and size of the config files every ReloadInterval and reloads them on changes,
+// files added to or removed from a config directory are changes as well. With an inventory block the config is
+// reloaded every refresh interval of the inventory as well, so the devices follow the inventory.
+func (monitor *Monitor) watch(ctx context.Context, stop chan struct{}) {
+	defer monitor.wg.Done()
+
+	ticker := time.NewTicker(monitor.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		stat, err := configStat(monitor.ConfigFile)
+		if err != nil {
+			log.Printf("unable to check config file, %v", err)
+			continue
+		}
+
+		monitor.mu.RLock()
+		changed := stat != monitor.stat || monitor.refresh > 0 && time.Since(monitor.loaded) >= monitor.refresh
+		monitor.mu.RUnlock()
+
+		if changed {
+			if err := monitor.ReloadContext(ctx); err != nil {
+				log.Printf("config not reloaded, %v", err)
+			}
+		}
+	}
+}
+
+// config returns the configuration of the device with the given host.
+func (monitor *Monitor) config(host string) Device {
+	monitor.mu.RLock()
+	defer monitor.mu.RUnlock()
+
+	return monitor.configs[host]
+}
+
+// device returns a pointer to the state of the device with the given host, or nil if it doesn't exist.
+// The caller has to hold the lock.
+func (monitor *Monitor) device(host string) *Device {
+	for i := range monitor.devices {
+		if monitor.devices[i].Host == host {
+			return &monitor.devices[i]
+		}
+	}
+
+	return nil
+}
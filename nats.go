@@ -0,0 +1,162 @@
+package MikrotikMonitor
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSPublisher publishes the results of devices to NATS, each device to the subject Subject.<name>,
+// e.g. mikrotik.results.core-router, so subscribers can pick devices with wildcards.
+// It speaks the NATS client protocol itself and keeps one connection, which is reestablished after errors.
+type NATSPublisher struct {
+	Address  string
+	Subject  string
+	Encoding string
+	User     string
+	Password string
+	Token    string
+	TLS      bool
+	Timeout  time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewNATSPublisher returns a publisher to the NATS server at address, e.g. "nats.example.com:4222", which
+// publishes JSON encoded results below the subject.
+func NewNATSPublisher(address string, subject string) *NATSPublisher {
+	return &NATSPublisher{Address: address, Subject: subject, Encoding: EncodingJSON, Timeout: 10 * time.Second}
+}
+
+// Publish sends the result of a device and waits until the server has processed it,
+// so rejected messages, e.g. missing permissions for the subject, are returned as errors.
+func (publisher *NATSPublisher) Publish(result DeviceResult) error {
+	payload, err := encodeResult(result, publisher.Encoding)
+	if err != nil {
+		return err
+	}
+	subject := publisher.Subject + "." + subjectToken(result.Device.publishKey())
+
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+
+	if publisher.conn == nil {
+		if err := publisher.connect(); err != nil {
+			return err
+		}
+	}
+	_ = publisher.conn.SetDeadline(time.Now().Add(publisher.Timeout))
+	message := fmt.Sprintf("PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload)
+	if _, err := publisher.conn.Write([]byte(message)); err != nil {
+		publisher.close()
+		return fmt.Errorf("NATS %s unable to publish to %s: %w", publisher.Address, subject, err)
+	}
+	if err := publisher.pong(); err != nil {
+		publisher.close()
+		return fmt.Errorf("NATS %s unable to publish to %s: %w", publisher.Address, subject, err)
+	}
+
+	return nil
+}
+
+// Close closes the connection to the server.
+func (publisher *NATSPublisher) Close() error {
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+
+	publisher.close()
+	return nil
+}
+
+// close drops the connection, the next Publish connects again.
+func (publisher *NATSPublisher) close() {
+	if publisher.conn != nil {
+		_ = publisher.conn.Close()
+	}
+	publisher.conn, publisher.reader = nil, nil
+}
+
+// connect connects to the server, reads its INFO and authenticates with CONNECT.
+func (publisher *NATSPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", publisher.Address, publisher.Timeout)
+	if err != nil {
+		return fmt.Errorf("NATS %s %w: %w", publisher.Address, ErrConnect, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(publisher.Timeout))
+	publisher.conn, publisher.reader = conn, bufio.NewReader(conn)
+
+	line, err := publisher.reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		publisher.close()
+		return fmt.Errorf("NATS %s %w: no INFO from the server", publisher.Address, ErrConnect)
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info)
+
+	if publisher.TLS || info.TLSRequired {
+		host, _, _ := net.SplitHostPort(publisher.Address)
+		secure := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := secure.Handshake(); err != nil {
+			publisher.close()
+			return fmt.Errorf("NATS %s TLS handshake failed: %w", publisher.Address, err)
+		}
+		publisher.conn, publisher.reader = secure, bufio.NewReader(secure)
+	}
+
+	options := map[string]any{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "mikrotikmonitor",
+		"lang":     "go",
+		"version":  MonitorVersion,
+		"protocol": 0,
+	}
+	if publisher.User != "" {
+		options["user"], options["pass"] = publisher.User, publisher.Password
+	}
+	if publisher.Token != "" {
+		options["auth_token"] = publisher.Token
+	}
+	connect, _ := json.Marshal(options)
+	if _, err := fmt.Fprintf(publisher.conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		publisher.close()
+		return fmt.Errorf("NATS %s %w: %w", publisher.Address, ErrConnect, err)
+	}
+	if err := publisher.pong(); err != nil {
+		publisher.close()
+		return fmt.Errorf("NATS %s %w: %w", publisher.Address, ErrConnect, err)
+	}
+
+	return nil
+}
+
+// pong reads until the PONG of the server, answers its PINGs and returns -ERR messages as errors.
+func (publisher *NATSPublisher) pong() error {
+	for {
+		line, err := publisher.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := publisher.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New(strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+	}
+}
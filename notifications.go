@@ -0,0 +1,345 @@
+package MikrotikMonitor
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Notifications is the notifications block of the config file. It routes events to receivers by their severity,
+// device and the time, e.g. critical problems of core routers to PagerDuty and Telegram and the problems of customer
+// premises equipment into an email digest. The Notifiers of the monitor still receive all events.
+type Notifications struct {
+	Receivers []Receiver
+	Routes    []Route
+}
+
+// Receiver is a named destination of notifications, one of PagerDuty, Opsgenie, Telegram, Slack, Mattermost, Matrix,
+// Gotify, Ntfy or Email.
+type Receiver struct {
+	Name       string
+	PagerDuty  *PagerDuty
+	Opsgenie   *Opsgenie
+	Telegram   *Telegram
+	Slack      *Slack
+	Mattermost *Mattermost
+	Matrix     *Matrix
+	Gotify     *Gotify
+	Ntfy       *Ntfy
+	Email      *Email
+}
+
+// Route passes the matching events to its Receivers. Severity is the lowest severity of the events, Host, Site, Group,
+// Tag and Type match like those of a Silence, empty fields match all. Days and Hours limit the route to a schedule in
+// the local time zone, e.g. [mon, tue, wed, thu, fri] and 08:00-18:00, hours may span midnight like 22:00-06:00.
+// The routes are checked in order, the first matching route takes the event, unless Continue is set.
+type Route struct {
+	Severity  string
+	Host      string
+	Site      string
+	Group     string
+	Tag       string
+	Type      string
+	Days      []string
+	Hours     string
+	Receivers []string
+	Continue  bool
+}
+
+// severities are the severities of events, from the lowest to the highest.
+var severities = []string{SeverityInfo, SeverityWarning, SeverityCritical}
+
+// LoadNotifications reads the notifications block of the config file and validates it, nil if the block is missing.
+// Routing keys, API keys, webhooks, tokens and passwords may reference environment variables like ${PAGERDUTY_KEY}.
+func LoadNotifications(filename string) (*Notifications, error) {
+	documents, err := readConfigDocuments(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadNotifications(documents)
+}
+
+// loadNotifications is LoadNotifications with the parsed documents of the config files.
+func loadNotifications(documents []configDocument) (*Notifications, error) {
+	var parser struct {
+		Notifications *Notifications `yaml:"notifications"`
+	}
+
+	if err := decodeConfig(documents, &parser); err != nil {
+		return nil, err
+	}
+	notifications := parser.Notifications
+	if notifications == nil {
+		return nil, nil
+	}
+
+	var errs []error
+	names := map[string]bool{}
+	for i := range notifications.Receivers {
+		receiver := &notifications.Receivers[i]
+		fail := func(format string, a ...any) {
+			errs = append(errs, fmt.Errorf("receiver %d %s: %s", i+1, receiver.Name, fmt.Sprintf(format, a...)))
+		}
+
+		if receiver.Name == "" {
+			fail("missing name")
+		} else if names[receiver.Name] {
+			fail("duplicate name")
+		}
+		names[receiver.Name] = true
+
+		configured := 0
+		if pagerDuty := receiver.PagerDuty; pagerDuty != nil {
+			configured++
+			if pagerDuty.RoutingKey == "" {
+				fail("missing routing_key of pagerduty")
+			}
+		}
+		if opsgenie := receiver.Opsgenie; opsgenie != nil {
+			configured++
+			if opsgenie.APIKey == "" {
+				fail("missing api_key of opsgenie")
+			}
+		}
+		if telegram := receiver.Telegram; telegram != nil {
+			configured++
+			if telegram.Token == "" || telegram.ChatID == "" {
+				fail("missing token or chat_id of telegram")
+			}
+		}
+		if slack := receiver.Slack; slack != nil {
+			configured++
+			if slack.Webhook == "" && (slack.Token == "" || slack.Channel == "") {
+				fail("missing webhook or token and channel of slack")
+			}
+		}
+		if mattermost := receiver.Mattermost; mattermost != nil {
+			configured++
+			if mattermost.Webhook == "" && (mattermost.URL == "" || mattermost.Token == "" || mattermost.ChannelID == "") {
+				fail("missing webhook or url, token and channel_id of mattermost")
+			}
+		}
+		if matrix := receiver.Matrix; matrix != nil {
+			configured++
+			if matrix.Homeserver == "" || matrix.Token == "" || matrix.Room == "" {
+				fail("missing homeserver, token or room of matrix")
+			}
+		}
+		if gotify := receiver.Gotify; gotify != nil {
+			configured++
+			if gotify.URL == "" || gotify.Token == "" {
+				fail("missing url or token of gotify")
+			}
+		}
+		if ntfy := receiver.Ntfy; ntfy != nil {
+			configured++
+			if ntfy.Topic == "" {
+				fail("missing topic of ntfy")
+			}
+		}
+		if email := receiver.Email; email != nil {
+			configured++
+			if email.Server == "" || email.From == "" || len(email.To) == 0 {
+				fail("missing server, from or to of email")
+			}
+			if email.Digest < 0 {
+				fail("negative digest")
+			}
+		}
+		if configured != 1 {
+			fail("needs one of pagerduty, opsgenie, telegram, slack, mattermost, matrix, gotify, ntfy or email")
+		}
+	}
+
+	for i, route := range notifications.Routes {
+		fail := func(format string, a ...any) {
+			errs = append(errs, fmt.Errorf("route %d: %s", i+1, fmt.Sprintf(format, a...)))
+		}
+
+		if route.Severity != "" && !slices.Contains(severities, route.Severity) {
+			fail("unknown severity %q", route.Severity)
+		}
+		for _, day := range route.Days {
+			if _, err := parseWeekday(day); err != nil {
+				fail("%v", err)
+			}
+		}
+		if route.Hours != "" {
+			if _, _, err := parseHours(route.Hours); err != nil {
+				fail("%v", err)
+			}
+		}
+		if len(route.Receivers) == 0 {
+			fail("missing receivers")
+		}
+		for _, name := range route.Receivers {
+			if !names[name] {
+				fail("unknown receiver %q", name)
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid notifications in config file:\n%v", err)
+	}
+
+	return notifications, nil
+}
+
+// Notify passes the event to the configured destination of the receiver.
+func (receiver *Receiver) Notify(event Event) error {
+	switch {
+	case receiver.PagerDuty != nil:
+		return receiver.PagerDuty.Notify(event)
+	case receiver.Opsgenie != nil:
+		return receiver.Opsgenie.Notify(event)
+	case receiver.Telegram != nil:
+		return receiver.Telegram.Notify(event)
+	case receiver.Slack != nil:
+		return receiver.Slack.Notify(event)
+	case receiver.Mattermost != nil:
+		return receiver.Mattermost.Notify(event)
+	case receiver.Matrix != nil:
+		return receiver.Matrix.Notify(event)
+	case receiver.Gotify != nil:
+		return receiver.Gotify.Notify(event)
+	case receiver.Ntfy != nil:
+		return receiver.Ntfy.Notify(event)
+	case receiver.Email != nil:
+		return receiver.Email.Notify(event)
+	}
+
+	return nil
+}
+
+// setValues sets the function returning the recent values of the metric of an event for the sparklines of the chats.
+func (notifications *Notifications) setValues(values func(event Event) []float64) {
+	for _, receiver := range notifications.Receivers {
+		switch {
+		case receiver.Slack != nil:
+			receiver.Slack.Values = values
+		case receiver.Mattermost != nil:
+			receiver.Mattermost.Values = values
+		case receiver.Matrix != nil:
+			receiver.Matrix.Values = values
+		}
+	}
+}
+
+// keep carries the receivers of previous over which are unchanged, so a reload loses neither the threads of the chats
+// nor the pending digests of the mails.
+func (notifications *Notifications) keep(previous *Notifications) {
+	if notifications == nil || previous == nil {
+		return
+	}
+	for i := range notifications.Receivers {
+		receiver := &notifications.Receivers[i]
+		for _, old := range previous.Receivers {
+			if old.Name != receiver.Name {
+				continue
+			}
+			switch {
+			case receiver.Slack != nil && old.Slack != nil:
+				current, kept := receiver.Slack, old.Slack
+				if current.Webhook == kept.Webhook && current.Token == kept.Token && current.Channel == kept.Channel &&
+					current.URL == kept.URL {
+					receiver.Slack = kept
+				}
+			case receiver.Mattermost != nil && old.Mattermost != nil:
+				current, kept := receiver.Mattermost, old.Mattermost
+				if current.Webhook == kept.Webhook && current.URL == kept.URL && current.Token == kept.Token &&
+					current.ChannelID == kept.ChannelID {
+					receiver.Mattermost = kept
+				}
+			case receiver.Matrix != nil && old.Matrix != nil:
+				current, kept := receiver.Matrix, old.Matrix
+				if current.Homeserver == kept.Homeserver && current.Token == kept.Token && current.Room == kept.Room {
+					receiver.Matrix = kept
+				}
+			case receiver.Email != nil && old.Email != nil:
+				current, kept := receiver.Email, old.Email
+				if current.Server == kept.Server && current.User == kept.User && current.Password == kept.Password &&
+					current.From == kept.From && slices.Equal(current.To, kept.To) && current.Digest == kept.Digest {
+					receiver.Email = kept
+				}
+			}
+		}
+	}
+}
+
+// receivers returns the receivers of the routes matching the event at the given time, each at most once.
+func (notifications *Notifications) receivers(event Event, now time.Time) []*Receiver {
+	var names []string
+	for _, route := range notifications.Routes {
+		if !route.matches(event, now) {
+			continue
+		}
+		for _, name := range route.Receivers {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		if !route.Continue {
+			break
+		}
+	}
+
+	var receivers []*Receiver
+	for _, name := range names {
+		for i := range notifications.Receivers {
+			if notifications.Receivers[i].Name == name {
+				receivers = append(receivers, &notifications.Receivers[i])
+			}
+		}
+	}
+
+	return receivers
+}
+
+// matches reports whether the route takes the event at the given time.
+func (route Route) matches(event Event, now time.Time) bool {
+	if route.Severity != "" && slices.Index(severities, event.Severity) < slices.Index(severities, route.Severity) ||
+		route.Host != "" && route.Host != event.Host || route.Site != "" && route.Site != event.Site ||
+		route.Group != "" && route.Group != event.Group || route.Type != "" && route.Type != event.Type ||
+		route.Tag != "" && !slices.Contains(event.Tags, route.Tag) {
+		return false
+	}
+
+	now = now.Local()
+	if len(route.Days) > 0 && !slices.ContainsFunc(route.Days, func(day string) bool {
+		weekday, err := parseWeekday(day)
+		return err == nil && weekday == now.Weekday()
+	}) {
+		return false
+	}
+	if route.Hours != "" {
+		from, to, err := parseHours(route.Hours)
+		if err != nil {
+			return false
+		}
+		clock := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+		if from <= to && (clock < from || clock >= to) || from > to && clock < from && clock >= to {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseHours parses a time range of a day like 08:00-18:00 into the durations since midnight.
+func parseHours(hours string) (time.Duration, time.Duration, error) {
+	start, end, found := strings.Cut(hours, "-")
+	from, err := time.Parse("15:04", strings.TrimSpace(start))
+	if !found || err != nil {
+		return 0, 0, fmt.Errorf("hours %q is not <hh:mm>-<hh:mm>", hours)
+	}
+	to, err := time.Parse("15:04", strings.TrimSpace(end))
+	if err != nil {
+		return 0, 0, fmt.Errorf("hours %q is not <hh:mm>-<hh:mm>", hours)
+	}
+
+	return time.Duration(from.Hour())*time.Hour + time.Duration(from.Minute())*time.Minute,
+		time.Duration(to.Hour())*time.Hour + time.Duration(to.Minute())*time.Minute, nil
+}
@@ -0,0 +1,83 @@
+package MikrotikMonitor
+
+import (
+	"log"
+	"time"
+)
+
+// EventRebootDetected is the type of events raised when the uptime of a device went backwards between two polls.
+const EventRebootDetected = "RebootDetected"
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Event is a state change of a device which is passed to the notifiers.
+// ID is assigned by Monitor.Notify and identifies the event in Monitor.Event.
+// Resolved is set on the event which ends a previously reported problem of the same Type and Subject.
+// Details is optional information spanning several lines, e.g. the diff of a ConfigChanged event.
+// Metric is the metric of the condition of the rule which raised the event, empty for other events.
+type Event struct {
+	ID       string
+	Type     string
+	Severity string
+	Host     string
+	Name     string
+	Site     string
+	Group    string
+	Tags     []string
+	Subject  string
+	Message  string
+	Details  string
+	Metric   string
+	Time     time.Time
+	Resolved bool
+}
+
+// Notifier delivers events, e.g. to a chat, a mail address or a log.
+type Notifier interface {
+	Notify(event Event) error
+}
+
+// NotifierFunc adapts an ordinary function to the Notifier interface.
+type NotifierFunc func(event Event) error
+
+// Notify calls f(event).
+func (f NotifierFunc) Notify(event Event) error {
+	return f(event)
+}
+
+// LogNotifier writes events to the standard logger.
+type LogNotifier struct{}
+
+// Notify logs the event.
+func (LogNotifier) Notify(event Event) error {
+	state := event.Severity
+	if event.Resolved {
+		state = "resolved"
+	}
+	log.Printf("[%s] %s %s %s: %s", state, event.Type, event.Host, event.Subject, event.Message)
+	if event.Details != "" {
+		log.Print(event.Details)
+	}
+
+	return nil
+}
+
+// NewEvent returns an event of the given type and severity for the device.
+func (device *Device) NewEvent(eventType string, severity string, subject string, message string) Event {
+	return Event{
+		Type:     eventType,
+		Severity: severity,
+		Host:     device.Host,
+		Name:     device.Name,
+		Site:     device.Site,
+		Group:    device.Group,
+		Tags:     device.Tags,
+		Subject:  subject,
+		Message:  message,
+		Time:     time.Now(),
+	}
+}
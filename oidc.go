@@ -0,0 +1,310 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDC authenticates the bearer tokens of an OpenID Connect provider, e.g. Keycloak or Dex. The token must be issued by
+// the Issuer for the Audience, its signing keys are found via the discovery document of the Issuer. The role is taken
+// from the RolesClaim, default groups, which may be a path like realm_access.roles: a token with one of the Admin values
+// is an admin, one with one of the Viewer values a viewer. Without Admin and Viewer values every valid token is a viewer.
+// With a SitesClaim a token is limited to the sites of the claim, to no site without it and to all sites with "*".
+type OIDC struct {
+	Issuer     string
+	Audience   string
+	RolesClaim string `yaml:"roles_claim"`
+	SitesClaim string `yaml:"sites_claim"`
+	Admin      []string
+	Viewer     []string
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// oidcLeeway is the clock skew allowed for the times of a token.
+const oidcLeeway = time.Minute
+
+// user verifies the token and returns its user, named by the claim preferred_username, email or sub.
+func (oidc *OIDC) user(ctx context.Context, token string) (apiUser, error) {
+	claims, err := oidc.verify(ctx, token)
+	if err != nil {
+		return apiUser{}, fmt.Errorf("invalid token, %v", err)
+	}
+	var name string
+	for _, claim := range []string{"preferred_username", "email", "sub"} {
+		if name, _ = claims[claim].(string); name != "" {
+			break
+		}
+	}
+
+	var sites []string
+	if oidc.SitesClaim != "" {
+		sites = []string{}
+		for _, site := range claimValues(claims, oidc.SitesClaim) {
+			if site == "*" {
+				sites = nil
+				break
+			}
+			if site != "" {
+				sites = append(sites, site)
+			}
+		}
+	}
+
+	path := oidc.RolesClaim
+	if path == "" {
+		path = "groups"
+	}
+	values := claimValues(claims, path)
+	matches := func(allowed []string) bool {
+		return slices.ContainsFunc(values, func(value string) bool { return slices.Contains(allowed, value) })
+	}
+	switch {
+	case matches(oidc.Admin):
+		return apiUser{Name: name, Role: RoleAdmin, Sites: sites}, nil
+	case matches(oidc.Viewer), len(oidc.Admin) == 0 && len(oidc.Viewer) == 0:
+		return apiUser{Name: name, Role: RoleViewer, Sites: sites}, nil
+	}
+
+	return apiUser{}, fmt.Errorf("no role for %s %v", path, values)
+}
+
+// claimValues returns the strings of the claim at the path, e.g. realm_access.roles, a single string or a list.
+func claimValues(claims map[string]any, path string) []string {
+	var value any = claims
+	for _, name := range strings.Split(path, ".") {
+		object, _ := value.(map[string]any)
+		value = object[name]
+	}
+	var values []string
+	switch value := value.(type) {
+	case string:
+		values = []string{value}
+	case []any:
+		for _, item := range value {
+			if item, ok := item.(string); ok {
+				values = append(values, item)
+			}
+		}
+	}
+
+	return values
+}
+
+// verify checks the signature, issuer, audience and lifetime of the token and returns its claims.
+func (oidc *OIDC) verify(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("no JWT")
+	}
+	var header struct {
+		Alg string
+		Kid string
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	key, err := oidc.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims["iss"] != oidc.Issuer {
+		return nil, fmt.Errorf("issuer %v isn't %s", claims["iss"], oidc.Issuer)
+	}
+	switch audience := claims["aud"].(type) {
+	case string:
+		if audience != oidc.Audience {
+			return nil, fmt.Errorf("audience %s isn't %s", audience, oidc.Audience)
+		}
+	case []any:
+		if !slices.Contains(audience, any(oidc.Audience)) {
+			return nil, fmt.Errorf("audience %v doesn't contain %s", audience, oidc.Audience)
+		}
+	default:
+		return nil, fmt.Errorf("missing audience")
+	}
+	now := time.Now()
+	expires, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("missing expiry")
+	}
+	if now.Add(-oidcLeeway).After(time.Unix(int64(expires), 0)) {
+		return nil, fmt.Errorf("expired")
+	}
+	if notBefore, ok := claims["nbf"].(float64); ok && now.Add(oidcLeeway).Before(time.Unix(int64(notBefore), 0)) {
+		return nil, fmt.Errorf("not valid yet")
+	}
+
+	return claims, nil
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JWT.
+func decodeSegment(segment string, v any) error {
+	content, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// verifySignature verifies the signature of the signed content with the key, RS256, RS384, RS512, ES256 and ES384
+// are supported.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	hashes := map[string]crypto.Hash{
+		"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+		"ES256": crypto.SHA256, "ES384": crypto.SHA384,
+	}
+	hash, found := hashes[alg]
+	if !found {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm %s doesn't match RSA key", alg)
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		// the curve is bound to the algorithm, e.g. ES256 has to be signed with P-256
+		curves := map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384()}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if curves[alg] != key.Curve || len(signature) != 2*size {
+			return fmt.Errorf("algorithm %s doesn't match EC key", alg)
+		}
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported key type %T", key)
+}
+
+// key returns the signing key with the id. The keys are fetched from the provider on first use and again for unknown
+// ids, at most once a minute, so rotated keys are picked up.
+func (oidc *OIDC) key(ctx context.Context, id string) (crypto.PublicKey, error) {
+	oidc.mu.Lock()
+	defer oidc.mu.Unlock()
+
+	if key, found := oidc.keys[id]; found {
+		return key, nil
+	}
+	if time.Since(oidc.fetched) < time.Minute {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	oidc.fetched = time.Now()
+	keys, err := oidc.fetchKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch keys of %s, %v", oidc.Issuer, err)
+	}
+	oidc.keys = keys
+	if key, found := oidc.keys[id]; found {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown key %q", id)
+}
+
+// fetchKeys reads the JSON Web Key Set of the provider found via its discovery document.
+func (oidc *OIDC) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := getJSON(ctx, strings.TrimSuffix(oidc.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("missing jwks_uri in discovery document")
+	}
+	var set struct {
+		Keys []struct {
+			Kty string
+			Kid string
+			Use string
+			N   string
+			E   string
+			Crv string
+			X   string
+			Y   string
+		}
+	}
+	if err := getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	decode := func(value string) *big.Int {
+		content, _ := base64.RawURLEncoding.DecodeString(value)
+		return new(big.Int).SetBytes(content)
+	}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			keys[jwk.Kid] = &rsa.PublicKey{N: decode(jwk.N), E: int(decode(jwk.E).Int64())}
+		case "EC":
+			curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384()}
+			curve, found := curves[jwk.Crv]
+			x, y := decode(jwk.X), decode(jwk.Y)
+			if found && curve.IsOnCurve(x, y) {
+				keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// getJSON decodes the JSON response of a GET request.
+func getJSON(ctx context.Context, url string, v any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(v)
+}
@@ -0,0 +1,308 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// oidcProvider is a fake OpenID Connect provider with an RSA key and EC keys of P-256 and P-384.
+type oidcProvider struct {
+	server *httptest.Server
+	rsa    *rsa.PrivateKey
+	p256   *ecdsa.PrivateKey
+	p384   *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	kids     []string
+	requests int
+}
+
+func newOIDCProvider(t *testing.T) *oidcProvider {
+	t.Helper()
+	provider := &oidcProvider{kids: []string{"rsa", "p256", "p384"}}
+	var err error
+	if provider.rsa, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if provider.p256, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if provider.p384, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	provider.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"issuer": provider.server.URL, "jwks_uri": provider.server.URL + "/keys"})
+		case "/keys":
+			provider.mu.Lock()
+			provider.requests++
+			kids := provider.kids
+			provider.mu.Unlock()
+			encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+			var keys []map[string]string
+			for _, kid := range kids {
+				switch kid {
+				case "rsa":
+					keys = append(keys, map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": encode(provider.rsa.N),
+						"e": encode(big.NewInt(int64(provider.rsa.E)))})
+				case "p256", "p384":
+					key := map[string]*ecdsa.PrivateKey{"p256": provider.p256, "p384": provider.p384}[kid]
+					keys = append(keys, map[string]string{"kty": "EC", "kid": kid, "crv": key.Curve.Params().Name,
+						"x": encode(key.X), "y": encode(key.Y)})
+				}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(provider.server.Close)
+
+	return provider
+}
+
+// keyRequests returns the number of requests of the key set.
+func (provider *oidcProvider) keyRequests() int {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	return provider.requests
+}
+
+// token returns a JWT with the header and the claims signed with the key of the kid for the alg of the header.
+func (provider *oidcProvider) token(t *testing.T, header map[string]any, claims map[string]any) string {
+	t.Helper()
+	segment := func(v any) string {
+		content, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(content)
+	}
+	signed := segment(header) + "." + segment(claims)
+
+	alg, _ := header["alg"].(string)
+	hashes := map[string]crypto.Hash{"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+		"ES256": crypto.SHA256, "ES384": crypto.SHA384}
+	var signature []byte
+	switch {
+	case alg == "none":
+	case alg == "HS256":
+		// the public key as HMAC secret, the classic confusion of asymmetric and symmetric algorithms
+		secret, err := x509.MarshalPKIXPublicKey(&provider.rsa.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	default:
+		hash := hashes[alg]
+		hasher := hash.New()
+		hasher.Write([]byte(signed))
+		digest := hasher.Sum(nil)
+		var err error
+		switch header["kid"] {
+		case "rsa":
+			signature, err = rsa.SignPKCS1v15(rand.Reader, provider.rsa, hash, digest)
+		case "p256", "p384":
+			key := provider.p256
+			if header["kid"] == "p384" {
+				key = provider.p384
+			}
+			var r, s *big.Int
+			r, s, err = ecdsa.Sign(rand.Reader, key, digest)
+			size := (key.Curve.Params().BitSize + 7) / 8
+			signature = make([]byte, 2*size)
+			r.FillBytes(signature[:size])
+			s.FillBytes(signature[size:])
+		default:
+			signature, err = rsa.SignPKCS1v15(rand.Reader, provider.rsa, hash, digest)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCVerify(t *testing.T) {
+	provider := newOIDCProvider(t)
+	issuer := provider.server.URL
+	now := time.Now().Unix()
+	claims := func(changes map[string]any) map[string]any {
+		claims := map[string]any{"iss": issuer, "aud": "monitor", "sub": "alice", "exp": now + 300, "iat": now}
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+				continue
+			}
+			claims[name] = value
+		}
+		return claims
+	}
+	header := func(alg string, kid string) map[string]any {
+		return map[string]any{"alg": alg, "kid": kid, "typ": "JWT"}
+	}
+	tamper := func(token string, part int) string {
+		parts := strings.Split(token, ".")
+		content, _ := base64.RawURLEncoding.DecodeString(parts[part])
+		if part == 1 {
+			content = []byte(strings.Replace(string(content), `"sub":"alice"`, `"sub":"admin"`, 1))
+		} else {
+			content[len(content)/2] ^= 0x01
+		}
+		parts[part] = base64.RawURLEncoding.EncodeToString(content)
+		return strings.Join(parts, ".")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"RS256", provider.token(t, header("RS256", "rsa"), claims(nil)), ""},
+		{"RS384", provider.token(t, header("RS384", "rsa"), claims(nil)), ""},
+		{"RS512", provider.token(t, header("RS512", "rsa"), claims(nil)), ""},
+		{"ES256", provider.token(t, header("ES256", "p256"), claims(nil)), ""},
+		{"ES384", provider.token(t, header("ES384", "p384"), claims(nil)), ""},
+		{"audience in list", provider.token(t, header("RS256", "rsa"), claims(map[string]any{"aud": []string{"other", "monitor"}})), ""},
+		{"expired within leeway", provider.token(t, header("RS256", "rsa"), claims(map[string]any{"exp": now - 30})), ""},
+		{"valid within leeway", provider.token(t, header("RS256", "rsa"), claims(map[string]any{"nbf": now + 30})), ""},
+
+		{"alg none", provider.token(t, header("none", "rsa"), claims(nil)), "unsupported algorithm"},
+		{"alg none without kid", provider.token(t, map[string]any{"alg": "none"}, claims(nil)), "unknown key"},
+		{"HS256 with the public key", provider.token(t, header("HS256", "rsa"), claims(nil)), "unsupported algorithm"},
+		{"ES256 with RSA key", provider.token(t, header("ES256", "rsa"), claims(nil)), "doesn't match RSA key"},
+		{"RS256 with EC key", provider.token(t, header("RS256", "p256"), claims(nil)), "doesn't match EC key"},
+		{"ES256 with P-384 key", provider.token(t, header("ES256", "p384"), claims(nil)), "doesn't match EC key"},
+		{"wrong audience", provider.token(t, header("RS256", "rsa"), claims(map[string]any{"aud": "grafana"})), "audience"},
+		{"audience not in list", provider.token(t, header("RS256", "rsa"), claims(map[string]any{"aud": []string{"grafana"}})), "audience"},
+		{"missing audience", provider.token(t, header("RS256", "rsa"), claims(map[string]any{"aud": nil})), "missing audience"},
+		{"wrong issuer", provider.token(t, header("RS256", "rsa"), claims(map[string]any{"iss": "https://evil.example.com"})), "issuer"},
+		{"missing issuer", provider.token(t, header("RS256", "rsa"), claims(map[string]any{"iss": nil})), "issuer"},
+		{"expired", provider.token(t, header("RS256", "rsa"), claims(map[string]any{"exp": now - 120})), "expired"},
+		{"missing expiry", provider.token(t, header("RS256", "rsa"), claims(map[string]any{"exp": nil})), "missing expiry"},
+		{"not yet valid", provider.token(t, header("RS256", "rsa"), claims(map[string]any{"nbf": now + 120})), "not valid yet"},
+		{"unknown kid", provider.token(t, header("RS256", "unknown"), claims(nil)), "unknown key"},
+		{"tampered RSA signature", tamper(provider.token(t, header("RS256", "rsa"), claims(nil)), 2), "verification error"},
+		{"tampered EC signature", tamper(provider.token(t, header("ES256", "p256"), claims(nil)), 2), "invalid signature"},
+		{"tampered claims", tamper(provider.token(t, header("RS256", "rsa"), claims(nil)), 1), "verification error"},
+		{"no JWT", "abc.def", "no JWT"},
+		{"invalid header", "!." + strings.SplitN(provider.token(t, header("RS256", "rsa"), claims(nil)), ".", 2)[1], "illegal base64"},
+	}
+	oidc := &OIDC{Issuer: issuer, Audience: "monitor"}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verified, err := oidc.verify(context.Background(), test.token)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if verified["sub"] != "alice" {
+					t.Errorf("claims %v, want sub alice", verified)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	provider := newOIDCProvider(t)
+	provider.kids = []string{"rsa"}
+	oidc := &OIDC{Issuer: provider.server.URL, Audience: "monitor"}
+	claims := map[string]any{"iss": provider.server.URL, "aud": "monitor", "sub": "alice", "exp": time.Now().Unix() + 300}
+	token := provider.token(t, map[string]any{"alg": "ES256", "kid": "p256"}, claims)
+
+	// the key set is fetched once for the unknown kid and not again within a minute
+	for i := 0; i < 2; i++ {
+		if _, err := oidc.verify(context.Background(), token); err == nil || !strings.Contains(err.Error(), "unknown key") {
+			t.Fatalf("error %v, want unknown key", err)
+		}
+	}
+	if requests := provider.keyRequests(); requests != 1 {
+		t.Fatalf("%d requests of the key set, want 1", requests)
+	}
+
+	// a rotated key is picked up after a minute
+	provider.mu.Lock()
+	provider.kids = []string{"rsa", "p256"}
+	provider.mu.Unlock()
+	oidc.mu.Lock()
+	oidc.fetched = oidc.fetched.Add(-time.Minute)
+	oidc.mu.Unlock()
+	if _, err := oidc.verify(context.Background(), token); err != nil {
+		t.Fatalf("rotated key not used, %v", err)
+	}
+	if requests := provider.keyRequests(); requests != 2 {
+		t.Fatalf("%d requests of the key set, want 2", requests)
+	}
+}
+
+func TestOIDCUser(t *testing.T) {
+	provider := newOIDCProvider(t)
+	oidc := &OIDC{Issuer: provider.server.URL, Audience: "monitor", RolesClaim: "realm_access.roles", SitesClaim: "sites",
+		Admin: []string{"noc-admin"}, Viewer: []string{"noc"}}
+	token := func(roles []string, sites any) string {
+		claims := map[string]any{"iss": provider.server.URL, "aud": "monitor", "sub": "1234", "preferred_username": "alice",
+			"exp": time.Now().Unix() + 300, "realm_access": map[string]any{"roles": roles}}
+		if sites != nil {
+			claims["sites"] = sites
+		}
+		return provider.token(t, map[string]any{"alg": "RS256", "kid": "rsa"}, claims)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		role  string
+		sites []string
+		err   bool
+	}{
+		{"admin", token([]string{"offline_access", "noc-admin"}, "*"), RoleAdmin, nil, false},
+		{"viewer of a site", token([]string{"noc"}, "acme"), RoleViewer, []string{"acme"}, false},
+		{"viewer of sites", token([]string{"noc"}, []string{"acme", "globex"}), RoleViewer, []string{"acme", "globex"}, false},
+		{"viewer without sites", token([]string{"noc"}, nil), RoleViewer, []string{}, false},
+		{"no role", token([]string{"offline_access"}, "*"), "", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user, err := oidc.user(context.Background(), test.token)
+			if test.err {
+				if err == nil {
+					t.Fatalf("user %+v, want an error", user)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Name != "alice" || user.Role != test.role || (user.Sites == nil) != (test.sites == nil) ||
+				strings.Join(user.Sites, ",") != strings.Join(test.sites, ",") {
+				t.Errorf("user %+v, want alice as %s of %v", user, test.role, test.sites)
+			}
+		})
+	}
+}
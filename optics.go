@@ -0,0 +1,191 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OIDs of the optical table of the MikroTik MIB with the DDM values of the SFP modules, indexed by the interface index.
+const (
+	oidOpticalName        = ".1.3.6.1.4.1.14988.1.1.19.1.1.2"
+	oidOpticalRxLoss      = ".1.3.6.1.4.1.14988.1.1.19.1.1.3"
+	oidOpticalTxFault     = ".1.3.6.1.4.1.14988.1.1.19.1.1.4"
+	oidOpticalWavelength  = ".1.3.6.1.4.1.14988.1.1.19.1.1.5"
+	oidOpticalTemperature = ".1.3.6.1.4.1.14988.1.1.19.1.1.6"
+	oidOpticalVoltage     = ".1.3.6.1.4.1.14988.1.1.19.1.1.7"
+	oidOpticalBias        = ".1.3.6.1.4.1.14988.1.1.19.1.1.8"
+	oidOpticalTxPower     = ".1.3.6.1.4.1.14988.1.1.19.1.1.9"
+	oidOpticalRxPower     = ".1.3.6.1.4.1.14988.1.1.19.1.1.10"
+)
+
+// Optic is the diagnostic data (DDM) of an SFP module. Wavelength is in nanometers, Temperature in degrees Celsius,
+// Voltage in volts, TxBias in milliamperes and TxPower and RxPower in dBm.
+// Vendor and PartNumber are read via the API, so they stay empty on devices without an api block.
+type Optic struct {
+	Index       int     `json:"Index"`
+	Name        string  `json:"Name"`
+	Vendor      string  `json:"Vendor"`
+	PartNumber  string  `json:"PartNumber"`
+	Wavelength  float64 `json:"Wavelength"`
+	Temperature float64 `json:"Temperature"`
+	Voltage     float64 `json:"Voltage"`
+	TxBias      float64 `json:"TxBias"`
+	TxPower     float64 `json:"TxPower"`
+	RxPower     float64 `json:"RxPower"`
+	RxLoss      bool    `json:"RxLoss"`
+	TxFault     bool    `json:"TxFault"`
+}
+
+// GetOptics reads the DDM values of the SFP modules of the device, devices without SFP modules report none.
+// Devices read via SNMP use the optical table of the MikroTik MIB, the vendor is read via the API if the device
+// has an api block. Devices with another backend get all values from /interface/ethernet/monitor.
+func (device *Device) GetOptics() error {
+	if !usesSNMP(device) {
+		return device.getOpticsAPI(true)
+	}
+
+	optics := map[int]*Optic{}
+	columns := []struct {
+		oid string
+		set func(optic *Optic, value int64)
+	}{
+		{oidOpticalRxLoss, func(optic *Optic, value int64) { optic.RxLoss = value == 1 }},
+		{oidOpticalTxFault, func(optic *Optic, value int64) { optic.TxFault = value == 1 }},
+		// the wavelength is reported in hundredths of a nanometer, the voltage in millivolts
+		// and the power levels in thousandths of a dBm
+		{oidOpticalWavelength, func(optic *Optic, value int64) { optic.Wavelength = float64(value) / 100 }},
+		{oidOpticalTemperature, func(optic *Optic, value int64) { optic.Temperature = float64(value) }},
+		{oidOpticalVoltage, func(optic *Optic, value int64) { optic.Voltage = float64(value) / 1000 }},
+		{oidOpticalBias, func(optic *Optic, value int64) { optic.TxBias = float64(value) }},
+		{oidOpticalTxPower, func(optic *Optic, value int64) { optic.TxPower = float64(value) / 1000 }},
+		{oidOpticalRxPower, func(optic *Optic, value int64) { optic.RxPower = float64(value) / 1000 }},
+	}
+	get := func(oid string, variable gosnmp.SnmpPDU) *Optic {
+		index, err := strconv.Atoi(strings.TrimPrefix(variable.Name, oid+"."))
+		if err != nil {
+			return nil
+		}
+		if optics[index] == nil {
+			optics[index] = &Optic{Index: index}
+		}
+		return optics[index]
+	}
+
+	err := device.snmp.BulkWalk(oidOpticalName, func(variable gosnmp.SnmpPDU) error {
+		if optic := get(oidOpticalName, variable); optic != nil {
+			optic.Name, _ = AsString(variable)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s unable to read optical table: %v", device.Host, err)
+	}
+	for _, column := range columns {
+		err := device.snmp.BulkWalk(column.oid, func(variable gosnmp.SnmpPDU) error {
+			value, err := AsInt(variable)
+			if optic := get(column.oid, variable); optic != nil && err == nil {
+				column.set(optic, value)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s unable to read optical table: %v", device.Host, err)
+		}
+	}
+
+	device.Optics = make([]Optic, 0, len(optics))
+	for _, optic := range optics {
+		device.Optics = append(device.Optics, *optic)
+	}
+	sort.Slice(device.Optics, func(i, j int) bool {
+		return device.Optics[i].Index < device.Optics[j].Index
+	})
+
+	if device.API.User != "" && len(device.Optics) > 0 {
+		return device.getOpticsAPI(false)
+	}
+
+	return nil
+}
+
+// getOpticsAPI monitors the SFP interfaces once via the API. With all, the optics are replaced including their
+// DDM values, otherwise only the vendor and part number of the optics read via SNMP are set.
+func (device *Device) getOpticsAPI(all bool) error {
+	var names []string
+	if all {
+		interfaces, err := device.Print("/interface/ethernet")
+		if err != nil {
+			return err
+		}
+		for _, iface := range interfaces {
+			if strings.HasPrefix(iface["name"], "sfp") || strings.HasPrefix(iface["name"], "qsfp") {
+				names = append(names, iface["name"])
+			}
+		}
+	} else {
+		for _, optic := range device.Optics {
+			names = append(names, optic.Name)
+		}
+	}
+
+	var optics []Optic
+	for i, name := range names {
+		replies, err := device.Execute("/interface/ethernet/monitor", map[string]string{"numbers": name, "once": ""})
+		if err != nil {
+			return err
+		}
+		if len(replies) == 0 || replies[0]["sfp-module-present"] == "false" {
+			continue
+		}
+		values := replies[0]
+		optic := Optic{
+			Index:      i + 1,
+			Name:       name,
+			Vendor:     values["sfp-vendor-name"],
+			PartNumber: values["sfp-vendor-part-number"],
+			RxLoss:     values["sfp-rx-loss"] == "true",
+			TxFault:    values["sfp-tx-fault"] == "true",
+		}
+		optic.Wavelength, _ = strconv.ParseFloat(strings.TrimSuffix(values["sfp-wavelength"], "nm"), 64)
+		optic.Temperature, _ = strconv.ParseFloat(strings.TrimSuffix(values["sfp-temperature"], "C"), 64)
+		optic.Voltage, _ = strconv.ParseFloat(strings.TrimSuffix(values["sfp-supply-voltage"], "V"), 64)
+		optic.TxBias, _ = strconv.ParseFloat(strings.TrimSuffix(values["sfp-tx-bias-current"], "mA"), 64)
+		optic.TxPower, _ = strconv.ParseFloat(strings.TrimSuffix(values["sfp-tx-power"], "dBm"), 64)
+		optic.RxPower, _ = strconv.ParseFloat(strings.TrimSuffix(values["sfp-rx-power"], "dBm"), 64)
+		optics = append(optics, optic)
+	}
+
+	if all {
+		device.Optics = optics
+		return nil
+	}
+	for i := range device.Optics {
+		for _, optic := range optics {
+			if optic.Name == device.Optics[i].Name {
+				device.Optics[i].Vendor = optic.Vendor
+				device.Optics[i].PartNumber = optic.PartNumber
+			}
+		}
+	}
+
+	return nil
+}
+
+// opticsMetric returns a rule metric which aggregates a value of all SFP modules, e.g. the lowest RX power.
+// Devices without SFP modules have no value.
+func opticsMetric(value func(optic Optic) float64, aggregate func(a, b float64) float64) func(previous, current Device) (float64, bool) {
+	return func(previous, current Device) (float64, bool) {
+		result, found := 0.0, false
+		for _, optic := range current.Optics {
+			if !found {
+				result, found = value(optic), true
+				continue
+			}
+			result = aggregate(result, value(optic))
+		}
+		return result, current.Reached && found
+	}
+}
@@ -0,0 +1,265 @@
+package MikrotikMonitor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLP span kinds, status codes and the cumulative aggregation temporality of sums.
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindClient   = 3
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+	otlpCumulative       = 2
+)
+
+// otlpScope is the name of the instrumentation scope of the metrics and spans.
+const otlpScope = "github.com/mcules/MikrotikMonitor"
+
+// OTLPExporter sends the metrics of polled devices and a trace of every poll to an OpenTelemetry collector
+// via OTLP/HTTP with the JSON encoding, so slow devices show up in existing observability stacks.
+// The metrics are those of ResultPrometheus, counters become cumulative sums. Every poll is a span with a
+// child span for every collector which ran. It is a Publisher, so it is attached with Monitor.Publish.
+type OTLPExporter struct {
+	Endpoint string
+	Headers  map[string]string
+	Client   *http.Client
+}
+
+// NewOTLPExporter returns an exporter to the OTLP/HTTP endpoint of a collector, e.g. "http://localhost:4318".
+// The metrics and traces are sent to the /v1/metrics and /v1/traces paths below it.
+func NewOTLPExporter(endpoint string) *OTLPExporter {
+	return &OTLPExporter{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Headers:  map[string]string{},
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Publish sends the metrics and the trace of the poll of a device.
+func (exporter *OTLPExporter) Publish(result DeviceResult) error {
+	if err := exporter.ExportMetrics(Devices{result.Device}); err != nil {
+		return err
+	}
+
+	return exporter.ExportTrace(result)
+}
+
+// Close does nothing, the exporter has no connections to close.
+func (exporter *OTLPExporter) Close() error {
+	return nil
+}
+
+// otlpAttribute is a key value pair of OTLP with a string value.
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+// otlpAttributes returns the pairs as OTLP attributes.
+func otlpAttributes(pairs [][2]string) []otlpAttribute {
+	attributes := make([]otlpAttribute, len(pairs))
+	for i, pair := range pairs {
+		attributes[i].Key = pair[0]
+		attributes[i].Value.StringValue = pair[1]
+	}
+
+	return attributes
+}
+
+// otlpResource returns the resource of the monitor, which is the same for metrics and traces.
+func otlpResource() map[string]any {
+	return map[string]any{"attributes": otlpAttributes([][2]string{
+		{"service.name", "mikrotikmonitor"},
+		{"service.version", MonitorVersion},
+	})}
+}
+
+// otlpTime returns a time in nanoseconds since the epoch as string, as 64 bit integers are encoded in OTLP/JSON.
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// ExportMetrics sends the metrics of the devices. All data points carry the time of the last poll of their device.
+func (exporter *OTLPExporter) ExportMetrics(devices Devices) error {
+	w := &metricsWriter{collect: true}
+	devices.writeMetrics(w)
+
+	polled := map[string]string{}
+	for _, device := range devices {
+		polled[device.Host] = otlpTime(device.LastPolled)
+		if device.LastPolled.IsZero() {
+			polled[device.Host] = otlpTime(time.Now())
+		}
+	}
+
+	var metrics []map[string]any
+	for _, family := range w.families {
+		var points []map[string]any
+		for _, sample := range family.samples {
+			if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+				// JSON has no representation of them
+				continue
+			}
+			timestamp := otlpTime(time.Now())
+			for _, label := range sample.labels {
+				if label[0] == "host" {
+					timestamp = polled[label[1]]
+				}
+			}
+			points = append(points, map[string]any{
+				"attributes":   otlpAttributes(sample.labels),
+				"timeUnixNano": timestamp,
+				"asDouble":     sample.value,
+			})
+		}
+		if len(points) == 0 {
+			continue
+		}
+
+		metric := map[string]any{"name": family.name, "description": family.help}
+		if family.kind == "counter" {
+			metric["name"] = strings.TrimSuffix(family.name, "_total")
+			metric["sum"] = map[string]any{"dataPoints": points, "aggregationTemporality": otlpCumulative, "isMonotonic": true}
+		} else {
+			metric["gauge"] = map[string]any{"dataPoints": points}
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return exporter.post("/v1/metrics", map[string]any{"resourceMetrics": []any{map[string]any{
+		"resource": otlpResource(),
+		"scopeMetrics": []any{map[string]any{
+			"scope":   map[string]any{"name": otlpScope, "version": MonitorVersion},
+			"metrics": metrics,
+		}},
+	}}})
+}
+
+// ExportTrace sends the trace of the poll of a device: a span of the whole poll and a child span for every
+// collector which ran during the poll, both with error status if they failed.
+func (exporter *OTLPExporter) ExportTrace(result DeviceResult) error {
+	device := result.Device
+	end := device.LastPolled
+	if end.IsZero() {
+		end = time.Now()
+	}
+	start := end.Add(-result.Duration)
+	traceID := otlpID(16)
+	pollID := otlpID(8)
+
+	attributes := otlpAttributes([][2]string{
+		{"mikrotik.host", device.Host},
+		{"mikrotik.name", device.Name},
+		{"mikrotik.site", device.Site},
+		{"mikrotik.group", device.Group},
+		{"mikrotik.model", device.Model},
+		{"mikrotik.routeros", device.Version.RouterOS},
+	})
+	poll := map[string]any{
+		"traceId":           traceID,
+		"spanId":            pollID,
+		"name":              "poll",
+		"kind":              otlpSpanKindClient,
+		"startTimeUnixNano": otlpTime(start),
+		"endTimeUnixNano":   otlpTime(end),
+		"attributes":        attributes,
+		"status":            otlpStatus(device.LastError),
+	}
+	spans := []map[string]any{poll}
+
+	names := make([]string, 0, len(device.Collectors))
+	for name, state := range device.Collectors {
+		// collectors skipped by their circuit breaker keep the state of an earlier poll
+		if !state.LastRun.Before(start) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return device.Collectors[names[i]].LastRun.Before(device.Collectors[names[j]].LastRun)
+	})
+	for _, name := range names {
+		state := device.Collectors[name]
+		message := ""
+		if state.Failures > 0 {
+			message = state.LastError
+		}
+		spans = append(spans, map[string]any{
+			"traceId":           traceID,
+			"spanId":            otlpID(8),
+			"parentSpanId":      pollID,
+			"name":              "collect " + name,
+			"kind":              otlpSpanKindInternal,
+			"startTimeUnixNano": otlpTime(state.LastRun),
+			"endTimeUnixNano":   otlpTime(state.LastRun.Add(state.Duration)),
+			"attributes":        otlpAttributes([][2]string{{"mikrotik.host", device.Host}, {"mikrotik.collector", name}}),
+			"status":            otlpStatus(message),
+		})
+	}
+
+	return exporter.post("/v1/traces", map[string]any{"resourceSpans": []any{map[string]any{
+		"resource": otlpResource(),
+		"scopeSpans": []any{map[string]any{
+			"scope": map[string]any{"name": otlpScope, "version": MonitorVersion},
+			"spans": spans,
+		}},
+	}}})
+}
+
+// otlpStatus returns the status of a span, an error if the message isn't empty.
+func otlpStatus(message string) map[string]any {
+	if message != "" {
+		return map[string]any{"code": otlpStatusError, "message": message}
+	}
+
+	return map[string]any{"code": otlpStatusOK}
+}
+
+// otlpID returns a random trace or span ID of n bytes, hex encoded as in OTLP/JSON.
+func otlpID(n int) string {
+	id := make([]byte, n)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// post sends a request to a path of the endpoint.
+func (exporter *OTLPExporter) post(path string, body any) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, exporter.Endpoint+path, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range exporter.Headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := exporter.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("OTLP request %s failed: %w", path, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("OTLP request %s failed: %s %s", path, response.Status, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
@@ -0,0 +1,541 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// labels returns the identifying labels of the device followed by its configured labels, sorted by name.
+// Configured labels never replace the identifying labels.
+func (device *Device) labels() [][2]string {
+	labels := [][2]string{{"host", device.Host}, {"name", device.Name}, {"site", device.Site}, {"group", device.Group}}
+	reserved := map[string]bool{"host": true, "name": true, "site": true, "group": true, "interface": true}
+
+	var extra [][2]string
+	for key, value := range device.Labels {
+		key = invalidLabelChars.ReplaceAllString(key, "_")
+		if reserved[key] {
+			continue
+		}
+		extra = append(extra, [2]string{key, value})
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i][0] < extra[j][0] })
+
+	return append(labels, extra...)
+}
+
+// metricsWriter renders metrics in the Prometheus text format or in OpenMetrics.
+// With collect set, the metrics are collected in families instead, e.g. to send them via OTLP.
+type metricsWriter struct {
+	strings.Builder
+	openMetrics bool
+	collect     bool
+	families    []metricFamily
+}
+
+// metricFamily is a metric with its samples collected by a metricsWriter.
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	samples []metricSample
+}
+
+// metricSample is a sample of a metricFamily.
+type metricSample struct {
+	labels [][2]string
+	value  float64
+}
+
+var escapeLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metric writes the HELP and TYPE lines of a metric family.
+// OpenMetrics names counter families without the _total suffix of their samples.
+func (w *metricsWriter) metric(name string, help string, kind string) {
+	if w.collect {
+		w.families = append(w.families, metricFamily{name: name, help: help, kind: kind})
+		return
+	}
+	if w.openMetrics && kind == "counter" {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a sample of a metric.
+func (w *metricsWriter) sample(name string, labels [][2]string, value float64) {
+	if w.collect {
+		for i := len(w.families) - 1; i >= 0; i-- {
+			if w.families[i].name == name {
+				w.families[i].samples = append(w.families[i].samples, metricSample{labels: labels, value: value})
+				break
+			}
+		}
+		return
+	}
+	if len(labels) == 0 {
+		fmt.Fprintf(w, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+		return
+	}
+	fmt.Fprintf(w, "%s{%s} %s\n", name, formatLabels(labels), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// exemplar writes a sample of a counter with an exemplar, which is only part of the output in OpenMetrics.
+func (w *metricsWriter) exemplar(name string, labels [][2]string, value float64, exemplar [][2]string, timestamp time.Time) {
+	if !w.openMetrics {
+		w.sample(name, labels, value)
+		return
+	}
+	fmt.Fprintf(w, "%s{%s} %s # {%s} 1 %s\n", name, formatLabels(labels), strconv.FormatFloat(value, 'g', -1, 64),
+		formatLabels(exemplar), strconv.FormatFloat(float64(timestamp.UnixMilli())/1000, 'f', 3, 64))
+}
+
+func formatLabels(labels [][2]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, label[0]+`="`+escapeLabel.Replace(label[1])+`"`)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// ResultPrometheus returns the devices in the Prometheus text exposition format.
+// Every metric carries host, name, site and group and the configured labels of its device.
+func (devices *Devices) ResultPrometheus() string {
+	w := &metricsWriter{}
+	devices.writeMetrics(w)
+
+	return w.String()
+}
+
+// ResultOpenMetrics returns the devices in the OpenMetrics text format, with the same metrics as ResultPrometheus.
+func (devices *Devices) ResultOpenMetrics() string {
+	w := &metricsWriter{openMetrics: true}
+	devices.writeMetrics(w)
+	w.WriteString("# EOF\n")
+
+	return w.String()
+}
+
+// writeMetrics writes the metrics of all devices.
+func (devices *Devices) writeMetrics(w *metricsWriter) {
+	metric, sample := w.metric, w.sample
+	boolean := func(value bool) float64 {
+		if value {
+			return 1
+		}
+		return 0
+	}
+
+	metric("mikrotik_up", "Whether the device answered the last poll.", "gauge")
+	for _, device := range *devices {
+		sample("mikrotik_up", device.labels(), boolean(device.Reached))
+	}
+
+	metric("mikrotik_info", "Model, versions, serial number and update channel of the device.", "gauge")
+	for _, device := range *devices {
+		labels := append(device.labels(), [2]string{"model", device.Model}, [2]string{"routeros", device.Version.RouterOS},
+			[2]string{"bootloader", device.Version.Bootloader}, [2]string{"latest", device.Version.Latest},
+			[2]string{"serial", device.SerialNumber}, [2]string{"update_channel", device.UpdateChannel},
+			[2]string{"latest_release", device.Version.LatestRelease})
+		sample("mikrotik_info", labels, 1)
+	}
+
+	metric("mikrotik_snmp_rtt_seconds", "Round trip time of the SNMP request of the last poll.", "gauge")
+	for _, device := range *devices {
+		if device.Reached {
+			sample("mikrotik_snmp_rtt_seconds", device.labels(), device.Latency.SNMP.Seconds())
+		}
+	}
+
+	pings := []struct {
+		name  string
+		help  string
+		value func(latency Latency) float64
+	}{
+		{"mikrotik_ping_rtt_seconds", "Average ICMP round trip time of the last poll.", func(latency Latency) float64 { return latency.Ping.Seconds() }},
+		{"mikrotik_ping_jitter_seconds", "Average difference between consecutive ICMP round trip times of the last poll.", func(latency Latency) float64 { return latency.Jitter.Seconds() }},
+		{"mikrotik_ping_loss_ratio", "Share of ICMP echo requests without reply in the last poll.", func(latency Latency) float64 { return latency.Loss }},
+	}
+	for _, ping := range pings {
+		metric(ping.name, ping.help, "gauge")
+		for _, device := range *devices {
+			if device.Latency.Samples > 0 && device.Reached {
+				sample(ping.name, device.labels(), ping.value(device.Latency))
+			}
+		}
+	}
+
+	metric("mikrotik_update_available", "Whether a newer RouterOS version is available on the channel of the device.", "gauge")
+	for _, device := range *devices {
+		sample("mikrotik_update_available", device.labels(), boolean(device.Version.UpdateAvailable))
+	}
+
+	metric("mikrotik_advisory", "Known critical vulnerability or end of life affecting the RouterOS version of the device.", "gauge")
+	for _, device := range *devices {
+		for _, advisory := range device.Advisories {
+			sample("mikrotik_advisory", append(device.labels(), [2]string{"advisory", advisory}), 1)
+		}
+	}
+
+	metric("mikrotik_security_score", "Security posture of the device, 100 without weak credentials.", "gauge")
+	for _, device := range *devices {
+		if !device.Reached {
+			// the audit only runs on reached devices
+			continue
+		}
+		sample("mikrotik_security_score", device.labels(), float64(device.Audit.Score))
+	}
+
+	metric("mikrotik_wireless_clients", "Number of connected wireless clients.", "gauge")
+	for _, device := range *devices {
+		sample("mikrotik_wireless_clients", device.labels(), float64(device.Wireless.Clients))
+	}
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(iface Interface) uint64
+	}{
+		{"mikrotik_interface_in_octets_total", "Received octets.", func(iface Interface) uint64 { return iface.InOctets }},
+		{"mikrotik_interface_out_octets_total", "Sent octets.", func(iface Interface) uint64 { return iface.OutOctets }},
+		{"mikrotik_interface_in_packets_total", "Received unicast packets.", func(iface Interface) uint64 { return iface.InPackets }},
+		{"mikrotik_interface_out_packets_total", "Sent unicast packets.", func(iface Interface) uint64 { return iface.OutPackets }},
+		{"mikrotik_interface_in_errors_total", "Received packets with errors.", func(iface Interface) uint64 { return iface.InErrors }},
+		{"mikrotik_interface_out_errors_total", "Packets not sent because of errors.", func(iface Interface) uint64 { return iface.OutErrors }},
+		{"mikrotik_interface_in_discards_total", "Discarded received packets.", func(iface Interface) uint64 { return iface.InDiscards }},
+		{"mikrotik_interface_out_discards_total", "Discarded packets to send.", func(iface Interface) uint64 { return iface.OutDiscards }},
+	}
+	for _, counter := range counters {
+		metric(counter.name, counter.help, "counter")
+		for _, device := range *devices {
+			for _, iface := range device.Interfaces {
+				sample(counter.name, append(device.labels(), [2]string{"interface", iface.Name}), float64(counter.value(iface)))
+			}
+		}
+	}
+
+	queueCounters := []struct {
+		name  string
+		help  string
+		kind  string
+		value func(counters QueueCounters) uint64
+	}{
+		{"mikrotik_queue_bytes_total", "Bytes passed through the queue.", "counter", func(counters QueueCounters) uint64 { return counters.Bytes }},
+		{"mikrotik_queue_packets_total", "Packets passed through the queue.", "counter", func(counters QueueCounters) uint64 { return counters.Packets }},
+		{"mikrotik_queue_dropped_total", "Packets dropped by the queue.", "counter", func(counters QueueCounters) uint64 { return counters.Dropped }},
+		{"mikrotik_queue_max_limit_bits", "Rate limit of the queue in bits per second, 0 if unlimited or unknown.", "gauge", func(counters QueueCounters) uint64 { return counters.MaxLimit }},
+	}
+	for _, counter := range queueCounters {
+		metric(counter.name, counter.help, counter.kind)
+		for _, device := range *devices {
+			for _, queue := range device.Queues {
+				labels := append(device.labels(), [2]string{"queue", queue.Name}, [2]string{"type", queue.Type})
+				if queue.Type == QueueSimple {
+					sample(counter.name, append(labels, [2]string{"direction", "in"}), float64(counter.value(queue.In)))
+				}
+				sample(counter.name, append(labels, [2]string{"direction", "out"}), float64(counter.value(queue.Out)))
+			}
+		}
+	}
+
+	poe := []struct {
+		name  string
+		help  string
+		value func(port POEPort) float64
+	}{
+		{"mikrotik_poe_powered", "Whether the PoE-out port powers a device.", func(port POEPort) float64 { return boolean(port.Status == POEPoweredOn) }},
+		{"mikrotik_poe_voltage_volts", "Voltage of the PoE-out port.", func(port POEPort) float64 { return port.Voltage }},
+		{"mikrotik_poe_current_amperes", "Current drawn from the PoE-out port.", func(port POEPort) float64 { return port.Current / 1000 }},
+		{"mikrotik_poe_power_watts", "Power drawn from the PoE-out port.", func(port POEPort) float64 { return port.Power }},
+	}
+	for _, value := range poe {
+		metric(value.name, value.help, "gauge")
+		for _, device := range *devices {
+			for _, port := range device.POE {
+				sample(value.name, append(device.labels(), [2]string{"interface", port.Name}, [2]string{"status", port.Status}), value.value(port))
+			}
+		}
+	}
+
+	metric("mikrotik_capsman_caps", "Number of CAPs managed by the CAPsMAN of the device by state.", "gauge")
+	for _, device := range *devices {
+		states := map[string]int{}
+		var names []string
+		for _, managed := range device.CAPsMAN.CAPs {
+			if states[managed.State] == 0 {
+				names = append(names, managed.State)
+			}
+			states[managed.State]++
+		}
+		sort.Strings(names)
+		for _, state := range names {
+			sample("mikrotik_capsman_caps", append(device.labels(), [2]string{"state", state}), float64(states[state]))
+		}
+	}
+	metric("mikrotik_capsman_clients", "Number of clients registered on an interface managed by CAPsMAN.", "gauge")
+	for _, device := range *devices {
+		for _, iface := range device.CAPsMAN.Interfaces {
+			sample("mikrotik_capsman_clients", append(device.labels(), [2]string{"interface", iface.Name}, [2]string{"channel", iface.Channel}), float64(iface.Clients))
+		}
+	}
+
+	metric("mikrotik_conntrack_entries", "Number of entries in the connection tracking table.", "gauge")
+	for _, device := range *devices {
+		if device.Firewall.MaxConnections > 0 {
+			sample("mikrotik_conntrack_entries", device.labels(), float64(device.Firewall.Connections))
+		}
+	}
+	metric("mikrotik_conntrack_max_entries", "Maximum number of entries in the connection tracking table.", "gauge")
+	for _, device := range *devices {
+		if device.Firewall.MaxConnections > 0 {
+			sample("mikrotik_conntrack_max_entries", device.labels(), float64(device.Firewall.MaxConnections))
+		}
+	}
+	for _, counter := range []struct {
+		name  string
+		help  string
+		value func(rule FirewallRule) uint64
+	}{
+		{"mikrotik_firewall_rule_packets_total", "Packets matched by a tagged firewall rule.", func(rule FirewallRule) uint64 { return rule.Packets }},
+		{"mikrotik_firewall_rule_bytes_total", "Bytes matched by a tagged firewall rule.", func(rule FirewallRule) uint64 { return rule.Bytes }},
+	} {
+		metric(counter.name, counter.help, "counter")
+		for _, device := range *devices {
+			for _, rule := range device.Firewall.Rules {
+				labels := append(device.labels(), [2]string{"table", rule.Table}, [2]string{"chain", rule.Chain},
+					[2]string{"action", rule.Action}, [2]string{"comment", rule.Comment})
+				sample(counter.name, labels, float64(counter.value(rule)))
+			}
+		}
+	}
+
+	metric("mikrotik_bgp_peer_up", "Whether the BGP session is established.", "gauge")
+	for _, device := range *devices {
+		for _, peer := range device.Routing.BGP {
+			labels := append(device.labels(), [2]string{"peer", peer.Address}, [2]string{"peer_name", peer.Name}, [2]string{"as", strconv.Itoa(peer.AS)})
+			sample("mikrotik_bgp_peer_up", labels, boolean(peer.State == BGPEstablished))
+		}
+	}
+	metric("mikrotik_bgp_peer_prefixes", "Number of prefixes received from the BGP peer.", "gauge")
+	for _, device := range *devices {
+		for _, peer := range device.Routing.BGP {
+			labels := append(device.labels(), [2]string{"peer", peer.Address}, [2]string{"peer_name", peer.Name}, [2]string{"as", strconv.Itoa(peer.AS)})
+			sample("mikrotik_bgp_peer_prefixes", labels, float64(peer.Prefixes))
+		}
+	}
+	metric("mikrotik_ospf_neighbor_up", "Whether the OSPF neighbor is in state Full.", "gauge")
+	for _, device := range *devices {
+		for _, neighbor := range device.Routing.OSPF {
+			labels := append(device.labels(), [2]string{"neighbor", neighbor.Address}, [2]string{"router_id", neighbor.RouterID})
+			sample("mikrotik_ospf_neighbor_up", labels, boolean(neighbor.State == OSPFFull))
+		}
+	}
+
+	metric("mikrotik_ipsec_peer_established", "Whether the active IPsec peer is established.", "gauge")
+	for _, device := range *devices {
+		for _, peer := range device.VPN.IPsec {
+			sample("mikrotik_ipsec_peer_established", append(device.labels(), [2]string{"peer", peer.Address}), boolean(peer.State == "established"))
+		}
+	}
+	metric("mikrotik_ipsec_installed_sas", "Number of installed IPsec security associations.", "gauge")
+	for _, device := range *devices {
+		if device.API.User != "" {
+			sample("mikrotik_ipsec_installed_sas", device.labels(), float64(len(device.VPN.SAs)))
+		}
+	}
+	metric("mikrotik_wireguard_last_handshake_seconds", "Time since the last handshake of the WireGuard peer.", "gauge")
+	for _, device := range *devices {
+		for _, peer := range device.VPN.WireGuard {
+			if peer.Handshaked {
+				labels := append(device.labels(), [2]string{"interface", peer.Interface}, [2]string{"peer", peer.Name}, [2]string{"endpoint", peer.Endpoint})
+				sample("mikrotik_wireguard_last_handshake_seconds", labels, peer.LastHandshake.Seconds())
+			}
+		}
+	}
+	for _, counter := range []struct {
+		name  string
+		help  string
+		value func(peer WireGuardPeer) uint64
+	}{
+		{"mikrotik_wireguard_rx_bytes_total", "Bytes received from the WireGuard peer.", func(peer WireGuardPeer) uint64 { return peer.RxBytes }},
+		{"mikrotik_wireguard_tx_bytes_total", "Bytes sent to the WireGuard peer.", func(peer WireGuardPeer) uint64 { return peer.TxBytes }},
+	} {
+		metric(counter.name, counter.help, "counter")
+		for _, device := range *devices {
+			for _, peer := range device.VPN.WireGuard {
+				labels := append(device.labels(), [2]string{"interface", peer.Interface}, [2]string{"peer", peer.Name}, [2]string{"endpoint", peer.Endpoint})
+				sample(counter.name, labels, float64(counter.value(peer)))
+			}
+		}
+	}
+
+	metric("mikrotik_sessions", "Number of active subscriber sessions.", "gauge")
+	for _, device := range *devices {
+		if device.API.User == "" {
+			continue
+		}
+		sample("mikrotik_sessions", append(device.labels(), [2]string{"type", SessionHotspot}), float64(device.Sessions.Hotspot))
+		sample("mikrotik_sessions", append(device.labels(), [2]string{"type", SessionPPPoE}), float64(device.Sessions.PPPoE))
+	}
+
+	metric("mikrotik_table_entries", "Number of entries in the ARP, IPv6 neighbor and bridge host tables.", "gauge")
+	for _, device := range *devices {
+		if !device.Reached {
+			continue
+		}
+		sample("mikrotik_table_entries", append(device.labels(), [2]string{"table", "arp"}), float64(device.Tables.ARP))
+		sample("mikrotik_table_entries", append(device.labels(), [2]string{"table", "nd"}), float64(device.Tables.ND))
+		sample("mikrotik_table_entries", append(device.labels(), [2]string{"table", "bridge_hosts"}), float64(device.Tables.BridgeHosts))
+	}
+
+	customs := map[string]CustomOID{}
+	var customNames []string
+	for _, device := range *devices {
+		for _, custom := range device.OIDs {
+			if _, found := customs[custom.Name]; !found {
+				customs[custom.Name] = custom
+				customNames = append(customNames, custom.Name)
+			}
+		}
+	}
+	sort.Strings(customNames)
+	for _, name := range customNames {
+		custom := customs[name]
+		kind, help := custom.Type, "Custom OID "+custom.OID
+		if kind == "" {
+			kind = CustomGauge
+		}
+		if custom.Unit != "" {
+			help += " in " + custom.Unit
+		}
+		metricName := "mikrotik_custom_" + name
+		if kind == CustomCounter && !strings.HasSuffix(metricName, "_total") {
+			metricName += "_total"
+		}
+		metric(metricName, help+".", kind)
+		for _, device := range *devices {
+			if value, found := device.Custom[name]; found {
+				sample(metricName, device.labels(), value)
+			}
+		}
+	}
+
+	metric("mikrotik_service_up", "Whether the service check passed in the last poll.", "gauge")
+	for _, device := range *devices {
+		for _, result := range device.ServiceStates {
+			sample("mikrotik_service_up", append(device.labels(), [2]string{"service", result.Name}, [2]string{"type", result.Type}), boolean(result.Up))
+		}
+	}
+	metric("mikrotik_service_duration_seconds", "Duration of the service check in the last poll.", "gauge")
+	for _, device := range *devices {
+		for _, result := range device.ServiceStates {
+			sample("mikrotik_service_duration_seconds", append(device.labels(), [2]string{"service", result.Name}, [2]string{"type", result.Type}), result.Duration.Seconds())
+		}
+	}
+
+	metric("mikrotik_storage_size_bytes", "Size of the memory or disk.", "gauge")
+	for _, device := range *devices {
+		for _, storage := range device.Storage {
+			sample("mikrotik_storage_size_bytes", append(device.labels(), [2]string{"storage", storage.Name}, [2]string{"type", storage.Type}), float64(storage.Total))
+		}
+	}
+	metric("mikrotik_storage_used_bytes", "Used bytes of the memory or disk.", "gauge")
+	for _, device := range *devices {
+		for _, storage := range device.Storage {
+			sample("mikrotik_storage_used_bytes", append(device.labels(), [2]string{"storage", storage.Name}, [2]string{"type", storage.Type}), float64(storage.Used))
+		}
+	}
+
+	optics := []struct {
+		name  string
+		help  string
+		value func(optic Optic) float64
+	}{
+		{"mikrotik_sfp_temperature_celsius", "Temperature of the SFP module.", func(optic Optic) float64 { return optic.Temperature }},
+		{"mikrotik_sfp_tx_power_dbm", "Transmit power of the SFP module.", func(optic Optic) float64 { return optic.TxPower }},
+		{"mikrotik_sfp_rx_power_dbm", "Receive power of the SFP module.", func(optic Optic) float64 { return optic.RxPower }},
+		{"mikrotik_sfp_tx_bias_amperes", "Laser bias current of the SFP module.", func(optic Optic) float64 { return optic.TxBias / 1000 }},
+		{"mikrotik_sfp_rx_loss", "Whether the SFP module lost the receive signal.", func(optic Optic) float64 { return boolean(optic.RxLoss) }},
+	}
+	for _, value := range optics {
+		metric(value.name, value.help, "gauge")
+		for _, device := range *devices {
+			for _, optic := range device.Optics {
+				labels := append(device.labels(), [2]string{"interface", optic.Name}, [2]string{"vendor", optic.Vendor},
+					[2]string{"wavelength", strconv.FormatFloat(optic.Wavelength, 'f', -1, 64)})
+				sample(value.name, labels, value.value(optic))
+			}
+		}
+	}
+
+	rates := []struct {
+		name  string
+		help  string
+		value func(rates Rates) float64
+	}{
+		{"mikrotik_interface_in_bits_per_second", "Received bits per second between the last two polls.", func(rates Rates) float64 { return rates.InBits }},
+		{"mikrotik_interface_out_bits_per_second", "Sent bits per second between the last two polls.", func(rates Rates) float64 { return rates.OutBits }},
+		{"mikrotik_interface_in_packets_per_second", "Received unicast packets per second between the last two polls.", func(rates Rates) float64 { return rates.InPackets }},
+		{"mikrotik_interface_out_packets_per_second", "Sent unicast packets per second between the last two polls.", func(rates Rates) float64 { return rates.OutPackets }},
+	}
+	for _, rate := range rates {
+		metric(rate.name, rate.help, "gauge")
+		for _, device := range *devices {
+			for _, iface := range device.Interfaces {
+				sample(rate.name, append(device.labels(), [2]string{"interface", iface.Name}), rate.value(iface.Rates))
+			}
+		}
+	}
+}
+
+// ResultInflux returns the devices in the InfluxDB line protocol.
+// The measurement mikrotik holds the device values, mikrotik_interface the interface counters
+// and mikrotik_custom the values of the custom OIDs.
+// Host, name, site, group and the configured labels are written as tags, empty tags are omitted.
+func (devices *Devices) ResultInflux() string {
+	var builder strings.Builder
+	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+	escapeTag := strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	escapeString := strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+	tags := func(labels [][2]string) string {
+		var result string
+		for _, label := range labels {
+			if label[1] != "" {
+				result += "," + escapeTag.Replace(label[0]) + "=" + escapeTag.Replace(label[1])
+			}
+		}
+		return result
+	}
+
+	for _, device := range *devices {
+		fmt.Fprintf(&builder, "mikrotik%s reached=%t,update_available=%t,wireless_clients=%di,security_score=%di,routeros=\"%s\",model=\"%s\" %s\n",
+			tags(device.labels()), device.Reached, device.Version.UpdateAvailable, device.Wireless.Clients, device.Audit.Score,
+			escapeString.Replace(device.Version.RouterOS), escapeString.Replace(device.Model), timestamp)
+
+		if len(device.Custom) > 0 {
+			fields := make([]string, 0, len(device.Custom))
+			for name, value := range device.Custom {
+				fields = append(fields, name+"="+strconv.FormatFloat(value, 'g', -1, 64))
+			}
+			sort.Strings(fields)
+			fmt.Fprintf(&builder, "mikrotik_custom%s %s %s\n", tags(device.labels()), strings.Join(fields, ","), timestamp)
+		}
+
+		for _, iface := range device.Interfaces {
+			fmt.Fprintf(&builder, "mikrotik_interface%s in_octets=%di,out_octets=%di,in_packets=%di,out_packets=%di,in_errors=%di,out_errors=%di,in_discards=%di,out_discards=%di,"+
+				"in_bps=%g,out_bps=%g,in_pps=%g,out_pps=%g %s\n",
+				tags(append(device.labels(), [2]string{"interface", iface.Name})),
+				iface.InOctets, iface.OutOctets, iface.InPackets, iface.OutPackets, iface.InErrors, iface.OutErrors, iface.InDiscards, iface.OutDiscards,
+				iface.Rates.InBits, iface.Rates.OutBits, iface.Rates.InPackets, iface.Rates.OutPackets, timestamp)
+		}
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,101 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"github.com/gosnmp/gosnmp"
+	"sync"
+	"time"
+)
+
+// pacer spaces the SNMP requests of all devices of a monitor evenly at a rate per second.
+// It is safe for concurrent use.
+type pacer struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time
+}
+
+// wait blocks until the next request may be sent, or the context is cancelled, and returns the time waited.
+func (pacer *pacer) wait(ctx context.Context) time.Duration {
+	pacer.mu.Lock()
+	now := time.Now()
+	at := pacer.next
+	if at.Before(now) {
+		at = now
+	}
+	pacer.next = at.Add(time.Duration(float64(time.Second) / pacer.rate))
+	pacer.mu.Unlock()
+
+	return sleep(ctx, at.Sub(now))
+}
+
+// sleep blocks for the duration or until the context is cancelled and returns the time slept.
+func sleep(ctx context.Context, duration time.Duration) time.Duration {
+	if duration <= 0 {
+		return 0
+	}
+	start := time.Now()
+	timer := time.NewTimer(duration)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+	case <-timer.C:
+	}
+
+	return time.Since(start)
+}
+
+// pace returns the PreSend hook of the SNMP client of the device, nil if the requests aren't limited.
+// The hook keeps the Delay of the SNMP settings between two requests to the device and waits for the rate
+// limit of the monitor.
+func (device *Device) pace() func(*gosnmp.GoSNMP) {
+	pacer, delay := device.pacer, device.SNMP.Delay
+	if pacer == nil && delay <= 0 {
+		return nil
+	}
+
+	var last time.Time
+	return func(client *gosnmp.GoSNMP) {
+		ctx := client.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		var waited time.Duration
+		if delay > 0 && !last.IsZero() {
+			waited += sleep(ctx, time.Until(last.Add(delay)))
+		}
+		if pacer != nil {
+			waited += pacer.wait(ctx)
+		}
+		last = time.Now()
+
+		if waited > 0 && client.Conn != nil {
+			// gosnmp set the deadline of the request before the wait
+			deadline := time.Now().Add(client.Timeout)
+			if contextDeadline, ok := ctx.Deadline(); ok && contextDeadline.Before(deadline) {
+				deadline = contextDeadline
+			}
+			_ = client.Conn.SetDeadline(deadline)
+		}
+	}
+}
+
+// pacing returns the pacer of the RateLimit, nil if the requests aren't limited.
+func (monitor *Monitor) pacing() *pacer {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	if monitor.RateLimit <= 0 {
+		monitor.pacer = nil
+		return nil
+	}
+	if monitor.pacer == nil {
+		monitor.pacer = &pacer{}
+	}
+	monitor.pacer.mu.Lock()
+	monitor.pacer.rate = monitor.RateLimit
+	monitor.pacer.mu.Unlock()
+
+	return monitor.pacer
+}
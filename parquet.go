@@ -0,0 +1,260 @@
+package MikrotikMonitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Parquet physical types, converted types and thrift compact protocol types used by the ParquetWriter.
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// ParquetColumn is a required column of a Parquet file.
+// Exactly one of Strings, Int64s and Doubles holds the values, Timestamp marks Int64s as milliseconds since the epoch.
+type ParquetColumn struct {
+	Name      string
+	Strings   []string
+	Int64s    []int64
+	Doubles   []float64
+	Timestamp bool
+}
+
+// WriteParquet writes the columns as an uncompressed Parquet file with a single row group and one PLAIN encoded
+// data page per column. All columns must hold the same number of values.
+// The metadata is stored as key/value pairs in the file footer.
+func WriteParquet(w io.Writer, columns []ParquetColumn, metadata map[string]string) error {
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+
+	rows := 0
+	if len(columns) > 0 {
+		rows = columns[0].len()
+	}
+
+	type chunk struct {
+		offset int64
+		size   int64
+	}
+	chunks := make([]chunk, len(columns))
+	for i, column := range columns {
+		var page bytes.Buffer
+		switch {
+		case column.Strings != nil:
+			for _, value := range column.Strings {
+				_ = binary.Write(&page, binary.LittleEndian, uint32(len(value)))
+				page.WriteString(value)
+			}
+		case column.Doubles != nil:
+			for _, value := range column.Doubles {
+				_ = binary.Write(&page, binary.LittleEndian, math.Float64bits(value))
+			}
+		default:
+			for _, value := range column.Int64s {
+				_ = binary.Write(&page, binary.LittleEndian, value)
+			}
+		}
+
+		header := &thriftWriter{}
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(page.Len()))
+		header.i32(3, int32(page.Len()))
+		header.beginStruct(5)
+		header.i32(1, int32(column.len()))
+		header.i32(2, 0) // PLAIN
+		header.i32(3, 3) // RLE
+		header.i32(4, 3) // RLE
+		header.endStruct()
+		header.stop()
+
+		chunks[i] = chunk{offset: int64(file.Len()), size: int64(header.Len() + page.Len())}
+		file.Write(header.Bytes())
+		file.Write(page.Bytes())
+	}
+
+	meta := &thriftWriter{}
+	meta.i32(1, 1)
+	meta.beginList(2, thriftStruct, len(columns)+1)
+	meta.beginElement()
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.endStruct()
+	for _, column := range columns {
+		meta.beginElement()
+		meta.i32(1, column.physicalType())
+		meta.i32(3, 0) // REQUIRED
+		meta.str(4, column.Name)
+		switch {
+		case column.Strings != nil:
+			meta.i32(6, parquetUTF8)
+		case column.Timestamp:
+			meta.i32(6, parquetTimestampMillis)
+		}
+		meta.endStruct()
+	}
+	meta.i64(3, int64(rows))
+
+	var total int64
+	for _, c := range chunks {
+		total += c.size
+	}
+	meta.beginList(4, thriftStruct, 1)
+	meta.beginElement()
+	meta.beginList(1, thriftStruct, len(columns))
+	for i, column := range columns {
+		meta.beginElement()
+		meta.i64(2, chunks[i].offset)
+		meta.beginStruct(3)
+		meta.i32(1, column.physicalType())
+		meta.beginList(2, thriftI32, 1)
+		meta.varint(0)
+		meta.beginList(3, thriftBinary, 1)
+		meta.binary(column.Name)
+		meta.i32(4, 0) // UNCOMPRESSED
+		meta.i64(5, int64(column.len()))
+		meta.i64(6, chunks[i].size)
+		meta.i64(7, chunks[i].size)
+		meta.i64(9, chunks[i].offset)
+		meta.endStruct()
+		meta.endStruct()
+	}
+	meta.i64(2, total)
+	meta.i64(3, int64(rows))
+	meta.endStruct()
+
+	if len(metadata) > 0 {
+		keys := sortedKeys(metadata)
+		meta.beginList(5, thriftStruct, len(keys))
+		for _, key := range keys {
+			meta.beginElement()
+			meta.str(1, key)
+			meta.str(2, metadata[key])
+			meta.endStruct()
+		}
+	}
+	meta.str(6, "MikrotikMonitor")
+	meta.stop()
+
+	file.Write(meta.Bytes())
+	_ = binary.Write(&file, binary.LittleEndian, uint32(meta.Len()))
+	file.WriteString("PAR1")
+
+	_, err := w.Write(file.Bytes())
+
+	return err
+}
+
+func (column ParquetColumn) len() int {
+	switch {
+	case column.Strings != nil:
+		return len(column.Strings)
+	case column.Doubles != nil:
+		return len(column.Doubles)
+	}
+
+	return len(column.Int64s)
+}
+
+func (column ParquetColumn) physicalType() int32 {
+	switch {
+	case column.Strings != nil:
+		return parquetByteArray
+	case column.Doubles != nil:
+		return parquetDouble
+	}
+
+	return parquetInt64
+}
+
+// thriftWriter encodes structs in the thrift compact protocol, which is used by the Parquet metadata.
+type thriftWriter struct {
+	bytes.Buffer
+	last  int16
+	stack []int16
+}
+
+func (t *thriftWriter) varint(value uint64) {
+	for value >= 0x80 {
+		t.WriteByte(byte(value) | 0x80)
+		value >>= 7
+	}
+	t.WriteByte(byte(value))
+}
+
+func (t *thriftWriter) zigzag(value int64) {
+	t.varint(uint64((value << 1) ^ (value >> 63)))
+}
+
+func (t *thriftWriter) field(id int16, kind byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		t.WriteByte(kind)
+		t.zigzag(int64(id))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) i32(id int16, value int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(value))
+}
+
+func (t *thriftWriter) i64(id int16, value int64) {
+	t.field(id, thriftI64)
+	t.zigzag(value)
+}
+
+func (t *thriftWriter) binary(value string) {
+	t.varint(uint64(len(value)))
+	t.WriteString(value)
+}
+
+func (t *thriftWriter) str(id int16, value string) {
+	t.field(id, thriftBinary)
+	t.binary(value)
+}
+
+func (t *thriftWriter) beginList(id int16, kind byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.WriteByte(byte(size)<<4 | kind)
+		return
+	}
+	t.WriteByte(0xf0 | kind)
+	t.varint(uint64(size))
+}
+
+// beginStruct starts a struct field, beginElement a struct element of a list.
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.beginElement()
+}
+
+func (t *thriftWriter) beginElement() {
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+func (t *thriftWriter) endStruct() {
+	t.stop()
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *thriftWriter) stop() {
+	t.WriteByte(0)
+}
@@ -0,0 +1,114 @@
+package MikrotikMonitor
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+)
+
+// ErrNoValue is returned by the decoding helpers for variables the agent has no value for,
+// i.e. noSuchObject, noSuchInstance, endOfMibView or null.
+var ErrNoValue = errors.New("no value")
+
+// checkValue returns ErrNoValue for variables without a value.
+func checkValue(variable gosnmp.SnmpPDU) error {
+	switch variable.Type {
+	case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView, gosnmp.Null:
+		return fmt.Errorf("%s: %w", variable.Name, ErrNoValue)
+	}
+
+	return nil
+}
+
+// AsString returns the value of an OctetString variable, e.g. a name or a description.
+// Unlike a type assertion on Value it returns an error instead of panicking for unexpected types.
+func AsString(variable gosnmp.SnmpPDU) (string, error) {
+	if err := checkValue(variable); err != nil {
+		return "", err
+	}
+	value, ok := variable.Value.([]byte)
+	if !ok {
+		return "", fmt.Errorf("%s: expected an octet string, got %s", variable.Name, variable.Type)
+	}
+
+	return string(value), nil
+}
+
+// AsIPAddress returns the value of an IpAddress variable, e.g. "192.168.88.1".
+func AsIPAddress(variable gosnmp.SnmpPDU) (string, error) {
+	if err := checkValue(variable); err != nil {
+		return "", err
+	}
+	value, ok := variable.Value.(string)
+	if variable.Type != gosnmp.IPAddress || !ok {
+		return "", fmt.Errorf("%s: expected an IP address, got %s", variable.Name, variable.Type)
+	}
+
+	return value, nil
+}
+
+// AsOID returns the value of an ObjectIdentifier variable with a leading dot.
+func AsOID(variable gosnmp.SnmpPDU) (string, error) {
+	if err := checkValue(variable); err != nil {
+		return "", err
+	}
+	value, ok := variable.Value.(string)
+	if variable.Type != gosnmp.ObjectIdentifier || !ok {
+		return "", fmt.Errorf("%s: expected an object identifier, got %s", variable.Name, variable.Type)
+	}
+	if len(value) > 0 && value[0] != '.' {
+		value = "." + value
+	}
+
+	return value, nil
+}
+
+// AsInt returns the value of an Integer, Gauge32, Counter32, TimeTicks or Uinteger32 variable.
+func AsInt(variable gosnmp.SnmpPDU) (int64, error) {
+	if err := checkValue(variable); err != nil {
+		return 0, err
+	}
+	switch variable.Type {
+	case gosnmp.Integer, gosnmp.Gauge32, gosnmp.Counter32, gosnmp.TimeTicks, gosnmp.Uinteger32:
+		return gosnmp.ToBigInt(variable.Value).Int64(), nil
+	case gosnmp.Counter64:
+		value := gosnmp.ToBigInt(variable.Value)
+		if !value.IsInt64() {
+			return 0, fmt.Errorf("%s: %s overflows an int64", variable.Name, value)
+		}
+		return value.Int64(), nil
+	}
+
+	return 0, fmt.Errorf("%s: expected an integer, got %s", variable.Name, variable.Type)
+}
+
+// AsCounter64 returns the value of a Counter64, Counter32 or Gauge32 variable, e.g. an octet counter.
+// Non-negative integers are accepted as well, as some agents report counters of their own MIB as integers.
+func AsCounter64(variable gosnmp.SnmpPDU) (uint64, error) {
+	if err := checkValue(variable); err != nil {
+		return 0, err
+	}
+	switch variable.Type {
+	case gosnmp.Counter64, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.Uinteger32, gosnmp.TimeTicks:
+		return gosnmp.ToBigInt(variable.Value).Uint64(), nil
+	case gosnmp.Integer:
+		value := gosnmp.ToBigInt(variable.Value).Int64()
+		if value < 0 {
+			return 0, fmt.Errorf("%s: negative counter %d", variable.Name, value)
+		}
+		return uint64(value), nil
+	}
+
+	return 0, fmt.Errorf("%s: expected a counter, got %s", variable.Name, variable.Type)
+}
+
+// AsFloat returns the value of a numeric variable as float64, counters beyond 2^53 lose precision.
+func AsFloat(variable gosnmp.SnmpPDU) (float64, error) {
+	if variable.Type == gosnmp.Counter64 {
+		value, err := AsCounter64(variable)
+		return float64(value), err
+	}
+	value, err := AsInt(variable)
+
+	return float64(value), err
+}
@@ -0,0 +1,146 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EventPOE is the type of events raised when a PoE-out port stops powering its device, e.g. an access point.
+// The event is resolved when the port powers a device again, the subject is the name of the port.
+const EventPOE = "POE"
+
+// PoE port states of the MikroTik MIB.
+const (
+	POEDisabled       = "disabled"
+	POEWaitingForLoad = "waiting-for-load"
+	POEPoweredOn      = "powered-on"
+	POEOverload       = "overload"
+)
+
+// OIDs of the PoE table of the MikroTik MIB, indexed by the interface index.
+const (
+	oidPOEName    = ".1.3.6.1.4.1.14988.1.1.15.1.1.2"
+	oidPOEStatus  = ".1.3.6.1.4.1.14988.1.1.15.1.1.3"
+	oidPOEVoltage = ".1.3.6.1.4.1.14988.1.1.15.1.1.4"
+	oidPOECurrent = ".1.3.6.1.4.1.14988.1.1.15.1.1.5"
+	oidPOEPower   = ".1.3.6.1.4.1.14988.1.1.15.1.1.6"
+)
+
+// POEPort is the state of a PoE-out port. Voltage is in volts, Current in milliamperes and Power in watts.
+type POEPort struct {
+	Index   int     `json:"Index"`
+	Name    string  `json:"Name"`
+	Status  string  `json:"Status"`
+	Voltage float64 `json:"Voltage"`
+	Current float64 `json:"Current"`
+	Power   float64 `json:"Power"`
+}
+
+// GetPOE walks the PoE table of the device. Devices without PoE-out, which have an empty table, report no ports.
+// The SNMP connection of the device has to be established already.
+func (device *Device) GetPOE() error {
+	ports := map[int]*POEPort{}
+	columns := []struct {
+		oid string
+		set func(port *POEPort, variable gosnmp.SnmpPDU)
+	}{
+		{oidPOEName, func(port *POEPort, variable gosnmp.SnmpPDU) {
+			port.Name, _ = AsString(variable)
+		}},
+		{oidPOEStatus, func(port *POEPort, variable gosnmp.SnmpPDU) {
+			status, err := AsInt(variable)
+			if err == nil {
+				port.Status = poeStatus(status)
+			}
+		}},
+		{oidPOEVoltage, func(port *POEPort, variable gosnmp.SnmpPDU) {
+			// the voltage and the power are reported in tenths
+			voltage, _ := AsFloat(variable)
+			port.Voltage = voltage / 10
+		}},
+		{oidPOECurrent, func(port *POEPort, variable gosnmp.SnmpPDU) {
+			port.Current, _ = AsFloat(variable)
+		}},
+		{oidPOEPower, func(port *POEPort, variable gosnmp.SnmpPDU) {
+			power, _ := AsFloat(variable)
+			port.Power = power / 10
+		}},
+	}
+
+	for _, column := range columns {
+		err := device.snmp.BulkWalk(column.oid, func(variable gosnmp.SnmpPDU) error {
+			index, err := strconv.Atoi(strings.TrimPrefix(variable.Name, column.oid+"."))
+			if err != nil {
+				return nil
+			}
+			if ports[index] == nil {
+				ports[index] = &POEPort{Index: index}
+			}
+			column.set(ports[index], variable)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s unable to read PoE table: %v", device.Host, err)
+		}
+	}
+
+	device.POE = make([]POEPort, 0, len(ports))
+	for _, port := range ports {
+		device.POE = append(device.POE, *port)
+	}
+	sort.Slice(device.POE, func(i, j int) bool {
+		return device.POE[i].Index < device.POE[j].Index
+	})
+
+	return nil
+}
+
+// poeStatus returns the name of a PoE state of the MikroTik MIB.
+func poeStatus(value int64) string {
+	switch value {
+	case 1:
+		return POEDisabled
+	case 2:
+		return POEWaitingForLoad
+	case 3:
+		return POEPoweredOn
+	case 4:
+		return POEOverload
+	}
+
+	return "unknown"
+}
+
+// poeChanges returns the events of PoE ports which stopped or started powering their device between two polls.
+func poeChanges(previous, current Device) []Event {
+	before := map[int]POEPort{}
+	for _, port := range previous.POE {
+		before[port.Index] = port
+	}
+
+	var events []Event
+	for _, port := range current.POE {
+		old, found := before[port.Index]
+		if !found || old.Status == port.Status {
+			continue
+		}
+		switch {
+		case old.Status == POEPoweredOn:
+			severity := SeverityWarning
+			if port.Status == POEOverload {
+				severity = SeverityCritical
+			}
+			events = append(events, current.NewEvent(EventPOE, severity, port.Name,
+				fmt.Sprintf("PoE port stopped powering, status %s after %.1f W", port.Status, old.Power)))
+		case port.Status == POEPoweredOn:
+			event := current.NewEvent(EventPOE, SeverityWarning, port.Name, fmt.Sprintf("PoE port powers again, %.1f W", port.Power))
+			event.Resolved = true
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
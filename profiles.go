@@ -0,0 +1,53 @@
+package MikrotikMonitor
+
+import (
+	"regexp"
+	"slices"
+)
+
+// ProfileSystem is the profile of the basic request of GetDevice, which always runs.
+// All other profiles are named like the Collectors, e.g. interfaces, wireless, poe or optics.
+const ProfileSystem = "system"
+
+// ModelProfile skips collectors on devices whose model matches Pattern, because the hardware doesn't have them,
+// e.g. SFP cages on a hAP lite or wireless on a CCR.
+type ModelProfile struct {
+	Pattern *regexp.Regexp
+	Skip    []string
+}
+
+// ModelProfiles select the collectors of devices without configured profiles by their model, the first match wins.
+// All MikroTik agents report the same sysObjectID, so the model of the basic request is used instead.
+// Models without a match run all collectors.
+var ModelProfiles = []ModelProfile{
+	// Cloud Hosted Router and x86 installations have no RouterBOARD hardware
+	{regexp.MustCompile(`^(CHR|x86)`), []string{"wireless", "capsman", "poe", "optics"}},
+	{regexp.MustCompile(`^CCR`), []string{"wireless", "capsman", "poe"}},
+	// hAP lite and hAP mini have neither SFP cages nor PoE-out
+	{regexp.MustCompile(`^(RB941|RB931|hAP lite|hAP mini)`), []string{"poe", "optics"}},
+	{regexp.MustCompile(`^(CRS3\d\d|CSS)`), []string{"wireless", "capsman"}},
+}
+
+// profileEnabled reports whether a collector runs on the device. Devices with configured profiles only run those,
+// other devices run all collectors which aren't skipped by the ModelProfiles of their model.
+func (device *Device) profileEnabled(collector string) bool {
+	if len(device.Profiles) > 0 {
+		return slices.Contains(device.Profiles, collector)
+	}
+	for _, profile := range ModelProfiles {
+		if profile.Pattern.MatchString(device.Model) {
+			return !slices.Contains(profile.Skip, collector)
+		}
+	}
+
+	return true
+}
+
+// knownProfile reports whether a profile name is the system profile or the name of a collector.
+func knownProfile(name string) bool {
+	if name == ProfileSystem {
+		return true
+	}
+
+	return slices.ContainsFunc(Collectors, func(collector Collector) bool { return collector.Name == name })
+}
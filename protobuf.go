@@ -0,0 +1,215 @@
+package MikrotikMonitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Wire types of the protobuf encoding.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// protoWriter encodes a message in the protobuf binary format. Fields with the default value of their type are
+// omitted like proto3 does.
+type protoWriter struct {
+	bytes.Buffer
+}
+
+func (p *protoWriter) varint(value uint64) {
+	for value >= 0x80 {
+		p.WriteByte(byte(value) | 0x80)
+		value >>= 7
+	}
+	p.WriteByte(byte(value))
+}
+
+func (p *protoWriter) tag(field int, wire int) {
+	p.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (p *protoWriter) uint64(field int, value uint64) {
+	if value != 0 {
+		p.tag(field, protoVarint)
+		p.varint(value)
+	}
+}
+
+func (p *protoWriter) int64(field int, value int64) {
+	p.uint64(field, uint64(value))
+}
+
+func (p *protoWriter) bool(field int, value bool) {
+	if value {
+		p.uint64(field, 1)
+	}
+}
+
+func (p *protoWriter) double(field int, value float64) {
+	if value != 0 {
+		p.tag(field, protoFixed64)
+		p.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(value)))
+	}
+}
+
+func (p *protoWriter) bytes(field int, value []byte) {
+	p.tag(field, protoBytes)
+	p.varint(uint64(len(value)))
+	p.Write(value)
+}
+
+func (p *protoWriter) string(field int, value string) {
+	if value != "" {
+		p.bytes(field, []byte(value))
+	}
+}
+
+// strings writes a repeated string field.
+func (p *protoWriter) strings(field int, values []string) {
+	for _, value := range values {
+		p.bytes(field, []byte(value))
+	}
+}
+
+// message writes a nested message, encoded by encode, even if it is empty.
+func (p *protoWriter) message(field int, encode func(*protoWriter)) {
+	var nested protoWriter
+	encode(&nested)
+	p.bytes(field, nested.Bytes())
+}
+
+// time writes a google.protobuf.Timestamp, nothing for the zero time.
+func (p *protoWriter) time(field int, value time.Time) {
+	if value.IsZero() {
+		return
+	}
+	p.message(field, func(p *protoWriter) {
+		p.int64(1, value.Unix())
+		p.int64(2, int64(value.Nanosecond()))
+	})
+}
+
+// duration writes a google.protobuf.Duration.
+func (p *protoWriter) duration(field int, value time.Duration) {
+	if value == 0 {
+		return
+	}
+	p.message(field, func(p *protoWriter) {
+		p.int64(1, int64(value/time.Second))
+		p.int64(2, int64(value%time.Second))
+	})
+}
+
+// stringMap writes a map<string, string> field, ordered by key so equal maps are encoded equally.
+func (p *protoWriter) stringMap(field int, values map[string]string) {
+	for _, key := range sortedKeys(values) {
+		p.message(field, func(p *protoWriter) {
+			p.string(1, key)
+			p.string(2, values[key])
+		})
+	}
+}
+
+// doubleMap writes a map<string, double> field, ordered by key.
+func (p *protoWriter) doubleMap(field int, values map[string]float64) {
+	for _, key := range sortedKeys(values) {
+		p.message(field, func(p *protoWriter) {
+			p.string(1, key)
+			p.double(2, values[key])
+		})
+	}
+}
+
+// protoField is a field of a decoded message. Value is the number of varint and fixed fields, Data the content of
+// length-delimited fields like strings and nested messages.
+type protoField struct {
+	Number int
+	Value  uint64
+	Data   []byte
+}
+
+// protoFields decodes the fields of a message in the protobuf binary format in their order.
+func protoFields(message []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid protobuf field")
+		}
+		message = message[n:]
+		field := protoField{Number: int(key >> 3)}
+		switch key & 7 {
+		case protoVarint:
+			field.Value, n = binary.Uvarint(message)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid protobuf varint of field %d", field.Number)
+			}
+		case protoFixed64:
+			if n = 8; len(message) < n {
+				return nil, fmt.Errorf("truncated protobuf field %d", field.Number)
+			}
+			field.Value = binary.LittleEndian.Uint64(message)
+		case protoFixed32:
+			if n = 4; len(message) < n {
+				return nil, fmt.Errorf("truncated protobuf field %d", field.Number)
+			}
+			field.Value = uint64(binary.LittleEndian.Uint32(message))
+		case protoBytes:
+			length, m := binary.Uvarint(message)
+			if m <= 0 || uint64(len(message)-m) < length {
+				return nil, fmt.Errorf("truncated protobuf field %d", field.Number)
+			}
+			field.Data, n = message[m:m+int(length)], m+int(length)
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d of field %d", key&7, field.Number)
+		}
+		message = message[n:]
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// protoTime decodes a google.protobuf.Timestamp.
+func protoTime(message []byte) (time.Time, error) {
+	fields, err := protoFields(message)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var seconds, nanos int64
+	for _, field := range fields {
+		switch field.Number {
+		case 1:
+			seconds = int64(field.Value)
+		case 2:
+			nanos = int64(int32(field.Value))
+		}
+	}
+
+	return time.Unix(seconds, nanos), nil
+}
+
+// protoDuration decodes a google.protobuf.Duration.
+func protoDuration(message []byte) (time.Duration, error) {
+	fields, err := protoFields(message)
+	if err != nil {
+		return 0, err
+	}
+	var duration time.Duration
+	for _, field := range fields {
+		switch field.Number {
+		case 1:
+			duration += time.Duration(int64(field.Value)) * time.Second
+		case 2:
+			duration += time.Duration(int32(field.Value))
+		}
+	}
+
+	return duration, nil
+}
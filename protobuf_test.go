@@ -0,0 +1,116 @@
+package MikrotikMonitor
+
+import (
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The vectors are encoded with google.golang.org/protobuf/encoding/protowire.
+
+func TestProtoWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		encode func(p *protoWriter)
+		want   string
+	}{
+		{"uint64", func(p *protoWriter) { p.uint64(1, 1) }, "0801"},
+		{"uint64 of two bytes", func(p *protoWriter) { p.uint64(3, 300) }, "18ac02"},
+		{"uint64 max with tag of two bytes", func(p *protoWriter) { p.uint64(16, math.MaxUint64) }, "8001ffffffffffffffffff01"},
+		{"uint64 zero", func(p *protoWriter) { p.uint64(1, 0) }, ""},
+		{"negative int64", func(p *protoWriter) { p.int64(2, -1) }, "10ffffffffffffffffff01"},
+		{"bool", func(p *protoWriter) { p.bool(7, true) }, "3801"},
+		{"bool false", func(p *protoWriter) { p.bool(7, false) }, ""},
+		{"double", func(p *protoWriter) { p.double(4, 1.5) }, "21000000000000f83f"},
+		{"negative double", func(p *protoWriter) { p.double(2, -2.25) }, "1100000000000002c0"},
+		{"double zero", func(p *protoWriter) { p.double(2, 0) }, ""},
+		{"string", func(p *protoWriter) { p.string(1, "héllo") }, "0a0668c3a96c6c6f"},
+		{"empty string", func(p *protoWriter) { p.string(1, "") }, ""},
+		{"repeated string with empty value", func(p *protoWriter) { p.strings(5, []string{"core", ""}) }, "2a04636f72652a00"},
+		{"bytes with length of two bytes", func(p *protoWriter) { p.bytes(9, make([]byte, 200)) }, "4ac801" + strings.Repeat("00", 200)},
+		{"empty message", func(p *protoWriter) { p.message(12, func(p *protoWriter) {}) }, "6200"},
+		{"time", func(p *protoWriter) { p.time(8, time.Unix(1700000000, 123456789)) }, "420b0880e2cfaa0610959aef3a"},
+		{"time before epoch", func(p *protoWriter) { p.time(8, time.Unix(-1, 500000000)) }, "421108ffffffffffffffffff011080cab5ee01"},
+		{"zero time", func(p *protoWriter) { p.time(8, time.Time{}) }, ""},
+		{"duration", func(p *protoWriter) { p.duration(13, 90500*time.Millisecond) }, "6a08085a1080cab5ee01"},
+		{"negative duration", func(p *protoWriter) { p.duration(13, -1500*time.Millisecond) },
+			"6a1608ffffffffffffffffff011080b6ca91feffffffff01"},
+		{"string map", func(p *protoWriter) { p.stringMap(6, map[string]string{"b": "", "a": "x"}) }, "32060a016112017832030a0162"},
+		{"double map", func(p *protoWriter) { p.doubleMap(17, map[string]float64{"temp": 41.5, "load": 0}) },
+			"8a01060a046c6f61648a010f0a0474656d70110000000000c04440"},
+		{"event", func(p *protoWriter) {
+			writeEvent(p, Event{ID: "e1", Type: "down", Severity: "critical", Host: "r1", Tags: []string{"core", "edge"},
+				Time: time.Unix(1700000000, 5), Resolved: true, Site: "acme"})
+		}, "0a0265311204646f776e1a08637269746963616c220272313a04636f72653a04656467655a080880e2cfaa06100560016a0461636d65"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var p protoWriter
+			test.encode(&p)
+			if got := hex.EncodeToString(p.Bytes()); got != test.want {
+				t.Errorf("encoded\n%s, want\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestProtoFields(t *testing.T) {
+	// varint 150, fixed32, double 1.5, string abc and an empty message of field 2047
+	message, _ := hex.DecodeString("08960115efbeadde19000000000000f83f2203616263fa7f00")
+	fields, err := protoFields(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []protoField{{1, 150, nil}, {2, 0xdeadbeef, nil}, {3, math.Float64bits(1.5), nil}, {4, 0, []byte("abc")}, {2047, 0, []byte{}}}
+	if len(fields) != len(want) {
+		t.Fatalf("fields %v, want %v", fields, want)
+	}
+	for i := range want {
+		if fields[i].Number != want[i].Number || fields[i].Value != want[i].Value || string(fields[i].Data) != string(want[i].Data) {
+			t.Errorf("field %d %v, want %v", i, fields[i], want[i])
+		}
+	}
+
+	for _, invalid := range []string{
+		// truncated tag, varint, fixed64 and fixed32
+		"80", "0896", "19000000", "1500",
+		// length beyond the message, length overflowing int and a truncated length
+		"220361", "22ffffffffffffffff7f", "2280",
+		// start group, wire type 3
+		"0b",
+	} {
+		message, _ := hex.DecodeString(invalid)
+		if fields, err := protoFields(message); err == nil {
+			t.Errorf("%s decoded to %v, want an error", invalid, fields)
+		}
+	}
+}
+
+func TestProtoTimeAndDuration(t *testing.T) {
+	for _, value := range []time.Time{time.Unix(1700000000, 123456789), time.Unix(-1, 500000000), time.Unix(0, 1)} {
+		var p protoWriter
+		p.time(1, value)
+		fields, err := protoFields(p.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := protoTime(fields[0].Data)
+		if err != nil || !decoded.Equal(value) {
+			t.Errorf("time %v decoded to %v, %v", value, decoded, err)
+		}
+	}
+	for _, value := range []time.Duration{90500 * time.Millisecond, -1500 * time.Millisecond, time.Nanosecond, -time.Nanosecond} {
+		var p protoWriter
+		p.duration(1, value)
+		fields, err := protoFields(p.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := protoDuration(fields[0].Data)
+		if err != nil || decoded != value {
+			t.Errorf("duration %v decoded to %v, %v", value, decoded, err)
+		}
+	}
+}
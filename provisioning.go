@@ -0,0 +1,66 @@
+package MikrotikMonitor
+
+import (
+	"strings"
+)
+
+// EventProvisioning is the type of events raised when a device looks factory-default or partially provisioned.
+const EventProvisioning = "Provisioning"
+
+// DefaultIdentity is the system identity of a RouterOS device in its factory-default state.
+const DefaultIdentity = "MikroTik"
+
+type Provisioning struct {
+	DefaultIdentity bool `json:"DefaultIdentity"`
+	DefaultAdmin    bool `json:"DefaultAdmin"`
+	NoFirewall      bool `json:"NoFirewall"`
+}
+
+// Incomplete reports whether any sign of a factory-default or partially provisioned device was found.
+func (provisioning Provisioning) Incomplete() bool {
+	return provisioning.DefaultIdentity || provisioning.DefaultAdmin || provisioning.NoFirewall
+}
+
+// String lists the found problems, separated by commas.
+func (provisioning Provisioning) String() string {
+	var problems []string
+	if provisioning.DefaultIdentity {
+		problems = append(problems, "default identity")
+	}
+	if provisioning.DefaultAdmin {
+		problems = append(problems, "default admin user")
+	}
+	if provisioning.NoFirewall {
+		problems = append(problems, "no firewall filter rules")
+	}
+
+	return strings.Join(problems, ", ")
+}
+
+// GetProvisioning checks the device for signs of a factory-default or partially provisioned configuration.
+// The identity is taken from the name read via SNMP. If API credentials are configured,
+// the enabled users and the firewall filter rules are read via the REST or binary API as well.
+func (device *Device) GetProvisioning() error {
+	device.Provisioning = Provisioning{DefaultIdentity: device.Name == DefaultIdentity}
+	if device.API.User == "" {
+		return nil
+	}
+
+	users, err := device.Print("/user")
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if user["name"] == "admin" && user["disabled"] != "true" {
+			device.Provisioning.DefaultAdmin = true
+		}
+	}
+
+	rules, err := device.Print("/ip/firewall/filter")
+	if err != nil {
+		return err
+	}
+	device.Provisioning.NoFirewall = len(rules) == 0
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package MikrotikMonitor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Encodings of published results.
+const (
+	// EncodingJSON encodes a result as the device of ResultJson in the same envelope, with device instead of devices.
+	EncodingJSON = "json"
+	// EncodingAvro encodes a result as an Avro record of the Columns in the binary encoding, without container or
+	// schema registry framing. The schema is returned by AvroSchema.
+	EncodingAvro = "avro"
+)
+
+// Publisher sends the poll results of devices to a message bus, e.g. NATS or Kafka.
+type Publisher interface {
+	Publish(result DeviceResult) error
+	Close() error
+}
+
+// Publish sends the result of every device to the publisher as soon as its poll has finished, see Results.
+// Errors of the publisher are logged. Publishing ends when the monitor is stopped.
+func (monitor *Monitor) Publish(publisher Publisher) {
+	results := monitor.Results()
+	go func() {
+		for result := range results {
+			if err := publisher.Publish(result); err != nil {
+				log.Printf("%s unable to publish result, %v", result.Device.Host, err)
+			}
+		}
+	}()
+}
+
+// publishKey returns the key results of the device are published with, its name or, as long as the device
+// has never been reached, its host.
+func (device *Device) publishKey() string {
+	if device.Name != "" {
+		return device.Name
+	}
+
+	return device.Host
+}
+
+// encodeResult encodes a result with the encoding, JSON if it is empty.
+func encodeResult(result DeviceResult, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingJSON, "":
+		var envelope struct {
+			Schema      string    `json:"schema"`
+			GeneratedAt time.Time `json:"generated_at"`
+			Duration    int64     `json:"duration"`
+			Device      Device    `json:"device"`
+		}
+		envelope.Schema = DevicesSchema
+		envelope.GeneratedAt = time.Now().UTC()
+		envelope.Duration = int64(result.Duration)
+		envelope.Device = result.Device
+		return json.Marshal(envelope)
+	case EncodingAvro:
+		return avroRecord(result.Device), nil
+	}
+
+	return nil, fmt.Errorf("unknown encoding %q", encoding)
+}
+
+var invalidAvroChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// AvroSchema returns the Avro schema of results published with EncodingAvro as JSON.
+// Every column is a field, named like the column with underscores instead of dots, e.g. Version_RouterOS.
+// Times are milliseconds since the epoch, durations nanoseconds like in the JSON output. Lists of strings are arrays,
+// maps of strings or numbers are maps and all other lists and maps are represented by their number of entries.
+func AvroSchema() string {
+	var fields []map[string]any
+	for _, column := range Columns() {
+		fields = append(fields, map[string]any{
+			"name": invalidAvroChars.ReplaceAllString(column.Name, "_"),
+			"type": avroType(reflect.TypeOf(Device{}).FieldByIndex(column.index).Type),
+		})
+	}
+	schema, _ := json.Marshal(map[string]any{
+		"type":      "record",
+		"name":      "Device",
+		"namespace": "mikrotikmonitor." + DevicesSchema,
+		"fields":    fields,
+	})
+
+	return string(schema)
+}
+
+// avroType returns the Avro schema of a column type.
+func avroType(fieldType reflect.Type) any {
+	if fieldType == reflect.TypeOf(time.Time{}) {
+		return map[string]string{"type": "long", "logicalType": "timestamp-millis"}
+	}
+
+	switch fieldType.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Float32, reflect.Float64:
+		return "double"
+	case reflect.String:
+		return "string"
+	case reflect.Slice:
+		if fieldType.Elem().Kind() == reflect.String {
+			return map[string]string{"type": "array", "items": "string"}
+		}
+	case reflect.Map:
+		if fieldType.Key().Kind() == reflect.String {
+			switch fieldType.Elem().Kind() {
+			case reflect.String:
+				return map[string]string{"type": "map", "values": "string"}
+			case reflect.Float64:
+				return map[string]string{"type": "map", "values": "double"}
+			}
+		}
+	}
+
+	return "long"
+}
+
+// avroRecord returns the columns of a device in the Avro binary encoding of AvroSchema.
+func avroRecord(device Device) []byte {
+	var b []byte
+	record := reflect.ValueOf(device)
+	for _, column := range Columns() {
+		b = avroValue(b, record.FieldByIndex(column.index))
+	}
+
+	return b
+}
+
+// avroValue appends a value in the Avro binary encoding of its avroType.
+func avroValue(b []byte, value reflect.Value) []byte {
+	if t, ok := value.Interface().(time.Time); ok {
+		return binary.AppendVarint(b, t.UnixMilli())
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			return append(b, 1)
+		}
+		return append(b, 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(b, value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return binary.AppendVarint(b, int64(min(value.Uint(), math.MaxInt64)))
+	case reflect.Float32, reflect.Float64:
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(value.Float()))
+	case reflect.String:
+		return avroString(b, value.String())
+	}
+
+	// lists and maps are written as a single block followed by the empty block which ends them
+	switch avroType(value.Type()).(type) {
+	case map[string]string:
+		if value.Len() == 0 {
+			return append(b, 0)
+		}
+		b = binary.AppendVarint(b, int64(value.Len()))
+		if value.Kind() == reflect.Slice {
+			for i := 0; i < value.Len(); i++ {
+				b = avroString(b, value.Index(i).String())
+			}
+			return append(b, 0)
+		}
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			b = avroString(b, key.String())
+			b = avroValue(b, value.MapIndex(key))
+		}
+		return append(b, 0)
+	}
+
+	return binary.AppendVarint(b, int64(value.Len()))
+}
+
+// avroString appends a string in the Avro binary encoding.
+func avroString(b []byte, value string) []byte {
+	b = binary.AppendVarint(b, int64(len(value)))
+	return append(b, value...)
+}
+
+var invalidSubjectChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// subjectToken returns the key of a device as a token of a NATS subject, other characters are replaced by underscores.
+func subjectToken(key string) string {
+	return invalidSubjectChars.ReplaceAllString(strings.TrimSpace(key), "_")
+}
@@ -0,0 +1,246 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Queue types.
+const (
+	QueueSimple = "simple"
+	QueueTree   = "tree"
+)
+
+// OIDs of the simple queue and queue tree tables of the MikroTik MIB.
+const (
+	oidQueueSimpleName       = ".1.3.6.1.4.1.14988.1.1.2.1.1.2"
+	oidQueueSimpleSrcAddr    = ".1.3.6.1.4.1.14988.1.1.2.1.1.3"
+	oidQueueSimpleBytesIn    = ".1.3.6.1.4.1.14988.1.1.2.1.1.8"
+	oidQueueSimpleBytesOut   = ".1.3.6.1.4.1.14988.1.1.2.1.1.9"
+	oidQueueSimplePacketsIn  = ".1.3.6.1.4.1.14988.1.1.2.1.1.10"
+	oidQueueSimplePacketsOut = ".1.3.6.1.4.1.14988.1.1.2.1.1.11"
+	oidQueueSimpleDroppedIn  = ".1.3.6.1.4.1.14988.1.1.2.1.1.14"
+	oidQueueSimpleDroppedOut = ".1.3.6.1.4.1.14988.1.1.2.1.1.15"
+	oidQueueTreeName         = ".1.3.6.1.4.1.14988.1.1.2.2.1.2"
+	oidQueueTreePackets      = ".1.3.6.1.4.1.14988.1.1.2.2.1.6"
+	oidQueueTreeHCBytes      = ".1.3.6.1.4.1.14988.1.1.2.2.1.7"
+	oidQueueTreeDropped      = ".1.3.6.1.4.1.14988.1.1.2.2.1.9"
+)
+
+// QueueCounters are the counters and the rate limit of one direction of a queue.
+// MaxLimit is in bits per second, zero means unlimited or unknown.
+type QueueCounters struct {
+	Bytes    uint64 `json:"Bytes"`
+	Packets  uint64 `json:"Packets"`
+	Dropped  uint64 `json:"Dropped"`
+	MaxLimit uint64 `json:"MaxLimit"`
+}
+
+// Queue is a simple queue or a queue tree entry of the device.
+// In of a simple queue is the upload of its target, Out the download. Queue tree entries shape one direction only,
+// which is reported in Out.
+type Queue struct {
+	Name   string        `json:"Name"`
+	Type   string        `json:"Type"`
+	Target string        `json:"Target"`
+	Parent string        `json:"Parent"`
+	In     QueueCounters `json:"In"`
+	Out    QueueCounters `json:"Out"`
+}
+
+// GetQueues reads the simple queues and the queue tree of the device, e.g. the bandwidth caps of the subscribers of a WISP.
+// Devices read via SNMP get the counters from the MikroTik MIB, which lacks the rate limits. Those are read
+// via the API if the device has an api block, devices with another backend get all values from the API.
+func (device *Device) GetQueues() error {
+	if !usesSNMP(device) {
+		return device.getQueuesAPI(true)
+	}
+
+	simple := map[string]*Queue{}
+	simpleColumns := []struct {
+		oid string
+		set func(queue *Queue, variable gosnmp.SnmpPDU)
+	}{
+		{oidQueueSimpleName, func(queue *Queue, variable gosnmp.SnmpPDU) {
+			queue.Name, _ = AsString(variable)
+		}},
+		{oidQueueSimpleSrcAddr, func(queue *Queue, variable gosnmp.SnmpPDU) {
+			if value, err := AsIPAddress(variable); err == nil && value != "0.0.0.0" {
+				queue.Target = value
+			}
+		}},
+		{oidQueueSimpleBytesIn, func(queue *Queue, variable gosnmp.SnmpPDU) {
+			queue.In.Bytes, _ = AsCounter64(variable)
+		}},
+		{oidQueueSimpleBytesOut, func(queue *Queue, variable gosnmp.SnmpPDU) {
+			queue.Out.Bytes, _ = AsCounter64(variable)
+		}},
+		{oidQueueSimplePacketsIn, func(queue *Queue, variable gosnmp.SnmpPDU) {
+			queue.In.Packets, _ = AsCounter64(variable)
+		}},
+		{oidQueueSimplePacketsOut, func(queue *Queue, variable gosnmp.SnmpPDU) {
+			queue.Out.Packets, _ = AsCounter64(variable)
+		}},
+		{oidQueueSimpleDroppedIn, func(queue *Queue, variable gosnmp.SnmpPDU) {
+			queue.In.Dropped, _ = AsCounter64(variable)
+		}},
+		{oidQueueSimpleDroppedOut, func(queue *Queue, variable gosnmp.SnmpPDU) {
+			queue.Out.Dropped, _ = AsCounter64(variable)
+		}},
+	}
+	for _, column := range simpleColumns {
+		if err := device.walkQueues(column.oid, simple, QueueSimple, column.set); err != nil {
+			return err
+		}
+	}
+
+	tree := map[string]*Queue{}
+	treeColumns := []struct {
+		oid string
+		set func(queue *Queue, variable gosnmp.SnmpPDU)
+	}{
+		{oidQueueTreeName, func(queue *Queue, variable gosnmp.SnmpPDU) {
+			queue.Name, _ = AsString(variable)
+		}},
+		{oidQueueTreeHCBytes, func(queue *Queue, variable gosnmp.SnmpPDU) {
+			queue.Out.Bytes, _ = AsCounter64(variable)
+		}},
+		{oidQueueTreePackets, func(queue *Queue, variable gosnmp.SnmpPDU) {
+			queue.Out.Packets, _ = AsCounter64(variable)
+		}},
+		{oidQueueTreeDropped, func(queue *Queue, variable gosnmp.SnmpPDU) {
+			queue.Out.Dropped, _ = AsCounter64(variable)
+		}},
+	}
+	for _, column := range treeColumns {
+		if err := device.walkQueues(column.oid, tree, QueueTree, column.set); err != nil {
+			return err
+		}
+	}
+
+	device.Queues = make([]Queue, 0, len(simple)+len(tree))
+	for _, queues := range []map[string]*Queue{simple, tree} {
+		for _, queue := range queues {
+			device.Queues = append(device.Queues, *queue)
+		}
+	}
+	sortQueues(device.Queues)
+
+	if device.API.User != "" {
+		return device.getQueuesAPI(false)
+	}
+
+	return nil
+}
+
+// walkQueues walks a column of a queue table and sets the values in the queue of the same index.
+func (device *Device) walkQueues(oid string, queues map[string]*Queue, queueType string, set func(queue *Queue, variable gosnmp.SnmpPDU)) error {
+	err := device.snmp.BulkWalk(oid, func(variable gosnmp.SnmpPDU) error {
+		index := strings.TrimPrefix(variable.Name, oid+".")
+		if queues[index] == nil {
+			queues[index] = &Queue{Type: queueType}
+		}
+		set(queues[index], variable)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s unable to read %s queues: %v", device.Host, queueType, err)
+	}
+
+	return nil
+}
+
+// getQueuesAPI reads the queues via the API. With all, the queues are replaced including their counters,
+// otherwise only the targets, parents and rate limits of the queues read via SNMP are set.
+func (device *Device) getQueuesAPI(all bool) error {
+	var queues []Queue
+	for _, queueType := range []string{QueueSimple, QueueTree} {
+		items, err := device.Print("/queue/" + queueType)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			queue := Queue{Name: item["name"], Type: queueType, Target: item["target"], Parent: item["parent"]}
+			if queueType == QueueSimple {
+				queue.In.Bytes, queue.Out.Bytes = parseQueuePair(item["bytes"])
+				queue.In.Packets, queue.Out.Packets = parseQueuePair(item["packets"])
+				queue.In.Dropped, queue.Out.Dropped = parseQueuePair(item["dropped"])
+				upload, download, _ := strings.Cut(item["max-limit"], "/")
+				queue.In.MaxLimit, queue.Out.MaxLimit = ParseRate(upload), ParseRate(download)
+			} else {
+				queue.Out.Bytes, _ = strconv.ParseUint(item["bytes"], 10, 64)
+				queue.Out.Packets, _ = strconv.ParseUint(item["packets"], 10, 64)
+				queue.Out.Dropped, _ = strconv.ParseUint(item["dropped"], 10, 64)
+				queue.Out.MaxLimit = ParseRate(item["max-limit"])
+			}
+			if queue.Parent == "none" {
+				queue.Parent = ""
+			}
+			queues = append(queues, queue)
+		}
+	}
+
+	if all {
+		sortQueues(queues)
+		device.Queues = queues
+		return nil
+	}
+
+	for i := range device.Queues {
+		for _, queue := range queues {
+			if queue.Name == device.Queues[i].Name && queue.Type == device.Queues[i].Type {
+				device.Queues[i].Target = queue.Target
+				device.Queues[i].Parent = queue.Parent
+				device.Queues[i].In.MaxLimit = queue.In.MaxLimit
+				device.Queues[i].Out.MaxLimit = queue.Out.MaxLimit
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseQueuePair parses a pair of counters of a simple queue, e.g. "1234/5678".
+func parseQueuePair(value string) (uint64, uint64) {
+	first, second, _ := strings.Cut(value, "/")
+	in, _ := strconv.ParseUint(first, 10, 64)
+	out, _ := strconv.ParseUint(second, 10, 64)
+
+	return in, out
+}
+
+// ParseRate parses a rate as printed by RouterOS, e.g. "10M", "512k" or "1000000", in bits per second.
+// Unlimited rates and invalid values return zero.
+func ParseRate(value string) uint64 {
+	multiplier := uint64(1)
+	switch {
+	case strings.HasSuffix(value, "k"):
+		multiplier = 1000
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1000 * 1000
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1000 * 1000 * 1000
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 {
+		return 0
+	}
+
+	return uint64(rate * float64(multiplier))
+}
+
+// sortQueues sorts simple queues before the queue tree, each by name.
+func sortQueues(queues []Queue) {
+	sort.Slice(queues, func(i, j int) bool {
+		if queues[i].Type != queues[j].Type {
+			return queues[i].Type == QueueSimple
+		}
+		return queues[i].Name < queues[j].Name
+	})
+}
@@ -0,0 +1,100 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Rates are the traffic of an interface per second, computed from the counters of two polls.
+type Rates struct {
+	InBits     float64 `json:"InBits"`
+	OutBits    float64 `json:"OutBits"`
+	InPackets  float64 `json:"InPackets"`
+	OutPackets float64 `json:"OutPackets"`
+}
+
+// RateCalculator keeps the interface counters of the previous poll of every device and computes the rates of the
+// interfaces of the next poll. Counters which wrapped between the polls are corrected, the octet counters are
+// 64 bit (ifHCInOctets), the packet counters 32 bit (ifInUcastPkts). After a reboot of the device, which resets
+// all counters, the rates are left at zero for one poll. It is safe for concurrent use.
+type RateCalculator struct {
+	mu      sync.Mutex
+	samples map[string]rateSample
+	uptimes map[string]time.Duration
+}
+
+type rateSample struct {
+	iface Interface
+	time  time.Time
+}
+
+// NewRateCalculator returns an empty RateCalculator.
+func NewRateCalculator() *RateCalculator {
+	return &RateCalculator{samples: map[string]rateSample{}, uptimes: map[string]time.Duration{}}
+}
+
+// counterDelta returns the increase of a counter of the given width in bits, taking a wrap into account.
+func counterDelta(previous, current uint64, bits int) uint64 {
+	if current >= previous {
+		return current - previous
+	}
+	if bits == 32 && previous <= math.MaxUint32 {
+		return current + (math.MaxUint32 - previous) + 1
+	}
+
+	return current + (math.MaxUint64 - previous) + 1
+}
+
+// Update sets the rates of the interfaces of a polled device from the counters of its previous poll at the given time.
+// Interfaces seen for the first time keep zero rates.
+func (calculator *RateCalculator) Update(device *Device, now time.Time) {
+	calculator.mu.Lock()
+	defer calculator.mu.Unlock()
+
+	if calculator.samples == nil {
+		calculator.samples = map[string]rateSample{}
+		calculator.uptimes = map[string]time.Duration{}
+	}
+
+	previousUptime, known := calculator.uptimes[device.Host]
+	rebooted := known && device.Uptime < previousUptime
+	calculator.uptimes[device.Host] = device.Uptime
+
+	for i := range device.Interfaces {
+		iface := &device.Interfaces[i]
+		key := fmt.Sprintf("%s/%d", device.Host, iface.Index)
+		previous, found := calculator.samples[key]
+		calculator.samples[key] = rateSample{iface: *iface, time: now}
+
+		iface.Rates = Rates{}
+		seconds := now.Sub(previous.time).Seconds()
+		if !found || rebooted || seconds <= 0 {
+			continue
+		}
+		iface.Rates = Rates{
+			InBits:     float64(counterDelta(previous.iface.InOctets, iface.InOctets, 64)) * 8 / seconds,
+			OutBits:    float64(counterDelta(previous.iface.OutOctets, iface.OutOctets, 64)) * 8 / seconds,
+			InPackets:  float64(counterDelta(previous.iface.InPackets, iface.InPackets, 32)) / seconds,
+			OutPackets: float64(counterDelta(previous.iface.OutPackets, iface.OutPackets, 32)) / seconds,
+		}
+	}
+}
+
+// seed sets the counters of the device, polled at the given time, as the previous poll, e.g. of a state restored
+// after a restart, so the next poll has rates.
+func (calculator *RateCalculator) seed(device Device, at time.Time) {
+	calculator.mu.Lock()
+	defer calculator.mu.Unlock()
+
+	if calculator.samples == nil {
+		calculator.samples = map[string]rateSample{}
+		calculator.uptimes = map[string]time.Duration{}
+	}
+
+	calculator.uptimes[device.Host] = device.Uptime
+	for _, iface := range device.Interfaces {
+		calculator.samples[fmt.Sprintf("%s/%d", device.Host, iface.Index)] = rateSample{iface: iface, time: at}
+	}
+}
@@ -0,0 +1,121 @@
+package MikrotikMonitor
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+type Fallback struct {
+	Ping    bool
+	TCPPort int
+}
+
+type Reachability struct {
+	SNMPOK  bool          `json:"SNMPOK"`
+	PingOK  bool          `json:"PingOK"`
+	TCPOK   bool          `json:"TCPOK"`
+	Latency time.Duration `json:"Latency"`
+}
+
+// Down reports whether the device answered neither SNMP nor one of the fallback probes.
+// A device which answers a fallback probe but not SNMP is reachable, but SNMP is probably misconfigured.
+func (reachability Reachability) Down() bool {
+	return !reachability.SNMPOK && !reachability.PingOK && !reachability.TCPOK
+}
+
+// Probe runs the configured fallback probes against the device and records their result in Reachability.
+// Ping sends an ICMP echo request, which needs a raw socket and therefore root or CAP_NET_RAW.
+// TCPPort opens a TCP connection to the port, e.g. 8291 for winbox or 22 for SSH.
+// Latency is the round trip time of the first successful probe.
+func (device *Device) Probe() error {
+	timeout := device.SNMP.Timeout
+	if timeout == 0 {
+		timeout = 3 * time.Second
+	}
+
+	var errs []error
+	if device.Fallback.Ping {
+		latency, err := Ping(device.address(), timeout)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s ping failed: %v", device.Host, err))
+		} else {
+			device.Reachability.PingOK = true
+			device.Reachability.Latency = latency
+		}
+	}
+
+	if device.Fallback.TCPPort > 0 {
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(device.address(), strconv.Itoa(device.Fallback.TCPPort)), timeout)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s TCP probe failed: %v", device.Host, err))
+		} else {
+			_ = conn.Close()
+			device.Reachability.TCPOK = true
+			if device.Reachability.Latency == 0 {
+				device.Reachability.Latency = time.Since(start)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Ping sends an ICMP echo request to the host and returns the round trip time of the reply.
+func Ping(host string, timeout time.Duration) (time.Duration, error) {
+	address, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return 0, err
+	}
+
+	network, request, reply := "ip4:icmp", byte(8), byte(0)
+	if address.IP.To4() == nil {
+		// the kernel computes the checksum of ICMPv6 on raw sockets
+		network, request, reply = "ip6:ipv6-icmp", byte(128), byte(129)
+	}
+
+	conn, err := net.ListenPacket(network, "")
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	id := os.Getpid() & 0xffff
+	sequence := int(time.Now().UnixNano() & 0xffff)
+	message := []byte{request, 0, 0, 0, byte(id >> 8), byte(id), byte(sequence >> 8), byte(sequence), 'm', 'k', 't', 'm'}
+	if request == 8 {
+		sum := 0
+		for i := 0; i < len(message); i += 2 {
+			sum += int(message[i])<<8 | int(message[i+1])
+		}
+		sum = (sum >> 16) + (sum & 0xffff)
+		sum += sum >> 16
+		message[2], message[3] = byte(^sum>>8), byte(^sum)
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	if _, err := conn.WriteTo(message, address); err != nil {
+		return 0, err
+	}
+
+	buffer := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return 0, err
+		}
+		if n < 8 || buffer[0] != reply || !from.(*net.IPAddr).IP.Equal(address.IP) {
+			continue
+		}
+		if int(buffer[4])<<8|int(buffer[5]) == id && int(buffer[6])<<8|int(buffer[7]) == sequence {
+			return time.Since(start), nil
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PagerDuty triggers and resolves alerts via the PagerDuty Events API v2 with the RoutingKey of a service or ruleset.
+// The events of a problem, identified by host, type and subject, are deduplicated into one alert, which the resolved
+// event resolves, e.g. when the device is up again or the condition of the rule doesn't hold anymore. The severities
+// info, warning and critical of events and rules are those of PagerDuty. URL defaults to the Events API of PagerDuty.
+type PagerDuty struct {
+	RoutingKey string       `yaml:"routing_key"`
+	URL        string       `yaml:"url"`
+	Client     *http.Client `yaml:"-"`
+}
+
+// Notify triggers or resolves the alert of the event.
+func (pagerDuty *PagerDuty) Notify(event Event) error {
+	address := pagerDuty.URL
+	if address == "" {
+		address = "https://events.pagerduty.com/v2/enqueue"
+	}
+	body := map[string]any{
+		"routing_key":  pagerDuty.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    event.Host + "/" + event.Type + "/" + event.Subject,
+	}
+	if event.Resolved {
+		body["event_action"] = "resolve"
+	} else {
+		body["payload"] = map[string]any{
+			"summary":   truncate(eventSummary(event), 1024),
+			"source":    event.Host,
+			"severity":  event.Severity,
+			"timestamp": event.Time.Format(time.RFC3339),
+			"class":     event.Type,
+			"group":     event.Group,
+			"custom_details": map[string]any{
+				"name":    event.Name,
+				"site":    event.Site,
+				"tags":    event.Tags,
+				"details": event.Details,
+			},
+		}
+	}
+
+	return jsonRequest(pagerDuty.Client, http.MethodPost, address, nil, body, nil)
+}
+
+// Opsgenie creates and closes alerts via the Opsgenie Alert API with the APIKey of an API integration. Like with
+// PagerDuty the events of a problem are one alert, identified by its alias, which the resolved event closes.
+// The severity of the event is mapped to the priority of the alert, critical to P1, warning to P3 and info to P5.
+// URL defaults to the API of the US instance, https://api.eu.opsgenie.com for the EU instance.
+type Opsgenie struct {
+	APIKey string       `yaml:"api_key"`
+	URL    string       `yaml:"url"`
+	Client *http.Client `yaml:"-"`
+}
+
+// opsgeniePriorities are the priorities of alerts by the severity of their event.
+var opsgeniePriorities = map[string]string{SeverityCritical: "P1", SeverityWarning: "P3", SeverityInfo: "P5"}
+
+// Notify creates or closes the alert of the event.
+func (opsgenie *Opsgenie) Notify(event Event) error {
+	address := opsgenie.URL
+	if address == "" {
+		address = "https://api.opsgenie.com"
+	}
+	address = strings.TrimSuffix(address, "/") + "/v2/alerts"
+	header := http.Header{"Authorization": {"GenieKey " + opsgenie.APIKey}}
+	alias := truncate(event.Host+"/"+event.Type+"/"+event.Subject, 512)
+
+	if event.Resolved {
+		return jsonRequest(opsgenie.Client, http.MethodPost, address+"/"+url.PathEscape(alias)+"/close?identifierType=alias",
+			header, map[string]string{"source": "MikrotikMonitor", "note": event.Message}, nil)
+	}
+
+	priority, found := opsgeniePriorities[event.Severity]
+	if !found {
+		priority = "P3"
+	}
+	tags := slices.Clone(event.Tags)
+	if event.Site != "" {
+		tags = append(tags, "site:"+event.Site)
+	}
+	body := map[string]any{
+		"message":     truncate(eventSummary(event), 130),
+		"alias":       alias,
+		"description": truncate(strings.TrimSpace(event.Message+"\n\n"+event.Details), 15000),
+		"priority":    priority,
+		"entity":      event.Host,
+		"source":      "MikrotikMonitor",
+		"tags":        tags,
+		"details": map[string]string{
+			"type":    event.Type,
+			"subject": event.Subject,
+			"name":    event.Name,
+			"site":    event.Site,
+			"group":   event.Group,
+		},
+	}
+
+	return jsonRequest(opsgenie.Client, http.MethodPost, address, header, body, nil)
+}
+
+// Telegram sends events as messages of the bot with the Token to the chat ChatID via the Telegram Bot API.
+// URL defaults to the Bot API of Telegram.
+type Telegram struct {
+	Token  string       `yaml:"token"`
+	ChatID string       `yaml:"chat_id"`
+	URL    string       `yaml:"url"`
+	Client *http.Client `yaml:"-"`
+}
+
+// Notify sends the event as message.
+func (telegram *Telegram) Notify(event Event) error {
+	address := telegram.URL
+	if address == "" {
+		address = "https://api.telegram.org"
+	}
+	text := eventSummary(event)
+	if event.Details != "" {
+		text += "\n\n" + event.Details
+	}
+	body := map[string]any{"chat_id": telegram.ChatID, "text": truncate(text, 4096), "disable_web_page_preview": true}
+
+	err := jsonRequest(telegram.Client, http.MethodPost, strings.TrimSuffix(address, "/")+"/bot"+telegram.Token+"/sendMessage",
+		nil, body, nil)
+	if err != nil && telegram.Token != "" {
+		// the token is part of the URL of the error
+		return fmt.Errorf("%s", strings.ReplaceAll(err.Error(), telegram.Token, "***"))
+	}
+
+	return err
+}
+
+// Gotify sends events as messages of the application with the Token to a self-hosted Gotify server at URL.
+// The severity of the event is mapped to the priority of the message, critical to 8, warning to 5 and info and resolved
+// events to 2.
+type Gotify struct {
+	URL    string       `yaml:"url"`
+	Token  string       `yaml:"token"`
+	Client *http.Client `yaml:"-"`
+}
+
+// gotifyPriorities are the priorities of messages by the severity of their event.
+var gotifyPriorities = map[string]int{SeverityCritical: 8, SeverityWarning: 5, SeverityInfo: 2}
+
+// Notify sends the event as message.
+func (gotify *Gotify) Notify(event Event) error {
+	priority := gotifyPriorities[event.Severity]
+	if event.Resolved {
+		priority = gotifyPriorities[SeverityInfo]
+	}
+	body := map[string]any{"title": eventTitle(event), "message": pushMessage(event), "priority": priority}
+
+	return jsonRequest(gotify.Client, http.MethodPost, strings.TrimSuffix(gotify.URL, "/")+"/message",
+		http.Header{"X-Gotify-Key": {gotify.Token}}, body, nil)
+}
+
+// Ntfy publishes events to the Topic of a ntfy server at URL, by default ntfy.sh. Protected topics need the access
+// Token or a User and Password. The severity of the event is mapped to the priority of the message, critical to urgent,
+// warning to high and info and resolved events to the default priority.
+type Ntfy struct {
+	URL      string       `yaml:"url"`
+	Topic    string       `yaml:"topic"`
+	Token    string       `yaml:"token"`
+	User     string       `yaml:"user"`
+	Password string       `yaml:"password"`
+	Client   *http.Client `yaml:"-"`
+}
+
+// ntfyPriorities are the priorities and tags, shown as emojis, of messages by the severity of their event.
+var ntfyPriorities = map[string]struct {
+	priority int
+	tag      string
+}{
+	SeverityCritical: {5, "rotating_light"},
+	SeverityWarning:  {4, "warning"},
+	SeverityInfo:     {3, "information_source"},
+}
+
+// Notify publishes the event as message.
+func (ntfy *Ntfy) Notify(event Event) error {
+	address := ntfy.URL
+	if address == "" {
+		address = "https://ntfy.sh"
+	}
+	priority := ntfyPriorities[event.Severity]
+	if event.Resolved {
+		priority.priority, priority.tag = ntfyPriorities[SeverityInfo].priority, "white_check_mark"
+	}
+	body := map[string]any{"topic": ntfy.Topic, "title": eventTitle(event), "message": pushMessage(event)}
+	if priority.priority != 0 {
+		body["priority"], body["tags"] = priority.priority, []string{priority.tag}
+	}
+
+	header := basicAuth(ntfy.User, ntfy.Password)
+	if ntfy.Token != "" {
+		header = http.Header{"Authorization": {"Bearer " + ntfy.Token}}
+	}
+
+	return jsonRequest(ntfy.Client, http.MethodPost, address, header, body, nil)
+}
+
+// pushMessage returns the message and the details of an event for the body of a push notification.
+func pushMessage(event Event) string {
+	message := event.Message
+	if event.Site != "" {
+		message += "\nSite: " + event.Site
+	}
+	if event.Details != "" {
+		message += "\n\n" + event.Details
+	}
+
+	return truncate(message, 4096)
+}
+
+// Email sends events by mail From the address To the addresses via the SMTP server Server, host:port, with STARTTLS
+// if the server offers it and authenticated if User is set. With Digest the events are collected and sent as one mail
+// every Digest instead, e.g. for problems which don't need immediate attention.
+type Email struct {
+	Server   string        `yaml:"server"`
+	User     string        `yaml:"user"`
+	Password string        `yaml:"password"`
+	From     string        `yaml:"from"`
+	To       []string      `yaml:"to"`
+	Digest   time.Duration `yaml:"digest"`
+
+	mu      sync.Mutex
+	pending []Event
+	timer   *time.Timer
+}
+
+// Notify sends the event by mail, or adds it to the digest.
+func (email *Email) Notify(event Event) error {
+	if email.Digest <= 0 {
+		body := formatTimelineEvent(event) + "\n"
+		if event.Details != "" {
+			body += "\n" + event.Details + "\n"
+		}
+		return email.send(eventSummary(event), body)
+	}
+
+	email.mu.Lock()
+	defer email.mu.Unlock()
+	email.pending = append(email.pending, event)
+	if email.timer == nil {
+		email.timer = time.AfterFunc(email.Digest, email.flush)
+	}
+
+	return nil
+}
+
+// flush sends the collected events as digest.
+func (email *Email) flush() {
+	email.mu.Lock()
+	events := email.pending
+	email.pending, email.timer = nil, nil
+	email.mu.Unlock()
+	if len(events) == 0 {
+		return
+	}
+
+	var b strings.Builder
+	for _, event := range events {
+		b.WriteString(event.Time.Format(time.RFC3339) + " " + eventSummary(event) + "\n")
+	}
+	if err := email.send(fmt.Sprintf("%d MikrotikMonitor events", len(events)), b.String()); err != nil {
+		log.Printf("unable to send digest of %d events to %s, %v", len(events), strings.Join(email.To, ", "), err)
+	}
+}
+
+// send sends a mail with the subject and the plain text body.
+func (email *Email) send(subject string, body string) error {
+	var auth smtp.Auth
+	if email.User != "" {
+		host, _, _ := net.SplitHostPort(email.Server)
+		auth = smtp.PlainAuth("", email.User, email.Password, host)
+	}
+
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n", email.From, strings.Join(email.To, ", "),
+		mime.QEncoding.Encode("utf-8", subject), time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(email.Server, auth, email.From, email.To, []byte(message.String())); err != nil {
+		return fmt.Errorf("unable to send mail via %s, %v", email.Server, err)
+	}
+
+	return nil
+}
+
+// eventSummary returns a one line summary of an event for the title of a notification.
+func eventSummary(event Event) string {
+	return eventTitle(event) + " - " + event.Message
+}
+
+// eventTitle returns the state, the device and the problem of an event for the title of a notification with the
+// message in its body.
+func eventTitle(event Event) string {
+	state := event.Severity
+	if event.Resolved {
+		state = "resolved"
+	}
+	name := event.Host
+	if event.Name != "" {
+		name = event.Name + " (" + event.Host + ")"
+	}
+	title := fmt.Sprintf("[%s] %s: %s", state, name, event.Type)
+	if event.Subject != "" {
+		title += " " + event.Subject
+	}
+
+	return title
+}
+
+// truncate returns the text cut to at most limit characters.
+func truncate(text string, limit int) string {
+	if runes := []rune(text); len(runes) > limit {
+		return string(runes[:limit])
+	}
+
+	return text
+}
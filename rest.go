@@ -0,0 +1,133 @@
+package MikrotikMonitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type API struct {
+	User         string
+	Password     string
+	PasswordFile string `yaml:"password_file"`
+	Port         int
+	TLS          bool
+	Insecure     bool
+	Timeout      time.Duration
+}
+
+// restURL returns the URL of a RouterOS REST API path of the device.
+func (device *Device) restURL(path string) string {
+	port := ""
+	if device.API.Port > 0 {
+		port = strconv.Itoa(device.API.Port)
+	}
+
+	return "https://" + urlHost(device.address(), port) + "/rest" + path
+}
+
+// RESTRequest sends a request to the RouterOS v7 REST API of the device, e.g. "POST /tool/sniffer/start".
+// The body is encoded as JSON if it is not nil, the response is decoded into result if it is not nil.
+// The request is canceled when the timeout of the running collector expires.
+// Insecure skips the verification of the certificate, which is self-signed on most devices.
+func (device *Device) RESTRequest(method string, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	ctx := device.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	request, err := http.NewRequestWithContext(ctx, method, device.restURL(path), reader)
+	if err != nil {
+		return err
+	}
+	request.SetBasicAuth(device.API.User, device.API.Password)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	timeout := device.API.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: device.API.Insecure},
+		},
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("%s REST request %s %s failed: %v", device.Host, method, path, err)
+	}
+	defer response.Body.Close()
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("%s REST request %s %s failed: %v", device.Host, method, path, err)
+	}
+	if response.StatusCode >= 300 {
+		var routerError struct {
+			Message string
+			Detail  string
+		}
+		_ = json.Unmarshal(content, &routerError)
+		return fmt.Errorf("%s REST request %s %s failed: %s %s %s", device.Host, method, path, response.Status, routerError.Message, routerError.Detail)
+	}
+
+	if result != nil && len(content) > 0 {
+		return json.Unmarshal(content, result)
+	}
+
+	return nil
+}
+
+// restPrint returns the items of a menu path via the REST API.
+// Single items like /system/resource are returned as a slice with one element, all values are strings.
+func (device *Device) restPrint(path string) ([]map[string]string, error) {
+	return device.restItems(http.MethodGet, path, nil)
+}
+
+// restItems sends a REST request and returns the items of the response like restPrint.
+func (device *Device) restItems(method string, path string, body any) ([]map[string]string, error) {
+	var raw json.RawMessage
+	if err := device.RESTRequest(method, path, body, &raw); err != nil {
+		return nil, err
+	}
+
+	var items []map[string]any
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '{' {
+		var item map[string]any
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	} else if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]string, 0, len(items))
+	for _, item := range items {
+		values := make(map[string]string, len(item))
+		for key, value := range item {
+			values[key] = fmt.Sprint(value)
+		}
+		result = append(result, values)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package MikrotikMonitor
+
+import (
+	"log"
+	"time"
+)
+
+// ResultsBuffer is the number of results a channel of Results holds for a consumer which falls behind.
+var ResultsBuffer = 100
+
+// DeviceResult is the result of a poll of a device. Err is the error of the poll, if it failed.
+type DeviceResult struct {
+	Device   Device
+	Err      error
+	Duration time.Duration
+}
+
+// Results returns a channel which receives the result of every device as soon as its poll has finished,
+// so consumers, e.g. a pipeline to Kafka or NATS, don't wait for the slowest device of a poll.
+// Every call returns a new channel which receives all results. The poll never waits for a consumer,
+// results which don't fit into the ResultsBuffer of the channel are dropped and logged.
+// The channels are closed when the monitor is stopped.
+func (monitor *Monitor) Results() <-chan DeviceResult {
+	results := make(chan DeviceResult, ResultsBuffer)
+
+	monitor.mu.Lock()
+	monitor.results = append(monitor.results, results)
+	monitor.mu.Unlock()
+
+	return results
+}
+
+// publish sends the result of a device to the channels of Results.
+func (monitor *Monitor) publish(result DeviceResult) {
+	monitor.mu.RLock()
+	defer monitor.mu.RUnlock()
+
+	for _, results := range monitor.results {
+		select {
+		case results <- result:
+		default:
+			monitor.stats.observeDropped()
+			log.Printf("%s result dropped, the consumer of the results is too slow", result.Device.Host)
+		}
+	}
+}
+
+// closeResults closes the channels of Results.
+func (monitor *Monitor) closeResults() {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	for _, results := range monitor.results {
+		close(results)
+	}
+	monitor.results = nil
+}
@@ -0,0 +1,59 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Retry is the retry policy of the basic SNMP request of GetDevice, configured in the retry block of the snmp settings.
+// The request is sent up to Attempts times, waiting Delay before the first retry and doubling the wait for every
+// further retry up to MaxDelay. By default only timeouts are retried, which are typical for packet loss on wireless
+// links, with AllErrors every error is. Attempts of 0 or 1 disable retries, the SNMP client's own retries apply in any case.
+type Retry struct {
+	Attempts  int           `json:"Attempts"`
+	Delay     time.Duration `json:"Delay"`
+	MaxDelay  time.Duration `json:"MaxDelay"`
+	AllErrors bool          `json:"AllErrors"`
+}
+
+// do calls request until it succeeds, the attempts are used up, the error is not retryable or the context is done.
+// It returns the error of the last attempt.
+func (retry Retry) do(ctx context.Context, request func() error) error {
+	delay := retry.Delay
+	if delay <= 0 {
+		delay = time.Second
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := request()
+		if err == nil || attempt >= retry.Attempts || ctx.Err() != nil || !retry.AllErrors && !isTimeout(err) {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		delay *= 2
+		if retry.MaxDelay > 0 && delay > retry.MaxDelay {
+			delay = retry.MaxDelay
+		}
+	}
+}
+
+// isTimeout reports whether the error is a timeout of the network or of the SNMP client, which only reports it as text.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "timeout")
+}
@@ -0,0 +1,242 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EventRouting is the type of events raised when a BGP session leaves Established or an OSPF neighbor leaves Full.
+// The event is resolved when the session is up again, the subject is the peer.
+const EventRouting = "Routing"
+
+// Routing protocol states of established sessions.
+const (
+	BGPEstablished = "established"
+	OSPFFull       = "full"
+)
+
+// OIDs of the peer table of the BGP4-MIB and the neighbor table of the OSPF-MIB.
+const (
+	oidBGPPeerState    = ".1.3.6.1.2.1.15.3.1.2"
+	oidBGPPeerRemoteAS = ".1.3.6.1.2.1.15.3.1.9"
+	oidOSPFNbrRouterID = ".1.3.6.1.2.1.14.10.1.3"
+	oidOSPFNbrState    = ".1.3.6.1.2.1.14.10.1.6"
+)
+
+// Routing is the state of the routing protocol sessions of the device.
+type Routing struct {
+	BGP  []BGPPeer      `json:"BGP"`
+	OSPF []OSPFNeighbor `json:"OSPF"`
+}
+
+// BGPPeer is a BGP session, State is in lower case, e.g. "established" or "active".
+// Prefixes is the number of received prefixes, which is only read via the API.
+type BGPPeer struct {
+	Name     string `json:"Name"`
+	Address  string `json:"Address"`
+	AS       int    `json:"AS"`
+	State    string `json:"State"`
+	Prefixes int    `json:"Prefixes"`
+}
+
+// OSPFNeighbor is an OSPF neighbor, State is in lower case, e.g. "full" or "2-way".
+type OSPFNeighbor struct {
+	Address  string `json:"Address"`
+	RouterID string `json:"RouterID"`
+	State    string `json:"State"`
+}
+
+// GetRouting reads the BGP sessions and the OSPF neighbors of the device.
+// Devices with an api block or another backend read /routing/bgp and /routing/ospf, which includes the
+// prefix counts. Devices read via SNMP only walk the BGP4-MIB and the OSPF-MIB.
+func (device *Device) GetRouting() error {
+	if device.API.User != "" || !usesSNMP(device) {
+		return device.getRoutingAPI()
+	}
+
+	routing := Routing{}
+	bgp := map[string]*BGPPeer{}
+	err := device.snmp.BulkWalk(oidBGPPeerState, func(variable gosnmp.SnmpPDU) error {
+		address := strings.TrimPrefix(variable.Name, oidBGPPeerState+".")
+		state, err := AsInt(variable)
+		if err != nil {
+			return nil
+		}
+		bgp[address] = &BGPPeer{Address: address, State: bgpState(state)}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s unable to read BGP peers: %v", device.Host, err)
+	}
+	err = device.snmp.BulkWalk(oidBGPPeerRemoteAS, func(variable gosnmp.SnmpPDU) error {
+		if peer := bgp[strings.TrimPrefix(variable.Name, oidBGPPeerRemoteAS+".")]; peer != nil {
+			as, _ := AsInt(variable)
+			peer.AS = int(as)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s unable to read BGP peers: %v", device.Host, err)
+	}
+	for _, peer := range bgp {
+		routing.BGP = append(routing.BGP, *peer)
+	}
+
+	ospf := map[string]*OSPFNeighbor{}
+	err = device.snmp.BulkWalk(oidOSPFNbrState, func(variable gosnmp.SnmpPDU) error {
+		// the index is the address of the neighbor followed by the interface index for unnumbered links
+		index := strings.TrimPrefix(variable.Name, oidOSPFNbrState+".")
+		parts := strings.Split(index, ".")
+		address := strings.Join(parts[:min(4, len(parts))], ".")
+		state, err := AsInt(variable)
+		if err != nil {
+			return nil
+		}
+		ospf[index] = &OSPFNeighbor{Address: address, State: ospfState(state)}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s unable to read OSPF neighbors: %v", device.Host, err)
+	}
+	err = device.snmp.BulkWalk(oidOSPFNbrRouterID, func(variable gosnmp.SnmpPDU) error {
+		if neighbor := ospf[strings.TrimPrefix(variable.Name, oidOSPFNbrRouterID+".")]; neighbor != nil {
+			neighbor.RouterID, _ = AsIPAddress(variable)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s unable to read OSPF neighbors: %v", device.Host, err)
+	}
+	for _, neighbor := range ospf {
+		routing.OSPF = append(routing.OSPF, *neighbor)
+	}
+
+	sortRouting(&routing)
+	device.Routing = routing
+
+	return nil
+}
+
+// getRoutingAPI reads the BGP sessions and OSPF neighbors via the API. RouterOS v7 lists BGP sessions in
+// /routing/bgp/session, RouterOS v6 lists peers in /routing/bgp/peer. Devices without the routing menus have no sessions.
+func (device *Device) getRoutingAPI() error {
+	routing := Routing{}
+
+	if device.Capabilities.Major >= 7 {
+		sessions, err := device.Print("/routing/bgp/session")
+		if err != nil {
+			return err
+		}
+		for _, session := range sessions {
+			peer := BGPPeer{
+				Name:    session["name"],
+				Address: session["remote.address"],
+				State:   strings.ToLower(session["state"]),
+			}
+			if session["established"] == "true" {
+				peer.State = BGPEstablished
+			} else if peer.State == "" {
+				peer.State = "idle"
+			}
+			peer.AS, _ = strconv.Atoi(session["remote.as"])
+			peer.Prefixes, _ = strconv.Atoi(session["prefix-count"])
+			routing.BGP = append(routing.BGP, peer)
+		}
+	} else {
+		peers, err := device.Print("/routing/bgp/peer")
+		if err != nil {
+			// the routing package can be disabled on RouterOS v6
+			peers = nil
+		}
+		for _, item := range peers {
+			peer := BGPPeer{Name: item["name"], Address: item["remote-address"], State: strings.ToLower(item["state"])}
+			peer.AS, _ = strconv.Atoi(item["remote-as"])
+			peer.Prefixes, _ = strconv.Atoi(item["prefix-count"])
+			routing.BGP = append(routing.BGP, peer)
+		}
+	}
+
+	neighbors, err := device.Print("/routing/ospf/neighbor")
+	if err != nil && device.Capabilities.Major >= 7 {
+		return err
+	}
+	for _, item := range neighbors {
+		routing.OSPF = append(routing.OSPF, OSPFNeighbor{
+			Address:  item["address"],
+			RouterID: item["router-id"],
+			State:    strings.ToLower(item["state"]),
+		})
+	}
+
+	sortRouting(&routing)
+	device.Routing = routing
+
+	return nil
+}
+
+// bgpState returns the name of a peer state of the BGP4-MIB.
+func bgpState(value int64) string {
+	states := []string{"idle", "connect", "active", "opensent", "openconfirm", BGPEstablished}
+	if value < 1 || int(value) > len(states) {
+		return "unknown"
+	}
+
+	return states[value-1]
+}
+
+// ospfState returns the name of a neighbor state of the OSPF-MIB.
+func ospfState(value int64) string {
+	states := []string{"down", "attempt", "init", "2-way", "exstart", "exchange", "loading", OSPFFull}
+	if value < 1 || int(value) > len(states) {
+		return "unknown"
+	}
+
+	return states[value-1]
+}
+
+// sortRouting sorts the BGP peers and the OSPF neighbors by address.
+func sortRouting(routing *Routing) {
+	sort.Slice(routing.BGP, func(i, j int) bool { return routing.BGP[i].Address < routing.BGP[j].Address })
+	sort.Slice(routing.OSPF, func(i, j int) bool { return routing.OSPF[i].Address < routing.OSPF[j].Address })
+}
+
+// routingChanges returns the events of BGP sessions which left or reached Established and of OSPF neighbors which
+// left or reached Full between two polls. Sessions which disappeared while being up count as down.
+func routingChanges(previous, current Device) []Event {
+	var events []Event
+	change := func(subject string, upState string, before string, after string) {
+		switch {
+		case before == upState && after != upState:
+			if after == "" {
+				after = "gone"
+			}
+			events = append(events, current.NewEvent(EventRouting, SeverityCritical, subject,
+				fmt.Sprintf("session left %s, state %s", upState, after)))
+		case before != "" && before != upState && after == upState:
+			event := current.NewEvent(EventRouting, SeverityCritical, subject, fmt.Sprintf("session is %s again", upState))
+			event.Resolved = true
+			events = append(events, event)
+		}
+	}
+
+	bgp := map[string]string{}
+	for _, peer := range current.Routing.BGP {
+		bgp[peer.Address] = peer.State
+	}
+	for _, peer := range previous.Routing.BGP {
+		change("BGP "+peer.Address, BGPEstablished, peer.State, bgp[peer.Address])
+	}
+
+	ospf := map[string]string{}
+	for _, neighbor := range current.Routing.OSPF {
+		ospf[neighbor.Address] = neighbor.State
+	}
+	for _, neighbor := range previous.Routing.OSPF {
+		change("OSPF "+neighbor.Address, OSPFFull, neighbor.State, ospf[neighbor.Address])
+	}
+
+	return events
+}
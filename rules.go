@@ -0,0 +1,377 @@
+package MikrotikMonitor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventRule is the type of events raised by the RuleEngine, the subject is the name of the rule.
+const EventRule = "Rule"
+
+// Rule is a threshold condition on a metric of the devices, defined in the rules block of the config file.
+// Condition is "<metric> <operator> <value>", e.g. "cpu > 80", with the operators >, >=, <, <=, == and !=.
+// The rule fires once the condition held for at least For and in at least Polls consecutive polls.
+// Group and Tag limit the rule to the devices of a group or with a tag.
+type Rule struct {
+	Name      string
+	Condition string
+	For       time.Duration
+	Polls     int
+	Severity  string
+	Group     string
+	Tag       string
+}
+
+// RuleMetrics are the metrics rules can use. A metric returns false if it has no value for the poll,
+// e.g. the CPU load of an unreachable device, which leaves the state of the rule unchanged.
+var RuleMetrics = map[string]func(previous, current Device) (float64, bool){
+	"down": func(previous, current Device) (float64, bool) {
+		// the dampened state of the monitor, if the device was polled by one
+		down := !current.Reached
+		if !current.Availability.Updated.IsZero() {
+			down = current.Availability.Down
+		}
+		if down {
+			return 1, true
+		}
+		return 0, true
+	},
+	"cpu": func(previous, current Device) (float64, bool) {
+		return float64(current.Health.CPULoad), current.Reached
+	},
+	"temperature": func(previous, current Device) (float64, bool) {
+		return current.Health.Temperature, current.Reached && current.Health.Temperature != 0
+	},
+	"interface_errors": func(previous, current Device) (float64, bool) {
+		if !previous.Reached || !current.Reached {
+			return 0, false
+		}
+		before := map[int]Interface{}
+		for _, iface := range previous.Interfaces {
+			before[iface.Index] = iface
+		}
+		var increase float64
+		for _, iface := range current.Interfaces {
+			old, found := before[iface.Index]
+			if !found || iface.InErrors < old.InErrors || iface.OutErrors < old.OutErrors {
+				continue
+			}
+			increase += float64(iface.InErrors - old.InErrors + iface.OutErrors - old.OutErrors)
+		}
+		return increase, true
+	},
+	"snmp_rtt_ms": func(previous, current Device) (float64, bool) {
+		return float64(current.Latency.SNMP) / float64(time.Millisecond), current.Reached
+	},
+	"ping_loss": func(previous, current Device) (float64, bool) {
+		return current.Latency.Loss * 100, current.Latency.Samples > 0
+	},
+	"wireless_clients": func(previous, current Device) (float64, bool) {
+		return float64(current.Wireless.Clients), current.Reached
+	},
+	"conntrack_usage": func(previous, current Device) (float64, bool) {
+		if current.Firewall.MaxConnections == 0 {
+			return 0, false
+		}
+		return float64(current.Firewall.Connections) / float64(current.Firewall.MaxConnections) * 100, current.Reached
+	},
+	"firewall_unmatched":      unmatchedRules,
+	"wireguard_handshake_age": handshakeAge,
+	"hotspot_sessions": func(previous, current Device) (float64, bool) {
+		return float64(current.Sessions.Hotspot), current.Reached && current.API.User != ""
+	},
+	"pppoe_sessions": func(previous, current Device) (float64, bool) {
+		return float64(current.Sessions.PPPoE), current.Reached && current.API.User != ""
+	},
+	"session_drop":  sessionDrop,
+	"services_down": servicesDown,
+	"arp_entries": func(previous, current Device) (float64, bool) {
+		return float64(current.Tables.ARP), current.Reached
+	},
+	"arp_growth": tableGrowth(func(tables Tables) int { return tables.ARP }),
+	"nd_growth":  tableGrowth(func(tables Tables) int { return tables.ND }),
+	"bridge_hosts": func(previous, current Device) (float64, bool) {
+		return float64(current.Tables.BridgeHosts), current.Reached
+	},
+	"bridge_hosts_growth": tableGrowth(func(tables Tables) int { return tables.BridgeHosts }),
+	"disk_usage":          storageMetric(StorageDisk),
+	"memory_usage":        storageMetric(StorageRAM),
+	"sfp_rx_power":        opticsMetric(func(optic Optic) float64 { return optic.RxPower }, math.Min),
+	"sfp_tx_power":        opticsMetric(func(optic Optic) float64 { return optic.TxPower }, math.Min),
+	"sfp_temperature":     opticsMetric(func(optic Optic) float64 { return optic.Temperature }, math.Max),
+	"sfp_rx_loss": opticsMetric(func(optic Optic) float64 {
+		if optic.RxLoss {
+			return 1
+		}
+		return 0
+	}, func(a, b float64) float64 { return a + b }),
+}
+
+// condition is a parsed Rule.Condition.
+type condition struct {
+	metric   string
+	operator string
+	value    float64
+}
+
+// parseCondition parses a condition like "cpu > 80".
+func parseCondition(value string) (condition, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 3 {
+		return condition{}, fmt.Errorf("condition %q is not <metric> <operator> <value>", value)
+	}
+	if _, found := RuleMetrics[fields[0]]; !found {
+		return condition{}, fmt.Errorf("unknown metric %q", fields[0])
+	}
+	switch fields[1] {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return condition{}, fmt.Errorf("unknown operator %q", fields[1])
+	}
+	threshold, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return condition{}, fmt.Errorf("invalid value %q", fields[2])
+	}
+
+	return condition{metric: fields[0], operator: fields[1], value: threshold}, nil
+}
+
+func (c condition) holds(value float64) bool {
+	switch c.operator {
+	case ">":
+		return value > c.value
+	case ">=":
+		return value >= c.value
+	case "<":
+		return value < c.value
+	case "<=":
+		return value <= c.value
+	case "==":
+		return value == c.value
+	}
+
+	return value != c.value
+}
+
+// LoadRules reads the rules block of the config file and validates it.
+// A config file without rules returns no rules.
+func LoadRules(filename string) ([]Rule, error) {
+	documents, err := readConfigDocuments(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadRules(documents)
+}
+
+// loadRules is LoadRules with the parsed documents of the config files.
+func loadRules(documents []configDocument) ([]Rule, error) {
+	var parser struct {
+		Rules []Rule `yaml:"rules"`
+	}
+
+	if err := decodeConfig(documents, &parser); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	names := map[string]bool{}
+	for i := range parser.Rules {
+		rule := &parser.Rules[i]
+		fail := func(format string, a ...any) {
+			errs = append(errs, fmt.Errorf("rule %d %s: %s", i+1, rule.Name, fmt.Sprintf(format, a...)))
+		}
+
+		if rule.Name == "" {
+			fail("missing name")
+		} else if names[rule.Name] {
+			fail("duplicate name")
+		}
+		names[rule.Name] = true
+
+		if _, err := parseCondition(rule.Condition); err != nil {
+			fail("%v", err)
+		}
+		switch rule.Severity {
+		case "":
+			rule.Severity = SeverityWarning
+		case SeverityInfo, SeverityWarning, SeverityCritical:
+		default:
+			fail("unknown severity %q", rule.Severity)
+		}
+		if rule.Polls < 0 || rule.For < 0 {
+			fail("negative polls or duration")
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid rules in config file:\n%v", err)
+	}
+
+	return parser.Rules, nil
+}
+
+// RuleEngine evaluates the rules against every poll of a device and raises an event when a rule fires
+// and a resolved event when its condition doesn't hold anymore. It is safe for concurrent use.
+type RuleEngine struct {
+	mu     sync.Mutex
+	rules  []Rule
+	states map[string]*ruleState
+}
+
+type ruleState struct {
+	since  time.Time
+	polls  int
+	firing bool
+}
+
+// NewRuleEngine returns a RuleEngine for the rules.
+func NewRuleEngine(rules []Rule) *RuleEngine {
+	engine := &RuleEngine{}
+	engine.SetRules(rules)
+
+	return engine
+}
+
+// SetRules replaces the rules. The state of unchanged rules is kept, so a reload doesn't resolve or raise alerts again.
+func (engine *RuleEngine) SetRules(rules []Rule) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	old := map[string]Rule{}
+	for _, rule := range engine.rules {
+		old[rule.Name] = rule
+	}
+	for key := range engine.states {
+		name, _, _ := strings.Cut(key, "\x00")
+		if !ruleUnchanged(old[name], rules) {
+			delete(engine.states, key)
+		}
+	}
+	if engine.states == nil {
+		engine.states = map[string]*ruleState{}
+	}
+	engine.rules = rules
+}
+
+// ruleUnchanged reports whether the rule is part of the rules with the same settings.
+func ruleUnchanged(rule Rule, rules []Rule) bool {
+	for _, r := range rules {
+		if r.Name == rule.Name {
+			return reflect.DeepEqual(r, rule)
+		}
+	}
+
+	return false
+}
+
+// Rules returns the rules sorted by name.
+func (engine *RuleEngine) Rules() []Rule {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	rules := append([]Rule(nil), engine.rules...)
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+
+	return rules
+}
+
+// Update evaluates all rules for a polled device against its previous state and returns the resulting events.
+func (engine *RuleEngine) Update(previous, current Device) []Event {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	now := time.Now()
+	var events []Event
+	for _, rule := range engine.rules {
+		if rule.Group != "" && rule.Group != current.Group || rule.Tag != "" && !current.HasTag(rule.Tag) {
+			continue
+		}
+		c, err := parseCondition(rule.Condition)
+		if err != nil {
+			continue
+		}
+		value, ok := RuleMetrics[c.metric](previous, current)
+		if !ok {
+			continue
+		}
+
+		key := rule.Name + "\x00" + current.Host
+		state := engine.states[key]
+		if state == nil {
+			state = &ruleState{}
+			engine.states[key] = state
+		}
+
+		if !c.holds(value) {
+			if state.firing {
+				event := current.NewEvent(EventRule, rule.Severity, rule.Name, fmt.Sprintf("%s is %g, resolved", c.metric, value))
+				event.Resolved, event.Metric = true, c.metric
+				events = append(events, event)
+			}
+			*state = ruleState{}
+			continue
+		}
+
+		if state.polls == 0 {
+			state.since = now
+		}
+		state.polls++
+		polls := rule.Polls
+		if polls < 1 {
+			polls = 1
+		}
+		if !state.firing && state.polls >= polls && now.Sub(state.since) >= rule.For {
+			state.firing = true
+			event := current.NewEvent(EventRule, rule.Severity, rule.Name, fmt.Sprintf("%s is %g (%s)", c.metric, value, rule.Condition))
+			event.Metric = c.metric
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// storedRuleState is the state of a rule for a device in the state file of the monitor.
+type storedRuleState struct {
+	Since  time.Time `json:"since"`
+	Polls  int       `json:"polls"`
+	Firing bool      `json:"firing"`
+}
+
+// snapshot returns the rules and their states by rule name and host.
+func (engine *RuleEngine) snapshot() ([]Rule, map[string]storedRuleState) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	states := make(map[string]storedRuleState, len(engine.states))
+	for key, state := range engine.states {
+		states[key] = storedRuleState{Since: state.since, Polls: state.polls, Firing: state.firing}
+	}
+
+	return append([]Rule(nil), engine.rules...), states
+}
+
+// restore sets the states of a snapshot, states of rules which changed since are dropped like by SetRules.
+func (engine *RuleEngine) restore(rules []Rule, states map[string]storedRuleState) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	old := map[string]Rule{}
+	for _, rule := range rules {
+		old[rule.Name] = rule
+	}
+	for key, state := range states {
+		name, _, _ := strings.Cut(key, "\x00")
+		if _, found := old[name]; !found || !ruleUnchanged(old[name], engine.rules) {
+			continue
+		}
+		engine.states[key] = &ruleState{since: state.Since, polls: state.Polls, firing: state.Firing}
+	}
+}
@@ -0,0 +1,225 @@
+package MikrotikMonitor
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Store is a BackupStore in a bucket of an S3-compatible object storage like AWS S3 or MinIO.
+// The objects are addressed path-style, e.g. https://s3.example.com/bucket/prefix/name, and the requests
+// are signed with AWS Signature Version 4. Region defaults to us-east-1, which MinIO accepts as well.
+type S3Store struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client `yaml:"-"`
+}
+
+// Put stores the content as object.
+func (store *S3Store) Put(name string, content []byte) error {
+	response, err := store.request(http.MethodPut, name, nil, content)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	return nil
+}
+
+// Get returns the content of an object.
+func (store *S3Store) Get(name string) ([]byte, error) {
+	response, err := store.request(http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return io.ReadAll(response.Body)
+}
+
+// Delete removes an object.
+func (store *S3Store) Delete(name string) error {
+	response, err := store.request(http.MethodDelete, name, nil, nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	return nil
+}
+
+// List returns the sorted names of the objects starting with the prefix.
+func (store *S3Store) List(prefix string) ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {store.Prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		response, err := store.request(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse object list of bucket %s: %v", store.Bucket, err)
+		}
+
+		for _, object := range result.Contents {
+			names = append(names, strings.TrimPrefix(object.Key, store.Prefix))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// request sends a signed request for an object, or for the bucket if the name is empty.
+// Responses with an error status are returned as error.
+func (store *S3Store) request(method string, name string, query url.Values, body []byte) (*http.Response, error) {
+	endpoint, err := url.Parse(store.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: %v", store.Endpoint, err)
+	}
+	path := "/" + store.Bucket
+	if name != "" {
+		path += "/" + store.Prefix + name
+	}
+	endpoint.Path = path
+	endpoint.RawPath = s3Escape(path, false)
+	endpoint.RawQuery = s3Query(query)
+
+	request, err := http.NewRequest(method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	store.sign(request, body, time.Now().UTC())
+
+	client := store.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Minute}
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("S3 request %s %s failed: %v", method, path, err)
+	}
+	if response.StatusCode >= 300 {
+		defer response.Body.Close()
+		var s3Error struct {
+			Code    string
+			Message string
+		}
+		_ = xml.NewDecoder(io.LimitReader(response.Body, 4096)).Decode(&s3Error)
+		if response.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("S3 request %s %s failed: %w", method, path, os.ErrNotExist)
+		}
+		return nil, fmt.Errorf("S3 request %s %s failed: %s %s %s", method, path, response.Status, s3Error.Code, s3Error.Message)
+	}
+
+	return response, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to the request.
+func (store *S3Store) sign(request *http.Request, body []byte, now time.Time) {
+	region := store.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	date := now.Format("20060102")
+	timestamp := now.Format("20060102T150405Z")
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+
+	request.Header.Set("X-Amz-Date", timestamp)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	canonical := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		"host:" + request.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + timestamp,
+		"",
+		"host;x-amz-content-sha256;x-amz-date",
+		payloadHash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	scope := date + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := []byte("AWS4" + store.SecretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=%s",
+		store.AccessKey, scope, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// s3Query returns the query sorted by key with the values encoded like s3Escape, as the signature requires.
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes all characters except the unreserved ones, slashes are kept unless escapeSlash is set.
+func s3Escape(value string, escapeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(value) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ScriptName is the name of the metrics script the monitor manages on the devices.
+const ScriptName = "mikrotikmonitor-metrics"
+
+// ScriptVersion is the version of the bundled metrics script.
+// It has to be increased whenever ScriptSource changes, so outdated deployments are detected.
+const ScriptVersion = 1
+
+const (
+	oidScriptName      = ".1.3.6.1.4.1.14988.1.1.8.1.1.2"
+	oidScriptRunOutput = ".1.3.6.1.4.1.14988.1.1.18.1.1.2"
+)
+
+// ScriptSource is the RouterOS script publishing extra metrics which are not part of the MikroTik MIB.
+// Every line of its output is a key=value pair, the first line always carries the script version.
+// Firewall filter rules are exported if their comment starts with "monitor:", the rest of the comment is used as key.
+var ScriptSource = `:put ("version=` + strconv.Itoa(ScriptVersion) + `")
+:foreach r in=[/ip firewall filter find where comment~"^monitor:"] do={
+  :local c [/ip firewall filter get $r comment]
+  :local k [:pick $c 8 [:len $c]]
+  :put ("filter." . $k . ".bytes=" . [/ip firewall filter get $r bytes])
+  :put ("filter." . $k . ".packets=" . [/ip firewall filter get $r packets])
+}`
+
+type Script struct {
+	Active   bool              `json:"Active"`
+	Version  int               `json:"Version"`
+	Outdated bool              `json:"Outdated"`
+	Metrics  map[string]string `json:"Metrics"`
+}
+
+// ScriptCommands returns the RouterOS commands which install or replace the metrics script on a device.
+// The script is read via SNMP, so the device needs an SNMP community with write access to run it.
+func ScriptCommands() string {
+	source := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\r\n`).Replace(ScriptSource)
+
+	return fmt.Sprintf("/system script remove [find name=\"%s\"]\n/system script add name=\"%s\" policy=read,test source=\"%s\"\n", ScriptName, ScriptName, source)
+}
+
+// DeployScript installs the current version of the metrics script on the device via the REST API,
+// an existing script with the same name is replaced.
+func (device *Device) DeployScript() error {
+	var scripts []struct {
+		ID   string `json:".id"`
+		Name string
+	}
+	if err := device.RESTRequest(http.MethodGet, "/system/script?name="+ScriptName, nil, &scripts); err != nil {
+		return err
+	}
+	for _, script := range scripts {
+		if err := device.RESTRequest(http.MethodDelete, "/system/script/"+script.ID, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	script := map[string]string{"name": ScriptName, "policy": "read,test", "source": ScriptSource}
+	return device.RESTRequest(http.MethodPut, "/system/script", script, nil)
+}
+
+// GetScript runs the metrics script on the device and populates the Script struct with its output.
+// It looks up the script index by name in the script table and reads the run output of that index.
+// The SNMP connection of the device has to be established already.
+// If the script is missing or its version differs from ScriptVersion, Outdated is set.
+func (device *Device) GetScript() error {
+	device.Script.Outdated = true
+
+	index := ""
+	err := device.snmp.BulkWalk(oidScriptName, func(variable gosnmp.SnmpPDU) error {
+		if value, err := AsString(variable); err == nil && value == ScriptName {
+			index = strings.TrimPrefix(variable.Name, oidScriptName)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s unable to read script table: %v", device.Host, err)
+	}
+	if index == "" {
+		return fmt.Errorf("%s script %s is not deployed", device.Host, ScriptName)
+	}
+
+	result, err := device.snmp.Get([]string{oidScriptRunOutput + index})
+	if err != nil {
+		return fmt.Errorf("%s unable to run script %s: %v", device.Host, ScriptName, err)
+	}
+	if len(result.Variables) == 0 {
+		return fmt.Errorf("%s script %s returned no output", device.Host, ScriptName)
+	}
+	output, err := AsString(result.Variables[0])
+	if err != nil {
+		return fmt.Errorf("%s script %s returned no output: %v", device.Host, ScriptName, err)
+	}
+
+	device.Script.Metrics = map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found {
+			continue
+		}
+		if key == "version" {
+			device.Script.Version, _ = strconv.Atoi(value)
+			continue
+		}
+		device.Script.Metrics[key] = value
+	}
+	device.Script.Outdated = device.Script.Version != ScriptVersion
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package MikrotikMonitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// secret is a credential of a device together with the file it may be read from.
+type secret struct {
+	name  string
+	value *string
+	file  *string
+}
+
+// secrets returns the credentials of the device.
+func (device *Device) secrets() []secret {
+	return []secret{
+		{"community", &device.SNMP.Community, &device.SNMP.CommunityFile},
+		{"authentication passphrase", &device.SNMP.Authentication.Passphrase, &device.SNMP.Authentication.PassphraseFile},
+		{"privacy passphrase", &device.SNMP.Privacy.Passphrase, &device.SNMP.Privacy.PassphraseFile},
+		{"api password", &device.API.Password, &device.API.PasswordFile},
+		{"ssh password", &device.SSH.Password, &device.SSH.PasswordFile},
+	}
+}
+
+// LoadSecrets reads the credentials of the devices which are kept out of the config file. A credential is read from
+// the file of its _file setting, e.g. community_file or passphrase_file, with the trailing newline removed. With systemd
+// the files are e.g. ${CREDENTIALS_DIRECTORY}/snmp-community of LoadCredential=. A credential set in the config takes
+// precedence over its file, so a device can override a file of the snmp_defaults. A credential of the form
+// vault:path#field is read from the KV secrets engine of HashiCorp Vault, e.g. vault:secret/data/mikrotik#community,
+// at VAULT_ADDR with VAULT_TOKEN. All problems are returned together.
+func (devices *Devices) LoadSecrets() error {
+	var errs []error
+	vault := &Vault{}
+	for i := range *devices {
+		device := &(*devices)[i]
+		for _, secret := range device.secrets() {
+			if *secret.file != "" && *secret.value == "" {
+				content, err := os.ReadFile(*secret.file)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: unable to read %s: %v", device.Host, secret.name, err))
+					continue
+				}
+				*secret.value = strings.TrimRight(string(content), "\r\n")
+				continue
+			}
+
+			if reference, found := strings.CutPrefix(*secret.value, "vault:"); found {
+				value, err := vault.Secret(reference)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: unable to read %s: %v", device.Host, secret.name, err))
+					continue
+				}
+				*secret.value = value
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Vault reads secrets from the KV secrets engine, version 1 or 2, of HashiCorp Vault. Address, Token and Namespace
+// default to the VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE environment variables. Every path is read once,
+// a failed read isn't repeated either.
+type Vault struct {
+	Address   string
+	Token     string
+	Namespace string
+	Client    *http.Client
+
+	paths  map[string]map[string]any
+	failed map[string]error
+}
+
+// Secret returns a field of a secret, the reference is the path and the field separated by #, e.g. secret/data/mikrotik#community.
+func (vault *Vault) Secret(reference string) (string, error) {
+	path, field, found := strings.Cut(reference, "#")
+	if !found || path == "" || field == "" {
+		return "", fmt.Errorf("invalid vault reference %q, use vault:path#field", reference)
+	}
+
+	if err, failed := vault.failed[path]; failed {
+		return "", err
+	}
+	data, found := vault.paths[path]
+	if !found {
+		if vault.paths == nil {
+			vault.paths, vault.failed = map[string]map[string]any{}, map[string]error{}
+		}
+		var err error
+		if data, err = vault.read(path); err != nil {
+			vault.failed[path] = err
+			return "", err
+		}
+		vault.paths[path] = data
+	}
+
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no field %s", path, field)
+	}
+
+	return value, nil
+}
+
+// read returns the data of the secret at the path.
+func (vault *Vault) read(path string) (map[string]any, error) {
+	address, token, namespace := vault.Address, vault.Token, vault.Namespace
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if namespace == "" {
+		namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	if address == "" || token == "" {
+		return nil, fmt.Errorf("vault address or token missing, set VAULT_ADDR and VAULT_TOKEN")
+	}
+
+	request, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(address, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-Vault-Token", token)
+	if namespace != "" {
+		request.Header.Set("X-Vault-Namespace", namespace)
+	}
+	client := vault.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read vault secret %s: %v", path, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to read vault secret %s: %s", path, response.Status)
+	}
+
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("unable to parse vault secret %s: %v", path, err)
+	}
+	// version 2 of the KV engine nests the fields in data with the metadata next to them
+	if nested, ok := secret.Data["data"].(map[string]any); ok {
+		if _, versioned := secret.Data["metadata"]; versioned {
+			return nested, nil
+		}
+	}
+
+	return secret.Data, nil
+}
@@ -0,0 +1,231 @@
+package MikrotikMonitor
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PollDurationBuckets are the upper bounds in seconds of the buckets of the poll duration histograms.
+var PollDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// histogram counts observations in buckets like a Prometheus histogram, the counts aren't cumulative.
+type histogram struct {
+	counts []float64
+	sum    float64
+	count  float64
+}
+
+// observe adds an observation in seconds.
+func (h *histogram) observe(seconds float64) {
+	if h.counts == nil {
+		h.counts = make([]float64, len(PollDurationBuckets))
+	}
+	for i, bound := range PollDurationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// write writes the cumulative buckets, the sum and the count of the histogram.
+func (h *histogram) write(w *metricsWriter, name string) {
+	var cumulative float64
+	for i, bound := range PollDurationBuckets {
+		if h.counts != nil {
+			cumulative += h.counts[i]
+		}
+		w.sample(name+"_bucket", [][2]string{{"le", strconv.FormatFloat(bound, 'g', -1, 64)}}, cumulative)
+	}
+	w.sample(name+"_bucket", [][2]string{{"le", "+Inf"}}, h.count)
+	w.sample(name+"_sum", nil, h.sum)
+	w.sample(name+"_count", nil, h.count)
+}
+
+// monitorStats are the metrics of the monitor itself.
+type monitorStats struct {
+	mu            sync.Mutex
+	devicePolls   histogram
+	cycles        histogram
+	pollErrors    map[string]float64
+	queue         int
+	lastCycle     time.Time
+	reloads       map[string]float64
+	lastReload    time.Time
+	lastReloadErr time.Time
+	dropped       float64
+}
+
+// pollErrorClass returns the class of the error of a poll, by the sentinel errors it wraps.
+func pollErrorClass(err error) string {
+	switch {
+	case errors.Is(err, ErrConnect):
+		return "connect"
+	case errors.Is(err, ErrSNMPRequest):
+		return "snmp_request"
+	}
+
+	return "other"
+}
+
+// observePoll records the duration and the error of the poll of a device.
+func (stats *monitorStats) observePoll(duration time.Duration, err error) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	stats.devicePolls.observe(duration.Seconds())
+	if err != nil {
+		if stats.pollErrors == nil {
+			stats.pollErrors = map[string]float64{}
+		}
+		stats.pollErrors[pollErrorClass(err)]++
+	}
+}
+
+// observeCycle records the duration of a poll of all devices which has finished.
+func (stats *monitorStats) observeCycle(start time.Time) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	stats.lastCycle = time.Now()
+	stats.cycles.observe(stats.lastCycle.Sub(start).Seconds())
+}
+
+// setQueue sets the number of devices waiting to be polled.
+func (stats *monitorStats) setQueue(queue int) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	stats.queue = queue
+}
+
+// observeReload records the result of a reload of the config file.
+func (stats *monitorStats) observeReload(err error) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	if stats.reloads == nil {
+		stats.reloads = map[string]float64{}
+	}
+	if err != nil {
+		stats.reloads["failure"]++
+		stats.lastReloadErr = time.Now()
+		return
+	}
+	stats.reloads["success"]++
+	stats.lastReload = time.Now()
+}
+
+// observeDropped counts a result dropped because a consumer of Results was too slow.
+func (stats *monitorStats) observeDropped() {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	stats.dropped++
+}
+
+// writeSelfMetrics writes the metrics of the monitor itself, so the monitor can be monitored as well.
+func (monitor *Monitor) writeSelfMetrics(w *metricsWriter) {
+	stats := &monitor.stats
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	w.metric("mikrotik_monitor_device_poll_duration_seconds", "Duration of the polls of single devices.", "histogram")
+	stats.devicePolls.write(w, "mikrotik_monitor_device_poll_duration_seconds")
+	w.metric("mikrotik_monitor_poll_duration_seconds", "Duration of the polls of all devices.", "histogram")
+	stats.cycles.write(w, "mikrotik_monitor_poll_duration_seconds")
+
+	w.metric("mikrotik_monitor_poll_errors_total", "Number of failed polls of devices per error class.", "counter")
+	for _, class := range []string{"connect", "snmp_request", "other"} {
+		w.sample("mikrotik_monitor_poll_errors_total", [][2]string{{"class", class}}, stats.pollErrors[class])
+	}
+	w.metric("mikrotik_monitor_poll_queue_depth", "Number of devices waiting to be polled in the running poll.", "gauge")
+	w.sample("mikrotik_monitor_poll_queue_depth", nil, float64(stats.queue))
+	if !stats.lastCycle.IsZero() {
+		w.metric("mikrotik_monitor_last_poll_timestamp_seconds", "Time the last poll of all devices finished.", "gauge")
+		w.sample("mikrotik_monitor_last_poll_timestamp_seconds", nil, float64(stats.lastCycle.Unix()))
+	}
+
+	w.metric("mikrotik_monitor_config_reloads_total", "Number of loads of the config file per result.", "counter")
+	for _, result := range []string{"success", "failure"} {
+		w.sample("mikrotik_monitor_config_reloads_total", [][2]string{{"result", result}}, stats.reloads[result])
+	}
+	for _, reload := range []struct {
+		name string
+		help string
+		time time.Time
+	}{
+		{"mikrotik_monitor_config_last_reload_success_timestamp_seconds", "Time the config file was loaded successfully.", stats.lastReload},
+		{"mikrotik_monitor_config_last_reload_failure_timestamp_seconds", "Time the config file failed to load.", stats.lastReloadErr},
+	} {
+		if !reload.time.IsZero() {
+			w.metric(reload.name, reload.help, "gauge")
+			w.sample(reload.name, nil, float64(reload.time.Unix()))
+		}
+	}
+
+	w.metric("mikrotik_monitor_results_dropped_total", "Number of results dropped because a consumer was too slow.", "counter")
+	w.sample("mikrotik_monitor_results_dropped_total", nil, stats.dropped)
+	w.metric("mikrotik_monitor_info", "Version of the monitor.", "gauge")
+	w.sample("mikrotik_monitor_info", [][2]string{{"version", MonitorVersion}}, 1)
+}
+
+// MonitorHealth is the state of the monitor reported by the /healthz endpoint.
+type MonitorHealth struct {
+	Healthy    bool      `json:"healthy"`
+	Reason     string    `json:"reason,omitempty"`
+	Devices    int       `json:"devices"`
+	Reached    int       `json:"reached"`
+	LastPoll   time.Time `json:"last_poll"`
+	LastReload time.Time `json:"last_reload"`
+}
+
+// Health returns the state of the monitor itself, not of its devices. It is unhealthy if a running monitor hasn't finished a poll of all
+// devices within three intervals, e.g. because the scheduler hangs. Unreachable devices don't make it unhealthy.
+func (monitor *Monitor) Health() MonitorHealth {
+	devices := monitor.Devices()
+	monitor.mu.RLock()
+	running := monitor.stop != nil
+	started := monitor.started
+	monitor.mu.RUnlock()
+
+	monitor.stats.mu.Lock()
+	health := MonitorHealth{Healthy: true, Devices: len(devices), LastPoll: monitor.stats.lastCycle, LastReload: monitor.stats.lastReload}
+	monitor.stats.mu.Unlock()
+	for _, device := range devices {
+		if device.Reached {
+			health.Reached++
+		}
+	}
+
+	if running && monitor.Interval > 0 {
+		since := health.LastPoll
+		if since.IsZero() || since.Before(started) {
+			since = started
+		}
+		if overdue := time.Since(since); overdue > 3*monitor.Interval {
+			health.Healthy = false
+			health.Reason = "no poll finished for " + overdue.Round(time.Second).String()
+		}
+	}
+
+	return health
+}
+
+// healthHandler responds with the MonitorHealth of the monitor, with 503 Service Unavailable if it isn't healthy.
+func (monitor *Monitor) healthHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	health := monitor.Health()
+	status := http.StatusOK
+	if !health.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, health)
+}
@@ -0,0 +1,244 @@
+package MikrotikMonitor
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// MonitorVersion is the version of the monitor, set when building a release with
+// -ldflags "-X github.com/mcules/MikrotikMonitor.MonitorVersion=v1.2.3".
+var MonitorVersion = "dev"
+
+// UpdatePublicKey is the base64 encoded ed25519 public key the manifests of the release binaries are signed with, set
+// when building a release like MonitorVersion. Updates are refused without a key.
+var UpdatePublicKey = ""
+
+// DefaultUpdateRepository is the GitHub repository the releases of the monitor are published in.
+const DefaultUpdateRepository = "mcules/MikrotikMonitor"
+
+// Release is a release of the monitor. Binary, Manifest and Signature are the download URLs of the binary for the
+// platform of the running monitor, of its ReleaseManifest and of the detached ed25519 signature of the manifest,
+// they are empty if the release has none.
+type Release struct {
+	Version   string
+	URL       string
+	Published time.Time
+	Binary    string
+	Manifest  string
+	Signature string
+}
+
+// ReleaseManifest is the manifest of a release binary, published as JSON asset <asset>.manifest and signed as
+// <asset>.manifest.sig. The signature covers the version and the name of the asset along with the SHA-256 of the
+// binary, so a validly signed binary of another release or platform isn't installed.
+type ReleaseManifest struct {
+	Version string `json:"version"`
+	Asset   string `json:"asset"`
+	SHA256  string `json:"sha256"`
+}
+
+// Updater checks the GitHub releases of the monitor for a newer version and replaces the running binary with it,
+// so distributed probes can be kept current without copying binaries around. Binaries are only installed if the
+// signature of their manifest is valid for PublicKey.
+type Updater struct {
+	Repository string
+	PublicKey  ed25519.PublicKey
+	APIURL     string
+	Client     *http.Client
+}
+
+// NewUpdater returns an Updater for the releases of the repository, e.g. "mcules/MikrotikMonitor".
+// The public key is base64 encoded, an empty key allows checking for updates but not installing them.
+func NewUpdater(repository string, publicKey string) (*Updater, error) {
+	updater := &Updater{
+		Repository: repository,
+		APIURL:     "https://api.github.com",
+		Client:     &http.Client{Timeout: time.Minute},
+	}
+	if publicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid update public key, expected a base64 encoded ed25519 key")
+		}
+		updater.PublicKey = key
+	}
+
+	return updater, nil
+}
+
+// releaseAsset returns the name of the release binary for the platform, e.g. "mikrotikmonitor_linux_arm64".
+func releaseAsset() string {
+	name := "mikrotikmonitor_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+
+	return name
+}
+
+// Latest returns the newest published release of the repository.
+func (updater *Updater) Latest() (Release, error) {
+	var latest struct {
+		TagName     string    `json:"tag_name"`
+		HTMLURL     string    `json:"html_url"`
+		PublishedAt time.Time `json:"published_at"`
+		Assets      []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+
+	address := strings.TrimSuffix(updater.APIURL, "/") + "/repos/" + updater.Repository + "/releases/latest"
+	content, err := updater.get(address, 1<<20)
+	if err != nil {
+		return Release{}, err
+	}
+	if err := json.Unmarshal(content, &latest); err != nil {
+		return Release{}, fmt.Errorf("unable to read release of %s: %v", updater.Repository, err)
+	}
+
+	release := Release{Version: latest.TagName, URL: latest.HTMLURL, Published: latest.PublishedAt}
+	for _, asset := range latest.Assets {
+		switch asset.Name {
+		case releaseAsset():
+			release.Binary = asset.URL
+		case releaseAsset() + ".manifest":
+			release.Manifest = asset.URL
+		case releaseAsset() + ".manifest.sig":
+			release.Signature = asset.URL
+		}
+	}
+
+	return release, nil
+}
+
+// Check returns the newest release and whether it is newer than the running monitor.
+// Development builds without a version are never outdated.
+func (updater *Updater) Check() (Release, bool, error) {
+	release, err := updater.Latest()
+	if err != nil {
+		return release, false, err
+	}
+	if MonitorVersion == "dev" {
+		return release, false, nil
+	}
+
+	return release, CompareVersions(strings.TrimPrefix(release.Version, "v"), strings.TrimPrefix(MonitorVersion, "v")) > 0, nil
+}
+
+// Update downloads the binary of the release, verifies the signature of its manifest and that the manifest is the one
+// of the release, the asset of the platform and the binary, and replaces the executable at path with it.
+// The running process keeps the old binary until it is restarted.
+func (updater *Updater) Update(release Release, path string) error {
+	if len(updater.PublicKey) == 0 {
+		return errors.New("no update public key configured, refusing to install an unverified binary")
+	}
+	if release.Binary == "" || release.Manifest == "" || release.Signature == "" {
+		return fmt.Errorf("release %s has no signed binary %s", release.Version, releaseAsset())
+	}
+
+	content, err := updater.get(release.Manifest, 4096)
+	if err != nil {
+		return err
+	}
+	signature, err := updater.get(release.Signature, 4096)
+	if err != nil {
+		return err
+	}
+	// the signature is published either raw or base64 encoded
+	if len(signature) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature)))
+		if err != nil {
+			return fmt.Errorf("invalid signature of release %s: %v", release.Version, err)
+		}
+		signature = decoded
+	}
+	if !ed25519.Verify(updater.PublicKey, content, signature) {
+		return fmt.Errorf("invalid signature of release %s, binary not installed", release.Version)
+	}
+	var manifest ReleaseManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return fmt.Errorf("invalid manifest of release %s: %v", release.Version, err)
+	}
+	if manifest.Version != release.Version || manifest.Asset != releaseAsset() {
+		return fmt.Errorf("manifest of release %s is for %s %s, binary not installed", release.Version, manifest.Asset, manifest.Version)
+	}
+
+	binary, err := updater.get(release.Binary, 256<<20)
+	if err != nil {
+		return err
+	}
+	checksum := sha256.Sum256(binary)
+	if !strings.EqualFold(manifest.SHA256, hex.EncodeToString(checksum[:])) {
+		return fmt.Errorf("checksum of release %s doesn't match its manifest, binary not installed", release.Version)
+	}
+
+	// the new binary is written next to the old one, so it can be renamed over it atomically
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".update-")
+	if err != nil {
+		return fmt.Errorf("unable to install release %s: %v", release.Version, err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(binary); err != nil {
+		file.Close()
+		return fmt.Errorf("unable to install release %s: %v", release.Version, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("unable to install release %s: %v", release.Version, err)
+	}
+	if err := os.Chmod(file.Name(), 0755); err != nil {
+		return fmt.Errorf("unable to install release %s: %v", release.Version, err)
+	}
+	if runtime.GOOS == "windows" {
+		// a running executable can't be replaced on Windows, but it can be renamed
+		old := path + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return fmt.Errorf("unable to install release %s: %v", release.Version, err)
+		}
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("unable to install release %s: %v", release.Version, err)
+	}
+
+	return nil
+}
+
+// get downloads an address with at most limit bytes.
+func (updater *Updater) get(address string, limit int64) ([]byte, error) {
+	client := updater.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Minute}
+	}
+	response, err := client.Get(address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s: %v", address, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch %s: %s", address, response.Status)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(response.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s: %v", address, err)
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("unable to fetch %s: larger than %d bytes", address, limit)
+	}
+
+	return content, nil
+}
@@ -0,0 +1,154 @@
+package MikrotikMonitor
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdaterUpdate(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPrivate, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte("binary of v1.2.3")
+	checksum := sha256.Sum256(binary)
+	valid := ReleaseManifest{Version: "v1.2.3", Asset: releaseAsset(), SHA256: hex.EncodeToString(checksum[:])}
+
+	tests := []struct {
+		name     string
+		manifest func(manifest *ReleaseManifest)
+		// tamper modifies the manifest after it was signed
+		tamper    func(content []byte) []byte
+		signer    ed25519.PrivateKey
+		signature func(signature []byte) []byte
+		binary    []byte
+		err       string
+	}{
+		{name: "valid"},
+		{name: "raw signature", signature: func(signature []byte) []byte { return signature }},
+		{name: "signed manifest of another version", manifest: func(manifest *ReleaseManifest) { manifest.Version = "v1.0.0" },
+			err: "manifest of release v1.2.3 is for"},
+		{name: "signed manifest of another asset", manifest: func(manifest *ReleaseManifest) { manifest.Asset = "mikrotikmonitor_plan9_386" },
+			err: "manifest of release v1.2.3 is for"},
+		{name: "signed manifest of another binary", manifest: func(manifest *ReleaseManifest) { manifest.SHA256 = strings.Repeat("0", 64) },
+			err: "checksum of release v1.2.3 doesn't match"},
+		{name: "modified version", tamper: func(content []byte) []byte {
+			return []byte(strings.Replace(string(content), "v1.2.3", "v1.2.4", 1))
+		}, err: "invalid signature"},
+		{name: "modified asset", tamper: func(content []byte) []byte {
+			return []byte(strings.Replace(string(content), releaseAsset(), "mikrotikmonitor_plan9_386", 1))
+		}, err: "invalid signature"},
+		{name: "modified checksum", tamper: func(content []byte) []byte {
+			return []byte(strings.Replace(string(content), valid.SHA256, strings.Repeat("0", 64), 1))
+		}, err: "invalid signature"},
+		{name: "signature of another key", signer: otherPrivate, err: "invalid signature"},
+		{name: "modified signature", signature: func(signature []byte) []byte {
+			signature[0] ^= 1
+			return []byte(base64.StdEncoding.EncodeToString(signature))
+		}, err: "invalid signature"},
+		{name: "malformed signature", signature: func(signature []byte) []byte { return []byte("not base64!") },
+			err: "invalid signature"},
+		{name: "modified binary", binary: []byte("binary of v1.2.3 with a backdoor"),
+			err: "checksum of release v1.2.3 doesn't match"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manifest := valid
+			if test.manifest != nil {
+				test.manifest(&manifest)
+			}
+			content, err := json.Marshal(manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signer := private
+			if test.signer != nil {
+				signer = test.signer
+			}
+			signature := ed25519.Sign(signer, content)
+			if test.signature != nil {
+				signature = test.signature(signature)
+			} else {
+				signature = []byte(base64.StdEncoding.EncodeToString(signature))
+			}
+			if test.tamper != nil {
+				content = test.tamper(content)
+			}
+			served := binary
+			if test.binary != nil {
+				served = test.binary
+			}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/binary":
+					_, _ = w.Write(served)
+				case "/manifest":
+					_, _ = w.Write(content)
+				case "/signature":
+					_, _ = w.Write(signature)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			updater, err := NewUpdater("mcules/MikrotikMonitor", base64.StdEncoding.EncodeToString(public))
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "mikrotikmonitor")
+			if err := os.WriteFile(path, []byte("old binary"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			release := Release{Version: "v1.2.3", Binary: server.URL + "/binary", Manifest: server.URL + "/manifest",
+				Signature: server.URL + "/signature"}
+
+			err = updater.Update(release, path)
+			installed, readErr := os.ReadFile(path)
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if string(installed) != string(binary) {
+					t.Errorf("installed %q, want %q", installed, binary)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("error %v, want %q", err, test.err)
+			}
+			if string(installed) != "old binary" {
+				t.Errorf("installed %q despite the error", installed)
+			}
+		})
+	}
+}
+
+func TestUpdaterUpdateWithoutKey(t *testing.T) {
+	updater, err := NewUpdater("mcules/MikrotikMonitor", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = updater.Update(Release{Version: "v1.2.3", Binary: "http://127.0.0.1/binary", Manifest: "http://127.0.0.1/manifest",
+		Signature: "http://127.0.0.1/signature"}, filepath.Join(t.TempDir(), "mikrotikmonitor"))
+	if err == nil || !strings.Contains(err.Error(), "no update public key") {
+		t.Fatalf("error %v, want refusal without public key", err)
+	}
+}
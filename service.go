@@ -0,0 +1,211 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventService is the type of events raised when a service check fails or passes again, the subject is the name
+// of the check.
+const EventService = "Service"
+
+// Types of service checks.
+const (
+	ServiceTCP  = "tcp"
+	ServiceHTTP = "http"
+	ServiceDNS  = "dns"
+)
+
+// ServiceCheck is a synthetic check of a service behind the device run by the monitor host in every poll, like
+// netwatch on the device itself. Address is the host and port of a tcp check, the URL of an http check or the name
+// a dns check resolves, "{host}" is replaced by the host of the device.
+// An http check passes with Status, any status below 400 if zero. A dns check asks Server, the device on port 53
+// if empty, and passes if the name resolves, to the address Expect if set. Timeout defaults to 5s.
+// Service checks of the top-level service_checks block apply to all devices with the Tag and in the Group, empty matches all.
+type ServiceCheck struct {
+	Name     string        `json:"Name"`
+	Type     string        `json:"Type"`
+	Address  string        `json:"Address"`
+	Status   int           `json:"Status"`
+	Server   string        `json:"Server"`
+	Expect   string        `json:"Expect"`
+	Insecure bool          `json:"Insecure"`
+	Timeout  time.Duration `json:"Timeout"`
+	Tag      string        `json:"Tag"`
+	Group    string        `json:"Group"`
+}
+
+// ServiceState is the result of a service check in the last poll, Duration is the time the check took.
+type ServiceState struct {
+	Name     string        `json:"Name"`
+	Type     string        `json:"Type"`
+	Up       bool          `json:"Up"`
+	Duration time.Duration `json:"Duration"`
+	Error    string        `json:"Error,omitempty"`
+}
+
+// matches reports whether a service check of the top-level block applies to the device.
+func (check ServiceCheck) matches(device Device) bool {
+	return (check.Group == "" || check.Group == device.Group) && (check.Tag == "" || slices.Contains(device.Tags, check.Tag))
+}
+
+// validate returns the problems of a service check.
+func (check ServiceCheck) validate() []string {
+	var problems []string
+	if check.Name == "" {
+		problems = append(problems, "missing name of service check")
+	}
+	if check.Address == "" {
+		problems = append(problems, fmt.Sprintf("missing address of service check %s", check.Name))
+	}
+	switch check.Type {
+	case ServiceTCP, ServiceDNS:
+	case ServiceHTTP:
+		if !strings.HasPrefix(check.Address, "http://") && !strings.HasPrefix(check.Address, "https://") {
+			problems = append(problems, fmt.Sprintf("address %q of service check %s is no http or https URL", check.Address, check.Name))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown type %q of service check %s, use tcp, http or dns", check.Type, check.Name))
+	}
+
+	return problems
+}
+
+// CheckServices runs the service checks of the device concurrently and stores their results in ServiceStates.
+// The checks run independent of the reachability of the device, cancelling the context aborts them.
+func (device *Device) CheckServices(ctx context.Context) {
+	if len(device.Services) == 0 {
+		device.ServiceStates = nil
+		return
+	}
+
+	results := make([]ServiceState, len(device.Services))
+	var wg sync.WaitGroup
+	for i, check := range device.Services {
+		wg.Add(1)
+		go func(i int, check ServiceCheck) {
+			defer wg.Done()
+
+			timeout := check.Timeout
+			if timeout == 0 {
+				timeout = 5 * time.Second
+			}
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.run(checkCtx, device.Host)
+			results[i] = ServiceState{Name: check.Name, Type: check.Type, Up: err == nil, Duration: time.Since(start)}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, check)
+	}
+	wg.Wait()
+	device.ServiceStates = results
+}
+
+// run runs the check once, nil means the service passed.
+func (check ServiceCheck) run(ctx context.Context, host string) error {
+	address := strings.ReplaceAll(check.Address, "{host}", host)
+
+	switch check.Type {
+	case ServiceTCP:
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case ServiceHTTP:
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+		if err != nil {
+			return err
+		}
+		client := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: check.Insecure}, DisableKeepAlives: true},
+			// redirects are a status of their own, e.g. a captive portal redirecting all requests
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+		if check.Status != 0 && response.StatusCode != check.Status || check.Status == 0 && response.StatusCode >= 400 {
+			return fmt.Errorf("unexpected status %s", response.Status)
+		}
+		return nil
+
+	case ServiceDNS:
+		server := strings.ReplaceAll(check.Server, "{host}", host)
+		if server == "" {
+			server = host
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+		addresses, err := resolver.LookupHost(ctx, address)
+		if err != nil {
+			return err
+		}
+		if check.Expect != "" && !slices.Contains(addresses, check.Expect) {
+			return fmt.Errorf("%s resolves to %s instead of %s", address, strings.Join(addresses, ", "), check.Expect)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown type %q", check.Type)
+}
+
+// servicesDown returns the number of failed service checks, false if the device has none.
+func servicesDown(previous, current Device) (float64, bool) {
+	down := 0
+	for _, result := range current.ServiceStates {
+		if !result.Up {
+			down++
+		}
+	}
+
+	return float64(down), len(current.ServiceStates) > 0
+}
+
+// serviceChanges returns the events of service checks which failed or passed again since the previous poll.
+// A check failing in its first poll is reported as well.
+func serviceChanges(previous, current Device) []Event {
+	before := map[string]ServiceState{}
+	for _, result := range previous.ServiceStates {
+		before[result.Name] = result
+	}
+
+	var events []Event
+	for _, result := range current.ServiceStates {
+		old, found := before[result.Name]
+		switch {
+		case !result.Up && (!found || old.Up):
+			events = append(events, current.NewEvent(EventService, SeverityCritical, result.Name,
+				fmt.Sprintf("%s service check failed: %s", result.Type, result.Error)))
+		case result.Up && found && !old.Up:
+			event := current.NewEvent(EventService, SeverityCritical, result.Name, fmt.Sprintf("%s service check passes again", result.Type))
+			event.Resolved = true
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,143 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"log"
+	"sync"
+	"time"
+)
+
+// snmpSession is the SNMP client of a device kept open across polls, so SNMPv3 devices don't repeat the
+// engine discovery and time synchronization in every poll. mu is held by the poll using the session.
+type snmpSession struct {
+	mu     sync.Mutex
+	client *gosnmp.GoSNMP
+	key    string
+	idle   time.Duration
+	used   time.Time
+	closed bool
+}
+
+// sessionPool holds the open SNMP sessions by host. It is safe for concurrent use.
+type sessionPool struct {
+	mu       sync.Mutex
+	sessions map[string]*snmpSession
+}
+
+// snmpSessions returns the pool of the SNMP sessions of the devices of the monitor.
+func (monitor *Monitor) snmpSessions() *sessionPool {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	if monitor.sessions == nil {
+		monitor.sessions = &sessionPool{sessions: map[string]*snmpSession{}}
+	}
+
+	return monitor.sessions
+}
+
+// connectSNMP sets the SNMP client of the device to its open session in the pool of its monitor. A new session is
+// connected if there is none, the SNMP settings or the address changed, or the session was idle longer than IdleTimeout.
+// Devices polled without a monitor connect in every poll.
+// The returned function releases the session, failed closes it, so the next poll connects again.
+func (device *Device) connectSNMP() (release func(failed bool), err error) {
+	device.SNMPConfigure()
+	idle := device.SNMP.IdleTimeout
+	if idle == 0 {
+		idle = 5 * time.Minute
+	}
+	sessions := device.sessions
+	if idle < 0 || sessions == nil {
+		if err := device.snmp.Connect(); err != nil {
+			return nil, err
+		}
+		client := device.snmp
+		return func(bool) { closeSNMP(client) }, nil
+	}
+
+	session := sessions.session(device.Host)
+	session.mu.Lock()
+	for session.closed {
+		// the session was removed from the pool meanwhile
+		session.mu.Unlock()
+		session = sessions.session(device.Host)
+		session.mu.Lock()
+	}
+	key := fmt.Sprintf("%s %+v", device.address(), device.SNMP)
+	if session.client != nil && (session.key != key || time.Since(session.used) > session.idle) {
+		closeSNMP(session.client)
+		session.client = nil
+	}
+	if session.client == nil {
+		if err := device.snmp.Connect(); err != nil {
+			session.mu.Unlock()
+			return nil, err
+		}
+		session.client, session.key = device.snmp, key
+	} else {
+		session.client.Context, session.client.PreSend = device.snmp.Context, device.snmp.PreSend
+		device.snmp = session.client
+	}
+	session.idle = idle
+
+	return func(failed bool) {
+		if failed {
+			closeSNMP(session.client)
+			session.client = nil
+		}
+		session.used = time.Now()
+		session.mu.Unlock()
+	}, nil
+}
+
+// session returns the session of the host, sessions of other hosts idle longer than their timeout are closed,
+// e.g. of devices removed from the config.
+func (pool *sessionPool) session(host string) *snmpSession {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for other, session := range pool.sessions {
+		if other == host || !session.mu.TryLock() {
+			continue
+		}
+		if time.Since(session.used) > session.idle {
+			closeSNMP(session.client)
+			session.client, session.closed = nil, true
+			delete(pool.sessions, other)
+		}
+		session.mu.Unlock()
+	}
+
+	session, found := pool.sessions[host]
+	if !found {
+		session = &snmpSession{}
+		pool.sessions[host] = session
+	}
+
+	return session
+}
+
+// close closes the sessions of the pool.
+func (pool *sessionPool) close() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for host, session := range pool.sessions {
+		session.mu.Lock()
+		closeSNMP(session.client)
+		session.client, session.closed = nil, true
+		session.mu.Unlock()
+		delete(pool.sessions, host)
+	}
+}
+
+// closeSNMP closes the connection of an SNMP client.
+func closeSNMP(client *gosnmp.GoSNMP) {
+	if client == nil || client.Conn == nil {
+		return
+	}
+	if err := client.Conn.Close(); err != nil {
+		log.Printf("Error closing connection: %v\n", err)
+	}
+}
@@ -0,0 +1,87 @@
+package MikrotikMonitor
+
+import "time"
+
+// Subscriber session types.
+const (
+	SessionHotspot = "hotspot"
+	SessionPPPoE   = "pppoe"
+)
+
+// Sessions are the active subscriber sessions of a concentrator. With Details set, every session is listed in
+// Active, otherwise only the counts are kept, which matters for concentrators with thousands of subscribers.
+type Sessions struct {
+	Details bool      `json:"Details"`
+	Hotspot int       `json:"Hotspot"`
+	PPPoE   int       `json:"PPPoE"`
+	Active  []Session `json:"Active"`
+}
+
+// Session is an active Hotspot user or PPPoE session. Server is the Hotspot server or the PPPoE service name.
+type Session struct {
+	Type    string        `json:"Type"`
+	User    string        `json:"User"`
+	Address string        `json:"Address"`
+	MAC     string        `json:"MAC"`
+	Server  string        `json:"Server"`
+	Uptime  time.Duration `json:"Uptime"`
+}
+
+// GetSessions counts the active Hotspot users and PPPoE sessions of the device via the API.
+// Other PPP services like L2TP or SSTP aren't counted.
+func (device *Device) GetSessions() error {
+	hotspot, err := device.Print("/ip/hotspot/active")
+	if err != nil {
+		return err
+	}
+	ppp, err := device.Print("/ppp/active")
+	if err != nil {
+		return err
+	}
+
+	sessions := Sessions{Details: device.Sessions.Details}
+	for _, item := range hotspot {
+		sessions.Hotspot++
+		if sessions.Details {
+			sessions.Active = append(sessions.Active, Session{
+				Type:    SessionHotspot,
+				User:    item["user"],
+				Address: item["address"],
+				MAC:     item["mac-address"],
+				Server:  item["server"],
+				Uptime:  ParseRouterOSDuration(item["uptime"]),
+			})
+		}
+	}
+	for _, item := range ppp {
+		if item["service"] != SessionPPPoE {
+			continue
+		}
+		sessions.PPPoE++
+		if sessions.Details {
+			sessions.Active = append(sessions.Active, Session{
+				Type:    SessionPPPoE,
+				User:    item["name"],
+				Address: item["address"],
+				MAC:     item["caller-id"],
+				Server:  item["service-name"],
+				Uptime:  ParseRouterOSDuration(item["uptime"]),
+			})
+		}
+	}
+	device.Sessions = sessions
+
+	return nil
+}
+
+// sessionDrop is a rule metric with the share of the subscriber sessions lost since the previous poll in percent,
+// e.g. 50 if half of the sessions dropped at once. Devices without sessions have no value.
+func sessionDrop(previous, current Device) (float64, bool) {
+	before := previous.Sessions.Hotspot + previous.Sessions.PPPoE
+	after := current.Sessions.Hotspot + current.Sessions.PPPoE
+	if !previous.Reached || !current.Reached || before == 0 {
+		return 0, false
+	}
+
+	return max(0, float64(before-after)/float64(before)*100), true
+}
@@ -0,0 +1,248 @@
+package MikrotikMonitor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Silence suppresses the notifications of matching events, e.g. during planned upgrades.
+// Host, Site, Group, Tag and Type match the events, empty fields match all.
+// A silence is active between Start and End, a zero Start or End leaves that side open.
+// With Weekly, e.g. "sun 02:00", the silence is a recurring maintenance window of Duration instead.
+// Silenced events are still recorded in the event log, they are only not passed to the notifiers.
+type Silence struct {
+	ID       string
+	Host     string
+	Site     string
+	Group    string
+	Tag      string
+	Type     string
+	Start    time.Time
+	End      time.Time
+	Weekly   string
+	Duration time.Duration
+	Comment  string
+}
+
+// Matches reports whether the silence suppresses the event at the given time.
+func (silence Silence) Matches(event Event, now time.Time) bool {
+	if silence.Host != "" && silence.Host != event.Host || silence.Site != "" && silence.Site != event.Site ||
+		silence.Group != "" && silence.Group != event.Group || silence.Type != "" && silence.Type != event.Type {
+		return false
+	}
+	if silence.Tag != "" {
+		tagged := false
+		for _, tag := range event.Tags {
+			tagged = tagged || tag == silence.Tag
+		}
+		if !tagged {
+			return false
+		}
+	}
+
+	if silence.Weekly != "" {
+		start, err := silence.weeklyStart(now)
+		return err == nil && now.Sub(start) < silence.Duration
+	}
+
+	return (silence.Start.IsZero() || !now.Before(silence.Start)) && (silence.End.IsZero() || now.Before(silence.End))
+}
+
+// Expired reports whether a one-off silence has ended.
+func (silence Silence) Expired(now time.Time) bool {
+	return silence.Weekly == "" && !silence.End.IsZero() && !now.Before(silence.End)
+}
+
+// weeklyStart returns the latest start of the weekly maintenance window at or before now, in the local time zone.
+func (silence Silence) weeklyStart(now time.Time) (time.Time, error) {
+	fields := strings.Fields(strings.ToLower(silence.Weekly))
+	if len(fields) != 2 {
+		return time.Time{}, fmt.Errorf("weekly %q is not <weekday> <hh:mm>", silence.Weekly)
+	}
+	weekday, err := parseWeekday(fields[0])
+	if err != nil {
+		return time.Time{}, err
+	}
+	clock, err := time.Parse("15:04", fields[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", fields[1])
+	}
+
+	now = now.Local()
+	start := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+	start = start.AddDate(0, 0, -((int(now.Weekday()) - int(weekday) + 7) % 7))
+	if start.After(now) {
+		start = start.AddDate(0, 0, -7)
+	}
+
+	return start, nil
+}
+
+// parseWeekday parses a weekday, its name or an abbreviation of at least three letters, e.g. sun.
+func parseWeekday(name string) (time.Weekday, error) {
+	name = strings.ToLower(name)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.HasPrefix(strings.ToLower(day.String()), name) && len(name) >= 3 {
+			return day, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown weekday %q", name)
+}
+
+// validate checks the silence for errors.
+func (silence Silence) validate() error {
+	if silence.Weekly != "" {
+		if _, err := silence.weeklyStart(time.Now()); err != nil {
+			return err
+		}
+		if silence.Duration <= 0 {
+			return errors.New("missing duration of the weekly maintenance window")
+		}
+		return nil
+	}
+	if !silence.Start.IsZero() && !silence.End.IsZero() && !silence.Start.Before(silence.End) {
+		return errors.New("start is not before end")
+	}
+
+	return nil
+}
+
+// LoadSilences reads the maintenance block of the config file and validates it.
+// Silences from the config file get an ID from their position, so they keep it across reloads.
+func LoadSilences(filename string) ([]Silence, error) {
+	documents, err := readConfigDocuments(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadSilences(documents)
+}
+
+// loadSilences is LoadSilences with the parsed documents of the config files.
+func loadSilences(documents []configDocument) ([]Silence, error) {
+	var parser struct {
+		Maintenance []Silence `yaml:"maintenance"`
+	}
+
+	if err := decodeConfig(documents, &parser); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for i := range parser.Maintenance {
+		parser.Maintenance[i].ID = fmt.Sprintf("config-%d", i+1)
+		if err := parser.Maintenance[i].validate(); err != nil {
+			errs = append(errs, fmt.Errorf("maintenance %d: %v", i+1, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid maintenance windows in config file:\n%v", err)
+	}
+
+	return parser.Maintenance, nil
+}
+
+// Silences returns the silences from the config file and the ones added with AddSilence which haven't expired.
+func (monitor *Monitor) Silences() []Silence {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	now := time.Now()
+	kept := monitor.silences[:0]
+	for _, silence := range monitor.silences {
+		if !silence.Expired(now) {
+			kept = append(kept, silence)
+		}
+	}
+	monitor.silences = kept
+
+	return append(append([]Silence(nil), monitor.configSilences...), monitor.silences...)
+}
+
+// AddSilence adds a silence at runtime and returns it with its ID. Such silences are kept across reloads of the config file.
+func (monitor *Monitor) AddSilence(silence Silence) (Silence, error) {
+	if err := silence.validate(); err != nil {
+		return Silence{}, err
+	}
+	if silence.Start.IsZero() && silence.Weekly == "" {
+		silence.Start = time.Now()
+	}
+	silence.ID = newEventID(time.Now())
+
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+	monitor.silences = append(monitor.silences, silence)
+
+	return silence, nil
+}
+
+// RemoveSilence removes a silence added with AddSilence. Silences from the config file can't be removed.
+func (monitor *Monitor) RemoveSilence(id string) error {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	for i, silence := range monitor.silences {
+		if silence.ID == id {
+			monitor.silences = append(monitor.silences[:i], monitor.silences[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown silence %s", id)
+}
+
+// suppressed reports why the notification of an event is suppressed, or an empty string if it has to be delivered.
+// Events matching a silence are suppressed, as well as duplicates, which have the same state as the last delivered event
+// of the same host, type and subject within DedupWindow, and the state changes of flapping problems.
+// A problem flaps when it changed its state more than FlapThreshold times within FlapWindow,
+// its notifications are suppressed until it is stable again.
+func (monitor *Monitor) suppressed(event Event) string {
+	for _, silence := range monitor.Silences() {
+		if silence.Matches(event, event.Time) {
+			return "silenced by " + silence.ID
+		}
+	}
+
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	if monitor.delivered == nil {
+		monitor.delivered = map[[3]string]*deliveryState{}
+	}
+	key := [3]string{event.Host, event.Type, event.Subject}
+	state := monitor.delivered[key]
+	if state == nil {
+		state = &deliveryState{}
+		monitor.delivered[key] = state
+	}
+
+	if state.known && state.last.Resolved == event.Resolved && event.Time.Sub(state.last.Time) < monitor.DedupWindow {
+		return "duplicate"
+	}
+
+	changes := state.changes[:0]
+	for _, change := range state.changes {
+		if event.Time.Sub(change) < monitor.FlapWindow {
+			changes = append(changes, change)
+		}
+	}
+	state.changes = append(changes, event.Time)
+	if monitor.FlapThreshold > 0 && len(state.changes) > monitor.FlapThreshold {
+		return "flapping"
+	}
+
+	state.known = true
+	state.last = event
+
+	return ""
+}
+
+// deliveryState is the last delivered event of a host, type and subject and the times its state changed recently.
+type deliveryState struct {
+	known   bool
+	last    Event
+	changes []time.Time
+}
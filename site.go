@@ -0,0 +1,171 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Errors of requests of users limited to some sites: errAllSites for changes of devices, errSiteScope for other sites.
+var (
+	errAllSites  = errors.New("changing devices needs access to all sites")
+	errSiteScope = errors.New("site not accessible")
+)
+
+// SiteNotifier passes the events of the devices of the Sites to the Notifier and drops the others, e.g. to notify
+// each customer of a managed service provider of its own devices only.
+type SiteNotifier struct {
+	Sites    []string
+	Notifier Notifier
+}
+
+// Notify passes the event to the notifier if it is of one of the sites.
+func (notifier SiteNotifier) Notify(event Event) error {
+	if !slices.Contains(notifier.Sites, event.Site) {
+		return nil
+	}
+
+	return notifier.Notifier.Notify(event)
+}
+
+// SitePublisher publishes the results of the devices of the Sites with the Publisher and drops the others.
+type SitePublisher struct {
+	Sites     []string
+	Publisher Publisher
+}
+
+// Publish publishes the result if its device is of one of the sites.
+func (publisher SitePublisher) Publish(result DeviceResult) error {
+	if !slices.Contains(publisher.Sites, result.Device.Site) {
+		return nil
+	}
+
+	return publisher.Publisher.Publish(result)
+}
+
+// Close closes the publisher.
+func (publisher SitePublisher) Close() error {
+	return publisher.Publisher.Close()
+}
+
+// siteScope is the set of sites a request of the HTTP API may access, nil for all sites.
+type siteScope []string
+
+type siteScopeKey struct{}
+
+// withSites returns the request limited to the sites, unchanged if sites is nil.
+func withSites(r *http.Request, sites []string) *http.Request {
+	if sites == nil {
+		return r
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), siteScopeKey{}, siteScope(sites)))
+}
+
+// requestScope returns the sites the request may access.
+func requestScope(r *http.Request) siteScope {
+	scope, _ := r.Context().Value(siteScopeKey{}).(siteScope)
+	return scope
+}
+
+// all reports whether the scope includes all sites.
+func (scope siteScope) all() bool {
+	return scope == nil
+}
+
+// allows reports whether the scope includes the site.
+func (scope siteScope) allows(site string) bool {
+	return scope == nil || slices.Contains(scope, site)
+}
+
+// devices returns the devices of the sites of the scope.
+func (scope siteScope) devices(devices Devices) Devices {
+	return filterSites(scope, devices, func(device Device) string { return device.Site })
+}
+
+// silence returns a silence added by a request limited to the sites of the scope. A silence without a site gets the
+// site of the scope if it has a single one.
+func (scope siteScope) silence(silence Silence) (Silence, error) {
+	if scope.all() {
+		return silence, nil
+	}
+	if silence.Site == "" && len(scope) == 1 {
+		silence.Site = scope[0]
+	}
+	if !scope.allows(silence.Site) {
+		return Silence{}, errSiteScope
+	}
+
+	return silence, nil
+}
+
+// removeSilence removes a silence added with AddSilence if it is of the sites.
+func (monitor *Monitor) removeSilence(sites siteScope, id string) error {
+	if !sites.all() && !slices.ContainsFunc(monitor.Silences(), func(silence Silence) bool {
+		return silence.ID == id && sites.allows(silence.Site)
+	}) {
+		return fmt.Errorf("unknown silence %s", id)
+	}
+
+	return monitor.RemoveSilence(id)
+}
+
+// completeTask marks the task as done for the device or site if it is of the sites.
+func (monitor *Monitor) completeTask(sites siteScope, name string, scope string) error {
+	if !sites.all() && !slices.ContainsFunc(monitor.Tasks(), func(task TaskStatus) bool {
+		return task.Task == name && task.Scope == scope && sites.allows(task.Site)
+	}) {
+		return fmt.Errorf("unknown task %s for %s", name, scope)
+	}
+
+	return monitor.CompleteTask(name, scope)
+}
+
+// filterSites returns the items of the sites of the scope, site returns the site of an item.
+func filterSites[T any](scope siteScope, items []T, site func(T) string) []T {
+	if scope.all() {
+		return items
+	}
+	kept := []T{}
+	for _, item := range items {
+		if scope.allows(site(item)) {
+			kept = append(kept, item)
+		}
+	}
+
+	return kept
+}
+
+// sitesByHost returns the sites of the devices by their host.
+func sitesByHost(devices Devices) map[string]string {
+	sites := make(map[string]string, len(devices))
+	for _, device := range devices {
+		sites[device.Host] = device.Site
+	}
+
+	return sites
+}
+
+// historyKeySite returns the site of a key of the history, the site of the device of the key or the site of a per
+// site count of wireless clients. Keys of the whole fleet have no site.
+func historyKeySite(key string, sites map[string]string) string {
+	if site, found := strings.CutPrefix(key, HistoryWirelessClients+":"); found {
+		return site
+	}
+	_, host, _ := strings.Cut(key, ":")
+
+	return sites[host]
+}
+
+// scopeKeys returns the keys of the history of the sites of the scope.
+func (monitor *Monitor) scopeKeys(scope siteScope, keys []string) []string {
+	if scope.all() {
+		return keys
+	}
+	sites := sitesByHost(monitor.Devices())
+
+	return filterSites(scope, keys, func(key string) string { return historyKeySite(key, sites) })
+}
@@ -0,0 +1,243 @@
+package MikrotikMonitor
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SLAReport is the availability of the devices and their groups within a range of the history.
+type SLAReport struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Devices     []SLA     `json:"devices"`
+	Groups      []SLA     `json:"groups"`
+}
+
+// SLA is the availability of a device, or of all devices of a group. Monitored is the time covered by polls,
+// Availability the share of it the device was reachable in percent. Incidents are the outages, MTTR their mean
+// duration until the device was reachable again, outages still ongoing at the end of the range aren't part of it.
+type SLA struct {
+	Host         string        `json:"host,omitempty"`
+	Group        string        `json:"group"`
+	Monitored    time.Duration `json:"monitored"`
+	Downtime     time.Duration `json:"downtime"`
+	Availability float64       `json:"availability"`
+	Incidents    int           `json:"incidents"`
+	MTTR         time.Duration `json:"mttr"`
+	Outages      []Outage      `json:"outages,omitempty"`
+}
+
+// Outage is a time a device wasn't reachable, Ongoing if it still was at the end of the range.
+type Outage struct {
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"`
+	Ongoing  bool          `json:"ongoing,omitempty"`
+}
+
+// SLAReport returns the availability of the devices between from and to, computed from the up series of the history.
+// A poll counts until the next poll, gaps longer than three times the usual poll interval, e.g. while the monitor
+// was stopped, count as not monitored. The devices give the hosts and their groups, all hosts of the history without
+// group if devices is nil. A zero from or to leaves that side of the range open.
+func (history *History) SLAReport(devices Devices, from, to time.Time) SLAReport {
+	groups := map[string]string{}
+	if devices == nil {
+		for _, key := range history.Keys() {
+			if host, found := strings.CutPrefix(key, "up:"); found {
+				groups[host] = ""
+			}
+		}
+	}
+	for _, device := range devices {
+		groups[device.Host] = device.Group
+	}
+	hosts := make([]string, 0, len(groups))
+	for host := range groups {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	report := SLAReport{GeneratedAt: time.Now().UTC(), From: from, To: to}
+	byGroup := map[string]*SLA{}
+	repaired, resolved := map[string]time.Duration{}, map[string]int{}
+	for _, host := range hosts {
+		sla := deviceSLA(history.Get("up:"+host, from, to))
+		sla.Host, sla.Group = host, groups[host]
+		report.Devices = append(report.Devices, sla)
+
+		group := byGroup[sla.Group]
+		if group == nil {
+			group = &SLA{Group: sla.Group}
+			byGroup[sla.Group] = group
+		}
+		group.Monitored += sla.Monitored
+		group.Downtime += sla.Downtime
+		group.Incidents += sla.Incidents
+		for _, outage := range sla.Outages {
+			if !outage.Ongoing {
+				repaired[sla.Group] += outage.Duration
+				resolved[sla.Group]++
+			}
+		}
+	}
+	for name, group := range byGroup {
+		if resolved[name] > 0 {
+			group.MTTR = repaired[name] / time.Duration(resolved[name])
+		}
+		group.Availability = availability(group.Monitored, group.Downtime)
+		report.Groups = append(report.Groups, *group)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool { return report.Groups[i].Group < report.Groups[j].Group })
+
+	return report
+}
+
+// deviceSLA returns the availability of a device from the samples of its up series.
+func deviceSLA(samples []Sample) SLA {
+	var sla SLA
+	if len(samples) == 0 {
+		return sla
+	}
+
+	spacings := make([]time.Duration, 0, len(samples))
+	for i := 1; i < len(samples); i++ {
+		spacings = append(spacings, samples[i].Time.Sub(samples[i-1].Time))
+	}
+	slices.Sort(spacings)
+	var gap time.Duration
+	if len(spacings) > 0 {
+		gap = 3 * spacings[len(spacings)/2]
+	}
+
+	var outage *Outage
+	var repaired time.Duration
+	var resolved int
+	for i, sample := range samples {
+		covered := time.Duration(0)
+		if i+1 < len(samples) {
+			covered = min(samples[i+1].Time.Sub(sample.Time), gap)
+		}
+		sla.Monitored += covered
+
+		if sample.Value == 0 {
+			sla.Downtime += covered
+			if outage == nil {
+				outage = &Outage{Start: sample.Time}
+			}
+			outage.End = sample.Time.Add(covered)
+			continue
+		}
+		if outage != nil {
+			outage.End = sample.Time
+			outage.Duration = outage.End.Sub(outage.Start)
+			sla.Outages = append(sla.Outages, *outage)
+			repaired += outage.Duration
+			resolved++
+			outage = nil
+		}
+	}
+	if outage != nil {
+		outage.Duration, outage.Ongoing = outage.End.Sub(outage.Start), true
+		sla.Outages = append(sla.Outages, *outage)
+	}
+
+	sla.Incidents = len(sla.Outages)
+	if resolved > 0 {
+		sla.MTTR = repaired / time.Duration(resolved)
+	}
+	sla.Availability = availability(sla.Monitored, sla.Downtime)
+
+	return sla
+}
+
+// availability returns the share of the monitored time without downtime in percent, 100 if nothing was monitored.
+func availability(monitored, downtime time.Duration) float64 {
+	if monitored <= 0 {
+		return 100
+	}
+	return float64(monitored-downtime) / float64(monitored) * 100
+}
+
+// slaColumns are the columns of the CSV format of an SLAReport.
+var slaColumns = []string{"scope", "host", "group", "availability_percent", "monitored_seconds", "downtime_seconds", "incidents", "mttr_seconds"}
+
+// slaHTML is the template of the HTML format of an SLAReport.
+var slaHTML = template.Must(template.New("sla").Funcs(template.FuncMap{
+	"percent": func(value float64) string { return strconv.FormatFloat(value, 'f', 3, 64) + " %" },
+	"time": func(value time.Time) string {
+		if value.IsZero() {
+			return "open"
+		}
+		return value.Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Availability report</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:4px 8px;text-align:right}td:first-child,th:first-child{text-align:left}</style>
+</head>
+<body>
+<h1>Availability report</h1>
+<p>{{time .From}} to {{time .To}}, generated {{time .GeneratedAt}}</p>
+<h2>Groups</h2>
+<table>
+<tr><th>Group</th><th>Availability</th><th>Downtime</th><th>Incidents</th><th>MTTR</th></tr>
+{{range .Groups}}<tr><td>{{.Group}}</td><td>{{percent .Availability}}</td><td>{{.Downtime}}</td><td>{{.Incidents}}</td><td>{{.MTTR}}</td></tr>
+{{end}}</table>
+<h2>Devices</h2>
+<table>
+<tr><th>Host</th><th>Group</th><th>Availability</th><th>Downtime</th><th>Incidents</th><th>MTTR</th></tr>
+{{range .Devices}}<tr><td>{{.Host}}</td><td>{{.Group}}</td><td>{{percent .Availability}}</td><td>{{.Downtime}}</td><td>{{.Incidents}}</td><td>{{.MTTR}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// Write writes the report in the given format, json, csv or html. CSV has a row per device and per group,
+// durations in seconds.
+func (report SLAReport) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(slaColumns); err != nil {
+			return err
+		}
+		for _, scope := range []struct {
+			name string
+			slas []SLA
+		}{{"device", report.Devices}, {"group", report.Groups}} {
+			for _, sla := range scope.slas {
+				if err := writer.Write([]string{
+					scope.name, sla.Host, sla.Group,
+					strconv.FormatFloat(sla.Availability, 'f', -1, 64),
+					strconv.FormatFloat(sla.Monitored.Seconds(), 'f', -1, 64),
+					strconv.FormatFloat(sla.Downtime.Seconds(), 'f', -1, 64),
+					strconv.Itoa(sla.Incidents),
+					strconv.FormatFloat(sla.MTTR.Seconds(), 'f', -1, 64),
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "html":
+		return slaHTML.Execute(w, report)
+	default:
+		return fmt.Errorf("unknown report format %q", format)
+	}
+}
@@ -0,0 +1,223 @@
+package MikrotikMonitor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackendSSH reads the device information via SSH, for legacy devices with neither SNMP nor the API enabled.
+const BackendSSH = "ssh"
+
+// SSH are the settings of the SSH connections to a device. The host key of the device is verified against the
+// SHA256 fingerprint HostKey, as printed by ssh-keygen -l, or the KnownHosts file, one of them is required.
+// The SHA-1 algorithms ssh-rsa, diffie-hellman-group14-sha1 and hmac-sha1 are only offered with Legacy, for old
+// RouterOS v6 releases which lack SHA-2.
+type SSH struct {
+	User         string
+	Password     string
+	PasswordFile string `yaml:"password_file"`
+	KeyFile      string
+	Port         int
+	HostKey      string
+	KnownHosts   string `yaml:"known_hosts"`
+	Legacy       bool
+	Timeout      time.Duration
+}
+
+// usesSSH reports whether the commands of upgrades and exports run via SSH, for devices with the ssh backend and
+// devices with an ssh block but without an api block.
+func (device *Device) usesSSH() bool {
+	return device.Backend == BackendSSH || device.API.User == "" && device.SSH.User != ""
+}
+
+// Algorithms of the SSH connections, in order of preference. The legacy ones are added with Legacy of the ssh block.
+var (
+	sshKeyExchanges           = []string{"curve25519-sha256", "curve25519-sha256@libssh.org", "ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521", "diffie-hellman-group14-sha256"}
+	sshHostKeyAlgorithms      = []string{ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256}
+	sshMACs                   = []string{"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com", "hmac-sha2-256", "hmac-sha2-512"}
+	sshRSASignatures          = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256}
+	sshLegacyKeyExchanges     = []string{"diffie-hellman-group14-sha1"}
+	sshLegacyHostKeyAlgorithm = ssh.KeyAlgoRSA
+	sshLegacyMAC              = "hmac-sha1"
+)
+
+// sshInfoCommand prints the device information read by getDeviceSSH as key=value lines.
+// It only reads values, so a user of the read group is sufficient.
+var sshInfoCommand = strings.Join([]string{
+	`:put ("name=" . [/system identity get name])`,
+	`:put ("board-name=" . [/system resource get board-name])`,
+	`:put ("uptime=" . [/system resource get uptime])`,
+	`:put ("version=" . [/system resource get version])`,
+	`:put ("current-firmware=" . [/system routerboard get current-firmware])`,
+	`:put ("upgrade-firmware=" . [/system routerboard get upgrade-firmware])`,
+	`:do {:put ("serial-number=" . [/system routerboard get serial-number])} on-error={}`,
+	`:do {:put ("software-id=" . [/system license get software-id])} on-error={}`,
+	`:put ("channel=" . [/system package update get channel])`,
+	`:put ("latest-version=" . [/system package update get latest-version])`,
+}, "; ")
+
+// RunSSH logs in to the device via SSH and returns the output of the command.
+// It authenticates with the key file if one is configured, otherwise with the password.
+// The host key of the device has to match the host key or the known hosts file of the ssh block.
+func (device *Device) RunSSH(command string) (string, error) {
+	timeout := device.SSH.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	port := device.SSH.Port
+	if port == 0 {
+		port = 22
+	}
+	config, err := device.sshConfig(timeout)
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(device.address(), strconv.Itoa(port)), timeout)
+	if err != nil {
+		return "", fmt.Errorf("%s %w via SSH: %w", device.Host, ErrConnect, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(device.deadline(timeout))
+
+	// the known hosts are looked up by the configured host, not the address it resolved to
+	host := device.Host
+	if device.Address != "" {
+		host = device.Address
+	}
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, net.JoinHostPort(unbracket(host), strconv.Itoa(port)), config)
+	if err != nil {
+		return "", fmt.Errorf("%s SSH login failed: %v", device.Host, err)
+	}
+	client := ssh.NewClient(clientConn, channels, requests)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("%s SSH command failed: %v", device.Host, err)
+	}
+	defer session.Close()
+	var output bytes.Buffer
+	session.Stdout = &output
+	if err := session.Run(command); err != nil {
+		// the exit status doesn't matter for the output, RouterOS doesn't always send it
+		var exit *ssh.ExitError
+		var missing *ssh.ExitMissingError
+		if !errors.As(err, &exit) && !errors.As(err, &missing) {
+			return "", fmt.Errorf("%s SSH command failed: %v", device.Host, err)
+		}
+	}
+
+	return output.String(), nil
+}
+
+// sshConfig returns the client config of the ssh block of the device, which verifies the host key and authenticates
+// with the key file or the password.
+func (device *Device) sshConfig(timeout time.Duration) (*ssh.ClientConfig, error) {
+	config := &ssh.ClientConfig{
+		Config: ssh.Config{
+			KeyExchanges: slices.Clone(sshKeyExchanges),
+			MACs:         slices.Clone(sshMACs),
+		},
+		User:              device.SSH.User,
+		HostKeyAlgorithms: slices.Clone(sshHostKeyAlgorithms),
+		Timeout:           timeout,
+	}
+	signatures := slices.Clone(sshRSASignatures)
+	if device.SSH.Legacy {
+		config.KeyExchanges = append(config.KeyExchanges, sshLegacyKeyExchanges...)
+		config.HostKeyAlgorithms = append(config.HostKeyAlgorithms, sshLegacyHostKeyAlgorithm)
+		config.MACs = append(config.MACs, sshLegacyMAC)
+		signatures = append(signatures, ssh.KeyAlgoRSA)
+	}
+
+	switch {
+	case device.SSH.HostKey != "":
+		config.HostKeyCallback = func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			if fingerprint := ssh.FingerprintSHA256(key); fingerprint != device.SSH.HostKey {
+				return fmt.Errorf("host key %s doesn't match the configured fingerprint", fingerprint)
+			}
+			return nil
+		}
+	case device.SSH.KnownHosts != "":
+		callback, err := knownhosts.New(device.SSH.KnownHosts)
+		if err != nil {
+			return nil, fmt.Errorf("%s unable to read SSH known hosts: %v", device.Host, err)
+		}
+		config.HostKeyCallback = callback
+	default:
+		return nil, fmt.Errorf("%s has no SSH hostkey or known_hosts to verify the device", device.Host)
+	}
+
+	if device.SSH.KeyFile == "" {
+		config.Auth = []ssh.AuthMethod{ssh.Password(device.SSH.Password)}
+		return config, nil
+	}
+	data, err := os.ReadFile(device.SSH.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s unable to read SSH key: %v", device.Host, err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s unable to parse SSH key %s: %v", device.Host, device.SSH.KeyFile, err)
+	}
+	// RSA keys sign with SHA-2 unless the device needs the legacy algorithms
+	if rsaSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		if signer, err = ssh.NewSignerWithAlgorithms(rsaSigner, signatures); err != nil {
+			return nil, err
+		}
+	}
+	config.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+
+	return config, nil
+}
+
+// getDeviceSSH reads the device information with read-only commands via SSH instead of SNMP.
+// It populates the same fields as the SNMP request of GetDevice.
+func (device *Device) getDeviceSSH() error {
+	start := time.Now()
+	output, err := device.RunSSH(sshInfoCommand)
+	device.Latency.SNMP = time.Since(start)
+	if err != nil {
+		if err := device.Probe(); err != nil {
+			log.Println(err.Error())
+		}
+		return err
+	}
+
+	values := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		if key, value, found := strings.Cut(strings.TrimSpace(line), "="); found {
+			values[key] = value
+		}
+	}
+	if values["name"] == "" && values["board-name"] == "" {
+		return fmt.Errorf("%s unexpected SSH output: %q", device.Host, output)
+	}
+
+	device.Reached = true
+	device.Name = values["name"]
+	device.Model = values["board-name"]
+	device.Uptime = ParseRouterOSDuration(values["uptime"])
+	if fields := strings.Fields(values["version"]); len(fields) > 0 {
+		device.Version.RouterOS = fields[0]
+	}
+	device.Version.Bootloader = values["current-firmware"]
+	device.Version.Latest = values["upgrade-firmware"]
+	device.SerialNumber = values["serial-number"]
+	device.SoftwareID = values["software-id"]
+	device.UpdateChannel = values["channel"]
+	device.Version.LatestRelease = values["latest-version"]
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package MikrotikMonitor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// monitorState is the content of the state file of a monitor.
+type monitorState struct {
+	Saved   time.Time                  `json:"saved"`
+	Devices []storedDevice             `json:"devices"`
+	Rules   []Rule                     `json:"rules"`
+	Alerts  map[string]storedRuleState `json:"alerts"`
+}
+
+// storedDevice is the last state of a device with the fingerprint of its config.
+type storedDevice struct {
+	Config string          `json:"config"`
+	Device json.RawMessage `json:"device"`
+}
+
+// configFingerprint returns a hash of the config of a device, which changes with any of its settings.
+// Credentials are part of the config, so only the hash is stored.
+func configFingerprint(config Device) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%+v", config)))
+	return hex.EncodeToString(sum[:])
+}
+
+// SaveState writes the last state of the devices and the states of the rules to the StateFile, so a restarted monitor
+// continues where it stopped, see Start. The file is replaced atomically. Credentials aren't written.
+func (monitor *Monitor) SaveState() error {
+	if monitor.StateFile == "" {
+		return nil
+	}
+
+	state := monitorState{Saved: time.Now()}
+	monitor.mu.RLock()
+	for _, device := range monitor.devices {
+		config, found := monitor.configs[device.Host]
+		if !found || device.LastPolled.IsZero() {
+			continue
+		}
+		encoded, err := json.Marshal(device)
+		if err != nil {
+			monitor.mu.RUnlock()
+			return err
+		}
+		state.Devices = append(state.Devices, storedDevice{Config: configFingerprint(config), Device: encoded})
+	}
+	monitor.mu.RUnlock()
+	if monitor.Rules != nil {
+		state.Rules, state.Alerts = monitor.Rules.snapshot()
+	}
+
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(monitor.StateFile), filepath.Base(monitor.StateFile)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(content); err != nil {
+		_ = temp.Close()
+		_ = os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), monitor.StateFile)
+}
+
+// restoreState sets the devices, the rate baselines of their counters and the states of the rules to the ones of the
+// StateFile. Devices whose config changed since are polled from scratch, like after a reload. A missing file is no error.
+func (monitor *Monitor) restoreState() error {
+	if monitor.StateFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(monitor.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state monitorState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return fmt.Errorf("unable to parse state file %s: %v", monitor.StateFile, err)
+	}
+
+	var restored []Device
+	monitor.mu.Lock()
+	for _, stored := range state.Devices {
+		var host struct{ Host string }
+		if err := json.Unmarshal(stored.Device, &host); err != nil {
+			continue
+		}
+		config, found := monitor.configs[host.Host]
+		if !found || configFingerprint(config) != stored.Config {
+			continue
+		}
+		// the settings which aren't stored, e.g. the credentials, are kept from the config
+		device := config
+		if err := json.Unmarshal(stored.Device, &device); err != nil {
+			continue
+		}
+		*monitor.device(device.Host) = device
+		restored = append(restored, device)
+	}
+	monitor.mu.Unlock()
+
+	for _, device := range restored {
+		if device.Reached && monitor.Rates != nil {
+			monitor.Rates.seed(device, device.LastPolled)
+		}
+	}
+	if monitor.Rules != nil {
+		monitor.Rules.restore(state.Rules, state.Alerts)
+	}
+	log.Printf("state of %d devices restored from %s, saved %s", len(restored), monitor.StateFile, state.Saved.Format(time.RFC3339))
+
+	return nil
+}
+
+// saveState saves the state and logs errors.
+func (monitor *Monitor) saveState() {
+	if err := monitor.SaveState(); err != nil {
+		log.Printf("unable to save state, %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Storage types.
+const (
+	StorageRAM   = "ram"
+	StorageDisk  = "disk"
+	StorageOther = "other"
+)
+
+// OIDs of the hrStorage table of the HOST-RESOURCES MIB.
+const (
+	oidStorageType  = ".1.3.6.1.2.1.25.2.3.1.2"
+	oidStorageDescr = ".1.3.6.1.2.1.25.2.3.1.3"
+	oidStorageUnits = ".1.3.6.1.2.1.25.2.3.1.4"
+	oidStorageSize  = ".1.3.6.1.2.1.25.2.3.1.5"
+	oidStorageUsed  = ".1.3.6.1.2.1.25.2.3.1.6"
+
+	oidStorageTypeRAM       = ".1.3.6.1.2.1.25.2.1.2"
+	oidStorageTypeFixedDisk = ".1.3.6.1.2.1.25.2.1.4"
+	oidStorageTypeFlash     = ".1.3.6.1.2.1.25.2.1.9"
+)
+
+// Storage is a memory or a disk of the device, e.g. "main memory" or "system disk". Total and Used are in bytes.
+type Storage struct {
+	Index int    `json:"Index"`
+	Name  string `json:"Name"`
+	Type  string `json:"Type"`
+	Total uint64 `json:"Total"`
+	Used  uint64 `json:"Used"`
+}
+
+// UsedPercent returns the used share of the storage in percent, zero if its size is unknown.
+func (storage Storage) UsedPercent() float64 {
+	if storage.Total == 0 {
+		return 0
+	}
+
+	return float64(storage.Used) / float64(storage.Total) * 100
+}
+
+// GetStorage reads the memory and disk usage of the device, so devices whose flash fills up with logs or supout
+// files are noticed before an upgrade fails. Via SNMP it walks the hrStorage table, other backends read /system/resource.
+func (device *Device) GetStorage() error {
+	if !usesSNMP(device) {
+		return device.getStorageAPI()
+	}
+
+	storages := map[int]*Storage{}
+	units := map[int]uint64{}
+	sizes := map[int]uint64{}
+	used := map[int]uint64{}
+	columns := []struct {
+		oid string
+		set func(index int, variable gosnmp.SnmpPDU)
+	}{
+		{oidStorageType, func(index int, variable gosnmp.SnmpPDU) {
+			value, _ := AsOID(variable)
+			switch value {
+			case oidStorageTypeRAM:
+				storages[index].Type = StorageRAM
+			case oidStorageTypeFixedDisk, oidStorageTypeFlash:
+				storages[index].Type = StorageDisk
+			default:
+				storages[index].Type = StorageOther
+			}
+		}},
+		{oidStorageDescr, func(index int, variable gosnmp.SnmpPDU) {
+			storages[index].Name, _ = AsString(variable)
+		}},
+		{oidStorageUnits, func(index int, variable gosnmp.SnmpPDU) {
+			units[index], _ = AsCounter64(variable)
+		}},
+		{oidStorageSize, func(index int, variable gosnmp.SnmpPDU) {
+			sizes[index], _ = AsCounter64(variable)
+		}},
+		{oidStorageUsed, func(index int, variable gosnmp.SnmpPDU) {
+			used[index], _ = AsCounter64(variable)
+		}},
+	}
+
+	for _, column := range columns {
+		err := device.snmp.BulkWalk(column.oid, func(variable gosnmp.SnmpPDU) error {
+			index, err := strconv.Atoi(strings.TrimPrefix(variable.Name, column.oid+"."))
+			if err != nil {
+				return nil
+			}
+			if storages[index] == nil {
+				storages[index] = &Storage{Index: index}
+			}
+			column.set(index, variable)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s unable to read storage table: %v", device.Host, err)
+		}
+	}
+
+	device.Storage = make([]Storage, 0, len(storages))
+	for index, storage := range storages {
+		// sizes are reported in allocation units, e.g. 1024 bytes
+		storage.Total = sizes[index] * units[index]
+		storage.Used = used[index] * units[index]
+		device.Storage = append(device.Storage, *storage)
+	}
+	sort.Slice(device.Storage, func(i, j int) bool {
+		return device.Storage[i].Index < device.Storage[j].Index
+	})
+
+	return nil
+}
+
+// getStorageAPI reads the memory and the system disk from /system/resource via the REST API or the binary API.
+func (device *Device) getStorageAPI() error {
+	resource, err := device.printOne("/system/resource")
+	if err != nil {
+		return err
+	}
+
+	device.Storage = nil
+	for i, storage := range []struct {
+		name  string
+		kind  string
+		total string
+		free  string
+	}{
+		{"main memory", StorageRAM, "total-memory", "free-memory"},
+		{"system disk", StorageDisk, "total-hdd-space", "free-hdd-space"},
+	} {
+		total, err := strconv.ParseUint(resource[storage.total], 10, 64)
+		if err != nil {
+			continue
+		}
+		free, _ := strconv.ParseUint(resource[storage.free], 10, 64)
+		device.Storage = append(device.Storage, Storage{Index: i + 1, Name: storage.name, Type: storage.kind, Total: total, Used: total - min(free, total)})
+	}
+
+	return nil
+}
+
+// storageMetric returns a rule metric with the highest usage in percent of the storages of a type.
+// Devices without such a storage have no value.
+func storageMetric(storageType string) func(previous, current Device) (float64, bool) {
+	return func(previous, current Device) (float64, bool) {
+		result, found := 0.0, false
+		for _, storage := range current.Storage {
+			if storage.Type == storageType && storage.Total > 0 {
+				result, found = max(result, storage.UsedPercent()), true
+			}
+		}
+		return result, current.Reached && found
+	}
+}
@@ -0,0 +1,104 @@
+package MikrotikMonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// StreamBuffer is the number of messages the stream of a client holds, a client falling further behind misses messages.
+var StreamBuffer = 256
+
+// streamMessage is a message of the live stream, the state of a polled device or an event.
+type streamMessage struct {
+	kind string
+	host string
+	site string
+	data []byte
+}
+
+// subscribe returns a channel which receives the messages of the live stream and a function to unsubscribe.
+func (monitor *Monitor) subscribe() (<-chan streamMessage, func()) {
+	messages := make(chan streamMessage, StreamBuffer)
+
+	monitor.mu.Lock()
+	if monitor.streams == nil {
+		monitor.streams = map[chan streamMessage]struct{}{}
+	}
+	monitor.streams[messages] = struct{}{}
+	monitor.mu.Unlock()
+
+	return messages, func() {
+		monitor.mu.Lock()
+		delete(monitor.streams, messages)
+		monitor.mu.Unlock()
+	}
+}
+
+// broadcast sends a message to the subscribers of the live stream without waiting for them.
+func (monitor *Monitor) broadcast(kind string, host string, site string, value any) {
+	monitor.mu.RLock()
+	defer monitor.mu.RUnlock()
+
+	if len(monitor.streams) == 0 {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("unable to encode %s of %s for the stream, %v", kind, host, err)
+		return
+	}
+	for messages := range monitor.streams {
+		select {
+		case messages <- streamMessage{kind: kind, host: host, site: site, data: data}:
+		default:
+		}
+	}
+}
+
+// streamHandler serves the live stream as Server-Sent Events: a device event with the device as JSON after every
+// poll of a device and an event event for every event. ?host=10.0.0.1 limits the stream to a device.
+// A comment is sent every 30 seconds to keep the connection open through proxies.
+func (monitor *Monitor) streamHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	messages, unsubscribe := monitor.subscribe()
+	defer unsubscribe()
+	host := r.URL.Query().Get("host")
+	scope := requestScope(r)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			_, _ = fmt.Fprint(w, ": keepalive\n\n")
+		case message := <-messages:
+			if host != "" && message.host != host || !scope.allows(message.site) {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", message.kind, message.data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
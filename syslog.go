@@ -0,0 +1,363 @@
+package MikrotikMonitor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventSyslog is the type of events raised by SyslogRules, the subject is the name of the rule.
+const EventSyslog = "Syslog"
+
+// MaxSyslogEntries is the number of recent syslog entries a Monitor keeps for SyslogEntries.
+var MaxSyslogEntries = 1000
+
+// syslogSeverities are the names of the syslog severities, indexed by their code.
+var syslogSeverities = []string{"emergency", "alert", "critical", "error", "warning", "notice", "info", "debug"}
+
+// DefaultSyslogRules are the syslog rules of a config file without syslog_rules block: failed logins and OSPF
+// neighbors leaving the Full state, resolved once the neighbor is Full again.
+var DefaultSyslogRules = []SyslogRule{
+	{Name: "login-failure", Pattern: `login failure for user`, Severity: SeverityWarning},
+	{Name: "ospf-neighbor-down", Topic: "ospf", Pattern: `(?i)\bFull\s*(to|->)`, Resolve: `(?i)(to|->)\s*Full\b`, Severity: SeverityCritical},
+}
+
+// SyslogEntry is a log message of a device received by the SyslogListener. Topics are the RouterOS topics of the
+// message, e.g. system, error and critical, Severity the syslog severity of the message, e.g. error.
+type SyslogEntry struct {
+	Host     string
+	Time     time.Time
+	Severity string
+	Topics   []string
+	Message  string
+}
+
+// SyslogRule raises an event for log messages of the devices, defined in the syslog_rules block of the config file.
+// A message matches if it has the Topic, any topic if empty, and matches the regular expression Pattern.
+// Messages matching Resolve resolve the event of the rule, e.g. an OSPF neighbor which is Full again.
+type SyslogRule struct {
+	Name     string
+	Topic    string
+	Pattern  string
+	Resolve  string
+	Severity string
+
+	pattern *regexp.Regexp
+	resolve *regexp.Regexp
+}
+
+// LoadSyslogRules reads the syslog_rules block of the config file and validates it.
+// A config file without syslog_rules block returns the DefaultSyslogRules, an empty block no rules.
+func LoadSyslogRules(filename string) ([]SyslogRule, error) {
+	documents, err := readConfigDocuments(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadSyslogRules(documents)
+}
+
+// loadSyslogRules is LoadSyslogRules with the parsed documents of the config files.
+func loadSyslogRules(documents []configDocument) ([]SyslogRule, error) {
+	var parser struct {
+		Rules *[]SyslogRule `yaml:"syslog_rules"`
+	}
+
+	if err := decodeConfig(documents, &parser); err != nil {
+		return nil, err
+	}
+	rules := slices.Clone(DefaultSyslogRules)
+	if parser.Rules != nil {
+		rules = *parser.Rules
+	}
+
+	var errs []error
+	names := map[string]bool{}
+	for i := range rules {
+		rule := &rules[i]
+		fail := func(format string, a ...any) {
+			errs = append(errs, fmt.Errorf("syslog rule %d %s: %s", i+1, rule.Name, fmt.Sprintf(format, a...)))
+		}
+
+		if rule.Name == "" {
+			fail("missing name")
+		} else if names[rule.Name] {
+			fail("duplicate name")
+		}
+		names[rule.Name] = true
+
+		var err error
+		if rule.Pattern == "" {
+			fail("missing pattern")
+		} else if rule.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+			fail("invalid pattern: %v", err)
+		}
+		if rule.Resolve != "" {
+			if rule.resolve, err = regexp.Compile(rule.Resolve); err != nil {
+				fail("invalid resolve pattern: %v", err)
+			}
+		}
+		switch rule.Severity {
+		case "":
+			rule.Severity = SeverityWarning
+		case SeverityInfo, SeverityWarning, SeverityCritical:
+		default:
+			fail("unknown severity %q", rule.Severity)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid syslog rules in config file:\n%v", err)
+	}
+
+	return rules, nil
+}
+
+// ParseSyslog parses a syslog message as sent by the remote logging of RouterOS, with or without the BSD syslog
+// header, or in the RFC 5424 format. The topics are taken from the start of the message, e.g. "system,info,account".
+// Messages without timestamp get the current time, the Host of the entry is left empty.
+func ParseSyslog(message string) SyslogEntry {
+	entry := SyslogEntry{Time: time.Now(), Severity: "notice"}
+	text := strings.TrimRight(message, "\r\n\x00")
+
+	if strings.HasPrefix(text, "<") {
+		if end := strings.IndexByte(text, '>'); end > 0 {
+			if priority, err := strconv.Atoi(text[1:end]); err == nil {
+				entry.Severity = syslogSeverities[priority%8]
+				text = text[end+1:]
+			}
+		}
+	}
+
+	if rest, found := strings.CutPrefix(text, "1 "); found {
+		// RFC 5424: VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+		fields := strings.SplitN(rest, " ", 6)
+		if len(fields) == 6 {
+			if timestamp, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+				entry.Time = timestamp
+			}
+			text = fields[5]
+			if strings.HasPrefix(text, "-") {
+				text = strings.TrimPrefix(text[1:], " ")
+			} else if end := strings.Index(text, "] "); strings.HasPrefix(text, "[") && end > 0 {
+				text = text[end+2:]
+			}
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+	} else if len(text) > 16 && text[15] == ' ' {
+		// BSD syslog: Mmm dd hh:mm:ss HOSTNAME MSG
+		if timestamp, err := time.ParseInLocation(time.Stamp, text[:15], time.Local); err == nil {
+			now := time.Now()
+			entry.Time = timestamp.AddDate(now.Year(), 0, 0)
+			if entry.Time.After(now.Add(24 * time.Hour)) {
+				entry.Time = entry.Time.AddDate(-1, 0, 0)
+			}
+			if _, rest, found := strings.Cut(text[16:], " "); found {
+				text = rest
+			}
+		}
+	}
+
+	text = strings.TrimSpace(text)
+	if first, rest, found := strings.Cut(text, " "); found && syslogTopics.MatchString(first) {
+		entry.Topics = strings.Split(first, ",")
+		text = rest
+	}
+	entry.Message = text
+
+	return entry
+}
+
+var syslogTopics = regexp.MustCompile(`^[a-z0-9-]+(,[a-z0-9-]+)+$`)
+
+// SyslogListener receives the remote logging of the devices of a Monitor via UDP and TCP.
+// The sender of a message is identified by its source address, which has to be the address of a configured host,
+// messages of unknown senders are logged and dropped. The entries are kept by the monitor, see SyslogEntries,
+// and matched against the syslog rules of the config file, which raise Syslog events.
+type SyslogListener struct {
+	Monitor *Monitor
+
+	mu       sync.Mutex
+	resolver hostResolver
+	conn     net.PacketConn
+	listener net.Listener
+}
+
+// NewSyslogListener returns a SyslogListener which passes the log messages of the devices of the monitor on.
+func NewSyslogListener(monitor *Monitor) *SyslogListener {
+	return &SyslogListener{Monitor: monitor}
+}
+
+// ListenUDP receives messages on the UDP address, e.g. ":514", and blocks until Close is called.
+func (listener *SyslogListener) ListenUDP(address string) error {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return err
+	}
+	listener.mu.Lock()
+	listener.conn = conn
+	listener.mu.Unlock()
+
+	buffer := make([]byte, 65536)
+	for {
+		n, sender, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		listener.handle(sender.(*net.UDPAddr).IP, string(buffer[:n]))
+	}
+}
+
+// ListenTCP receives messages on the TCP address, e.g. ":514", and blocks until Close is called.
+// Messages are separated by newlines or framed by octet counting.
+func (listener *SyslogListener) ListenTCP(address string) error {
+	tcp, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	listener.mu.Lock()
+	listener.listener = tcp
+	listener.mu.Unlock()
+
+	for {
+		conn, err := tcp.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go listener.serve(conn)
+	}
+}
+
+// Close stops the listener.
+func (listener *SyslogListener) Close() {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+
+	if listener.conn != nil {
+		_ = listener.conn.Close()
+	}
+	if listener.listener != nil {
+		_ = listener.listener.Close()
+	}
+}
+
+// serve reads the messages of a TCP connection until it is closed.
+func (listener *SyslogListener) serve(conn net.Conn) {
+	defer conn.Close()
+
+	ip := conn.RemoteAddr().(*net.TCPAddr).IP
+	reader := bufio.NewReader(conn)
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return
+		}
+		var message string
+		if first[0] >= '1' && first[0] <= '9' {
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			size, err := strconv.Atoi(strings.TrimSpace(length))
+			if err != nil || size > 65536 {
+				log.Printf("%s invalid syslog frame, connection closed", ip)
+				return
+			}
+			content := make([]byte, size)
+			if _, err := io.ReadFull(reader, content); err != nil {
+				return
+			}
+			message = string(content)
+		} else if message, err = reader.ReadString('\n'); err != nil && message == "" {
+			return
+		}
+		if strings.TrimSpace(message) != "" {
+			listener.handle(ip, message)
+		}
+	}
+}
+
+// handle attaches a message to the device which sent it and notifies the monitor with the events of matching rules.
+func (listener *SyslogListener) handle(ip net.IP, message string) {
+	listener.mu.Lock()
+	device, found := listener.resolver.device(listener.Monitor.Devices(), ip)
+	listener.mu.Unlock()
+	if !found {
+		log.Printf("%s syslog message from unknown device dropped", ip)
+		return
+	}
+
+	entry := ParseSyslog(message)
+	entry.Host = device.Host
+	listener.Monitor.addSyslog(entry)
+	listener.Monitor.Notify(device.SyslogEvents(entry, listener.Monitor.SyslogRules())...)
+}
+
+// SyslogEvents returns the events the rules raise for a log message of the device.
+func (device *Device) SyslogEvents(entry SyslogEntry, rules []SyslogRule) []Event {
+	var events []Event
+	for _, rule := range rules {
+		if rule.Topic != "" && !slices.Contains(entry.Topics, rule.Topic) {
+			continue
+		}
+		switch {
+		case rule.pattern != nil && rule.pattern.MatchString(entry.Message):
+			events = append(events, device.NewEvent(EventSyslog, rule.Severity, rule.Name, entry.Message))
+		case rule.resolve != nil && rule.resolve.MatchString(entry.Message):
+			event := device.NewEvent(EventSyslog, rule.Severity, rule.Name, entry.Message)
+			event.Resolved = true
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// SyslogRules returns the syslog rules of the config file.
+func (monitor *Monitor) SyslogRules() []SyslogRule {
+	monitor.mu.RLock()
+	defer monitor.mu.RUnlock()
+
+	return monitor.syslogRules
+}
+
+// addSyslog stores a syslog entry in the recent entries.
+func (monitor *Monitor) addSyslog(entry SyslogEntry) {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	monitor.syslog = append(monitor.syslog, entry)
+	if len(monitor.syslog) > MaxSyslogEntries {
+		monitor.syslog = monitor.syslog[len(monitor.syslog)-MaxSyslogEntries:]
+	}
+}
+
+// SyslogEntries returns a copy of the recent syslog entries of the device with the given host, of all devices if
+// the host is empty, the oldest first.
+func (monitor *Monitor) SyslogEntries(host string) []SyslogEntry {
+	monitor.mu.RLock()
+	defer monitor.mu.RUnlock()
+
+	entries := []SyslogEntry{}
+	for _, entry := range monitor.syslog {
+		if host == "" || entry.Host == host {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
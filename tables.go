@@ -0,0 +1,93 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"strings"
+)
+
+// OIDs of the ARP table of the IP-MIB, the neighbor table of the IP-MIB and the forwarding database of the BRIDGE-MIB.
+const (
+	oidIPNetToMediaPhysAddress    = ".1.3.6.1.2.1.4.22.1.2"
+	oidIPNetToPhysicalPhysAddress = ".1.3.6.1.2.1.4.35.1.4"
+	oidDot1dTpFdbPort             = ".1.3.6.1.2.1.17.4.3.1.2"
+)
+
+// Tables are the sizes of the address tables of the device, ARP is the number of IPv4 ARP entries,
+// ND the number of IPv6 neighbors and BridgeHosts the number of hosts learned by the bridges.
+type Tables struct {
+	ARP         int `json:"ARP"`
+	ND          int `json:"ND"`
+	BridgeHosts int `json:"BridgeHosts"`
+}
+
+// GetTables counts the entries of the ARP, neighbor and bridge host tables, so sudden growth caused by a scan
+// or a loop can be noticed. Devices read via SNMP walk the IP-MIB and the BRIDGE-MIB, other backends
+// print /ip/arp, /ipv6/neighbor and /interface/bridge/host.
+func (device *Device) GetTables() error {
+	if !usesSNMP(device) {
+		return device.getTablesAPI()
+	}
+
+	tables := Tables{}
+	walks := []struct {
+		oid   string
+		name  string
+		count func(index string)
+	}{
+		{oidIPNetToMediaPhysAddress, "ARP table", func(index string) { tables.ARP++ }},
+		{oidIPNetToPhysicalPhysAddress, "neighbor table", func(index string) {
+			// the index is the interface index, the address type (2 for IPv6) and the address
+			if parts := strings.SplitN(index, ".", 3); len(parts) == 3 && parts[1] == "2" {
+				tables.ND++
+			}
+		}},
+		{oidDot1dTpFdbPort, "bridge hosts", func(index string) { tables.BridgeHosts++ }},
+	}
+	for _, walk := range walks {
+		err := device.snmp.BulkWalk(walk.oid, func(variable gosnmp.SnmpPDU) error {
+			walk.count(strings.TrimPrefix(variable.Name, walk.oid+"."))
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s unable to read %s: %v", device.Host, walk.name, err)
+		}
+	}
+	device.Tables = tables
+
+	return nil
+}
+
+// getTablesAPI counts the address tables via the REST API or the binary API.
+func (device *Device) getTablesAPI() error {
+	tables := Tables{}
+	for _, table := range []struct {
+		path  string
+		count *int
+	}{
+		{"/ip/arp", &tables.ARP},
+		{"/ipv6/neighbor", &tables.ND},
+		{"/interface/bridge/host", &tables.BridgeHosts},
+	} {
+		items, err := device.Print(table.path)
+		if err != nil {
+			return err
+		}
+		*table.count = len(items)
+	}
+	device.Tables = tables
+
+	return nil
+}
+
+// tableGrowth returns a rule metric with the growth of a table since the previous poll in percent,
+// e.g. 100 if the table doubled. Empty tables have no value.
+func tableGrowth(size func(tables Tables) int) func(previous, current Device) (float64, bool) {
+	return func(previous, current Device) (float64, bool) {
+		before := size(previous.Tables)
+		if !previous.Reached || !current.Reached || before == 0 {
+			return 0, false
+		}
+		return float64(size(current.Tables)-before) / float64(before) * 100, true
+	}
+}
@@ -0,0 +1,254 @@
+package MikrotikMonitor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EventMaintenanceDue is the type of the reminders of recurring maintenance tasks, the subject is the name of the task.
+// Completing the task with Monitor.CompleteTask resolves the reminder.
+const EventMaintenanceDue = "MaintenanceDue"
+
+// Task is a recurring maintenance task defined in the tasks block of the config file, e.g. checking the UPS battery.
+// Every is daily, weekly, monthly, quarterly, yearly or a duration like 720h, counted from Since.
+// Host, Site, Group and Tag select the devices, empty fields match all. With PerSite one reminder is raised
+// per site of the selected devices instead of one per device.
+type Task struct {
+	Name    string
+	Every   string
+	Since   time.Time
+	Host    string
+	Site    string
+	Group   string
+	Tag     string
+	PerSite bool
+	Comment string
+}
+
+// TaskStatus is the state of a task for a device, or for a site with PerSite. Site is the site of the device.
+// Due is the latest due date, which is zero if the task wasn't due yet, Next the following one.
+type TaskStatus struct {
+	Task      string
+	Scope     string
+	Site      string
+	Due       time.Time
+	Next      time.Time
+	Completed time.Time
+}
+
+// step returns the due date following t.
+func (task Task) step(t time.Time) (time.Time, error) {
+	switch strings.ToLower(task.Every) {
+	case "daily":
+		return t.AddDate(0, 0, 1), nil
+	case "weekly":
+		return t.AddDate(0, 0, 7), nil
+	case "monthly":
+		return t.AddDate(0, 1, 0), nil
+	case "quarterly":
+		return t.AddDate(0, 3, 0), nil
+	case "yearly":
+		return t.AddDate(1, 0, 0), nil
+	}
+
+	interval, err := time.ParseDuration(task.Every)
+	if err != nil || interval < time.Hour {
+		return time.Time{}, fmt.Errorf("every %q is not daily, weekly, monthly, quarterly, yearly or a duration of at least 1h", task.Every)
+	}
+
+	return t.Add(interval), nil
+}
+
+// due returns the latest due date at or before now and the next one after it.
+// The latest due date is zero if now is before Since.
+func (task Task) due(now time.Time) (time.Time, time.Time) {
+	var due time.Time
+	next := task.Since
+	for !next.After(now) {
+		due = next
+		following, err := task.step(next)
+		if err != nil {
+			return time.Time{}, time.Time{}
+		}
+		next = following
+	}
+
+	return due, next
+}
+
+// matches reports whether the task applies to the device.
+func (task Task) matches(device Device) bool {
+	return (task.Host == "" || task.Host == device.Host) && (task.Site == "" || task.Site == device.Site) &&
+		(task.Group == "" || task.Group == device.Group) && (task.Tag == "" || device.HasTag(task.Tag))
+}
+
+// LoadTasks reads the tasks block of the config file and validates it.
+func LoadTasks(filename string) ([]Task, error) {
+	documents, err := readConfigDocuments(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadTasks(documents)
+}
+
+// loadTasks is LoadTasks with the parsed documents of the config files.
+func loadTasks(documents []configDocument) ([]Task, error) {
+	var parser struct {
+		Tasks []Task `yaml:"tasks"`
+	}
+
+	if err := decodeConfig(documents, &parser); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	names := map[string]bool{}
+	for i, task := range parser.Tasks {
+		fail := func(format string, a ...any) {
+			errs = append(errs, fmt.Errorf("task %d %s: %s", i+1, task.Name, fmt.Sprintf(format, a...)))
+		}
+
+		if task.Name == "" {
+			fail("missing name")
+		} else if names[task.Name] {
+			fail("duplicate name")
+		}
+		names[task.Name] = true
+
+		if _, err := task.step(time.Now()); err != nil {
+			fail("%v", err)
+		}
+		if task.Since.IsZero() {
+			fail("missing since")
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid tasks in config file:\n%v", err)
+	}
+
+	return parser.Tasks, nil
+}
+
+// scopes returns the devices a task applies to, keyed by the scope of the reminder: the host of the device,
+// or with PerSite the site, represented by the first device of the site.
+func (task Task) scopes(devices Devices) map[string]Device {
+	scopes := map[string]Device{}
+	for _, device := range devices {
+		if !task.matches(device) {
+			continue
+		}
+		scope := device.Host
+		if task.PerSite {
+			scope = device.Site
+		}
+		if _, found := scopes[scope]; !found {
+			scopes[scope] = device
+		}
+	}
+
+	return scopes
+}
+
+// Tasks returns the state of the maintenance tasks per device or site, sorted by task and scope.
+func (monitor *Monitor) Tasks() []TaskStatus {
+	devices := monitor.Devices()
+	now := time.Now()
+
+	monitor.mu.RLock()
+	defer monitor.mu.RUnlock()
+
+	var tasks []TaskStatus
+	for _, task := range monitor.tasks {
+		due, next := task.due(now)
+		for scope, device := range task.scopes(devices) {
+			tasks = append(tasks, TaskStatus{
+				Task:      task.Name,
+				Scope:     scope,
+				Site:      device.Site,
+				Due:       due,
+				Next:      next,
+				Completed: monitor.completed[[2]string{task.Name, scope}],
+			})
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].Task != tasks[j].Task {
+			return tasks[i].Task < tasks[j].Task
+		}
+		return tasks[i].Scope < tasks[j].Scope
+	})
+
+	return tasks
+}
+
+// CompleteTask marks the task as done for the device or site and resolves its reminder.
+func (monitor *Monitor) CompleteTask(name string, scope string) error {
+	devices := monitor.Devices()
+
+	monitor.mu.Lock()
+	var event Event
+	found := false
+	for _, task := range monitor.tasks {
+		device, ok := task.scopes(devices)[scope]
+		if task.Name != name || !ok {
+			continue
+		}
+		if monitor.completed == nil {
+			monitor.completed = map[[2]string]time.Time{}
+		}
+		monitor.completed[[2]string{name, scope}] = time.Now()
+		event = device.NewEvent(EventMaintenanceDue, SeverityInfo, name, "completed for "+scope)
+		event.Resolved = true
+		found = true
+	}
+	monitor.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("unknown task %s for %s", name, scope)
+	}
+	monitor.Notify(event)
+
+	return nil
+}
+
+// remind returns a reminder for every task which became due for a device or site since it was reminded last.
+// Reminders are kept in memory, so after a restart the reminders of tasks which are due and not completed are raised again.
+func (monitor *Monitor) remind(now time.Time) []Event {
+	devices := monitor.Devices()
+
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	if monitor.reminded == nil {
+		monitor.reminded = map[[2]string]time.Time{}
+	}
+	var events []Event
+	for _, task := range monitor.tasks {
+		due, _ := task.due(now)
+		if due.IsZero() {
+			continue
+		}
+		for scope, device := range task.scopes(devices) {
+			key := [2]string{task.Name, scope}
+			if !monitor.reminded[key].Before(due) || !monitor.completed[key].Before(due) {
+				continue
+			}
+			monitor.reminded[key] = due
+
+			message := fmt.Sprintf("due since %s", due.Format("2006-01-02"))
+			if task.PerSite {
+				message = fmt.Sprintf("due for site %s since %s", scope, due.Format("2006-01-02"))
+			}
+			if task.Comment != "" {
+				message += ", " + task.Comment
+			}
+			events = append(events, device.NewEvent(EventMaintenanceDue, SeverityInfo, task.Name, message))
+		}
+	}
+
+	return events
+}
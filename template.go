@@ -0,0 +1,78 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateFuncs are the functions available in the templates of Render in addition to the builtin ones.
+var TemplateFuncs = template.FuncMap{
+	"formatBytes": formatBytes,
+	"since":       since,
+	"semverLess":  semverLess,
+}
+
+// Render executes a text/template with the devices as data, e.g. to generate a MOTD, a wiki table or a report.
+// Besides the builtin functions, formatBytes formats a size like "1.5 GiB", since returns the time passed since a
+// time rounded to seconds, e.g. since .LastPolled, and semverLess reports whether a RouterOS version is older than
+// another one, e.g. semverLess .Version.RouterOS "7.14".
+func (devices *Devices) Render(tmpl string) (string, error) {
+	parsed, err := template.New("render").Funcs(TemplateFuncs).Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse template: %w", err)
+	}
+
+	var b strings.Builder
+	if err := parsed.Execute(&b, *devices); err != nil {
+		return "", fmt.Errorf("unable to render template: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+// formatBytes formats a number of bytes with binary units, e.g. "512 B" or "1.5 GiB".
+func formatBytes(value any) (string, error) {
+	var size float64
+	switch typed := value.(type) {
+	case int:
+		size = float64(typed)
+	case int64:
+		size = float64(typed)
+	case uint:
+		size = float64(typed)
+	case uint64:
+		size = float64(typed)
+	case float64:
+		size = typed
+	default:
+		return "", fmt.Errorf("formatBytes: unable to format %T", value)
+	}
+
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f %s", size, units[unit]), nil
+	}
+
+	return fmt.Sprintf("%.1f %s", size, units[unit]), nil
+}
+
+// since returns the time passed since t rounded to seconds, zero for the zero time, e.g. of a device never polled.
+func since(t time.Time) time.Duration {
+	if t.IsZero() {
+		return 0
+	}
+
+	return time.Since(t).Round(time.Second)
+}
+
+// semverLess reports whether the version a is older than b, see CompareVersions.
+func semverLess(a, b string) bool {
+	return CompareVersions(a, b) < 0
+}
@@ -0,0 +1,364 @@
+package MikrotikMonitor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Incident is a sustained critical problem of a device for which a ticket is opened.
+// Timeline holds all events of the device since the problem started, the first one is the event which raised it.
+type Incident struct {
+	Device   Device
+	Event    Event
+	Timeline []Event
+}
+
+// Summary returns a one line summary of the incident for the ticket title.
+func (incident Incident) Summary() string {
+	name := incident.Device.Host
+	if incident.Device.Name != "" {
+		name = incident.Device.Name + " (" + incident.Device.Host + ")"
+	}
+
+	return fmt.Sprintf("[%s] %s: %s %s", incident.Event.Severity, name, incident.Event.Type, incident.Event.Subject)
+}
+
+// Description returns the device metadata and the event timeline of the incident for the ticket body.
+func (incident Incident) Description() string {
+	var b strings.Builder
+	device := incident.Device
+	fmt.Fprintf(&b, "Host: %s\nName: %s\nSite: %s\nGroup: %s\nTags: %s\nModel: %s\nRouterOS: %s\n",
+		device.Host, device.Name, device.Site, device.Group, strings.Join(device.Tags, ", "), device.Model, device.Version.RouterOS)
+	b.WriteString("\nTimeline:\n")
+	for _, event := range incident.Timeline {
+		b.WriteString(formatTimelineEvent(event) + "\n")
+	}
+
+	return b.String()
+}
+
+// formatTimelineEvent formats an event as a line of the timeline.
+func formatTimelineEvent(event Event) string {
+	state := event.Severity
+	if event.Resolved {
+		state = "resolved"
+	}
+
+	return fmt.Sprintf("%s [%s] %s %s: %s", event.Time.Format(time.RFC3339), state, event.Type, event.Subject, event.Message)
+}
+
+// TicketSystem opens, updates and closes tickets, e.g. Jira or ServiceNow.
+// Open returns the ID of the ticket, which is passed to Update and Close.
+type TicketSystem interface {
+	Open(incident Incident) (string, error)
+	Update(id string, incident Incident, event Event) error
+	Close(id string, incident Incident) error
+}
+
+// TicketNotifier is a Notifier which opens a ticket for every critical problem which isn't resolved within After.
+// Further events of the device are added to the open ticket, and the ticket is closed when the problem is resolved.
+// Problems are identified by the host, type and subject of the event like in Monitor.Notify.
+// Devices returns the current state of the devices for the metadata of the ticket, e.g. Monitor.Devices.
+type TicketNotifier struct {
+	System  TicketSystem
+	After   time.Duration
+	Devices func() Devices
+
+	mu        sync.Mutex
+	incidents map[[3]string]*incident
+}
+
+// incident is the state of a problem, ticket is empty until the ticket is opened.
+type incident struct {
+	Incident
+	ticket string
+	timer  *time.Timer
+}
+
+// NewTicketNotifier returns a TicketNotifier which opens a ticket in the system for critical problems lasting at least after.
+func NewTicketNotifier(system TicketSystem, after time.Duration, devices func() Devices) *TicketNotifier {
+	return &TicketNotifier{System: system, After: after, Devices: devices}
+}
+
+// Notify tracks the critical problems and adds the event to the timeline of all problems of its device.
+func (notifier *TicketNotifier) Notify(event Event) error {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+
+	if notifier.incidents == nil {
+		notifier.incidents = map[[3]string]*incident{}
+	}
+	key := [3]string{event.Host, event.Type, event.Subject}
+
+	var errs []string
+	for k, current := range notifier.incidents {
+		if k[0] != event.Host {
+			continue
+		}
+		current.Timeline = append(current.Timeline, event)
+		if k == key || current.ticket == "" {
+			continue
+		}
+		if err := notifier.System.Update(current.ticket, current.Incident, event); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	current := notifier.incidents[key]
+	switch {
+	case event.Resolved && current != nil:
+		current.timer.Stop()
+		delete(notifier.incidents, key)
+		if current.ticket != "" {
+			if err := notifier.System.Close(current.ticket, current.Incident); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	case !event.Resolved && current == nil && event.Severity == SeverityCritical:
+		current = &incident{Incident: Incident{Event: event, Timeline: []Event{event}}}
+		current.timer = time.AfterFunc(notifier.After, func() { notifier.open(key, current) })
+		notifier.incidents[key] = current
+	case !event.Resolved && current != nil && current.ticket != "":
+		if err := notifier.System.Update(current.ticket, current.Incident, event); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s ticket update failed: %s", event.Host, strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// open opens the ticket of a problem which is still unresolved after the threshold duration.
+func (notifier *TicketNotifier) open(key [3]string, current *incident) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+
+	if notifier.incidents[key] != current {
+		return
+	}
+	current.Device = Device{Host: current.Event.Host, Name: current.Event.Name, Group: current.Event.Group, Tags: current.Event.Tags}
+	if notifier.Devices != nil {
+		for _, device := range notifier.Devices() {
+			if device.Host == current.Event.Host {
+				current.Device = device
+			}
+		}
+	}
+
+	id, err := notifier.System.Open(current.Incident)
+	if err != nil {
+		log.Printf("%s unable to open ticket: %v", current.Event.Host, err)
+		delete(notifier.incidents, key)
+		return
+	}
+	current.ticket = id
+}
+
+// Jira opens tickets as issues of a project via the Jira REST API.
+// Updates are added as comments, and the issue is closed with the transition named CloseTransition, e.g. "Done".
+// Cloud instances authenticate with the user's mail address and an API token, Server instances with a password.
+type Jira struct {
+	URL             string
+	User            string
+	Token           string `json:"-"`
+	Project         string
+	IssueType       string
+	CloseTransition string
+	Client          *http.Client
+}
+
+// Open creates an issue and returns its key.
+func (jira *Jira) Open(incident Incident) (string, error) {
+	issueType := jira.IssueType
+	if issueType == "" {
+		issueType = "Incident"
+	}
+	labels := []string{"mikrotikmonitor"}
+	for _, tag := range incident.Device.Tags {
+		labels = append(labels, strings.ReplaceAll(tag, " ", "_"))
+	}
+	body := map[string]any{"fields": map[string]any{
+		"project":     map[string]string{"key": jira.Project},
+		"issuetype":   map[string]string{"name": issueType},
+		"summary":     incident.Summary(),
+		"description": incident.Description(),
+		"labels":      labels,
+	}}
+
+	var result struct {
+		Key string
+	}
+	if err := jira.request(http.MethodPost, "/rest/api/2/issue", body, &result); err != nil {
+		return "", err
+	}
+
+	return result.Key, nil
+}
+
+// Update adds the event as comment to the issue.
+func (jira *Jira) Update(id string, incident Incident, event Event) error {
+	return jira.request(http.MethodPost, "/rest/api/2/issue/"+url.PathEscape(id)+"/comment",
+		map[string]string{"body": formatTimelineEvent(event)}, nil)
+}
+
+// Close adds the timeline as comment and moves the issue with the close transition.
+func (jira *Jira) Close(id string, incident Incident) error {
+	path := "/rest/api/2/issue/" + url.PathEscape(id)
+	if err := jira.request(http.MethodPost, path+"/comment", map[string]string{"body": "Resolved.\n\n" + incident.Description()}, nil); err != nil {
+		return err
+	}
+
+	name := jira.CloseTransition
+	if name == "" {
+		name = "Done"
+	}
+	var result struct {
+		Transitions []struct {
+			ID   string
+			Name string
+		}
+	}
+	if err := jira.request(http.MethodGet, path+"/transitions", nil, &result); err != nil {
+		return err
+	}
+	for _, transition := range result.Transitions {
+		if strings.EqualFold(transition.Name, name) {
+			return jira.request(http.MethodPost, path+"/transitions", map[string]any{"transition": map[string]string{"id": transition.ID}}, nil)
+		}
+	}
+
+	return fmt.Errorf("no transition %q for Jira issue %s", name, id)
+}
+
+func (jira *Jira) request(method string, path string, body any, result any) error {
+	return jsonRequest(jira.Client, method, strings.TrimSuffix(jira.URL, "/")+path, basicAuth(jira.User, jira.Token), body, result)
+}
+
+// ServiceNow opens tickets as incidents via the ServiceNow Table API.
+// Updates are added as work notes, and the incident is resolved with CloseCode, e.g. "Solved (Permanently)".
+type ServiceNow struct {
+	URL             string
+	User            string
+	Password        string `json:"-"`
+	AssignmentGroup string
+	CloseCode       string
+	Client          *http.Client
+}
+
+// Open creates an incident and returns its sys_id.
+func (serviceNow *ServiceNow) Open(incident Incident) (string, error) {
+	body := map[string]string{
+		"short_description": incident.Summary(),
+		"description":       incident.Description(),
+		"impact":            "2",
+		"urgency":           "1",
+	}
+	if serviceNow.AssignmentGroup != "" {
+		body["assignment_group"] = serviceNow.AssignmentGroup
+	}
+
+	var result struct {
+		Result struct {
+			SysID string `json:"sys_id"`
+		}
+	}
+	if err := serviceNow.request(http.MethodPost, "", body, &result); err != nil {
+		return "", err
+	}
+
+	return result.Result.SysID, nil
+}
+
+// Update adds the event as work note to the incident.
+func (serviceNow *ServiceNow) Update(id string, incident Incident, event Event) error {
+	return serviceNow.request(http.MethodPatch, "/"+url.PathEscape(id), map[string]string{"work_notes": formatTimelineEvent(event)}, nil)
+}
+
+// Close resolves the incident with the timeline as close notes.
+func (serviceNow *ServiceNow) Close(id string, incident Incident) error {
+	closeCode := serviceNow.CloseCode
+	if closeCode == "" {
+		closeCode = "Solved (Permanently)"
+	}
+
+	return serviceNow.request(http.MethodPatch, "/"+url.PathEscape(id), map[string]string{
+		"state":       "6",
+		"close_code":  closeCode,
+		"close_notes": incident.Description(),
+	}, nil)
+}
+
+func (serviceNow *ServiceNow) request(method string, path string, body any, result any) error {
+	return jsonRequest(serviceNow.Client, method, strings.TrimSuffix(serviceNow.URL, "/")+"/api/now/table/incident"+path,
+		basicAuth(serviceNow.User, serviceNow.Password), body, result)
+}
+
+// basicAuth returns the header of the basic authentication with user and password, nil if both are empty.
+func basicAuth(user string, password string) http.Header {
+	if user == "" && password == "" {
+		return nil
+	}
+
+	return http.Header{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))}}
+}
+
+// jsonRequest sends a JSON request with the additional header, e.g. for authentication, to a ticket system or
+// notification service and decodes the response into result.
+func jsonRequest(client *http.Client, method string, address string, header http.Header, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	request, err := http.NewRequest(method, address, reader)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("request %s %s failed: %v", method, address, err)
+	}
+	defer response.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("request %s %s failed: %v", method, address, err)
+	}
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("request %s %s failed: %s %s", method, address, response.Status, bytes.TrimSpace(content))
+	}
+	if result != nil && len(content) > 0 {
+		if err := json.Unmarshal(content, result); err != nil {
+			return fmt.Errorf("request %s %s returned invalid JSON: %v", method, address, err)
+		}
+	}
+
+	return nil
+}
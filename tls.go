@@ -0,0 +1,83 @@
+package MikrotikMonitor
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// certificateFiles serves the certificate of a pair of PEM files, read again when they change.
+type certificateFiles struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	stat        string
+	checked     time.Time
+}
+
+// CertificateFiles returns the TLS config of a server with the certificate chain and the key of PEM files, e.g. for
+// http.Server.TLSConfig. The files are checked for changes every 10 seconds and read again, so certificates renewed by
+// other tools, e.g. certbot, are used without restarting the monitor.
+func CertificateFiles(certFile, keyFile string) (*tls.Config, error) {
+	files := &certificateFiles{certFile: certFile, keyFile: keyFile}
+	if _, err := files.load(); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return files.load()
+		},
+	}, nil
+}
+
+// load returns the certificate, read again if the files changed. A broken pair, e.g. while the files are replaced,
+// is logged and the previous certificate is kept.
+func (files *certificateFiles) load() (*tls.Certificate, error) {
+	files.mu.Lock()
+	defer files.mu.Unlock()
+
+	if files.certificate != nil && time.Since(files.checked) < 10*time.Second {
+		return files.certificate, nil
+	}
+	files.checked = time.Now()
+
+	stat := ""
+	for _, name := range []string{files.certFile, files.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return files.fallback(err)
+		}
+		stat += fmt.Sprintf("%s %d %d\n", name, info.ModTime().UnixNano(), info.Size())
+	}
+	if stat == files.stat {
+		return files.certificate, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(files.certFile, files.keyFile)
+	if err != nil {
+		return files.fallback(err)
+	}
+	if files.certificate != nil {
+		log.Printf("certificate %s reloaded", files.certFile)
+	}
+	files.certificate, files.stat = &certificate, stat
+
+	return files.certificate, nil
+}
+
+// fallback returns the previous certificate if there is one, the error otherwise.
+func (files *certificateFiles) fallback(err error) (*tls.Certificate, error) {
+	if files.certificate == nil {
+		return nil, fmt.Errorf("unable to load certificate %s, %v", files.certFile, err)
+	}
+	log.Printf("unable to reload certificate %s, %v", files.certFile, err)
+
+	return files.certificate, nil
+}
@@ -0,0 +1,198 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types raised by the TrapListener.
+// A linkUp trap resolves the LinkDown event of the same interface, all traps without a dedicated type are Trap events.
+const (
+	EventLinkDown     = "LinkDown"
+	EventLoginFailure = "LoginFailure"
+	EventTrap         = "Trap"
+)
+
+// OIDs of the generic traps and the variables identifying the interface of link traps.
+const (
+	oidTrapOID       = ".1.3.6.1.6.3.1.1.4.1.0"
+	oidGenericTraps  = ".1.3.6.1.6.3.1.1.5"
+	oidColdStart     = oidGenericTraps + ".1"
+	oidWarmStart     = oidGenericTraps + ".2"
+	oidLinkDown      = oidGenericTraps + ".3"
+	oidLinkUp        = oidGenericTraps + ".4"
+	oidAuthFailure   = oidGenericTraps + ".5"
+	oidTrapIfIndex   = ".1.3.6.1.2.1.2.2.1.1."
+	oidTrapIfDescr   = ".1.3.6.1.2.1.2.2.1.2."
+	oidTrapIfName    = ".1.3.6.1.2.1.31.1.1.1.1."
+	oidSysUpTimeTrap = ".1.3.6.1.2.1.1.3.0"
+)
+
+// TrapListener receives SNMPv1 and SNMPv2c traps and informs from the devices of a Monitor.
+// The sender of a trap is identified by its source address, which has to be the address of a configured host,
+// and the community has to match the community of that device. Traps of unknown senders are logged and dropped.
+// Link down, link up and authentication failure traps become LinkDown and LoginFailure events,
+// all others, e.g. traps sent by netwatch scripts with /snmp send-trap, are passed on as Trap events.
+type TrapListener struct {
+	Monitor *Monitor
+
+	listener *gosnmp.TrapListener
+	mu       sync.Mutex
+	resolver hostResolver
+}
+
+// NewTrapListener returns a TrapListener which forwards the traps of the devices of the monitor as events.
+func NewTrapListener(monitor *Monitor) *TrapListener {
+	listener := &TrapListener{Monitor: monitor}
+	listener.listener = gosnmp.NewTrapListener()
+	listener.listener.Params = &gosnmp.GoSNMP{Version: gosnmp.Version2c}
+	listener.listener.OnNewTrap = listener.handle
+
+	return listener
+}
+
+// Listen receives traps on the UDP address, e.g. ":162", and blocks until Close is called.
+func (listener *TrapListener) Listen(address string) error {
+	return listener.listener.Listen(address)
+}
+
+// Close stops the listener.
+func (listener *TrapListener) Close() {
+	listener.listener.Close()
+}
+
+// handle correlates a trap to a device and notifies the monitor with the resulting event.
+func (listener *TrapListener) handle(packet *gosnmp.SnmpPacket, address *net.UDPAddr) {
+	listener.mu.Lock()
+	device, found := listener.resolver.device(listener.Monitor.Devices(), address.IP)
+	listener.mu.Unlock()
+	if !found {
+		log.Printf("%s trap from unknown device dropped", address.IP)
+		return
+	}
+	if packet.Community != device.SNMP.Community {
+		log.Printf("%s trap with wrong community dropped", device.Host)
+		return
+	}
+
+	listener.Monitor.Notify(device.TrapEvent(packet))
+}
+
+// hostResolver identifies the device which sent a trap or log message by its source address.
+// It isn't safe for concurrent use.
+type hostResolver struct {
+	failed map[string]time.Time
+}
+
+// device returns the device whose host or one of its addresses is or resolves to the IP address,
+// or which was polled at the IP address.
+// Host names are resolved with the cache of the polls and its TTL, names which can't be resolved aren't tried again
+// within the TTL either, so a trap storm doesn't cause a storm of DNS queries.
+func (resolver *hostResolver) device(devices Devices, ip net.IP) (Device, bool) {
+	if resolver.failed == nil {
+		resolver.failed = map[string]time.Time{}
+	}
+
+	for _, device := range devices {
+		hosts := append([]string{device.Host}, device.Addresses...)
+		if device.ResolvedIP != "" {
+			// a dynamic DNS name may point to a new address since it was cached
+			hosts = append(hosts, device.ResolvedIP)
+		}
+		for _, host := range hosts {
+			var addresses []net.IP
+			if parsed := parseAddress(host); parsed != nil {
+				addresses = []net.IP{parsed}
+			} else if failed, found := resolver.failed[host]; !found || time.Since(failed) >= device.dnsTTL() {
+				ips, err := device.lookup(context.Background(), unbracket(host), false)
+				if err != nil {
+					log.Println(err.Error())
+					resolver.failed[host] = time.Now()
+				} else {
+					delete(resolver.failed, host)
+				}
+				for _, resolved := range ips {
+					addresses = append(addresses, parseAddress(resolved))
+				}
+			}
+			for _, address := range addresses {
+				if address.Equal(ip) {
+					return device, true
+				}
+			}
+		}
+	}
+
+	return Device{}, false
+}
+
+// TrapEvent converts a trap of the device into an event.
+// The subject of link traps is the name of the interface, of all other traps the trap OID.
+// The message lists all variables of the trap.
+func (device *Device) TrapEvent(packet *gosnmp.SnmpPacket) Event {
+	trapOID := ""
+	if packet.Version == gosnmp.Version1 {
+		if packet.GenericTrap == 6 {
+			trapOID = packet.Enterprise + ".0." + strconv.Itoa(packet.SpecificTrap)
+		} else {
+			trapOID = oidGenericTraps + "." + strconv.Itoa(packet.GenericTrap+1)
+		}
+	}
+
+	var ifIndex, ifName string
+	var variables []string
+	for _, variable := range packet.Variables {
+		value := variable.Value
+		if bytes, ok := value.([]byte); ok {
+			value = string(bytes)
+		}
+
+		switch {
+		case variable.Name == oidTrapOID:
+			trapOID = fmt.Sprint(value)
+			continue
+		case variable.Name == oidSysUpTimeTrap:
+			continue
+		case strings.HasPrefix(variable.Name, oidTrapIfIndex):
+			ifIndex = fmt.Sprint(value)
+		case strings.HasPrefix(variable.Name, oidTrapIfName), strings.HasPrefix(variable.Name, oidTrapIfDescr) && ifName == "":
+			ifName = fmt.Sprint(value)
+		}
+		variables = append(variables, fmt.Sprintf("%s=%v", variable.Name, value))
+	}
+	if !strings.HasPrefix(trapOID, ".") {
+		trapOID = "." + trapOID
+	}
+
+	if ifName == "" && ifIndex != "" {
+		ifName = "ifIndex " + ifIndex
+		for _, iface := range device.Interfaces {
+			if strconv.Itoa(iface.Index) == ifIndex {
+				ifName = iface.Name
+			}
+		}
+	}
+	message := strings.Join(variables, " ")
+
+	switch trapOID {
+	case oidLinkDown:
+		return device.NewEvent(EventLinkDown, SeverityWarning, ifName, "link down")
+	case oidLinkUp:
+		event := device.NewEvent(EventLinkDown, SeverityWarning, ifName, "link up")
+		event.Resolved = true
+		return event
+	case oidAuthFailure:
+		return device.NewEvent(EventLoginFailure, SeverityWarning, "snmp", "authentication failure "+message)
+	case oidColdStart, oidWarmStart:
+		return device.NewEvent(EventTrap, SeverityInfo, trapOID, "device started "+message)
+	}
+
+	return device.NewEvent(EventTrap, SeverityInfo, trapOID, message)
+}
@@ -0,0 +1,261 @@
+package MikrotikMonitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventUpgrade is the type of events raised by Upgrade, the subject is the target version.
+const EventUpgrade = "Upgrade"
+
+// Results of the upgrade of a device.
+const (
+	UpgradeCurrent  = "current"
+	UpgradePlanned  = "planned"
+	UpgradeUpgraded = "upgraded"
+	UpgradeFailed   = "failed"
+	UpgradeSkipped  = "skipped"
+)
+
+// UpgradePlan is a bulk upgrade of RouterOS to the Version, which has to be the newest release of the update channel
+// of the devices, or of Channel, which is set on the devices before. Host, Site, Group and Tag select the devices,
+// empty fields match all. The devices of the Canary group are upgraded first, the others only if all canaries were
+// verified. At most Concurrency devices, default 1, are upgraded at the same time. After the install the device is
+// polled every VerifyInterval until it runs the Version, which fails the upgrade after VerifyTimeout.
+// With DryRun nothing is changed, the devices which would be upgraded are reported as planned.
+type UpgradePlan struct {
+	Version        string
+	Channel        string
+	Host           string
+	Site           string
+	Group          string
+	Tag            string
+	Canary         string
+	Concurrency    int
+	VerifyInterval time.Duration
+	VerifyTimeout  time.Duration
+	DryRun         bool
+}
+
+// UpgradeResult is the result of the upgrade of a device, From is the version before the upgrade.
+type UpgradeResult struct {
+	Host   string
+	From   string
+	Result string
+	Err    error
+}
+
+// matches reports whether the device is selected by the plan.
+func (plan UpgradePlan) matches(device Device) bool {
+	return (plan.Host == "" || device.Host == plan.Host) && (plan.Site == "" || device.Site == plan.Site) &&
+		(plan.Group == "" || device.Group == plan.Group) && (plan.Tag == "" || device.HasTag(plan.Tag))
+}
+
+// UpgradeRouterOS installs the newest release of the update channel of the device via the REST API, the binary API
+// or, for devices with the ssh backend or only an ssh block, via SSH. The channel is set before if it isn't empty. The newest release found
+// by check-for-updates has to be the version, so a device never installs a different release than planned.
+// The device downloads the release and reboots, the install doesn't wait for it.
+func (device *Device) UpgradeRouterOS(version string, channel string) error {
+	if device.usesSSH() {
+		return device.upgradeSSH(version, channel)
+	}
+	if device.API.User == "" {
+		return fmt.Errorf("%s unable to upgrade: neither api nor ssh configured", device.Host)
+	}
+
+	if channel != "" {
+		if _, err := device.Execute("/system/package/update/set", map[string]string{"channel": channel}); err != nil {
+			return err
+		}
+	}
+	if _, err := device.Execute("/system/package/update/check-for-updates", map[string]string{"once": ""}); err != nil {
+		return err
+	}
+	update, err := device.printOne("/system/package/update")
+	if err != nil {
+		return err
+	}
+	if update["latest-version"] != version {
+		return fmt.Errorf("%s unable to upgrade: newest release of %s is %q", device.Host, update["channel"], update["latest-version"])
+	}
+
+	// the device reboots after the download, a connection closed by the reboot isn't an error
+	if _, err := device.Execute("/system/package/update/install", map[string]string{}); err != nil {
+		log.Printf("%s install of RouterOS %s returned %v", device.Host, version, err)
+	}
+
+	return nil
+}
+
+// upgradeSSH is UpgradeRouterOS via SSH.
+func (device *Device) upgradeSSH(version string, channel string) error {
+	commands := []string{`/system package update check-for-updates once`, `:put ("latest-version=" . [/system package update get latest-version])`}
+	if channel != "" {
+		commands = append([]string{fmt.Sprintf(`/system package update set channel=%s`, channel)}, commands...)
+	}
+	output, err := device.RunSSH(strings.Join(commands, "; "))
+	if err != nil {
+		return err
+	}
+	var latest string
+	for _, line := range strings.Split(output, "\n") {
+		if value, found := strings.CutPrefix(strings.TrimSpace(line), "latest-version="); found {
+			latest = value
+		}
+	}
+	if latest != version {
+		return fmt.Errorf("%s unable to upgrade: newest release is %q", device.Host, latest)
+	}
+
+	if _, err := device.RunSSH(`/system package update install`); err != nil {
+		log.Printf("%s install of RouterOS %s returned %v", device.Host, version, err)
+	}
+
+	return nil
+}
+
+// Upgrade upgrades the outdated devices of the monitor selected by the plan and returns the result of every selected
+// device, devices which already run the version are current. Every upgrade is reported as event, failed ones as critical.
+// If a canary fails, the other devices are skipped. Cancelling the context skips the devices not started yet.
+func (monitor *Monitor) Upgrade(ctx context.Context, plan UpgradePlan) ([]UpgradeResult, error) {
+	if plan.Version == "" {
+		return nil, fmt.Errorf("upgrade version is missing")
+	}
+	switch plan.Channel {
+	case "", ChannelLongTerm, ChannelStable, ChannelTesting, ChannelDevelopment:
+	default:
+		return nil, fmt.Errorf("unknown update channel %q", plan.Channel)
+	}
+	if plan.Concurrency <= 0 {
+		plan.Concurrency = 1
+	}
+	if plan.VerifyInterval <= 0 {
+		plan.VerifyInterval = 30 * time.Second
+	}
+	if plan.VerifyTimeout <= 0 {
+		plan.VerifyTimeout = 15 * time.Minute
+	}
+
+	var results []UpgradeResult
+	var canaries, others Devices
+	for _, device := range monitor.Devices() {
+		if !plan.matches(device) {
+			continue
+		}
+		if device.Version.RouterOS != "" && CompareVersions(device.Version.RouterOS, plan.Version) >= 0 {
+			results = append(results, UpgradeResult{Host: device.Host, From: device.Version.RouterOS, Result: UpgradeCurrent})
+			continue
+		}
+		if plan.Canary != "" && device.Group == plan.Canary {
+			canaries = append(canaries, device)
+		} else {
+			others = append(others, device)
+		}
+	}
+
+	waves := []Devices{canaries, others}
+	for i, wave := range waves {
+		upgraded := monitor.upgradeWave(ctx, plan, wave)
+		results = append(results, upgraded...)
+
+		if i == 0 && !plan.DryRun {
+			for _, result := range upgraded {
+				if result.Result == UpgradeFailed {
+					for _, device := range others {
+						results = append(results, UpgradeResult{Host: device.Host, From: device.Version.RouterOS, Result: UpgradeSkipped,
+							Err: fmt.Errorf("%s skipped, canary %s failed", device.Host, result.Host)})
+					}
+					return results, nil
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// upgradeWave upgrades the devices with at most plan.Concurrency upgrades at the same time.
+func (monitor *Monitor) upgradeWave(ctx context.Context, plan UpgradePlan, devices Devices) []UpgradeResult {
+	results := make([]UpgradeResult, len(devices))
+	slots := make(chan struct{}, plan.Concurrency)
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		results[i] = UpgradeResult{Host: device.Host, From: device.Version.RouterOS, Result: UpgradePlanned}
+		if plan.DryRun {
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Result = UpgradeSkipped
+			results[i].Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(result *UpgradeResult, device Device) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			result.Err = monitor.upgradeDevice(ctx, plan, device)
+			result.Result = UpgradeUpgraded
+			if result.Err != nil {
+				result.Result = UpgradeFailed
+			}
+		}(&results[i], device)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// upgradeDevice upgrades a device and polls it until it runs the version of the plan.
+func (monitor *Monitor) upgradeDevice(ctx context.Context, plan UpgradePlan, device Device) error {
+	from := device.Version.RouterOS
+	monitor.Notify(device.NewEvent(EventUpgrade, SeverityInfo, plan.Version, fmt.Sprintf("upgrade from RouterOS %s started", from)))
+
+	err := device.UpgradeRouterOS(plan.Version, plan.Channel)
+	if err == nil {
+		err = device.verifyUpgrade(ctx, plan)
+	}
+	if err != nil {
+		monitor.Notify(device.NewEvent(EventUpgrade, SeverityCritical, plan.Version, fmt.Sprintf("upgrade failed: %v", err)))
+		return err
+	}
+
+	event := device.NewEvent(EventUpgrade, SeverityInfo, plan.Version, fmt.Sprintf("upgraded from RouterOS %s", from))
+	event.Resolved = true
+	monitor.Notify(event)
+
+	return nil
+}
+
+// verifyUpgrade polls the device until it is reached with the version of the plan or the VerifyTimeout expires.
+func (device *Device) verifyUpgrade(ctx context.Context, plan UpgradePlan) error {
+	deadline := time.NewTimer(plan.VerifyTimeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(plan.VerifyInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("%s runs RouterOS %q instead of %s after %s", device.Host, device.Version.RouterOS, plan.Version, plan.VerifyTimeout)
+		case <-ticker.C:
+		}
+
+		device.Reached = false
+		if err := device.GetDeviceContext(ctx); err != nil || !device.Reached {
+			continue
+		}
+		if CompareVersions(device.Version.RouterOS, plan.Version) >= 0 {
+			return nil
+		}
+	}
+}
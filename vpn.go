@@ -0,0 +1,119 @@
+package MikrotikMonitor
+
+import (
+	"strconv"
+	"time"
+)
+
+// VPN is the state of the IPsec and WireGuard tunnels of the device.
+type VPN struct {
+	IPsec     []IPsecPeer     `json:"IPsec"`
+	SAs       []IPsecSA       `json:"SAs"`
+	WireGuard []WireGuardPeer `json:"WireGuard"`
+}
+
+// IPsecPeer is an active IPsec peer, State is e.g. "established".
+type IPsecPeer struct {
+	Address string        `json:"Address"`
+	State   string        `json:"State"`
+	Uptime  time.Duration `json:"Uptime"`
+	SAs     int           `json:"SAs"`
+	RxBytes uint64        `json:"RxBytes"`
+	TxBytes uint64        `json:"TxBytes"`
+}
+
+// IPsecSA is an installed IPsec security association.
+type IPsecSA struct {
+	SPI         string `json:"SPI"`
+	Source      string `json:"Source"`
+	Destination string `json:"Destination"`
+	State       string `json:"State"`
+	Bytes       uint64 `json:"Bytes"`
+}
+
+// WireGuardPeer is a peer of a WireGuard interface. Endpoint is the configured endpoint of site-to-site tunnels,
+// it is empty for peers which connect to the device, e.g. road warriors.
+// LastHandshake is the time since the last handshake, Handshaked is false if there was none yet.
+type WireGuardPeer struct {
+	Name          string        `json:"Name"`
+	Interface     string        `json:"Interface"`
+	Endpoint      string        `json:"Endpoint"`
+	Handshaked    bool          `json:"Handshaked"`
+	LastHandshake time.Duration `json:"LastHandshake"`
+	RxBytes       uint64        `json:"RxBytes"`
+	TxBytes       uint64        `json:"TxBytes"`
+}
+
+// GetVPN reads the active IPsec peers and SAs and, on RouterOS v7, the WireGuard peers via the API.
+func (device *Device) GetVPN() error {
+	vpn := VPN{}
+
+	peers, err := device.Print("/ip/ipsec/active-peers")
+	if err != nil {
+		return err
+	}
+	for _, item := range peers {
+		peer := IPsecPeer{Address: item["remote-address"], State: item["state"], Uptime: ParseRouterOSDuration(item["uptime"])}
+		peer.SAs, _ = strconv.Atoi(item["ph2-total"])
+		peer.RxBytes, _ = strconv.ParseUint(item["rx-bytes"], 10, 64)
+		peer.TxBytes, _ = strconv.ParseUint(item["tx-bytes"], 10, 64)
+		vpn.IPsec = append(vpn.IPsec, peer)
+	}
+
+	sas, err := device.Print("/ip/ipsec/installed-sa")
+	if err != nil {
+		return err
+	}
+	for _, item := range sas {
+		sa := IPsecSA{SPI: item["spi"], Source: item["src-address"], Destination: item["dst-address"], State: item["state"]}
+		sa.Bytes, _ = strconv.ParseUint(item["current-bytes"], 10, 64)
+		vpn.SAs = append(vpn.SAs, sa)
+	}
+
+	if device.Capabilities.Major >= 7 {
+		wireguard, err := device.Print("/interface/wireguard/peers")
+		if err != nil {
+			return err
+		}
+		for _, item := range wireguard {
+			peer := WireGuardPeer{
+				Name:      firstValue(item, "name", "comment"),
+				Interface: item["interface"],
+				Endpoint:  item["endpoint-address"],
+			}
+			if peer.Name == "" {
+				peer.Name = item["public-key"]
+			}
+			if item["last-handshake"] != "" {
+				peer.Handshaked = true
+				peer.LastHandshake = ParseRouterOSDuration(item["last-handshake"])
+			}
+			peer.RxBytes, _ = strconv.ParseUint(item["rx"], 10, 64)
+			peer.TxBytes, _ = strconv.ParseUint(item["tx"], 10, 64)
+			vpn.WireGuard = append(vpn.WireGuard, peer)
+		}
+	}
+
+	device.VPN = vpn
+
+	return nil
+}
+
+// handshakeAge is a rule metric with the oldest last handshake of the WireGuard peers with an endpoint in seconds.
+// Peers without a handshake since the boot count with the uptime of the device. Devices without such peers have no value.
+func handshakeAge(previous, current Device) (float64, bool) {
+	age, found := time.Duration(0), false
+	for _, peer := range current.VPN.WireGuard {
+		if peer.Endpoint == "" {
+			// peers without an endpoint, e.g. road warriors, aren't expected to keep the tunnel up
+			continue
+		}
+		last := peer.LastHandshake
+		if !peer.Handshaked {
+			last = current.Uptime
+		}
+		age, found = max(age, last), true
+	}
+
+	return age.Seconds(), current.Reached && found
+}
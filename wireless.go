@@ -0,0 +1,66 @@
+package MikrotikMonitor
+
+import (
+	"fmt"
+	"github.com/gosnmp/gosnmp"
+	"time"
+)
+
+const oidWirelessClientCount = ".1.3.6.1.4.1.14988.1.1.1.3.1.6"
+
+// HistoryWirelessClients is the History key of the fleet-wide wireless client count.
+// Per site counts are stored under this key followed by ":" and the site name.
+const HistoryWirelessClients = "wireless_clients"
+
+type Wireless struct {
+	Clients int `json:"Clients"`
+}
+
+type WirelessRollup struct {
+	Timestamp time.Time
+	Total     int
+	Sites     map[string]int
+}
+
+// GetWireless sums up the connected clients of all wireless interfaces of the device.
+// Devices without wireless interfaces report zero clients.
+// The SNMP connection of the device has to be established already.
+func (device *Device) GetWireless() error {
+	clients := 0
+	err := device.snmp.BulkWalk(oidWirelessClientCount, func(variable gosnmp.SnmpPDU) error {
+		count, _ := AsInt(variable)
+		clients += int(count)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s unable to read wireless clients: %v", device.Host, err)
+	}
+	device.Wireless.Clients = clients
+
+	return nil
+}
+
+// WirelessClients aggregates the wireless client counts of all reached devices per site and fleet-wide.
+// Devices without a site are only part of the total.
+func (devices *Devices) WirelessClients() WirelessRollup {
+	rollup := WirelessRollup{Timestamp: time.Now(), Sites: map[string]int{}}
+	for _, device := range *devices {
+		if !device.Reached {
+			continue
+		}
+		rollup.Total += device.Wireless.Clients
+		if device.Site != "" {
+			rollup.Sites[device.Site] += device.Wireless.Clients
+		}
+	}
+
+	return rollup
+}
+
+// Record stores the rollup in the history, so peaks can be queried with History.Peak.
+func (rollup WirelessRollup) Record(history *History) {
+	history.Add(HistoryWirelessClients, rollup.Timestamp, float64(rollup.Total))
+	for site, clients := range rollup.Sites {
+		history.Add(HistoryWirelessClients+":"+site, rollup.Timestamp, float64(clients))
+	}
+}
@@ -0,0 +1,256 @@
+package MikrotikMonitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keys of the low-level discovery items of the ZabbixSender.
+const (
+	ZabbixDeviceDiscovery    = "mikrotik.devices.discovery"
+	ZabbixInterfaceDiscovery = "mikrotik.interfaces.discovery"
+)
+
+// zabbixDescriptiveLabels are labels of metrics which describe a value instead of identifying it, e.g. the status
+// of a PoE port. They aren't parameters of item keys, which would change with them otherwise.
+var zabbixDescriptiveLabels = map[string]bool{
+	"model": true, "routeros": true, "bootloader": true, "latest": true, "serial": true, "update_channel": true, "latest_release": true, "vendor": true, "wavelength": true,
+	"status": true, "channel": true, "endpoint": true, "peer_name": true, "as": true, "router_id": true,
+}
+
+// ZabbixValue is a value of an item of a Zabbix host sent with the Zabbix sender protocol.
+type ZabbixValue struct {
+	Host  string
+	Key   string
+	Value string
+	Clock time.Time
+}
+
+// ZabbixSender pushes the results of devices to a Zabbix server or proxy with the Zabbix sender protocol,
+// so existing Zabbix deployments can consume them with trapper items instead of SNMP items.
+// Every device is a Zabbix host named like the device, or like its host as long as it has never been reached.
+// Its metrics are items named like those of ResultPrometheus with the identifying labels as parameters,
+// e.g. mikrotik_interface_in_octets_total[ether1]. The interfaces are discovered with the item
+// mikrotik.interfaces.discovery, which provides {#INTERFACE} and {#IFINDEX}. With DiscoveryHost and Devices set,
+// all devices are discovered on that host with the item mikrotik.devices.discovery.
+// Discovery values are sent at most once per DiscoveryInterval.
+type ZabbixSender struct {
+	Address           string
+	DiscoveryHost     string
+	DiscoveryInterval time.Duration
+	Devices           func() Devices
+	Timeout           time.Duration
+
+	mu         sync.Mutex
+	discovered map[string]time.Time
+}
+
+// NewZabbixSender returns a sender to the trapper port of a Zabbix server or proxy, e.g. "zabbix.example.com:10051".
+func NewZabbixSender(address string) *ZabbixSender {
+	return &ZabbixSender{Address: address, DiscoveryInterval: 15 * time.Minute, Timeout: 10 * time.Second}
+}
+
+// Publish sends the values of a device and, if due, the discovery of its interfaces and of all devices.
+func (sender *ZabbixSender) Publish(result DeviceResult) error {
+	device := result.Device
+	values := device.ZabbixValues()
+
+	now := time.Now()
+	sender.mu.Lock()
+	if sender.discovered == nil {
+		sender.discovered = map[string]time.Time{}
+	}
+	host := device.publishKey()
+	if device.Reached && now.Sub(sender.discovered[host]) >= sender.DiscoveryInterval {
+		sender.discovered[host] = now
+		values = append(values, ZabbixValue{Host: host, Key: ZabbixInterfaceDiscovery, Value: device.ZabbixInterfaceDiscovery(), Clock: now})
+	}
+	if sender.DiscoveryHost != "" && sender.Devices != nil && now.Sub(sender.discovered[""]) >= sender.DiscoveryInterval {
+		sender.discovered[""] = now
+		devices := sender.Devices()
+		values = append(values, ZabbixValue{Host: sender.DiscoveryHost, Key: ZabbixDeviceDiscovery, Value: devices.ZabbixDiscovery(), Clock: now})
+	}
+	sender.mu.Unlock()
+
+	return sender.Send(values)
+}
+
+// Close does nothing, the sender connects for every request.
+func (sender *ZabbixSender) Close() error {
+	return nil
+}
+
+// Send sends values to the server. Values of items which don't exist on the server are ignored by it,
+// an error is only returned if the server rejected the request.
+func (sender *ZabbixSender) Send(values []ZabbixValue) error {
+	type item struct {
+		Host  string `json:"host"`
+		Key   string `json:"key"`
+		Value string `json:"value"`
+		Clock int64  `json:"clock"`
+		NS    int    `json:"ns"`
+	}
+	request := struct {
+		Request string `json:"request"`
+		Data    []item `json:"data"`
+		Clock   int64  `json:"clock"`
+	}{Request: "sender data", Clock: time.Now().Unix()}
+	for _, value := range values {
+		request.Data = append(request.Data, item{value.Host, value.Key, value.Value, value.Clock.Unix(), value.Clock.Nanosecond()})
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", sender.Address, sender.Timeout)
+	if err != nil {
+		return fmt.Errorf("Zabbix %s %w: %w", sender.Address, ErrConnect, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(sender.Timeout))
+
+	if _, err := conn.Write(zabbixPacket(body)); err != nil {
+		return fmt.Errorf("Zabbix %s request failed: %w", sender.Address, err)
+	}
+	content, err := readZabbixPacket(conn)
+	if err != nil {
+		return fmt.Errorf("Zabbix %s request failed: %w", sender.Address, err)
+	}
+	var response struct {
+		Response string `json:"response"`
+		Info     string `json:"info"`
+	}
+	if err := json.Unmarshal(content, &response); err != nil {
+		return fmt.Errorf("Zabbix %s request failed: %w", sender.Address, err)
+	}
+	if response.Response != "success" {
+		return fmt.Errorf("Zabbix %s request failed: %s %s", sender.Address, response.Response, response.Info)
+	}
+
+	return nil
+}
+
+// zabbixPacket returns data with the header of the Zabbix protocol: "ZBXD", the flags and the length of the data.
+func zabbixPacket(data []byte) []byte {
+	packet := append([]byte("ZBXD"), 1)
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(len(data)))
+	packet = binary.LittleEndian.AppendUint32(packet, 0)
+
+	return append(packet, data...)
+}
+
+// readZabbixPacket reads a packet of the Zabbix protocol and returns its data.
+func readZabbixPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:4], []byte("ZBXD")) {
+		return nil, errors.New("invalid response header")
+	}
+	length := binary.LittleEndian.Uint32(header[5:])
+	if length > 16<<20 {
+		return nil, fmt.Errorf("response of %d bytes too large", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// ZabbixValues returns the metrics of the device as values of its Zabbix host, besides the RouterOS version,
+// the model and the error of the last poll as text items mikrotik.routeros, mikrotik.model and mikrotik.error.
+func (device *Device) ZabbixValues() []ZabbixValue {
+	host := device.publishKey()
+	clock := device.LastPolled
+	if clock.IsZero() {
+		clock = time.Now()
+	}
+
+	w := &metricsWriter{collect: true}
+	(&Devices{*device}).writeMetrics(w)
+	identity := len(device.labels())
+
+	values := []ZabbixValue{{host, "mikrotik.error", device.LastError, clock}}
+	if device.Reached {
+		values = append(values,
+			ZabbixValue{host, "mikrotik.routeros", device.Version.RouterOS, clock},
+			ZabbixValue{host, "mikrotik.model", device.Model, clock})
+	}
+	for _, family := range w.families {
+		for _, sample := range family.samples {
+			if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+				continue
+			}
+			var parameters []string
+			for _, label := range sample.labels[min(identity, len(sample.labels)):] {
+				if !zabbixDescriptiveLabels[label[0]] {
+					parameters = append(parameters, zabbixParameter(label[1]))
+				}
+			}
+			key := family.name
+			if len(parameters) > 0 {
+				key += "[" + strings.Join(parameters, ",") + "]"
+			}
+			values = append(values, ZabbixValue{host, key, strconv.FormatFloat(sample.value, 'f', -1, 64), clock})
+		}
+	}
+
+	return values
+}
+
+// zabbixParameter returns a parameter of an item key, quoted if it contains characters with a meaning in keys.
+func zabbixParameter(value string) string {
+	if !strings.ContainsAny(value, `,]["`) && !strings.HasPrefix(value, " ") {
+		return value
+	}
+
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+// ZabbixDiscovery returns the low-level discovery JSON of the devices with the macros {#DEVICE}, the name of
+// the Zabbix host of the device, {#ADDRESS}, {#NAME}, {#SITE}, {#GROUP} and {#MODEL}.
+func (devices *Devices) ZabbixDiscovery() string {
+	discovery := []map[string]string{}
+	for _, device := range *devices {
+		discovery = append(discovery, map[string]string{
+			"{#DEVICE}":  device.publishKey(),
+			"{#ADDRESS}": device.Host,
+			"{#NAME}":    device.Name,
+			"{#SITE}":    device.Site,
+			"{#GROUP}":   device.Group,
+			"{#MODEL}":   device.Model,
+		})
+	}
+	content, _ := json.Marshal(discovery)
+
+	return string(content)
+}
+
+// ZabbixInterfaceDiscovery returns the low-level discovery JSON of the interfaces of the device with the macros
+// {#INTERFACE} and {#IFINDEX}.
+func (device *Device) ZabbixInterfaceDiscovery() string {
+	discovery := []map[string]string{}
+	for _, iface := range device.Interfaces {
+		discovery = append(discovery, map[string]string{
+			"{#INTERFACE}": iface.Name,
+			"{#IFINDEX}":   strconv.Itoa(iface.Index),
+		})
+	}
+	content, _ := json.Marshal(discovery)
+
+	return string(content)
+}